@@ -13,6 +13,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
@@ -32,10 +33,13 @@ import (
 	"github.com/priyxstudio/propel/internal/cron"
 	"github.com/priyxstudio/propel/internal/database"
 	"github.com/priyxstudio/propel/loggers/cli"
+	"github.com/priyxstudio/propel/proxy"
+	"github.com/priyxstudio/propel/proxy/stream"
 	"github.com/priyxstudio/propel/remote"
 	"github.com/priyxstudio/propel/fastdl"
 	"github.com/priyxstudio/propel/router"
 	"github.com/priyxstudio/propel/server"
+	"github.com/priyxstudio/propel/server/transfer"
 	"github.com/priyxstudio/propel/sftp"
 	"github.com/priyxstudio/propel/system"
 )
@@ -196,6 +200,12 @@ func rootCmdRun(cmd *cobra.Command, _ []string) {
 		log.WithField("server", s.ID()).Info("finished loading configuration for server")
 	}
 
+	// Restore any resumable transfers that were being received before the daemon
+	// was stopped so that the source nodes are able to resume them, and remove the
+	// transfers that are not resumed within the resume window.
+	transfer.RestoreIncoming(cmd.Context(), manager)
+	go router.ExpireTransfers(cmd.Context(), manager)
+
 	// Rebuild firewall rules from database (iptables rules are lost on reboot)
 	firewallMgr := firewall.NewManager()
 	go func() {
@@ -234,6 +244,11 @@ func rootCmdRun(cmd *cobra.Command, _ []string) {
 	// on Wings. This allows us to ensure the environment exists, write configurations,
 	// and reboot processes without causing a slow-down due to sequential booting.
 	pool := workerpool.New(4)
+
+	// Servers that need to be started again are not started by the pool, they are
+	// collected and started by the boot queue once every server has been loaded.
+	var bootMu sync.Mutex
+	var boot []server.BootQueueEntry
 	for _, serv := range manager.All() {
 		s := serv
 
@@ -276,9 +291,9 @@ func rootCmdRun(cmd *cobra.Command, _ []string) {
 			// This does mean that booting wings after a catastrophic machine crash and wiping out the Docker images
 			// as a result will result in a slow boot.
 			if !r && (st == environment.ProcessRunningState || st == environment.ProcessStartingState) {
-				if err := s.HandlePowerAction(server.PowerActionStart); err != nil {
-					s.Log().WithField("error", err).Warn("failed to return server to running state")
-				}
+				bootMu.Lock()
+				boot = append(boot, server.BootQueueEntry{Server: s, State: st})
+				bootMu.Unlock()
 			} else if r || (!r && s.IsRunning()) {
 				// If the server is currently running on Docker, mark the process as being in that state.
 				// We never want to stop an instance that is currently running external from Wings since
@@ -327,6 +342,10 @@ func rootCmdRun(cmd *cobra.Command, _ []string) {
 		s.OnStateChange()
 	}
 
+	// Start the servers that were previously running in the background, staggered so
+	// that the node is not overwhelmed by every server booting at the same time.
+	go server.RunBootQueue(cmd.Context(), boot)
+
 	defer func() {
 		// Cancel the context on all the running servers at this point, even though the
 		// program is just shutting down.
@@ -350,13 +369,20 @@ func rootCmdRun(cmd *cobra.Command, _ []string) {
 		}
 	}()
 
-	// FastDL - only uses nginx, no built-in server
+	// FastDL is served either by the built-in server or by nginx using a
+	// generated configuration.
 	fastdlCfg := config.Get().System.FastDL
-	
-	if fastdlCfg.Enabled {
+
+	if fastdlCfg.Enabled && fastdl.Builtin() {
+		go func() {
+			if err := fastdl.New(manager).Run(); err != nil {
+				log.WithError(err).Error("failed to start the built-in fastdl server")
+			}
+		}()
+	} else if fastdlCfg.Enabled {
 		// Check if nginx is installed
 		if !fastdl.IsNginxInstalled() {
-			log.Warn("fastdl: enabled but nginx is not installed - FastDL will not be available. Install nginx or disable FastDL.")
+			log.Warn("fastdl: enabled but nginx is not installed - FastDL will not be available. Install nginx, set the FastDL mode to builtin or disable FastDL.")
 		} else {
 			// Generate nginx configuration
 			if err := fastdl.GenerateNginxConfig(manager); err != nil {
@@ -367,6 +393,29 @@ func rootCmdRun(cmd *cobra.Command, _ []string) {
 		}
 	}
 
+	// Proxied domains are served by the built-in proxy, otherwise nginx site files
+	// are written as proxies are created.
+	if proxy.Builtin() {
+		go func() {
+			if err := proxy.Get().Run(cmd.Context()); err != nil {
+				log.WithError(err).Error("failed to start the built-in proxy")
+			}
+		}()
+	}
+
+	// Stream proxies forward to the ports allocated to the servers, so they are
+	// started once the servers have been loaded.
+	stream.Get().SetResolver(func(id string, port int) (string, bool) {
+		s, ok := manager.Get(id)
+		if !ok {
+			return "", false
+		}
+		return s.Config().Allocations.Address(port)
+	})
+	if err := stream.Get().Load(); err != nil {
+		log.WithError(err).Error("failed to start stream proxies")
+	}
+
 	sys := config.Get().System
 	// Ensure the archive directory exists.
 	if err := os.MkdirAll(sys.ArchiveDirectory, 0o755); err != nil {
@@ -66,18 +66,102 @@ type SftpConfiguration struct {
 }
 
 type FastDLConfiguration struct {
-	// Enabled controls whether FastDL is enabled. When enabled, nginx configuration
-	// will be generated for servers that have FastDL enabled. Requires nginx to be installed.
+	// Enabled controls whether FastDL is enabled. When enabled, files of servers that
+	// have FastDL enabled are served using the server selected by Mode.
 	Enabled bool `default:"false" json:"enabled" yaml:"enabled"`
 
-	// The bind port for the nginx FastDL server.
+	// Mode selects what serves FastDL files, either "nginx" to generate a
+	// configuration for an existing nginx install, or "builtin" to serve them
+	// from the daemon itself without requiring nginx.
+	Mode string `default:"nginx" json:"mode" yaml:"mode"`
+
+	// The bind port for the FastDL server.
 	Port int `default:"80" json:"bind_port" yaml:"bind_port"`
 
+	// Compress serves a bzip2 compressed copy of a file, created as it is sent,
+	// when a client requests a file with a .bz2 extension that does not exist.
+	// Source engine clients always request the compressed file first. This is
+	// only used by the built-in server.
+	Compress bool `default:"true" json:"compress" yaml:"compress"`
+
+	// CacheMaxAge is the number of seconds clients may cache files for before
+	// checking whether they have changed. This is only used by the built-in server.
+	CacheMaxAge int `default:"3600" json:"cache_max_age" yaml:"cache_max_age"`
+
+	// RateLimit is the number of requests per second allowed from each IP address,
+	// with bursts of up to RateBurst requests. A value of 0 disables the limit.
+	// This is only used by the built-in server.
+	RateLimit float64 `default:"50" json:"rate_limit" yaml:"rate_limit"`
+	RateBurst int     `default:"100" json:"rate_burst" yaml:"rate_burst"`
+
+	// Cache keeps bzip2 and gzip compressed copies of the files that are commonly
+	// downloaded by game clients, such as maps, models and sounds, which are
+	// created in the background and served in place of compressing each file as
+	// it is sent. This is only used by the built-in server.
+	Cache bool `default:"true" json:"cache" yaml:"cache"`
+
+	// CacheDirectory is where the compressed copies are stored. Defaults to the
+	// fastdl directory inside the root directory.
+	CacheDirectory string `json:"-" yaml:"cache_directory"`
+
+	// CacheSize is the maximum size in MiB of the compressed copies of every
+	// server combined, the copies used least recently are removed first.
+	CacheSize int `default:"2048" json:"cache_size" yaml:"cache_size"`
+
 	// NginxConfigPath is the path where nginx config files will be written.
 	// Defaults to /etc/nginx/sites-available/propel-fastdl
 	NginxConfigPath string `default:"/etc/nginx/sites-available/propel-fastdl" json:"nginx_config_path" yaml:"nginx_config_path"`
 }
 
+// ProxyConfiguration defines the reverse proxy used to serve domains pointed at
+// servers through the proxy endpoints.
+type ProxyConfiguration struct {
+	// Mode selects what serves proxied domains, either "nginx" to write site
+	// files for an existing nginx install, or "builtin" to proxy requests from the
+	// daemon itself and manage certificates in-process.
+	Mode string `default:"nginx" json:"mode" yaml:"mode"`
+
+	// BindAddress is the address the built-in proxy listens on.
+	BindAddress string `default:"0.0.0.0" json:"bind_address" yaml:"bind_address"`
+
+	// HTTPPort and HTTPSPort are the ports the built-in proxy listens on. The HTTP
+	// port answers ACME HTTP-01 challenges and redirects domains using SSL to the
+	// HTTPS port, which also answers TLS-ALPN-01 challenges.
+	HTTPPort  int `default:"80" json:"http_port" yaml:"http_port"`
+	HTTPSPort int `default:"443" json:"https_port" yaml:"https_port"`
+
+	// CertificateDirectory is where the certificates used by the built-in proxy
+	// are stored. Defaults to the certificates directory inside the root directory.
+	CertificateDirectory string `json:"-" yaml:"certificate_directory"`
+
+	// ACMEDirectory is the directory URL of the ACME server certificates are
+	// requested from, defaults to Let's Encrypt.
+	ACMEDirectory string `default:"https://acme-v02.api.letsencrypt.org/directory" json:"acme_directory" yaml:"acme_directory"`
+
+	// RenewBefore is the number of days before a certificate expires that the
+	// built-in proxy renews it.
+	RenewBefore int `default:"30" json:"renew_before" yaml:"renew_before"`
+
+	// UDPSessionTimeout is the number of seconds a client of a UDP stream proxy is
+	// remembered for after the last packet was sent in either direction.
+	UDPSessionTimeout int `default:"120" json:"udp_session_timeout" yaml:"udp_session_timeout"`
+
+	// UDPMaxSessions is the number of clients each UDP stream proxy forwards
+	// traffic for at the same time, packets from new clients are dropped once it
+	// is reached. If the value is less than 1 the number of clients is unlimited.
+	UDPMaxSessions int `default:"1024" json:"udp_max_sessions" yaml:"udp_max_sessions"`
+}
+
+// FirewallConfiguration defines how the firewall rules of servers are applied.
+type FirewallConfiguration struct {
+	// Backend selects what applies firewall rules on Linux, either "nftables" to
+	// program nftables over netlink, "iptables" to run the iptables commands, or
+	// "auto" to use nftables when the system uses iptables-nft or has no iptables
+	// at all, falling back to iptables otherwise. Rules applied by one backend
+	// are not removed when switching to the other.
+	Backend string `default:"auto" json:"backend" yaml:"backend"`
+}
+
 // ApiConfiguration defines the configuration for the internal API that is
 // exposed by the Wings webserver.
 type ApiConfiguration struct {
@@ -90,6 +174,9 @@ type ApiConfiguration struct {
 	// Docs controls whether the auto-generated Swagger/OpenAPI documentation is served.
 	Docs DocsConfiguration `yaml:"docs"`
 
+	// Metrics controls the Prometheus metrics endpoint exposed by the daemon.
+	Metrics MetricsConfiguration `json:"metrics" yaml:"metrics"`
+
 	// SSL configuration for the daemon.
 	Ssl struct {
 		Enabled         bool   `json:"enabled" yaml:"enabled"`
@@ -126,6 +213,17 @@ type DocsConfiguration struct {
 	Enabled bool `default:"true" yaml:"enabled"`
 }
 
+// MetricsConfiguration defines the settings for the Prometheus metrics endpoint.
+type MetricsConfiguration struct {
+	// Enabled toggles whether the /metrics endpoint is available.
+	Enabled bool `default:"false" json:"enabled" yaml:"enabled"`
+
+	// Token is the bearer token that scrapers must provide to access the metrics.
+	// This is deliberately separate from the node token so that it can be handed
+	// to a monitoring stack without granting access to the rest of the API.
+	Token string `json:"-" yaml:"token"`
+}
+
 // HostTerminalConfiguration defines settings for exposing a host shell.
 type HostTerminalConfiguration struct {
 	// Enabled toggles whether the host terminal websocket is available.
@@ -138,6 +236,62 @@ type HostTerminalConfiguration struct {
 	DisabledCommands []string `yaml:"disabled_commands"`
 }
 
+// GracefulStopConfiguration defines the default countdown used when a server is
+// gracefully stopped or restarted. Each of these can be overridden per request.
+type GracefulStopConfiguration struct {
+	// Countdown is the number of seconds to wait before the server is stopped.
+	Countdown int `default:"60" yaml:"countdown"`
+
+	// Announcements are the number of seconds remaining at which the countdown
+	// message is sent to the server console.
+	Announcements []int `default:"[60, 30, 10, 5, 4, 3, 2, 1]" yaml:"announcements"`
+
+	// Message is the console command used to announce the countdown. The {action}
+	// and {seconds} placeholders are replaced with "stop" or "restart" and the
+	// number of seconds remaining.
+	Message string `default:"say Server will {action} in {seconds} seconds!" yaml:"message"`
+
+	// Query is the protocol used to check the number of connected players, either
+	// "minecraft" or "source". If a query reports that there are no players online
+	// the countdown is skipped. Leave empty to always run the full countdown.
+	Query string `default:"" yaml:"query"`
+}
+
+// StartAdmissionConfiguration controls whether a server is allowed to start based
+// on the amount of memory already committed to running servers on the node.
+type StartAdmissionConfiguration struct {
+	// Enabled checks the committed memory on the node before starting a server.
+	Enabled bool `default:"true" yaml:"enabled"`
+
+	// OvercommitRatio is the multiple of the host memory that may be committed to
+	// running servers. A value of 1.0 only allows servers to start if the memory
+	// limits of every running server fit within the memory of the host.
+	OvercommitRatio float64 `default:"1.0" yaml:"overcommit_ratio"`
+
+	// Reserved is the amount of memory in mebibytes that is kept for the host
+	// system and the daemon, and is never committed to servers.
+	Reserved int64 `default:"512" yaml:"reserved"`
+
+	// Mode is either "queue", where a start that does not fit waits until enough
+	// memory is available, or "reject" where the start fails immediately.
+	Mode string `default:"queue" yaml:"mode"`
+
+	// QueueTimeout is the number of seconds a start may wait in the queue before
+	// it fails.
+	QueueTimeout int `default:"600" yaml:"queue_timeout"`
+}
+
+// BootQueueConfiguration controls how servers that were running before the daemon
+// stopped are started again when it boots.
+type BootQueueConfiguration struct {
+	// Concurrency is the number of servers that may be starting at the same time.
+	Concurrency int `default:"2" yaml:"concurrency"`
+
+	// Timeout is the number of seconds to wait for a server to reach the running
+	// state before the next server in the queue is started anyway.
+	Timeout int `default:"120" yaml:"timeout"`
+}
+
 // RemoteQueryConfiguration defines the configuration settings for remote requests
 // from Wings to the Panel.
 type RemoteQueryConfiguration struct {
@@ -304,15 +458,48 @@ type SystemConfiguration struct {
 	// The number of lines to send when a server connects to the websocket.
 	WebsocketLogCount int `default:"150" yaml:"websocket_log_count"`
 
+	// The maximum number of lines a websocket client may request when asking for
+	// the console history. Clients that do not request a specific number of lines
+	// will receive WebsocketLogCount lines.
+	WebsocketLogMaxCount int `default:"1000" yaml:"websocket_log_max_count"`
+
 	Sftp SftpConfiguration `yaml:"sftp"`
 
 	FastDL FastDLConfiguration `yaml:"fastdl"`
 
+	Proxy ProxyConfiguration `yaml:"proxy"`
+
+	Firewall FirewallConfiguration `yaml:"firewall"`
+
 	CrashDetection CrashDetection `yaml:"crash_detection"`
 
 	// The ammount of lines the activity logs should log on server crash
 	CrashActivityLogLines int `default:"2" yaml:"crash_detection_activity_lines"`
 
+	// ConsoleTranscripts controls the persistent copy of each server's console output
+	// that is kept on the disk beneath the log directory.
+	ConsoleTranscripts ConsoleTranscripts `yaml:"console_transcripts"`
+
+	// StatsHistory controls the resource usage history that is stored for servers.
+	StatsHistory StatsHistory `yaml:"stats_history"`
+
+	// GracefulStop controls the countdown used by graceful stop and restart actions.
+	GracefulStop GracefulStopConfiguration `yaml:"graceful_stop"`
+
+	// StartAdmission controls the memory check performed before a server starts.
+	StartAdmission StartAdmissionConfiguration `yaml:"start_admission"`
+
+	// BootQueue controls the order and rate at which servers are restored to their
+	// previous running state when the daemon boots.
+	BootQueue BootQueueConfiguration `yaml:"boot_queue"`
+
+	// Webhooks controls the delivery of server lifecycle events to external services.
+	Webhooks WebhooksConfiguration `yaml:"webhooks"`
+
+	// AuditLog controls the record of API requests and host commands that is kept on
+	// the disk beneath the log directory.
+	AuditLog AuditLogConfiguration `yaml:"audit_log"`
+
 	// HostTerminal controls interactive shell access to the host over websockets.
 	HostTerminal HostTerminalConfiguration `yaml:"host_terminal"`
 
@@ -339,6 +526,141 @@ type CrashDetection struct {
 	// to be automatically restarted, this value is used to prevent servers from
 	// becoming stuck in a boot-loop after multiple consecutive crashes.
 	Timeout int `default:"60" json:"timeout"`
+
+	// Strategy determines how a crashed server is restarted. The "timeout" strategy
+	// will not restart a server that crashes again within Timeout seconds of the last
+	// crash. The "backoff" strategy restarts the server after an exponentially growing
+	// delay, and gives up once MaxRestarts crashes have occurred within Window seconds.
+	Strategy string `default:"timeout" yaml:"strategy"`
+
+	// MaxRestarts is the number of crashes allowed within Window seconds before the
+	// backoff strategy stops restarting the server.
+	MaxRestarts int `default:"5" yaml:"max_restarts"`
+	Window      int `default:"600" yaml:"window"`
+
+	// The delay, in seconds, before the first restart when using the backoff strategy.
+	// Each subsequent crash within the window multiplies the delay by the multiplier,
+	// up to a maximum of BackoffMax seconds.
+	BackoffInitial    int     `default:"5" yaml:"backoff_initial"`
+	BackoffMax        int     `default:"300" yaml:"backoff_max"`
+	BackoffMultiplier float64 `default:"2" yaml:"backoff_multiplier"`
+
+	// ReportLines is the number of console lines captured in each crash report, and
+	// MaxReports is the number of reports that are kept for each server.
+	ReportLines int `default:"100" yaml:"report_lines"`
+	MaxReports  int `default:"25" yaml:"max_reports"`
+}
+
+type ConsoleTranscripts struct {
+	// Enabled controls whether console output is persisted to the disk for servers.
+	Enabled bool `default:"true" yaml:"enabled"`
+
+	// MaxSize is the size in MiB that the active transcript for a server can reach
+	// before it is rotated and compressed. If the value is less than 1 transcripts
+	// are never rotated.
+	MaxSize int64 `default:"10" yaml:"max_size"`
+
+	// MaxAge is the number of days that rotated transcripts are kept before they are
+	// deleted. If the value is less than 1 transcripts are never deleted due to age.
+	MaxAge int `default:"14" yaml:"max_age"`
+
+	// MaxFiles is the number of rotated transcripts that are kept for each server,
+	// the oldest transcripts are deleted first. If the value is less than 1 there
+	// is no limit.
+	MaxFiles int `default:"10" yaml:"max_files"`
+}
+
+type StatsHistory struct {
+	// Enabled controls whether the resource usage of servers is stored so that it
+	// can be queried after the fact.
+	Enabled bool `default:"true" yaml:"enabled"`
+
+	// The number of samples kept for each server at the per-second, per-minute and
+	// per-hour resolutions. By default this is an hour of per-second samples, a
+	// day of per-minute samples and 30 days of per-hour samples.
+	SecondSamples int `default:"3600" yaml:"second_samples"`
+	MinuteSamples int `default:"1440" yaml:"minute_samples"`
+	HourSamples   int `default:"720" yaml:"hour_samples"`
+
+	// FlushInterval is the number of seconds between writes of the collected samples
+	// to the database.
+	FlushInterval int `default:"10" yaml:"flush_interval"`
+}
+
+type WebhooksConfiguration struct {
+	// Enabled controls whether webhooks are delivered for server events. When disabled
+	// no deliveries are queued for either node level or per-server webhooks.
+	Enabled bool `default:"true" yaml:"enabled"`
+
+	// Endpoints are the node level webhooks which receive events for every server
+	// on this node.
+	Endpoints []WebhookEndpoint `yaml:"endpoints"`
+
+	// MaxAttempts is the number of times a delivery is attempted before it is marked
+	// as failed.
+	MaxAttempts int `default:"8" yaml:"max_attempts"`
+
+	// The delay, in seconds, before the first retry of a failed delivery. The delay
+	// doubles with each attempt, up to a maximum of BackoffMax seconds.
+	BackoffInitial int `default:"5" yaml:"backoff_initial"`
+	BackoffMax     int `default:"600" yaml:"backoff_max"`
+
+	// Timeout is the number of seconds to wait for an endpoint to respond.
+	Timeout int `default:"10" yaml:"timeout"`
+
+	// Retention is the number of days that completed deliveries are kept in the
+	// delivery log.
+	Retention int `default:"7" yaml:"retention"`
+}
+
+type WebhookEndpoint struct {
+	// URL is the http(s) address that events are delivered to.
+	URL string `json:"url" yaml:"url"`
+
+	// Format is the payload format used for deliveries, one of "json", "discord" or
+	// "slack".
+	Format string `default:"json" json:"format" yaml:"format"`
+
+	// Secret is used to sign the payload of each delivery with HMAC-SHA256. When empty
+	// deliveries are not signed.
+	Secret string `json:"-" yaml:"secret"`
+
+	// Events limits the events that are delivered to this endpoint. When empty every
+	// event is delivered.
+	Events []string `json:"events" yaml:"events"`
+}
+
+type AuditLogConfiguration struct {
+	// Enabled controls whether API requests and host commands are recorded.
+	Enabled bool `default:"true" yaml:"enabled"`
+
+	// MaxSize is the size in MiB that the active audit log can reach before it is
+	// rotated and compressed. If the value is less than 1 the log is never rotated.
+	MaxSize int64 `default:"50" yaml:"max_size"`
+
+	// MaxAge is the number of days that rotated audit logs are kept before they are
+	// deleted. If the value is less than 1 they are never deleted due to age.
+	MaxAge int `default:"90" yaml:"max_age"`
+
+	// MaxFiles is the number of rotated audit logs that are kept, the oldest are
+	// deleted first. If the value is less than 1 there is no limit.
+	MaxFiles int `default:"30" yaml:"max_files"`
+
+	// Syslog forwards each audit entry to a syslog server in addition to writing it
+	// to the disk.
+	Syslog AuditSyslogConfiguration `yaml:"syslog"`
+}
+
+type AuditSyslogConfiguration struct {
+	Enabled bool `default:"false" yaml:"enabled"`
+
+	// Network and Address of the syslog server, such as "udp" and "10.0.0.1:514".
+	// When both are empty the local syslog daemon is used.
+	Network string `yaml:"network"`
+	Address string `yaml:"address"`
+
+	// Tag is the program name attached to each forwarded entry.
+	Tag string `default:"propel-audit" yaml:"tag"`
 }
 
 type Backups struct {
@@ -384,6 +706,50 @@ type Transfers struct {
 	//
 	// Defaults to false; set to true to enforce checksum validation.
 	PerformChecksumChecks bool `default:"false" yaml:"perform_checksum_checks"`
+
+	// ChunkSize is the size in MiB of each chunk sent when transferring a server to
+	// a node that supports resumable transfers. Each chunk is checksummed and can
+	// be retried on its own.
+	//
+	// Defaults to 16 MiB.
+	ChunkSize int `default:"16" yaml:"chunk_size"`
+
+	// MaxRetries is the number of times a failed request is retried, waiting longer
+	// between each attempt, before the transfer is marked as failed.
+	//
+	// Defaults to 10.
+	MaxRetries int `default:"10" yaml:"max_retries"`
+
+	// ResumeWindow is the number of hours the target node keeps the data of a
+	// partially received transfer so that the source node can resume it, including
+	// across restarts of the target node. The source node keeps the archive of a
+	// failed transfer for as long, so that a transfer started again resumes.
+	//
+	// Defaults to 24 hours.
+	ResumeWindow int `default:"24" yaml:"resume_window"`
+
+	// UploadLimit imposes a Network I/O write limit on each transfer sent from this
+	// node to another node.
+	//
+	// If the value is less than 1, the upload speed is unlimited,
+	// if the value is greater than 0, the upload speed is the value in MiB/s.
+	//
+	// Defaults to 0 (unlimited)
+	UploadLimit int `default:"0" yaml:"upload_limit"`
+
+	// MaxConcurrent is the number of transfers that can be sent from this node at
+	// the same time. Any further transfers wait in a queue, in the order they were
+	// requested, until a running transfer finishes.
+	//
+	// Defaults to 0 (unlimited)
+	MaxConcurrent int `default:"0" yaml:"max_concurrent"`
+
+	// Windows limits when queued transfers are allowed to start, as a list of
+	// daily time ranges in the local time of the node such as "22:00-06:00". A
+	// transfer that has started keeps running once a window closes.
+	//
+	// Defaults to no windows, which allows transfers to start at any time.
+	Windows []string `yaml:"windows"`
 }
 
 type ConsoleThrottles struct {
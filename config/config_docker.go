@@ -97,12 +97,35 @@ type DockerConfiguration struct {
 	// automatically set to true if KVM is available on the host system, otherwise false.
 	EnableNativeKVM bool `json:"enable_native_kvm" yaml:"enable_native_kvm"`
 
+	// CpuPlacement configures how CPU threads on the host are assigned to server
+	// containers.
+	CpuPlacement CpuPlacementConfiguration `json:"cpu_placement" yaml:"cpu_placement"`
+
 	LogConfig struct {
 		Type   string            `default:"local" json:"type" yaml:"type"`
 		Config map[string]string `default:"{\"max-size\":\"5m\",\"max-file\":\"1\",\"compress\":\"false\",\"mode\":\"non-blocking\"}" json:"config" yaml:"config"`
 	} `json:"log_config" yaml:"log_config"`
 }
 
+// CpuPlacementConfiguration defines how CPU threads are assigned to servers.
+type CpuPlacementConfiguration struct {
+	// Mode is either "manual", where the threads provided by the Panel for a server
+	// are used as-is, or "auto" where any server with a CPU limit and no threads is
+	// assigned dedicated threads matching its limit. Servers without a CPU limit
+	// share the threads that have not been dedicated to another server.
+	Mode string `default:"manual" json:"mode" yaml:"mode"`
+
+	// Reserved is a cpuset of threads that are never assigned to a server when the
+	// mode is "auto", leaving them for the host system and the daemon.
+	Reserved string `default:"" json:"reserved" yaml:"reserved"`
+}
+
+// AutoCpuPlacement returns true if servers should be automatically assigned
+// dedicated CPU threads.
+func (c DockerConfiguration) AutoCpuPlacement() bool {
+	return c.CpuPlacement.Mode == "auto"
+}
+
 func (c DockerConfiguration) ContainerLogConfig() container.LogConfig {
 	if c.LogConfig.Type == "" {
 		return container.LogConfig{}
@@ -2,6 +2,7 @@ package environment
 
 import (
 	"fmt"
+	"net"
 	"strconv"
 
 	"github.com/docker/go-connections/nat"
@@ -113,3 +114,36 @@ func (a *Allocations) Exposed() nat.PortSet {
 }
 
 
+
+// Address returns the address that a connection to the given port of the server
+// should be made to from the host, or false if the port is not allocated to the
+// server. Allocations bound to every interface are reached through the loopback
+// address, and those bound to the loopback address are reached through the
+// propel0 network interface in the same way as DockerBindings.
+func (a *Allocations) Address(port int) (string, bool) {
+	ip, ok := "", false
+	for k, ports := range a.Mappings {
+		for _, p := range ports {
+			if p == port {
+				ip, ok = k, true
+				break
+			}
+		}
+	}
+	if !ok && a.DefaultMapping != nil && a.DefaultMapping.Port == port {
+		ip, ok = a.DefaultMapping.Ip, true
+	}
+	if !ok {
+		return "", false
+	}
+
+	switch ip {
+	case "", "0.0.0.0", "::":
+		ip = "127.0.0.1"
+	case "127.0.0.1":
+		if !config.Get().Docker.Network.ISPN {
+			ip = config.Get().Docker.Network.Interface
+		}
+	}
+	return net.JoinHostPort(ip, strconv.Itoa(port)), true
+}
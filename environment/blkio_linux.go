@@ -0,0 +1,78 @@
+//go:build linux
+
+package environment
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"emperror.dev/errors"
+	"golang.org/x/sys/unix"
+
+	"github.com/priyxstudio/propel/config"
+)
+
+var (
+	_dmu     sync.Mutex
+	_devices = make(map[string]BlockDevice)
+)
+
+// BlockDevice is a block device on the host system.
+type BlockDevice struct {
+	Path  string
+	Major uint32
+	Minor uint32
+}
+
+// DataDevice returns the block device that the server data directory is stored
+// on. Disk IO limits can only be applied to a whole disk, so if the data is on a
+// partition the disk containing it is returned.
+func DataDevice() (BlockDevice, error) {
+	dir := config.Get().System.Data
+
+	_dmu.Lock()
+	defer _dmu.Unlock()
+	if dev, ok := _devices[dir]; ok {
+		return dev, nil
+	}
+
+	var st unix.Stat_t
+	if err := unix.Stat(dir, &st); err != nil {
+		return BlockDevice{}, errors.Wrap(err, "environment: could not stat data directory")
+	}
+	major, minor := unix.Major(uint64(st.Dev)), unix.Minor(uint64(st.Dev))
+	// Filesystems such as overlayfs, btrfs and ZFS report an anonymous device
+	// which does not exist as a block device on the system.
+	if major == 0 {
+		return BlockDevice{}, errors.New("environment: data directory is not stored on a block device")
+	}
+
+	sys, err := filepath.EvalSymlinks("/sys/dev/block/" + strconv.Itoa(int(major)) + ":" + strconv.Itoa(int(minor)))
+	if err != nil {
+		return BlockDevice{}, errors.Wrap(err, "environment: could not resolve data directory block device")
+	}
+	if _, err := os.Stat(filepath.Join(sys, "partition")); err == nil {
+		sys = filepath.Dir(sys)
+		b, err := os.ReadFile(filepath.Join(sys, "dev"))
+		if err != nil {
+			return BlockDevice{}, errors.Wrap(err, "environment: could not read parent block device")
+		}
+		maj, min, _ := strings.Cut(strings.TrimSpace(string(b)), ":")
+		ma, err1 := strconv.ParseUint(maj, 10, 32)
+		mi, err2 := strconv.ParseUint(min, 10, 32)
+		if err1 != nil || err2 != nil {
+			return BlockDevice{}, errors.Errorf("environment: invalid parent block device number %q", string(b))
+		}
+		major, minor = uint32(ma), uint32(mi)
+	}
+
+	dev := BlockDevice{Path: "/dev/" + filepath.Base(sys), Major: major, Minor: minor}
+	if _, err := os.Stat(dev.Path); err != nil {
+		return BlockDevice{}, errors.Wrap(err, "environment: could not find data directory block device")
+	}
+	_devices[dir] = dev
+	return dev, nil
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package environment
+
+import "emperror.dev/errors"
+
+// BlockDevice is a block device on the host system.
+type BlockDevice struct {
+	Path  string
+	Major uint32
+	Minor uint32
+}
+
+// DataDevice is not supported on non-Linux platforms since disk IO limits are
+// applied using cgroups.
+func DataDevice() (BlockDevice, error) {
+	return BlockDevice{}, errors.New("environment: disk IO limits are only supported on Linux")
+}
@@ -41,6 +41,14 @@ func (c *Configuration) SetSettings(s Settings) {
 	c.mu.Unlock()
 }
 
+// Updates the limits for this environment on the fly, leaving the other settings
+// unchanged.
+func (c *Configuration) SetLimits(l Limits) {
+	c.mu.Lock()
+	c.settings.Limits = l
+	c.mu.Unlock()
+}
+
 // Updates the environment variables associated with this environment by replacing the entire
 // array of them with a new one.
 func (c *Configuration) SetEnvironmentVariables(ev []string) {
@@ -0,0 +1,105 @@
+//go:build linux
+
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"emperror.dev/errors"
+
+	"github.com/priyxstudio/propel/environment"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// applyIoLimits writes the disk IO limits for the server directly to the cgroup
+// of the running container. Docker does not update the device throttles of an
+// existing container, so this is required for changes to apply without the
+// container being re-created.
+func (e *Environment) applyIoLimits(ctx context.Context) error {
+	limits := e.Configuration.Limits()
+	dev, err := environment.DataDevice()
+	if err != nil {
+		if !limits.HasIoLimits() {
+			return nil
+		}
+		return err
+	}
+
+	c, err := e.ContainerInspect(ctx)
+	if err != nil {
+		return errors.Wrap(err, "environment/docker: could not inspect container")
+	}
+	if c.State == nil || !c.State.Running || c.State.Pid == 0 {
+		return nil
+	}
+
+	b, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(c.State.Pid), "cgroup"))
+	if err != nil {
+		return errors.Wrap(err, "environment/docker: could not read container cgroup")
+	}
+
+	device := strconv.Itoa(int(dev.Major)) + ":" + strconv.Itoa(int(dev.Minor))
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		// Each line is in the format "hierarchy-ID:controller-list:cgroup-path", the
+		// unified hierarchy used by cgroup v2 has an ID of 0 and no controllers.
+		parts := strings.SplitN(s.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			return writeCgroupV2IoLimits(parts[2], device, limits)
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			if controller == "blkio" {
+				return writeCgroupV1IoLimits(parts[2], device, limits)
+			}
+		}
+	}
+	return errors.New("environment/docker: could not find blkio cgroup for container")
+}
+
+// writeCgroupV2IoLimits writes the disk IO limits to the io.max file of a cgroup
+// v2 hierarchy, where "max" removes a limit.
+func writeCgroupV2IoLimits(path string, device string, limits environment.Limits) error {
+	rate := func(v uint64) string {
+		if v == 0 {
+			return "max"
+		}
+		return strconv.FormatUint(v, 10)
+	}
+	line := device +
+		" rbps=" + rate(limits.IoReadBps) +
+		" wbps=" + rate(limits.IoWriteBps) +
+		" riops=" + rate(limits.IoReadIops) +
+		" wiops=" + rate(limits.IoWriteIops)
+	if err := os.WriteFile(filepath.Join(cgroupRoot, path, "io.max"), []byte(line), 0o644); err != nil {
+		return errors.Wrap(err, "environment/docker: could not write io.max for container")
+	}
+	return nil
+}
+
+// writeCgroupV1IoLimits writes the disk IO limits to the blkio throttle files of
+// a cgroup v1 hierarchy, where a rate of 0 removes a limit.
+func writeCgroupV1IoLimits(path string, device string, limits environment.Limits) error {
+	files := map[string]uint64{
+		"blkio.throttle.read_bps_device":   limits.IoReadBps,
+		"blkio.throttle.write_bps_device":  limits.IoWriteBps,
+		"blkio.throttle.read_iops_device":  limits.IoReadIops,
+		"blkio.throttle.write_iops_device": limits.IoWriteIops,
+	}
+	for name, v := range files {
+		line := device + " " + strconv.FormatUint(v, 10)
+		if err := os.WriteFile(filepath.Join(cgroupRoot, "blkio", path, name), []byte(line), 0o644); err != nil {
+			return errors.Wrapf(err, "environment/docker: could not write %s for container", name)
+		}
+	}
+	return nil
+}
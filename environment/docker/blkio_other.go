@@ -0,0 +1,11 @@
+//go:build !linux
+
+package docker
+
+import "context"
+
+// applyIoLimits is a no-op on non-Linux platforms since the limits rely on
+// cgroups, which are not available.
+func (e *Environment) applyIoLimits(_ context.Context) error {
+	return nil
+}
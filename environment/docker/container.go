@@ -129,6 +129,16 @@ func (e *Environment) InSituUpdate() error {
 	}); err != nil {
 		return errors.Wrap(err, "environment/docker: could not update container")
 	}
+
+	// The remaining limits are applied outside of Docker. A failure to apply them
+	// only logs a warning rather than failing the update, which may leave the
+	// container without those limits until it is next started.
+	if err := e.applyIoLimits(ctx); err != nil {
+		e.log().WithField("error", err).Warn("failed to update disk IO limits for container")
+	}
+	if err := e.applyNetworkLimits(ctx); err != nil {
+		e.log().WithField("error", err).Warn("failed to update network limits for container")
+	}
 	return nil
 }
 
@@ -308,6 +318,10 @@ func (e *Environment) Destroy() error {
 
 	e.SetState(environment.ProcessOfflineState)
 
+	if err := e.removeNetworkLimits(context.Background()); err != nil {
+		e.log().WithField("error", err).Warn("failed to remove network limits for container")
+	}
+
 	// Don't trigger a destroy failure if we try to delete a container that does not
 	// exist on the system. We're just a step ahead of ourselves in that case.
 	//
@@ -0,0 +1,163 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/docker/docker/api/types/container"
+
+	"github.com/priyxstudio/propel/environment"
+)
+
+// The maximum length of a single line of console output that will be read from
+// the container logs. Anything longer than this is truncated by the scanner.
+const maxLogLineSize = 1024 * 1024
+
+var _ environment.LogHistory = (*Environment)(nil)
+
+// ReadLogPage returns a single page of console output from the container logs.
+// The logs are streamed from Docker line by line and at most limit+1 matching
+// lines are held in memory at any given point, so this is safe to call against
+// very large log files.
+//
+// Docker treats both "since" and "until" as inclusive, so the cursors are moved
+// by a single nanosecond to avoid returning the cursor line a second time.
+func (e *Environment) ReadLogPage(ctx context.Context, q environment.LogQuery) (environment.LogPage, error) {
+	if q.Limit <= 0 {
+		q.Limit = 100
+	}
+
+	since, until := q.Since, q.Until
+	if q.Forward() {
+		if since.IsZero() || q.After.After(since) {
+			since = q.After.Add(time.Nanosecond)
+		}
+	} else if !q.Before.IsZero() {
+		if until.IsZero() || q.Before.Before(until) {
+			until = q.Before.Add(-time.Nanosecond)
+		}
+	}
+
+	opts := container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Timestamps: true,
+	}
+	if !since.IsZero() {
+		opts.Since = since.Format(time.RFC3339Nano)
+	}
+	if !until.IsZero() {
+		opts.Until = until.Format(time.RFC3339Nano)
+	}
+	// When requesting the most recent lines without any filtering applied we can
+	// let Docker do the work for us. Tail cannot be combined with the other filters
+	// since Docker applies it before "until" is evaluated.
+	if !q.Forward() && q.Before.IsZero() && until.IsZero() && q.Pattern == nil {
+		opts.Tail = strconv.Itoa(q.Limit + 1)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	r, err := e.client.ContainerLogs(ctx, e.Id, opts)
+	if err != nil {
+		return environment.LogPage{}, errors.WithStack(err)
+	}
+	defer r.Close()
+
+	var page environment.LogPage
+	entries := make([]environment.LogEntry, 0, q.Limit+1)
+	err = scanLogEntries(r, func(entry environment.LogEntry) bool {
+		if !q.Matches(entry.Line) {
+			return true
+		}
+		if q.Forward() {
+			if len(entries) == q.Limit {
+				page.HasMore = true
+				return false
+			}
+			entries = append(entries, entry)
+			return true
+		}
+		// When paging backwards only the last limit+1 entries are kept, the extra
+		// entry is used to determine if there is anything before this page.
+		if len(entries) == q.Limit+1 {
+			copy(entries, entries[1:])
+			entries = entries[:q.Limit]
+		}
+		entries = append(entries, entry)
+		return true
+	})
+	if err != nil {
+		return environment.LogPage{}, err
+	}
+
+	if !q.Forward() && len(entries) > q.Limit {
+		page.HasMore = true
+		entries = entries[1:]
+	}
+	page.Entries = entries
+
+	return page, nil
+}
+
+// CopyLog streams the complete container log into the provided writer without
+// buffering it in memory.
+func (e *Environment) CopyLog(ctx context.Context, w io.Writer, timestamps bool) error {
+	r, err := e.client.ContainerLogs(ctx, e.Id, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Timestamps: timestamps,
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer r.Close()
+
+	if _, err := io.Copy(w, r); err != nil {
+		return errors.Wrap(err, "environment/docker: failed to copy container logs")
+	}
+	return nil
+}
+
+// scanLogEntries reads timestamped log lines from the reader and passes them to
+// the callback until either the reader is exhausted or the callback returns false.
+func scanLogEntries(r io.Reader, fn func(entry environment.LogEntry) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLogLineSize)
+	for scanner.Scan() {
+		entry, ok := parseLogEntry(scanner.Bytes())
+		if !ok {
+			continue
+		}
+		if !fn(entry) {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, context.Canceled) {
+		return errors.Wrap(err, "environment/docker: failed to read container logs")
+	}
+	return nil
+}
+
+// parseLogEntry splits a line returned by Docker with timestamps enabled into
+// the timestamp and the actual console output.
+func parseLogEntry(b []byte) (environment.LogEntry, bool) {
+	i := bytes.IndexByte(b, ' ')
+	if i <= 0 {
+		return environment.LogEntry{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, string(b[:i]))
+	if err != nil {
+		return environment.LogEntry{}, false
+	}
+	return environment.LogEntry{
+		Timestamp: t,
+		Line:      string(bytes.TrimRight(b[i+1:], "\r")),
+	}, true
+}
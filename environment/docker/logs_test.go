@@ -0,0 +1,47 @@
+package docker
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/priyxstudio/propel/environment"
+)
+
+func TestParseLogEntry(t *testing.T) {
+	entry, ok := parseLogEntry([]byte("2024-05-01T10:20:30.123456789Z [Server] Done (3.2s)!\r"))
+	if !ok {
+		t.Fatal("expected line to be parsed")
+	}
+	if entry.Line != "[Server] Done (3.2s)!" {
+		t.Fatalf("unexpected line %q", entry.Line)
+	}
+	expected := time.Date(2024, 5, 1, 10, 20, 30, 123456789, time.UTC)
+	if !entry.Timestamp.Equal(expected) {
+		t.Fatalf("expected timestamp %s, got %s", expected, entry.Timestamp)
+	}
+
+	if _, ok := parseLogEntry([]byte("no timestamp on this line")); ok {
+		t.Fatal("expected line without a timestamp to be skipped")
+	}
+}
+
+func TestScanLogEntries(t *testing.T) {
+	input := strings.Join([]string{
+		"2024-05-01T10:00:00Z first",
+		"2024-05-01T10:00:01Z second",
+		"2024-05-01T10:00:02Z third",
+	}, "\n")
+
+	var lines []string
+	err := scanLogEntries(strings.NewReader(input), func(entry environment.LogEntry) bool {
+		lines = append(lines, entry.Line)
+		return len(lines) < 2
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(lines) != 2 || lines[0] != "first" || lines[1] != "second" {
+		t.Fatalf("expected scanning to stop after two lines, got %#v", lines)
+	}
+}
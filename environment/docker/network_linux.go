@@ -0,0 +1,164 @@
+//go:build linux
+
+package docker
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"emperror.dev/errors"
+)
+
+// Network limits are applied with tc on the host side of the veth pair that
+// connects a container to the bridge network. Traffic leaving the host veth is
+// received by the container, so the ingress limit is applied to its root qdisc.
+// Traffic sent by the container arrives on the ingress of the host veth, which
+// cannot be shaped directly, so it is redirected to an ifb device where the
+// egress limit is applied instead.
+
+var vethPeerRegex = regexp.MustCompile(`eth0@if(\d+)`)
+
+// applyNetworkLimits applies the network limits for the server to its running
+// container, replacing any limits that were previously applied. The veth only
+// exists while the container is running, so this is a no-op for a container
+// that is stopped or uses the host network.
+func (e *Environment) applyNetworkLimits(ctx context.Context) error {
+	c, err := e.ContainerInspect(ctx)
+	if err != nil {
+		return errors.Wrap(err, "environment/docker: could not inspect container")
+	}
+	if c.State == nil || !c.State.Running || c.State.Pid == 0 {
+		return nil
+	}
+	if c.HostConfig != nil && c.HostConfig.NetworkMode.IsHost() {
+		return nil
+	}
+
+	veth, err := hostVeth(ctx, c.State.Pid)
+	if err != nil {
+		return err
+	}
+
+	// Start from a clean slate so that a limit which has been removed is also
+	// removed from the interface. This must happen before the ifb device is
+	// removed, otherwise the veth would keep redirecting the traffic sent by the
+	// container to a device that no longer exists. These fail if there is
+	// nothing to delete.
+	_ = runNetworkCommand(ctx, "tc", "qdisc", "del", "dev", veth, "root")
+	_ = runNetworkCommand(ctx, "tc", "qdisc", "del", "dev", veth, "ingress")
+
+	limits := e.Configuration.Limits()
+	ifb := ifbName(e.Id)
+	if !limits.HasNetworkLimits() {
+		return deleteLink(ctx, ifb)
+	}
+
+	if limits.NetworkIngress > 0 {
+		if err := runNetworkCommand(ctx, "tc", append([]string{"qdisc", "replace", "dev", veth, "root"}, tbf(limits.NetworkIngress)...)...); err != nil {
+			return err
+		}
+	}
+
+	if limits.NetworkEgress <= 0 {
+		return deleteLink(ctx, ifb)
+	}
+	if _, err := os.Stat(filepath.Join("/sys/class/net", ifb)); os.IsNotExist(err) {
+		if err := runNetworkCommand(ctx, "ip", "link", "add", ifb, "type", "ifb"); err != nil {
+			return err
+		}
+	}
+	if err := runNetworkCommand(ctx, "ip", "link", "set", "dev", ifb, "up"); err != nil {
+		return err
+	}
+	if err := runNetworkCommand(ctx, "tc", append([]string{"qdisc", "replace", "dev", ifb, "root"}, tbf(limits.NetworkEgress)...)...); err != nil {
+		return err
+	}
+	if err := runNetworkCommand(ctx, "tc", "qdisc", "add", "dev", veth, "handle", "ffff:", "ingress"); err != nil {
+		return err
+	}
+	return runNetworkCommand(ctx, "tc", "filter", "add", "dev", veth, "parent", "ffff:", "protocol", "all",
+		"u32", "match", "u32", "0", "0", "action", "mirred", "egress", "redirect", "dev", ifb)
+}
+
+// removeNetworkLimits removes the ifb device used to limit the egress traffic of
+// the container. The limits applied to the veth are removed along with it when
+// the container stops.
+func (e *Environment) removeNetworkLimits(ctx context.Context) error {
+	return deleteLink(ctx, ifbName(e.Id))
+}
+
+// ifbName returns the name of the ifb device for a container. Interface names
+// are limited to 15 characters so only part of the identifier is used.
+func ifbName(id string) string {
+	id = strings.ReplaceAll(id, "-", "")
+	if len(id) > 12 {
+		id = id[:12]
+	}
+	return "ifb" + id
+}
+
+// tbf returns the arguments for a token bucket filter limiting traffic to the
+// given rate in megabits per second. The burst allows for 10ms of traffic at
+// the full rate, which is enough to sustain the rate at common timer speeds.
+func tbf(mbit int64) []string {
+	burst := max(mbit*1_000_000/8/100, 32*1024)
+	return []string{
+		"tbf",
+		"rate", strconv.FormatInt(mbit, 10) + "mbit",
+		"burst", strconv.FormatInt(burst, 10),
+		"latency", "50ms",
+	}
+}
+
+// hostVeth returns the name of the host side of the veth pair for the container
+// running as the given process.
+func hostVeth(ctx context.Context, pid int) (string, error) {
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, "nsenter", "-t", strconv.Itoa(pid), "-n", "ip", "-o", "link", "show", "eth0")
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return "", errors.Wrap(err, "environment/docker: could not read container network interface")
+	}
+	m := vethPeerRegex.FindStringSubmatch(out.String())
+	if m == nil {
+		return "", errors.New("environment/docker: container network interface is not a veth")
+	}
+
+	entries, err := os.ReadDir("/sys/class/net")
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	for _, e := range entries {
+		b, err := os.ReadFile(filepath.Join("/sys/class/net", e.Name(), "ifindex"))
+		if err == nil && strings.TrimSpace(string(b)) == m[1] {
+			return e.Name(), nil
+		}
+	}
+	return "", errors.Errorf("environment/docker: could not find host interface with index %s", m[1])
+}
+
+// deleteLink removes a network interface from the host if it exists.
+func deleteLink(ctx context.Context, name string) error {
+	if _, err := os.Stat(filepath.Join("/sys/class/net", name)); os.IsNotExist(err) {
+		return nil
+	}
+	return runNetworkCommand(ctx, "ip", "link", "del", "dev", name)
+}
+
+// runNetworkCommand executes a network configuration command, including its output in the
+// returned error if it fails.
+func runNetworkCommand(ctx context.Context, name string, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "environment/docker: %s %s: %s", name, strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package docker
+
+import "context"
+
+// applyNetworkLimits is a no-op on non-Linux platforms since the limits rely on
+// tc, which is not available.
+func (e *Environment) applyNetworkLimits(_ context.Context) error {
+	return nil
+}
+
+// removeNetworkLimits is a no-op on non-Linux platforms.
+func (e *Environment) removeNetworkLimits(_ context.Context) error {
+	return nil
+}
@@ -164,6 +164,13 @@ func (e *Environment) Start(ctx context.Context) error {
 		return errors.WrapIf(err, "environment/docker: failed to start container")
 	}
 
+	// The network interface for the container only exists once it is running, so the
+	// network limits cannot be applied when the container is created. A failure here
+	// leaves the server unlimited rather than preventing it from starting.
+	if err := e.applyNetworkLimits(actx); err != nil {
+		e.log().WithField("error", err).Warn("failed to apply network limits to container")
+	}
+
 	// No errors, good to continue through.
 	sawError = false
 	return nil
@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"math"
+	"strings"
 	"time"
 
 	"emperror.dev/errors"
@@ -51,6 +52,7 @@ func (e *Environment) pollResources(ctx context.Context) error {
 		e.log().WithField("error", err).Warn("failed to calculate container uptime")
 	}
 
+	var blkio ioCounters
 	dec := json.NewDecoder(stats.Body)
 	for {
 		select {
@@ -90,11 +92,77 @@ func (e *Environment) pollResources(ctx context.Context) error {
 				st.Network.TxBytes += nw.TxBytes
 			}
 
+			st.Io = blkio.update(v.Read, v.BlkioStats, e.Configuration.Limits())
+
 			e.Events().Publish(environment.ResourceEvent, st)
 		}
 	}
 }
 
+// ioCounters tracks the cumulative disk IO counters for a container between stats
+// reports so that the current throughput can be calculated.
+type ioCounters struct {
+	read       time.Time
+	readBytes  uint64
+	writeBytes uint64
+	readOps    uint64
+	writeOps   uint64
+}
+
+// update records the disk IO counters reported for the container and returns
+// the disk IO stats, including the rates since the previous report. The rates
+// are compared against the limits for the server to determine if the container
+// is currently being throttled.
+func (c *ioCounters) update(read time.Time, stats container.BlkioStats, limits environment.Limits) environment.IoStats {
+	var next ioCounters
+	next.read = read
+	next.readBytes, next.writeBytes = sumBlkioEntries(stats.IoServiceBytesRecursive)
+	next.readOps, next.writeOps = sumBlkioEntries(stats.IoServicedRecursive)
+
+	st := environment.IoStats{ReadBytes: next.readBytes, WriteBytes: next.writeBytes}
+	if !c.read.IsZero() && read.After(c.read) {
+		secs := read.Sub(c.read).Seconds()
+		rate := func(cur, prev uint64) uint64 {
+			if cur < prev {
+				return 0
+			}
+			return uint64(math.Round(float64(cur-prev) / secs))
+		}
+		st.ReadBps = rate(next.readBytes, c.readBytes)
+		st.WriteBps = rate(next.writeBytes, c.writeBytes)
+		st.ReadIops = rate(next.readOps, c.readOps)
+		st.WriteIops = rate(next.writeOps, c.writeOps)
+	}
+	*c = next
+
+	// The throttle allows short bursts over the limit and the reported rates are
+	// averaged over the reporting interval, so treat anything within 5% of a
+	// limit as being throttled.
+	atLimit := func(v, limit uint64) bool {
+		return limit > 0 && float64(v) >= float64(limit)*0.95
+	}
+	st.Throttled = atLimit(st.ReadBps, limits.IoReadBps) ||
+		atLimit(st.WriteBps, limits.IoWriteBps) ||
+		atLimit(st.ReadIops, limits.IoReadIops) ||
+		atLimit(st.WriteIops, limits.IoWriteIops)
+	return st
+}
+
+// sumBlkioEntries returns the total read and write values for the blkio entries
+// across all devices. Docker reports the operations as "Read" and "Write" for
+// cgroup v1, and in lowercase for cgroup v2.
+func sumBlkioEntries(entries []container.BlkioStatEntry) (read uint64, write uint64) {
+	for _, entry := range entries {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			read += entry.Value
+		case "write":
+			write += entry.Value
+		}
+	}
+	return read, write
+}
+
 // The "docker stats" CLI call does not return the same value as the types.MemoryStats.Usage
 // value which can be rather confusing to people trying to compare panel usage to
 // their stats output.
@@ -0,0 +1,47 @@
+package docker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+
+	"github.com/priyxstudio/propel/environment"
+)
+
+func TestIoCountersUpdate(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	blkio := func(read, write uint64) container.BlkioStats {
+		return container.BlkioStats{
+			IoServiceBytesRecursive: []container.BlkioStatEntry{
+				{Major: 8, Op: "read", Value: read},
+				{Major: 8, Op: "write", Value: write},
+				{Major: 8, Op: "Total", Value: read + write},
+			},
+			IoServicedRecursive: []container.BlkioStatEntry{
+				{Major: 8, Op: "Read", Value: read / 1000},
+				{Major: 8, Op: "Write", Value: write / 1000},
+			},
+		}
+	}
+	limits := environment.Limits{IoWriteBps: 1_000_000}
+
+	var c ioCounters
+	st := c.update(start, blkio(1_000_000, 0), limits)
+	if st.ReadBytes != 1_000_000 || st.ReadBps != 0 {
+		t.Fatalf("expected only totals for the first report, got %+v", st)
+	}
+
+	st = c.update(start.Add(2*time.Second), blkio(2_000_000, 2_000_000), limits)
+	if st.ReadBps != 500_000 || st.WriteBps != 1_000_000 || st.WriteIops != 1_000 {
+		t.Fatalf("unexpected rates %+v", st)
+	}
+	if !st.Throttled {
+		t.Fatal("expected writes at the limit to be throttled")
+	}
+
+	st = c.update(start.Add(4*time.Second), blkio(2_000_000, 2_100_000), limits)
+	if st.Throttled {
+		t.Fatalf("expected writes under the limit to not be throttled, got %+v", st)
+	}
+}
@@ -0,0 +1,78 @@
+package environment
+
+import (
+	"context"
+	"io"
+	"regexp"
+	"time"
+)
+
+// LogEntry is a single line of console output along with the time at which the
+// underlying environment recorded it.
+type LogEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	Line      string    `json:"line"`
+}
+
+// LogQuery defines the window of console output that should be returned when
+// paging through the history of a process.
+type LogQuery struct {
+	// Since and Until bound the returned entries to a specific time range. A zero
+	// value means the range is unbounded on that side.
+	Since time.Time
+	Until time.Time
+
+	// Before and After are the cursors used when paging. When Before is set the
+	// entries immediately preceding that point in time are returned, when After
+	// is set the entries immediately following it are returned. If neither is set
+	// the most recent entries are returned.
+	Before time.Time
+	After  time.Time
+
+	// Limit is the maximum number of entries to return in a single page.
+	Limit int
+
+	// Pattern, when provided, only returns lines matching the expression.
+	Pattern *regexp.Regexp
+}
+
+// Forward returns true if the query is paging forwards in time from a cursor.
+func (q LogQuery) Forward() bool {
+	return !q.After.IsZero()
+}
+
+// Matches returns true if the provided line should be included in the page.
+func (q LogQuery) Matches(line string) bool {
+	return q.Pattern == nil || q.Pattern.MatchString(line)
+}
+
+// LogPage is a single page of console output. Entries are always ordered from
+// oldest to newest regardless of the direction being paged.
+type LogPage struct {
+	Entries []LogEntry `json:"data"`
+
+	// HasMore is true if there are additional matching entries beyond this page
+	// in the direction that was being paged.
+	HasMore bool `json:"has_more"`
+}
+
+// Cursors returns the cursor values that can be passed back as "before" and
+// "after" to retrieve the neighbouring pages.
+func (p LogPage) Cursors() (before time.Time, after time.Time) {
+	if len(p.Entries) == 0 {
+		return time.Time{}, time.Time{}
+	}
+	return p.Entries[0].Timestamp, p.Entries[len(p.Entries)-1].Timestamp
+}
+
+// LogHistory is implemented by environments that retain the complete console
+// output of a process and are able to page through it without loading all of
+// it into memory at once.
+type LogHistory interface {
+	// ReadLogPage returns a single page of console output matching the query.
+	ReadLogPage(ctx context.Context, q LogQuery) (LogPage, error)
+
+	// CopyLog streams the complete console output of the process into the
+	// provided writer, optionally prefixing each line with its timestamp.
+	CopyLog(ctx context.Context, w io.Writer, timestamps bool) error
+}
@@ -6,6 +6,7 @@ import (
 	"strconv"
 
 	"github.com/apex/log"
+	"github.com/docker/docker/api/types/blkiodev"
 	"github.com/docker/docker/api/types/container"
 
 	"github.com/priyxstudio/propel/config"
@@ -56,6 +57,20 @@ type Limits struct {
 	// Sets which CPU threads can be used by the docker instance.
 	Threads string `json:"threads"`
 
+	// The maximum rate, in megabits per second, at which the server may receive
+	// (ingress) and send (egress) network traffic. A value of 0 leaves the traffic
+	// unlimited.
+	NetworkIngress int64 `json:"network_ingress"`
+	NetworkEgress  int64 `json:"network_egress"`
+
+	// The absolute limits for disk IO on the device backing the server data
+	// directory. Throughput is in bytes per second and operations are per second,
+	// a value of 0 leaves that limit unset.
+	IoReadBps   uint64 `json:"io_read_bps"`
+	IoWriteBps  uint64 `json:"io_write_bps"`
+	IoReadIops  uint64 `json:"io_read_iops"`
+	IoWriteIops uint64 `json:"io_write_iops"`
+
 	OOMKiller bool `json:"oom_killer"`
 }
 
@@ -70,6 +85,17 @@ func (l Limits) ConvertedCpuLimit() int64 {
 	return l.CpuLimit * 1000
 }
 
+// HasNetworkLimits returns true if either direction of network traffic for the
+// server is rate limited.
+func (l Limits) HasNetworkLimits() bool {
+	return l.NetworkIngress > 0 || l.NetworkEgress > 0
+}
+
+// HasIoLimits returns true if any absolute disk IO limit is set for the server.
+func (l Limits) HasIoLimits() bool {
+	return l.IoReadBps > 0 || l.IoWriteBps > 0 || l.IoReadIops > 0 || l.IoWriteIops > 0
+}
+
 // MemoryOverheadMultiplier sets the hard limit for memory usage to be 5% more
 // than the amount of memory assigned to the server. If the memory limit for the
 // server is < 4G, use 10%, if less than 2G use 15%. This avoids unexpected
@@ -133,6 +159,19 @@ func (l Limits) AsContainerResources() container.Resources {
 		resources.CpusetCpus = l.Threads
 	}
 
+	// The IO weight is relative and ignored by a number of IO schedulers, so any
+	// absolute limits are applied to the device that the server data is stored on.
+	if l.HasIoLimits() {
+		if dev, err := DataDevice(); err != nil {
+			log.WithField("error", err).Warn("environment: could not apply disk IO limits to container")
+		} else {
+			resources.BlkioDeviceReadBps = throttleDevice(dev.Path, l.IoReadBps)
+			resources.BlkioDeviceWriteBps = throttleDevice(dev.Path, l.IoWriteBps)
+			resources.BlkioDeviceReadIOps = throttleDevice(dev.Path, l.IoReadIops)
+			resources.BlkioDeviceWriteIOps = throttleDevice(dev.Path, l.IoWriteIops)
+		}
+	}
+
 	
 	// Add KVM device mapping if native KVM support is enabled
 	if config.Get().Docker.EnableNativeKVM {
@@ -148,6 +187,15 @@ func (l Limits) AsContainerResources() container.Resources {
 	return resources
 }
 
+// throttleDevice returns the throttle for a device in the format used by Docker,
+// or nil if there is no limit.
+func throttleDevice(path string, rate uint64) []*blkiodev.ThrottleDevice {
+	if rate == 0 {
+		return nil
+	}
+	return []*blkiodev.ThrottleDevice{{Path: path, Rate: rate}}
+}
+
 type Variables map[string]interface{}
 
 // Get is an ugly hacky function to handle environment variables that get passed
@@ -20,6 +20,9 @@ type Stats struct {
 	// Current network transmit in & out for a container.
 	Network NetworkStats `json:"network"`
 
+	// Current disk IO for a container.
+	Io IoStats `json:"io"`
+
 	// The current uptime of the container, in milliseconds.
 	Uptime int64 `json:"uptime"`
 }
@@ -29,3 +32,18 @@ type NetworkStats struct {
 	TxBytes uint64 `json:"tx_bytes"`
 }
 
+type IoStats struct {
+	// The total bytes read from and written to disk by the container.
+	ReadBytes  uint64 `json:"read_bytes"`
+	WriteBytes uint64 `json:"write_bytes"`
+
+	// The current throughput in bytes per second, and operations per second.
+	ReadBps   uint64 `json:"read_bps"`
+	WriteBps  uint64 `json:"write_bps"`
+	ReadIops  uint64 `json:"read_iops"`
+	WriteIops uint64 `json:"write_iops"`
+
+	// Whether the current IO is at one of the disk IO limits for the server, in
+	// which case it is being throttled.
+	Throttled bool `json:"throttled"`
+}
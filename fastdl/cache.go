@@ -0,0 +1,503 @@
+package fastdl
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/dsnet/compress/bzip2"
+	"github.com/goccy/go-json"
+
+	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/internal/ufs"
+)
+
+// The compressed variants of a file kept in the cache.
+const (
+	VariantBzip2 = "bz2"
+	VariantGzip  = "gz"
+)
+
+// minCacheFileSize is the size in bytes below which a file is not worth keeping
+// a compressed copy of.
+const minCacheFileSize = 1024
+
+// CompressibleExtensions are the extensions of the files that compressed copies
+// are kept of, these are the maps, models, textures and sounds downloaded by
+// Source and GoldSrc clients.
+var CompressibleExtensions = []string{
+	".bsp", ".nav", ".ain", ".res", ".txt",
+	".mdl", ".vtx", ".vvd", ".phy", ".ani",
+	".vtf", ".vmt", ".wad", ".spr", ".tga", ".bmp",
+	".wav", ".mp3", ".pcf",
+}
+
+// CacheStats describes the compressed copies kept for a server.
+type CacheStats struct {
+	Enabled bool   `json:"enabled"`
+	Files   int    `json:"files"`
+	Bytes   int64  `json:"bytes"`
+	Pending int    `json:"pending"`
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+
+	// TotalBytes and LimitBytes are the size of the cache for every server and
+	// the size it is limited to.
+	TotalBytes int64 `json:"total_bytes"`
+	LimitBytes int64 `json:"limit_bytes"`
+}
+
+// cacheEntry is a file that compressed copies have been created for. The size
+// and modification time of the file are compared on every request so that the
+// copies are never served once the file has changed.
+type cacheEntry struct {
+	Size    int64            `json:"size"`
+	ModTime int64            `json:"mod_time"`
+	Sizes   map[string]int64 `json:"variants"`
+	Used    time.Time        `json:"used"`
+}
+
+// bytes returns the size of the compressed copies of the file.
+func (e *cacheEntry) bytes() int64 {
+	var n int64
+	for _, v := range e.Sizes {
+		n += v
+	}
+	return n
+}
+
+// cacheServer is the compressed copies kept for a server.
+type cacheServer struct {
+	entries map[string]*cacheEntry
+	hits    uint64
+	misses  uint64
+}
+
+type cacheJob struct {
+	server string
+	fs     *ufs.UnixFS
+	rel    string
+}
+
+// AssetCache keeps compressed copies of the files served over FastDL. Copies are
+// created by a background worker the first time a file is requested, and are
+// removed once the file changes or the cache grows past its size limit.
+type AssetCache struct {
+	mu       sync.Mutex
+	loadOnce sync.Once
+	workOnce sync.Once
+	servers  map[string]*cacheServer
+	bytes    int64
+	jobs     []cacheJob
+	pending  map[string]struct{}
+	signal   chan struct{}
+
+	// The directory and size limit of the cache, replaced in tests.
+	directory func() string
+	limit     func() int64
+}
+
+var cache = newAssetCache()
+
+// Cache returns the cache of compressed files served over FastDL.
+func Cache() *AssetCache {
+	return cache
+}
+
+func newAssetCache() *AssetCache {
+	return &AssetCache{
+		servers: make(map[string]*cacheServer),
+		pending: make(map[string]struct{}),
+		signal:  make(chan struct{}, 1),
+		directory: func() string {
+			cfg := config.Get().System
+			if cfg.FastDL.CacheDirectory != "" {
+				return cfg.FastDL.CacheDirectory
+			}
+			return filepath.Join(cfg.RootDirectory, "fastdl")
+		},
+		limit: func() int64 {
+			return int64(max(config.Get().System.FastDL.CacheSize, 0)) * 1024 * 1024
+		},
+	}
+}
+
+// cacheable returns true if compressed copies are kept of the file.
+func cacheable(rel string, size int64) bool {
+	if size < minCacheFileSize {
+		return false
+	}
+	ext := strings.ToLower(path.Ext(rel))
+	for _, v := range CompressibleExtensions {
+		if v == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// path returns the path of a compressed copy of a file.
+func (c *AssetCache) path(server, rel, variant string) string {
+	return filepath.Join(c.directory(), server, "files", filepath.FromSlash(path.Clean("/"+rel))) + "." + variant
+}
+
+// indexPath returns the path of the index of the copies kept for a server.
+func (c *AssetCache) indexPath(server string) string {
+	return filepath.Join(c.directory(), server, "index.json")
+}
+
+// load reads the index of every server from the disk the first time the cache
+// is used.
+func (c *AssetCache) load() {
+	c.loadOnce.Do(func() {
+		dirs, err := os.ReadDir(c.directory())
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.WithError(err).Warn("fastdl: failed to read cache directory")
+			}
+			return
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, d := range dirs {
+			if !d.IsDir() {
+				continue
+			}
+			b, err := os.ReadFile(c.indexPath(d.Name()))
+			if err != nil {
+				continue
+			}
+			var entries map[string]*cacheEntry
+			if err := json.Unmarshal(b, &entries); err != nil {
+				log.WithField("server", d.Name()).WithError(err).Warn("fastdl: ignoring invalid cache index")
+				continue
+			}
+			s := c.serverLocked(d.Name())
+			for rel, e := range entries {
+				s.entries[rel] = e
+				c.bytes += e.bytes()
+			}
+		}
+	})
+}
+
+// serverLocked returns the copies kept for a server. This must be called while
+// holding the lock.
+func (c *AssetCache) serverLocked(id string) *cacheServer {
+	s, ok := c.servers[id]
+	if !ok {
+		s = &cacheServer{entries: make(map[string]*cacheEntry)}
+		c.servers[id] = s
+	}
+	return s
+}
+
+// saveLocked writes the index of a server to the disk. This must be called while
+// holding the lock.
+func (c *AssetCache) saveLocked(id string) {
+	s := c.servers[id]
+	if s == nil || len(s.entries) == 0 {
+		_ = os.Remove(c.indexPath(id))
+		return
+	}
+	b, err := json.Marshal(s.entries)
+	if err == nil {
+		p := c.indexPath(id)
+		if err = os.MkdirAll(filepath.Dir(p), 0o755); err == nil {
+			if err = os.WriteFile(p+".tmp", b, 0o644); err == nil {
+				err = os.Rename(p+".tmp", p)
+			}
+		}
+	}
+	if err != nil {
+		log.WithField("server", id).WithError(err).Warn("fastdl: failed to save cache index")
+	}
+}
+
+// removeLocked removes the compressed copies of a file. This must be called
+// while holding the lock.
+func (c *AssetCache) removeLocked(id, rel string) {
+	s := c.servers[id]
+	if s == nil {
+		return
+	}
+	e, ok := s.entries[rel]
+	if !ok {
+		return
+	}
+	for variant := range e.Sizes {
+		_ = os.Remove(c.path(id, rel, variant))
+	}
+	c.bytes -= e.bytes()
+	delete(s.entries, rel)
+}
+
+// Lookup returns the path of a compressed copy of a file, if there is one for
+// the current version of the file. Otherwise the copies are created in the
+// background so they can be served on a later request.
+func (c *AssetCache) Lookup(server string, fs *ufs.UnixFS, rel string, info ufs.FileInfo, variant string) (string, bool) {
+	if !cacheable(rel, info.Size()) {
+		return "", false
+	}
+	c.load()
+
+	c.mu.Lock()
+	s := c.serverLocked(server)
+	e, ok := s.entries[rel]
+	if ok && e.Size == info.Size() && e.ModTime == info.ModTime().UnixNano() {
+		if _, ok := e.Sizes[variant]; ok {
+			s.hits++
+			e.Used = time.Now()
+			c.mu.Unlock()
+			return c.path(server, rel, variant), true
+		}
+	}
+	// The file changed since the copies were created.
+	if ok {
+		c.removeLocked(server, rel)
+		c.saveLocked(server)
+	}
+	s.misses++
+	c.mu.Unlock()
+
+	c.enqueue(cacheJob{server: server, fs: fs, rel: rel})
+	return "", false
+}
+
+// Stats returns the state of the copies kept for a server.
+func (c *AssetCache) Stats(server string) CacheStats {
+	c.load()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := CacheStats{
+		Enabled:    config.Get().System.FastDL.Cache,
+		TotalBytes: c.bytes,
+		LimitBytes: c.limit(),
+	}
+	if s := c.servers[server]; s != nil {
+		stats.Files = len(s.entries)
+		stats.Hits = s.hits
+		stats.Misses = s.misses
+		for _, e := range s.entries {
+			stats.Bytes += e.bytes()
+		}
+	}
+	for _, j := range c.jobs {
+		if j.server == server {
+			stats.Pending++
+		}
+	}
+	return stats
+}
+
+// Purge removes every compressed copy kept for a server.
+func (c *AssetCache) Purge(server string) error {
+	c.load()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s := c.servers[server]; s != nil {
+		for _, e := range s.entries {
+			c.bytes -= e.bytes()
+		}
+		delete(c.servers, server)
+	}
+	jobs := c.jobs[:0]
+	for _, j := range c.jobs {
+		if j.server != server {
+			jobs = append(jobs, j)
+		}
+	}
+	c.jobs = jobs
+	return os.RemoveAll(filepath.Join(c.directory(), server))
+}
+
+// enqueue queues the creation of the compressed copies of a file, unless it is
+// already queued.
+func (c *AssetCache) enqueue(j cacheJob) {
+	key := j.server + j.rel
+	c.mu.Lock()
+	if _, ok := c.pending[key]; ok {
+		c.mu.Unlock()
+		return
+	}
+	c.pending[key] = struct{}{}
+	c.jobs = append(c.jobs, j)
+	c.mu.Unlock()
+
+	c.workOnce.Do(func() {
+		go c.work()
+	})
+	select {
+	case c.signal <- struct{}{}:
+	default:
+	}
+}
+
+// work creates the compressed copies of queued files one at a time, since
+// compressing them is expensive.
+func (c *AssetCache) work() {
+	for range c.signal {
+		for {
+			c.mu.Lock()
+			if len(c.jobs) == 0 {
+				c.mu.Unlock()
+				break
+			}
+			j := c.jobs[0]
+			c.jobs = c.jobs[1:]
+			c.mu.Unlock()
+
+			if err := c.generate(j); err != nil {
+				log.WithFields(log.Fields{"server": j.server, "path": j.rel}).WithError(err).Debug("fastdl: failed to compress file")
+			}
+
+			c.mu.Lock()
+			delete(c.pending, j.server+j.rel)
+			c.mu.Unlock()
+		}
+	}
+}
+
+// generate creates the compressed copies of a file and adds them to the cache,
+// removing the copies used least recently if the cache grows past its limit.
+func (c *AssetCache) generate(j cacheJob) error {
+	f, err := j.fs.Open(j.rel)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() || !cacheable(j.rel, info.Size()) {
+		return nil
+	}
+
+	e := &cacheEntry{Size: info.Size(), ModTime: info.ModTime().UnixNano(), Sizes: map[string]int64{}, Used: time.Now()}
+	for _, variant := range []string{VariantBzip2, VariantGzip} {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		n, err := c.compress(f, c.path(j.server, j.rel, variant), variant)
+		if err != nil {
+			return err
+		}
+		e.Sizes[variant] = n
+	}
+	if e.bytes() > c.limit() {
+		for variant := range e.Sizes {
+			_ = os.Remove(c.path(j.server, j.rel, variant))
+		}
+		return errors.New("compressed file is larger than the cache")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The copies replace any created for an older version of the file.
+	s := c.serverLocked(j.server)
+	if prev, ok := s.entries[j.rel]; ok {
+		c.bytes -= prev.bytes()
+	}
+	s.entries[j.rel] = e
+	c.bytes += e.bytes()
+	for _, id := range c.evictLocked(j.server, j.rel) {
+		c.saveLocked(id)
+	}
+	c.saveLocked(j.server)
+	return nil
+}
+
+// compress writes a compressed copy of the file to the given path, returning its
+// size.
+func (c *AssetCache) compress(r io.Reader, p, variant string) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return 0, err
+	}
+	out, err := os.Create(p + ".tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	var w io.WriteCloser
+	if variant == VariantBzip2 {
+		w, err = bzip2.NewWriter(out, &bzip2.WriterConfig{Level: bzip2.BestCompression})
+	} else {
+		w, err = gzip.NewWriterLevel(out, gzip.BestCompression)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return 0, err
+	}
+	if err := w.Close(); err != nil {
+		return 0, err
+	}
+	st, err := out.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if err := out.Close(); err != nil {
+		return 0, err
+	}
+	return st.Size(), os.Rename(out.Name(), p)
+}
+
+// evictLocked removes the copies used least recently until the cache fits in its
+// limit, keeping the given file. It returns the servers that had copies removed.
+// This must be called while holding the lock.
+func (c *AssetCache) evictLocked(keepServer, keepRel string) []string {
+	limit := c.limit()
+	if c.bytes <= limit {
+		return nil
+	}
+
+	type candidate struct {
+		server, rel string
+		used        time.Time
+	}
+	var candidates []candidate
+	for id, s := range c.servers {
+		for rel, e := range s.entries {
+			if id != keepServer || rel != keepRel {
+				candidates = append(candidates, candidate{id, rel, e.Used})
+			}
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].used.Before(candidates[j].used)
+	})
+
+	changed := map[string]struct{}{}
+	for _, v := range candidates {
+		if c.bytes <= limit {
+			break
+		}
+		c.removeLocked(v.server, v.rel)
+		changed[v.server] = struct{}{}
+	}
+	var out []string
+	for id := range changed {
+		if id != keepServer {
+			out = append(out, id)
+		}
+	}
+	return out
+}
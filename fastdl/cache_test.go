@@ -0,0 +1,128 @@
+package fastdl
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/internal/ufs"
+)
+
+func newTestCache(t *testing.T, limit int64) (*AssetCache, *ufs.UnixFS, string) {
+	config.Set(&config.Configuration{
+		AuthenticationToken: "abc",
+		System:              config.SystemConfiguration{FastDL: config.FastDLConfiguration{Cache: true}},
+	})
+
+	data := t.TempDir()
+	fs, err := ufs.NewUnixFS(data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	c := newAssetCache()
+	c.directory = func() string { return dir }
+	c.limit = func() int64 { return limit }
+	// Jobs are run directly by the tests rather than by the worker.
+	c.workOnce.Do(func() {})
+	return c, fs, data
+}
+
+func TestAssetCache(t *testing.T) {
+	c, fs, data := newTestCache(t, 1024*1024)
+	if err := os.MkdirAll(filepath.Join(data, "maps"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(data, "maps", "de_test.bsp")
+	if err := os.WriteFile(p, bytes.Repeat([]byte("map data "), 1024), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := fs.Stat("/maps/de_test.bsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := c.Lookup("server", fs, "/maps/de_test.bsp", info, VariantBzip2); ok {
+		t.Fatal("expected the first lookup to miss")
+	}
+	// Run the queued job directly rather than waiting on the worker.
+	if err := c.generate(cacheJob{server: "server", fs: fs, rel: "/maps/de_test.bsp"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, variant := range []string{VariantBzip2, VariantGzip} {
+		cached, ok := c.Lookup("server", fs, "/maps/de_test.bsp", info, variant)
+		if !ok {
+			t.Fatalf("expected %s copy to be cached", variant)
+		}
+		if st, err := os.Stat(cached); err != nil || st.Size() >= info.Size() {
+			t.Fatalf("expected %s copy to be smaller than the file (%v)", variant, err)
+		}
+	}
+	stats := c.Stats("server")
+	if stats.Files != 1 || stats.Hits != 2 || stats.Misses != 1 || stats.Bytes == 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	// Copies of a file that changed are never served.
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(p, later, later); err != nil {
+		t.Fatal(err)
+	}
+	info, _ = fs.Stat("/maps/de_test.bsp")
+	if _, ok := c.Lookup("server", fs, "/maps/de_test.bsp", info, VariantBzip2); ok {
+		t.Fatal("expected copy of a changed file to be invalidated")
+	}
+	if stats := c.Stats("server"); stats.Files != 0 || stats.TotalBytes != 0 {
+		t.Fatalf("expected invalidated copies to be removed: %+v", stats)
+	}
+
+	if err := c.generate(cacheJob{server: "server", fs: fs, rel: "/maps/de_test.bsp"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Purge("server"); err != nil {
+		t.Fatal(err)
+	}
+	if stats := c.Stats("server"); stats.Files != 0 || stats.TotalBytes != 0 {
+		t.Fatalf("expected purged copies to be removed: %+v", stats)
+	}
+}
+
+func TestAssetCacheEviction(t *testing.T) {
+	// Random data does not compress, so each copy is about the size of the file.
+	c, fs, data := newTestCache(t, 12*1024)
+	r := rand.New(rand.NewSource(1))
+	for _, name := range []string{"a.bsp", "b.bsp"} {
+		b := make([]byte, 4096)
+		r.Read(b)
+		if err := os.WriteFile(filepath.Join(data, name), b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.generate(cacheJob{server: "server", fs: fs, rel: "/" + name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c.mu.Lock()
+	_, hasA := c.servers["server"].entries["/a.bsp"]
+	_, hasB := c.servers["server"].entries["/b.bsp"]
+	c.mu.Unlock()
+	if hasA || !hasB {
+		t.Fatalf("expected the least recently used copy to be evicted (a: %t, b: %t)", hasA, hasB)
+	}
+}
+
+func TestCacheable(t *testing.T) {
+	if !cacheable("/maps/de_dust2.BSP", 4096) {
+		t.Error("expected maps to be cacheable")
+	}
+	if cacheable("/maps/de_dust2.bsp", 10) {
+		t.Error("expected small files not to be cacheable")
+	}
+	if cacheable("/maps/de_dust2.bsp.bz2", 4096) {
+		t.Error("expected compressed files not to be cacheable")
+	}
+}
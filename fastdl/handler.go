@@ -1,94 +1,107 @@
 package fastdl
 
 import (
+	"errors"
 	"fmt"
+	"html"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
+	"path"
 	"strings"
+	"time"
 
 	"github.com/apex/log"
+	"github.com/dsnet/compress/bzip2"
 
 	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/internal/ufs"
 	"github.com/priyxstudio/propel/server"
 )
 
+// BlockedExtensions are the file extensions that are never served over FastDL,
+// since they contain plugin sources, configuration, logs or server binaries.
+// These are used by both the built-in server and the nginx configuration.
+var BlockedExtensions = []string{".sma", ".amxx", ".sp", ".smx", ".cfg", ".ini", ".log", ".bak", ".dat", ".sql", ".sq3", ".so", ".dll", ".php", ".zip", ".rar", ".jar", ".sh"}
+
+// BlockedDirectories are the directories that are never served over FastDL.
+// These are used by both the built-in server and the nginx configuration.
+var BlockedDirectories = []string{"addons", "cfg", "logs"}
+
 // FastDLHandler handles HTTP requests for the FastDL server.
 type FastDLHandler struct {
 	manager            *server.Manager
-	basePath           string
-	readOnly           bool
 	enableDirListing   bool
+	compress           bool
+	cacheMaxAge        int
+	limiter            *ipLimiter
+	cache              *AssetCache
 	blockedExtensions  map[string]bool
 	blockedDirectories map[string]bool
 }
 
 // NewHandler creates a new FastDL handler instance.
-// NOTE: This is not used when FastDL uses nginx (which is the default).
-// Kept for potential future use or if built-in server is re-enabled.
-func NewHandler(m *server.Manager, basePath string, cfg config.FastDLConfiguration) *FastDLHandler {
-	// Build blocked extensions map for fast lookup - use defaults
+func NewHandler(m *server.Manager, cfg config.FastDLConfiguration) *FastDLHandler {
+	// Build blocked extensions map for fast lookup
 	blockedExts := make(map[string]bool)
-	blockedExtensions := []string{".sma", ".amxx", ".sp", ".smx", ".cfg", ".ini", ".log", ".bak", ".dat", ".sql", ".sq3", ".so", ".dll", ".php", ".zip", ".rar", ".jar", ".sh"}
-	
-	for _, ext := range blockedExtensions {
+	for _, ext := range BlockedExtensions {
 		ext = strings.ToLower(strings.TrimSpace(ext))
 		if ext != "" {
 			blockedExts[ext] = true
 		}
 	}
 
-	// Build blocked directories map for fast lookup - use defaults
+	// Build blocked directories map for fast lookup
 	blockedDirs := make(map[string]bool)
-	blockedDirectories := []string{"addons", "cfg", "logs"}
-	
-	for _, dir := range blockedDirectories {
+	for _, dir := range BlockedDirectories {
 		dir = strings.ToLower(strings.TrimSpace(dir))
 		if dir != "" {
 			blockedDirs[dir] = true
 		}
 	}
 
-	return &FastDLHandler{
+	h := &FastDLHandler{
 		manager:            m,
-		basePath:            basePath,
-		readOnly:            false, // Default
-		enableDirListing:    true, // Default
-		blockedExtensions:   blockedExts,
-		blockedDirectories:  blockedDirs,
+		enableDirListing:   true, // Default
+		compress:           cfg.Compress,
+		cacheMaxAge:        max(cfg.CacheMaxAge, 0),
+		limiter:            newIPLimiter(cfg.RateLimit, cfg.RateBurst),
+		blockedExtensions:  blockedExts,
+		blockedDirectories: blockedDirs,
+	}
+	if cfg.Cache {
+		h.cache = Cache()
 	}
+	return h
 }
 
 // ServeHTTP handles incoming HTTP requests.
 func (h *FastDLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Only allow GET and HEAD methods
 	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 
+	if h.limiter != nil && !h.limiter.allow(clientIP(r)) {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+
 	// Parse the request path
 	// Expected format: /{server-uuid}/path/to/file
-	path := strings.TrimPrefix(r.URL.Path, "/")
-	if path == "" || path == "health" {
+	p := strings.TrimPrefix(r.URL.Path, "/")
+	if p == "" || p == "health" {
 		// Root path or health check (handled by mux)
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
 	// Split path into server UUID and file path
-	parts := strings.SplitN(path, "/", 2)
-	if len(parts) < 1 {
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
-
-	serverUUID := parts[0]
-	filePath := ""
-	if len(parts) > 1 {
-		filePath = parts[1]
-	}
+	serverUUID, filePath, _ := strings.Cut(p, "/")
 
 	// Get server instance
 	srv, ok := h.manager.Get(serverUUID)
@@ -101,9 +114,10 @@ func (h *FastDLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if FastDL is enabled for this server
-	cfg := srv.Config()
-	if !cfg.FastDL.Enabled {
+	// Check if FastDL is enabled for this server, this is read on every request
+	// so that changes to the server configuration apply straight away.
+	enabled, directory := srv.Config().GetFastDL()
+	if !enabled {
 		log.WithFields(log.Fields{
 			"server": serverUUID,
 			"ip":     r.RemoteAddr,
@@ -112,57 +126,38 @@ func (h *FastDLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Build full file path - use FastDL directory if configured
-	serverBasePath := filepath.Join(h.basePath, serverUUID)
-	if cfg.FastDL.Directory != "" {
-		// If server has a specific FastDL directory, prepend it
-		filePath = filepath.Join(cfg.FastDL.Directory, filePath)
-	}
-	fullPath := filepath.Join(serverBasePath, filePath)
-
-	// Security: Ensure the path is within the server's directory
-	absPath, err := filepath.Abs(fullPath)
-	if err != nil {
-		log.WithError(err).WithField("path", fullPath).Error("fastdl: failed to resolve absolute path")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	absBasePath, err := filepath.Abs(serverBasePath)
-	if err != nil {
-		log.WithError(err).WithField("path", serverBasePath).Error("fastdl: failed to resolve base path")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	if !strings.HasPrefix(absPath, absBasePath) {
-		log.WithFields(log.Fields{
-			"requested": absPath,
-			"base":      absBasePath,
-		}).Warn("fastdl: path traversal attempt detected")
-		w.WriteHeader(http.StatusForbidden)
-		return
-	}
+	// Files are served from the FastDL directory of the server. Cleaning the path
+	// as an absolute path removes any attempt to traverse out of the directory,
+	// and the server filesystem refuses to follow symlinks out of the server.
+	rel := path.Clean("/" + path.Join(directory, filePath))
 
 	// Check if path contains blocked directories
-	if h.isBlockedDirectory(filePath) {
+	if h.isBlockedDirectory(rel) {
 		log.WithFields(log.Fields{
 			"server": serverUUID,
-			"path":   filePath,
+			"path":   rel,
 			"ip":     r.RemoteAddr,
 		}).Warn("fastdl: blocked directory access attempted")
 		w.WriteHeader(http.StatusForbidden)
 		return
 	}
 
+	fs := srv.Filesystem().UnixFS()
+
 	// Get file info
-	info, err := os.Stat(absPath)
+	info, err := fs.Stat(rel)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, ufs.ErrNotExist) {
+			// Source engine clients request a compressed copy of every file first,
+			// which is created from the original file if there is none on disk.
+			if h.compress && strings.HasSuffix(rel, ".bz2") {
+				h.serveCompressed(w, r, fs, serverUUID, strings.TrimSuffix(rel, ".bz2"))
+				return
+			}
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
-		log.WithError(err).WithField("path", absPath).Error("fastdl: failed to stat file")
+		log.WithError(err).WithField("path", rel).Error("fastdl: failed to stat file")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -173,15 +168,15 @@ func (h *FastDLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
-		h.serveDirectoryListing(w, r, absPath, filePath, serverUUID)
+		h.serveDirectoryListing(w, r, fs, rel, strings.TrimPrefix(filePath, "/"), serverUUID)
 		return
 	}
 
 	// Check if file extension is blocked
-	if h.isBlockedExtension(absPath) {
+	if h.isBlockedExtension(rel) {
 		log.WithFields(log.Fields{
 			"server": serverUUID,
-			"path":   filePath,
+			"path":   rel,
 			"ip":     r.RemoteAddr,
 		}).Warn("fastdl: blocked file type access attempted")
 		w.WriteHeader(http.StatusForbidden)
@@ -189,15 +184,34 @@ func (h *FastDLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Serve the file
-	h.serveFile(w, r, absPath, info)
+	h.serveFile(w, r, fs, serverUUID, rel, info)
 }
 
-// serveFile serves a single file to the client.
-func (h *FastDLHandler) serveFile(w http.ResponseWriter, r *http.Request, filePath string, info os.FileInfo) {
+// serveFile serves a single file to the client, handling conditional and range
+// requests. A cached gzip compressed copy is sent instead if the client accepts
+// one.
+func (h *FastDLHandler) serveFile(w http.ResponseWriter, r *http.Request, fs *ufs.UnixFS, serverUUID, filePath string, info ufs.FileInfo) {
+	// Set content type based on file extension
+	w.Header().Set("Content-Type", getContentType(strings.ToLower(path.Ext(filePath))))
+
+	if h.cache != nil && cacheable(filePath, info.Size()) {
+		w.Header().Set("Vary", "Accept-Encoding")
+		if acceptsGzip(r) {
+			if p, ok := h.cache.Lookup(serverUUID, fs, filePath, info, VariantGzip); ok {
+				w.Header().Set("Content-Encoding", "gzip")
+				h.setCacheHeaders(w, info, VariantGzip)
+				if h.serveCached(w, r, p, info) {
+					return
+				}
+				w.Header().Del("Content-Encoding")
+			}
+		}
+	}
+
 	// Open the file
-	file, err := os.Open(filePath)
+	file, err := fs.Open(filePath)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, ufs.ErrNotExist) {
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
@@ -207,49 +221,149 @@ func (h *FastDLHandler) serveFile(w http.ResponseWriter, r *http.Request, filePa
 	}
 	defer file.Close()
 
-	// Set content type based on file extension
-	ext := strings.ToLower(filepath.Ext(filePath))
-	contentType := getContentType(ext)
-	w.Header().Set("Content-Type", contentType)
+	h.setCacheHeaders(w, info, "")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
+
+// serveCached serves a compressed copy of a file from the cache, returning false
+// if the copy could not be opened.
+func (h *FastDLHandler) serveCached(w http.ResponseWriter, r *http.Request, p string, info ufs.FileInfo) bool {
+	f, err := os.Open(p)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	http.ServeContent(w, r, "", info.ModTime(), f)
+	return true
+}
+
+// serveCompressed serves a bzip2 compressed copy of a file, using the cached copy
+// if there is one and otherwise compressing it as it is sent to the client.
+func (h *FastDLHandler) serveCompressed(w http.ResponseWriter, r *http.Request, fs *ufs.UnixFS, serverUUID, filePath string) {
+	info, err := fs.Stat(filePath)
+	if err != nil || info.IsDir() {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	// The original file must be allowed to be served for its compressed copy to
+	// be served.
+	if h.isBlockedExtension(filePath) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
 
-	// Set content length
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", info.Size()))
+	w.Header().Set("Content-Type", getContentType(".bz2"))
+	h.setCacheHeaders(w, info, VariantBzip2)
+	if h.cache != nil {
+		if p, ok := h.cache.Lookup(serverUUID, fs, filePath, info, VariantBzip2); ok && h.serveCached(w, r, p, info) {
+			return
+		}
+	}
+	// A copy compressed as it is sent is not byte for byte the same as the cached
+	// copy, so it only has a weak ETag and ranges of it cannot be requested.
+	etag := w.Header().Get("ETag")
+	w.Header().Set("ETag", "W/"+etag)
+	if notModified(r, etag, info.ModTime()) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	file, err := fs.Open(filePath)
+	if err != nil {
+		log.WithError(err).WithField("path", filePath).Error("fastdl: failed to open file")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	bw, err := bzip2.NewWriter(w, &bzip2.WriterConfig{Level: bzip2.BestSpeed})
+	if err != nil {
+		log.WithError(err).Error("fastdl: failed to create bzip2 writer")
+		return
+	}
+	if _, err := io.Copy(bw, file); err != nil {
+		log.WithError(err).WithField("path", filePath).Debug("fastdl: failed to send compressed file")
+		return
+	}
+	if err := bw.Close(); err != nil {
+		log.WithError(err).WithField("path", filePath).Debug("fastdl: failed to finish compressed file")
+	}
+}
 
-	// Set cache headers for better performance
-	w.Header().Set("Cache-Control", "public, max-age=3600")
+// setCacheHeaders sets the headers used by clients to cache a file and to check
+// whether it has changed since.
+func (h *FastDLHandler) setCacheHeaders(w http.ResponseWriter, info ufs.FileInfo, variant string) {
+	tag := fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size())
+	if variant != "" {
+		tag += "-" + variant
+	}
+	w.Header().Set("ETag", `"`+tag+`"`)
+	w.Header().Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", h.cacheMaxAge))
 
 	// Set CORS headers if needed
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD")
+}
 
-	// Write file content
-	w.WriteHeader(http.StatusOK)
-	if r.Method == http.MethodGet {
-		io.Copy(w, file)
+// acceptsGzip returns true if the client accepts gzip encoded responses.
+func acceptsGzip(r *http.Request) bool {
+	for _, v := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(v), ";")
+		if strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			q := strings.ReplaceAll(params, " ", "")
+			return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+		}
 	}
+	return false
+}
+
+// notModified returns true if the client already has the current version of a
+// file, based on the conditional headers of the request.
+func notModified(r *http.Request, etag string, modTime time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, v := range strings.Split(match, ",") {
+			v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+			if v == "*" || v == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil {
+		return !modTime.Truncate(time.Second).After(since)
+	}
+	return false
 }
 
 // serveDirectoryListing generates and serves an HTML directory listing.
-func (h *FastDLHandler) serveDirectoryListing(w http.ResponseWriter, r *http.Request, dirPath, relativePath, serverUUID string) {
-	entries, err := os.ReadDir(dirPath)
+func (h *FastDLHandler) serveDirectoryListing(w http.ResponseWriter, r *http.Request, fs *ufs.UnixFS, dirPath, relativePath, serverUUID string) {
+	entries, err := fs.ReadDir(dirPath)
 	if err != nil {
 		log.WithError(err).WithField("path", dirPath).Error("fastdl: failed to read directory")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	relativePath = strings.TrimSuffix(relativePath, "/")
 
-	// Build HTML listing
-	html := "<!DOCTYPE html>\n<html><head><title>Index of /" + serverUUID + "/" + relativePath + "</title></head><body>\n"
-	html += "<h1>Index of /" + serverUUID + "/" + relativePath + "</h1>\n"
-	html += "<hr><pre>\n"
+	// Build HTML listing, every value taken from the filesystem or the request is
+	// escaped since file names are controlled by the server owner.
+	title := html.EscapeString("/" + serverUUID + "/" + relativePath)
+	out := "<!DOCTYPE html>\n<html><head><title>Index of " + title + "</title></head><body>\n"
+	out += "<h1>Index of " + title + "</h1>\n"
+	out += "<hr><pre>\n"
 
 	// Add parent directory link if not at root
 	if relativePath != "" {
-		parentPath := filepath.Dir(relativePath)
+		parentPath := path.Dir(relativePath)
 		if parentPath == "." {
 			parentPath = ""
 		}
-		html += fmt.Sprintf("<a href=\"/%s/%s\">../</a>\n", serverUUID, parentPath)
+		out += fmt.Sprintf("<a href=\"/%s/%s\">../</a>\n", html.EscapeString(url.PathEscape(serverUUID)), html.EscapeString(escapePath(parentPath)))
 	}
 
 	// List directory entries
@@ -267,7 +381,7 @@ func (h *FastDLHandler) serveDirectoryListing(w http.ResponseWriter, r *http.Req
 		}
 
 		// Build link path
-		linkPath := filepath.Join(relativePath, name)
+		linkPath := path.Join(relativePath, name)
 		if relativePath == "" {
 			linkPath = name
 		}
@@ -288,31 +402,40 @@ func (h *FastDLHandler) serveDirectoryListing(w http.ResponseWriter, r *http.Req
 			icon = "📄"
 		}
 
-		html += fmt.Sprintf("<a href=\"/%s/%s\">%s %s</a>%s\n",
-			serverUUID,
-			strings.ReplaceAll(linkPath, " ", "%20"),
+		out += fmt.Sprintf("<a href=\"/%s/%s\">%s %s</a>%s\n",
+			html.EscapeString(url.PathEscape(serverUUID)),
+			html.EscapeString(escapePath(linkPath)),
 			icon,
-			name,
-			strings.Repeat(" ", 50-len(name))+size,
+			html.EscapeString(name),
+			strings.Repeat(" ", max(0, 50-len(name)))+size,
 		)
 	}
 
-	html += "</pre><hr></body></html>"
+	out += "</pre><hr></body></html>"
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(html))
+	w.Write([]byte(out))
+}
+
+// escapePath escapes each segment of a slash separated path for use in a URL.
+func escapePath(p string) string {
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
 }
 
 // isBlockedExtension checks if a file has a blocked extension.
 func (h *FastDLHandler) isBlockedExtension(filePath string) bool {
-	ext := strings.ToLower(filepath.Ext(filePath))
+	ext := strings.ToLower(path.Ext(filePath))
 	return h.blockedExtensions[ext]
 }
 
 // isBlockedDirectory checks if a path contains a blocked directory.
-func (h *FastDLHandler) isBlockedDirectory(path string) bool {
-	parts := strings.Split(strings.ToLower(path), string(filepath.Separator))
+func (h *FastDLHandler) isBlockedDirectory(p string) bool {
+	parts := strings.Split(strings.ToLower(p), "/")
 	for _, part := range parts {
 		if h.blockedDirectories[part] {
 			return true
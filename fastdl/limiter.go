@@ -0,0 +1,78 @@
+package fastdl
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// limiterIdleTimeout is how long the limiter of an IP address is kept after its
+// last request.
+const limiterIdleTimeout = time.Minute * 5
+
+// ipLimiter limits the rate of requests from each IP address.
+type ipLimiter struct {
+	mu      sync.Mutex
+	limit   rate.Limit
+	burst   int
+	clients map[string]*ipClient
+	pruned  time.Time
+}
+
+type ipClient struct {
+	limiter *rate.Limiter
+	seen    time.Time
+}
+
+// newIPLimiter returns a limiter allowing the given number of requests per
+// second from each IP address, or nil if there is no limit.
+func newIPLimiter(perSecond float64, burst int) *ipLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &ipLimiter{
+		limit:   rate.Limit(perSecond),
+		burst:   max(burst, 1),
+		clients: make(map[string]*ipClient),
+		pruned:  time.Now(),
+	}
+}
+
+// allow returns true if a request from the IP address is allowed right now.
+func (l *ipLimiter) allow(ip string) bool {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Forget addresses that have not made a request in a while so the map does
+	// not keep growing.
+	if now.Sub(l.pruned) > limiterIdleTimeout {
+		for k, c := range l.clients {
+			if now.Sub(c.seen) > limiterIdleTimeout {
+				delete(l.clients, k)
+			}
+		}
+		l.pruned = now
+	}
+
+	c, ok := l.clients[ip]
+	if !ok {
+		c = &ipClient{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[ip] = c
+	}
+	c.seen = now
+	return c.limiter.AllowN(now, 1)
+}
+
+// clientIP returns the IP address a request was made from.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
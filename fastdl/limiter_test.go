@@ -0,0 +1,50 @@
+package fastdl
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIPLimiter(t *testing.T) {
+	if newIPLimiter(0, 10) != nil {
+		t.Fatal("expected no limiter without a rate")
+	}
+
+	l := newIPLimiter(1, 2)
+	if !l.allow("10.0.0.1") || !l.allow("10.0.0.1") {
+		t.Fatal("expected requests within the burst to be allowed")
+	}
+	if l.allow("10.0.0.1") {
+		t.Fatal("expected request over the burst to be limited")
+	}
+	if !l.allow("10.0.0.2") {
+		t.Fatal("expected other addresses to have their own limit")
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	mod := time.Date(2024, 3, 10, 12, 0, 0, 500, time.UTC)
+
+	r, _ := http.NewRequest(http.MethodGet, "/", nil)
+	if notModified(r, `"a"`, mod) {
+		t.Fatal("expected request without conditional headers to be served")
+	}
+	r.Header.Set("If-None-Match", `"b", W/"a"`)
+	if !notModified(r, `"a"`, mod) {
+		t.Fatal("expected matching etag to be not modified")
+	}
+	r.Header.Set("If-None-Match", `"b"`)
+	r.Header.Set("If-Modified-Since", mod.Format(http.TimeFormat))
+	if notModified(r, `"a"`, mod) {
+		t.Fatal("expected etag to take priority over the modification time")
+	}
+	r.Header.Del("If-None-Match")
+	if !notModified(r, `"a"`, mod) {
+		t.Fatal("expected file not modified since the given time to be not modified")
+	}
+	r.Header.Set("If-Modified-Since", mod.Add(-time.Hour).Format(http.TimeFormat))
+	if notModified(r, `"a"`, mod) {
+		t.Fatal("expected file modified since the given time to be served")
+	}
+}
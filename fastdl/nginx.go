@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"emperror.dev/errors"
@@ -86,11 +87,19 @@ type serverConfig struct {
 }
 
 // buildNginxConfig builds the nginx configuration content matching the user's template exactly.
-// Uses default blocked extensions: .sma, .amxx, .sp, .smx, .cfg, .ini, .log, .bak, .dat, .sql, .sq3, .so, .dll, .php, .zip, .rar, .jar, .sh
-// Uses default blocked directories: addons, cfg, logs
+// Blocks the same BlockedExtensions and BlockedDirectories as the built-in server.
 func buildNginxConfig(cfg *config.Configuration, servers []serverConfig) string {
 	fastdlCfg := cfg.System.FastDL
 
+	exts := make([]string, len(BlockedExtensions))
+	for i, ext := range BlockedExtensions {
+		exts[i] = regexp.QuoteMeta(strings.TrimPrefix(ext, "."))
+	}
+	dirs := make([]string, len(BlockedDirectories))
+	for i, dir := range BlockedDirectories {
+		dirs[i] = regexp.QuoteMeta(dir)
+	}
+
 	// Determine server name - use panel location hostname or default
 	serverName := "example.website.ro" // Default from user's example
 	if panelURL := cfg.PanelLocation; panelURL != "" {
@@ -124,15 +133,15 @@ func buildNginxConfig(cfg *config.Configuration, servers []serverConfig) string
 		autoindex on;
 	}
 	
-	location ~\.(sma|amxx|sp|smx|cfg|ini|log|bak|dat|sql|sq3|so|dll|php|zip|rar|jar|sh)$ {
+	location ~\.(%s)$ {
 		return 403;
 	}
     
-	location ~ /(addons|cfg|logs) {
+	location ~ /(%s) {
   		deny all;
 	}
 }
-`, fastdlCfg.Port, fastdlCfg.Port, cfg.System.Data, serverName)
+`, fastdlCfg.Port, fastdlCfg.Port, cfg.System.Data, serverName, strings.Join(exts, "|"), strings.Join(dirs, "|"))
 
 	return config
 }
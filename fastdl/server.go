@@ -15,31 +15,52 @@ import (
 	"github.com/priyxstudio/propel/server"
 )
 
+// The values of the FastDL mode configuration option.
+const (
+	// ModeNginx generates a configuration for an existing nginx install that
+	// serves the files of every server with FastDL enabled.
+	ModeNginx = "nginx"
+	// ModeBuiltin serves the files from the daemon itself using FastDLServer.
+	ModeBuiltin = "builtin"
+)
+
+// Builtin returns true if FastDL files are served by the built-in server rather
+// than nginx.
+func Builtin() bool {
+	return config.Get().System.FastDL.Mode == ModeBuiltin
+}
+
+// Reload applies a change to the FastDL configuration of a server. The built-in
+// server reads the configuration of a server on every request so there is
+// nothing to do, otherwise the nginx configuration is generated again.
+func Reload(manager *server.Manager) error {
+	if !config.Get().System.FastDL.Enabled || Builtin() {
+		return nil
+	}
+	if err := GenerateNginxConfig(manager); err != nil {
+		return err
+	}
+	return ReloadNginx()
+}
+
 // FastDLServer represents the FastDL HTTP server instance.
 type FastDLServer struct {
-	manager  *server.Manager
-	BasePath string
-	ReadOnly bool
-	Listen   string
-	Handler  *FastDLHandler
-	server   *http.Server
+	manager *server.Manager
+	Listen  string
+	Handler *FastDLHandler
+	server  *http.Server
 }
 
-// New creates a new FastDL server instance.
-// NOTE: This is not used when FastDL uses nginx (which is the default).
-// Kept for potential future use or if built-in server is re-enabled.
+// New creates a new FastDL server instance. This is used when the FastDL mode
+// is set to "builtin", serving the files of each server from its FastDL
+// directory without nginx.
 func New(m *server.Manager) *FastDLServer {
-	cfg := config.Get().System
-	fastdlCfg := cfg.FastDL
-
-	handler := NewHandler(m, cfg.Data, fastdlCfg)
+	fastdlCfg := config.Get().System.FastDL
 
 	return &FastDLServer{
-		manager:  m,
-		BasePath: cfg.Data,
-		ReadOnly: false, // Default
-		Listen:   "0.0.0.0:" + strconv.Itoa(fastdlCfg.Port),
-		Handler:  handler,
+		manager: m,
+		Listen:  "0.0.0.0:" + strconv.Itoa(fastdlCfg.Port),
+		Handler: NewHandler(m, fastdlCfg),
 	}
 }
 
@@ -75,11 +96,13 @@ func (s *FastDLServer) Run() error {
 
 	// Create HTTP server
 	s.server = &http.Server{
-		Addr:    s.Listen,
-		Handler: mux,
+		Addr:              s.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: time.Second * 10,
+		IdleTimeout:       time.Minute,
 	}
 
-	// FastDL uses HTTP only (no SSL) - nginx handles SSL if needed
+	// FastDL uses HTTP only (no SSL) since game clients download over plain HTTP
 	log.WithField("listen", s.Listen).Info("fastdl server listening for HTTP connections")
 
 	// Start HTTP server
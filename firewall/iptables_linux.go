@@ -0,0 +1,425 @@
+//go:build linux
+
+package firewall
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/apex/log"
+
+	"github.com/priyxstudio/propel/internal/database"
+	"github.com/priyxstudio/propel/internal/models"
+)
+
+// iptablesBackend applies firewall rules by running iptables and ip6tables, a
+// rule is inserted into the raw PREROUTING chain for each protocol it uses
+type iptablesBackend struct{}
+
+func (b *iptablesBackend) name() string {
+	return "iptables"
+}
+
+// executeIptables executes an iptables or ip6tables command with explicit arguments to prevent command injection
+func (b *iptablesBackend) executeIptables(binary string, args ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, binary, args...)
+
+	// Capture stderr to include in error messages
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	cmd.Stdout = nil
+
+	err := cmd.Run()
+	if err != nil {
+		stderrStr := strings.TrimSpace(stderr.String())
+		cmdStr := strings.Join(append([]string{binary}, args...), " ")
+
+		if ctx.Err() == context.DeadlineExceeded {
+			if stderrStr != "" {
+				return errors.Wrapf(err, "iptables command timed out after 10 seconds: %s", stderrStr)
+			}
+			return errors.Wrap(err, "iptables command timed out after 10 seconds")
+		}
+		if ctx.Err() == context.Canceled {
+			if stderrStr != "" {
+				return errors.Wrapf(err, "iptables command was cancelled: %s", stderrStr)
+			}
+			return errors.Wrap(err, "iptables command was cancelled")
+		}
+
+		if exitError, ok := err.(*exec.ExitError); ok {
+			if exitError.ProcessState != nil {
+				if !exitError.ProcessState.Exited() {
+					if stderrStr != "" {
+						return errors.Wrapf(err, "iptables command was killed (likely permission issue or system limit): %s", stderrStr)
+					}
+					return errors.Wrap(err, "iptables command was killed (likely permission issue or system limit)")
+				}
+				// Include the actual command and stderr in the error
+				if stderrStr != "" {
+					log.WithFields(log.Fields{
+						"command": cmdStr,
+						"stderr":  stderrStr,
+						"exit":    exitError.ExitCode(),
+					}).Error("iptables command failed")
+					return errors.Wrapf(err, "iptables command failed (exit code: %d): %s", exitError.ExitCode(), stderrStr)
+				}
+				log.WithFields(log.Fields{
+					"command": cmdStr,
+					"exit":    exitError.ExitCode(),
+				}).Error("iptables command failed")
+				return errors.Wrapf(err, "iptables command failed (exit code: %d)", exitError.ExitCode())
+			}
+		}
+
+		if stderrStr != "" {
+			log.WithFields(log.Fields{
+				"command": cmdStr,
+				"stderr":  stderrStr,
+			}).Error("iptables command failed")
+			return errors.Wrapf(err, "iptables command failed: %s", stderrStr)
+		}
+		log.WithField("command", cmdStr).Error("iptables command failed")
+		return errors.Wrap(err, "iptables command failed")
+	}
+	return nil
+}
+
+// iptablesBinary returns the command used to manage a rule, rules for IPv6
+// addresses are managed with ip6tables
+func iptablesBinary(rule *models.FirewallRule) string {
+	if isIPv6(rule.RemoteIP) {
+		return "ip6tables"
+	}
+	return "iptables"
+}
+
+// dportArg returns the --dport argument of a rule, either a single port or a
+// range in the first:last form
+func dportArg(rule *models.FirewallRule) string {
+	if rule.LastPort() != rule.ServerPort {
+		return fmt.Sprintf("%d:%d", rule.ServerPort, rule.LastPort())
+	}
+	return strconv.Itoa(rule.ServerPort)
+}
+
+// ruleTarget returns the iptables target of a rule
+func ruleTarget(rule *models.FirewallRule) string {
+	if rule.Type == models.FirewallRuleTypeAllow {
+		// For allow rules, we use ACCEPT to let the packet continue
+		return "ACCEPT"
+	}
+	// For blocking, use DROP to stop the packet before DNAT
+	return "DROP"
+}
+
+// ruleSpec returns the match and target arguments of a rule for one protocol
+func ruleSpec(rule *models.FirewallRule, protocol string) []string {
+	return []string{
+		"-p", protocol,
+		"-s", rule.RemoteIP,
+		"--dport", dportArg(rule),
+		"-j", ruleTarget(rule),
+	}
+}
+
+// buildIptablesRuleArgs builds iptables command arguments to prevent command injection
+// Validates all inputs before building the command
+func (b *iptablesBackend) buildIptablesRuleArgs(rule *models.FirewallRule, protocol string, action string) ([]string, error) {
+	if err := validateRule(rule); err != nil {
+		return nil, err
+	}
+	if !slices.Contains(ruleProtocols(rule), protocol) {
+		return nil, errors.Errorf("protocol %s is not used by rule %d", protocol, rule.ID)
+	}
+
+	// For Docker containers, traffic is DNAT'd in PREROUTING (nat table)
+	// This means the destination port changes in FORWARD chain
+	// We need to match on the original destination port BEFORE DNAT
+	// Solution: Use PREROUTING in the raw table to match original port before DNAT
+	table := "raw"
+	chain := "PREROUTING"
+
+	// Build arguments array
+	args := []string{"-t", table}
+
+	// For INSERT, try priority-based positioning, otherwise append
+	if action == "-I" {
+		// Calculate position based on priority
+		position := b.calculateRulePosition(rule, protocol)
+		if position == 1 {
+			// Insert at the beginning (position 1)
+			args = append(args, "-I", chain)
+		} else if position > 1 {
+			// Insert at specific position
+			args = append(args, "-I", chain, fmt.Sprintf("%d", position))
+		} else {
+			// Position calculation failed, use append instead
+			args = append(args, "-A", chain)
+		}
+	} else {
+		// For other actions (like -D), use standard format
+		args = append(args, action, chain)
+	}
+
+	// Add rule parameters
+	return append(args, ruleSpec(rule, protocol)...), nil
+}
+
+// getChainLength gets the actual number of rules in the raw/PREROUTING chain from iptables
+// We use raw/PREROUTING for both allow and block rules to match original destination port before DNAT
+func (b *iptablesBackend) getChainLength(binary string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, binary, "-t", "raw", "-S", "PREROUTING")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = nil
+
+	if err := cmd.Run(); err != nil {
+		return 0, errors.Wrap(err, "failed to get chain length")
+	}
+
+	// Every rule is printed on its own line starting with -A, the policy of the
+	// chain is printed on the first line
+	length := 0
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if strings.HasPrefix(line, "-A ") {
+			length++
+		}
+	}
+	return length, nil
+}
+
+// calculateRulePosition calculates where to insert a rule based on its priority
+// Returns 0 if we should append instead of insert at a specific position
+func (b *iptablesBackend) calculateRulePosition(rule *models.FirewallRule, protocol string) int {
+	binary := iptablesBinary(rule)
+
+	// Get actual chain length from iptables
+	chainLength, err := b.getChainLength(binary)
+	if err != nil {
+		log.WithError(err).Debug("failed to get chain length, will append rule")
+		return 0 // Append instead of insert
+	}
+
+	// If chain is empty, insert at position 1 (beginning)
+	if chainLength == 0 {
+		return 1
+	}
+
+	// Get all rules from database for the same server, only the rules that are in
+	// the same chain, use the same protocol and overlap the ports of this rule are
+	// counted below
+	var existingRules []models.FirewallRule
+	database.Instance().Where("server_uuid = ? AND deleted_at IS NULL", rule.ServerUUID).
+		Order("priority ASC, created_at ASC").
+		Find(&existingRules)
+
+	// Count how many existing rules have priority <= our rule's priority
+	// These should be inserted before our rule
+	position := 1
+	for _, r := range existingRules {
+		// Skip the current rule if we're updating it
+		if r.ID == rule.ID {
+			continue
+		}
+		if iptablesBinary(&r) != binary || !slices.Contains(ruleProtocols(&r), protocol) {
+			continue
+		}
+		if r.ServerPort > rule.LastPort() || r.LastPort() < rule.ServerPort {
+			continue
+		}
+		if r.Priority < rule.Priority || (r.Priority == rule.Priority && r.CreatedAt.Before(rule.CreatedAt)) {
+			position++
+		}
+	}
+
+	// Ensure position doesn't exceed chain length + 1 (for insertion at end)
+	// If position calculation seems off, just append
+	if position > chainLength+1 {
+		log.WithFields(log.Fields{
+			"calculated_position": position,
+			"chain_length":        chainLength,
+			"rule_id":             rule.ID,
+			"protocol":            protocol,
+		}).Debug("calculated position exceeds chain length, will append instead")
+		return 0 // Append instead of insert
+	}
+
+	return position
+}
+
+// removeRule removes a firewall rule from iptables
+func (b *iptablesBackend) removeRule(rule *models.FirewallRule) error {
+	// Validate inputs
+	if err := validateRule(rule); err != nil {
+		return err
+	}
+
+	// We use raw table PREROUTING for both allow and block rules, a rule for
+	// both protocols was inserted once for each of them
+	binary := iptablesBinary(rule)
+	for _, protocol := range ruleProtocols(rule) {
+		deleteArgs := append([]string{"-t", "raw", "-D", "PREROUTING"}, ruleSpec(rule, protocol)...)
+
+		if err := b.executeIptables(binary, deleteArgs...); err != nil {
+			// Log warning but don't fail - rule might not exist in iptables
+			// This can happen if iptables was manually modified or rules were cleared
+			log.WithError(err).WithFields(log.Fields{
+				"rule_id":   rule.ID,
+				"remote_ip": rule.RemoteIP,
+				"port":      dportArg(rule),
+				"protocol":  protocol,
+				"type":      rule.Type,
+			}).Warn("failed to remove firewall rule from iptables (rule may not exist in iptables)")
+			// Still continue - the rule might not exist, which is fine
+			continue
+		}
+
+		// Rule successfully removed from iptables
+		log.WithFields(log.Fields{
+			"rule_id":   rule.ID,
+			"remote_ip": rule.RemoteIP,
+			"port":      dportArg(rule),
+			"protocol":  protocol,
+			"type":      rule.Type,
+		}).Debug("firewall rule removed from iptables")
+	}
+
+	return nil
+}
+
+// applyRule applies a firewall rule to iptables
+func (b *iptablesBackend) applyRule(rule *models.FirewallRule) error {
+	// Validate inputs before building commands
+	if err := validateRule(rule); err != nil {
+		return err
+	}
+
+	binary := iptablesBinary(rule)
+	for _, protocol := range ruleProtocols(rule) {
+		// First, check if rule already exists in iptables (to avoid duplicates)
+		// Use -C (check) which returns 0 if rule exists, 1 if it doesn't
+		checkArgs := append([]string{"-t", "raw", "-C", "PREROUTING"}, ruleSpec(rule, protocol)...)
+
+		// Execute check silently - we expect it to fail (exit code 1) if rule doesn't exist
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		cmd := exec.CommandContext(ctx, binary, checkArgs...)
+		cmd.Stdout = nil
+		cmd.Stderr = nil
+		checkErr := cmd.Run()
+		cancel()
+
+		if checkErr == nil {
+			// Rule already exists, skip insertion
+			log.WithFields(log.Fields{
+				"rule_id":   rule.ID,
+				"remote_ip": rule.RemoteIP,
+				"port":      dportArg(rule),
+				"protocol":  protocol,
+				"type":      rule.Type,
+			}).Debug("firewall rule already exists in iptables, skipping")
+			continue
+		}
+		// If check failed (exit code 1), rule doesn't exist - this is expected, continue with insertion
+
+		// Build and insert the rule with priority consideration
+		insertArgs, err := b.buildIptablesRuleArgs(rule, protocol, "-I")
+		if err != nil {
+			return errors.Wrap(err, "failed to build iptables rule arguments")
+		}
+
+		log.WithFields(log.Fields{
+			"rule_id": rule.ID,
+			"command": strings.Join(append([]string{binary}, insertArgs...), " "),
+		}).Debug("applying firewall rule to iptables")
+
+		if err := b.executeIptables(binary, insertArgs...); err != nil {
+			return errors.Wrapf(err, "failed to apply firewall rule %d", rule.ID)
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"rule_id":   rule.ID,
+		"server":    rule.ServerUUID,
+		"remote_ip": rule.RemoteIP,
+		"port":      dportArg(rule),
+		"protocol":  rule.Protocol,
+		"type":      rule.Type,
+		"priority":  rule.Priority,
+	}).Debug("firewall rule applied")
+
+	return nil
+}
+
+// replaceRules applies the rules of a server one by one, rules that are already
+// in iptables are left in place
+func (b *iptablesBackend) replaceRules(serverUUID string, rules []models.FirewallRule) (int, error) {
+	applied := 0
+	for _, rule := range rules {
+		if err := b.applyRule(&rule); err != nil {
+			log.WithError(err).WithField("rule_id", rule.ID).Warn("failed to apply firewall rule during sync")
+			// Continue with other rules
+			continue
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+// removeStoredRules removes every rule stored in the database, including deleted
+// ones, that is still present in iptables. This is used when switching to the
+// nftables backend so that the rules applied by this backend do not remain.
+func (b *iptablesBackend) removeStoredRules() {
+	var rules []models.FirewallRule
+	if err := database.Instance().Unscoped().Find(&rules).Error; err != nil {
+		log.WithError(err).Warn("firewall: failed to fetch firewall rules to remove from iptables")
+		return
+	}
+
+	removed := 0
+	for _, rule := range rules {
+		if err := validateRule(&rule); err != nil {
+			continue
+		}
+		binary := iptablesBinary(&rule)
+		for _, protocol := range ruleProtocols(&rule) {
+			spec := ruleSpec(&rule, protocol)
+			// Only rules that are present are removed, so that the rules which
+			// were never applied or are already gone do not log a warning.
+			if err := b.executeIptables(binary, append([]string{"-t", "raw", "-C", "PREROUTING"}, spec...)...); err != nil {
+				continue
+			}
+			if err := b.executeIptables(binary, append([]string{"-t", "raw", "-D", "PREROUTING"}, spec...)...); err != nil {
+				log.WithError(err).WithField("rule_id", rule.ID).Warn("firewall: failed to remove firewall rule from iptables")
+				continue
+			}
+			removed++
+		}
+	}
+	if removed > 0 {
+		log.WithField("removed", removed).Info("firewall: removed rules applied with iptables before switching to nftables")
+	}
+}
+
+// removeServer removes every rule of a server from iptables
+func (b *iptablesBackend) removeServer(serverUUID string, rules []models.FirewallRule) error {
+	for _, rule := range rules {
+		if err := b.removeRule(&rule); err != nil {
+			log.WithError(err).WithField("rule_id", rule.ID).Warn("failed to remove firewall rule from iptables during server deletion")
+		}
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package firewall
 
 import (
 	"net"
+	"slices"
 	"sync"
 
 	"emperror.dev/errors"
@@ -12,7 +13,7 @@ import (
 	"github.com/priyxstudio/propel/internal/models"
 )
 
-// Manager handles firewall rule management and iptables operations
+// Manager handles firewall rule management and iptables or nftables operations
 type Manager struct {
 	mu sync.RWMutex
 }
@@ -22,16 +23,64 @@ func NewManager() *Manager {
 	return &Manager{}
 }
 
-// executeIptables is now platform-specific, see manager_linux.go
+// executeIptables is now platform-specific, see iptables_linux.go
 
-// validateProtocol validates that protocol is tcp or udp
+// validateProtocol validates that protocol is tcp, udp or both
 func validateProtocol(protocol string) error {
-	if protocol != "tcp" && protocol != "udp" {
-		return errors.Errorf("invalid protocol: %s (must be 'tcp' or 'udp')", protocol)
+	if protocol != "tcp" && protocol != "udp" && protocol != "both" {
+		return errors.Errorf("invalid protocol: %s (must be 'tcp', 'udp' or 'both')", protocol)
 	}
 	return nil
 }
 
+// ruleProtocols returns the protocols a rule is applied for, a rule for both
+// protocols is applied once for tcp and once for udp
+func ruleProtocols(rule *models.FirewallRule) []string {
+	switch rule.Protocol {
+	case "", "tcp":
+		return []string{"tcp"}
+	case "both":
+		return []string{"tcp", "udp"}
+	}
+	return []string{rule.Protocol}
+}
+
+// isIPv6 returns true if the remote IP of a rule is an IPv6 address or network
+func isIPv6(remote string) bool {
+	if ip, _, err := net.ParseCIDR(remote); err == nil {
+		return ip.To4() == nil
+	}
+	if ip := net.ParseIP(remote); ip != nil {
+		return ip.To4() == nil
+	}
+	return false
+}
+
+// validatePorts validates the port or port range of a rule
+func validatePorts(rule *models.FirewallRule) error {
+	if rule.ServerPort < 1 || rule.ServerPort > 65535 {
+		return errors.Errorf("invalid port: %d (must be between 1 and 65535)", rule.ServerPort)
+	}
+	if rule.ServerPortEnd != 0 && (rule.ServerPortEnd < rule.ServerPort || rule.ServerPortEnd > 65535) {
+		return errors.Errorf("invalid port range: %d-%d (the end must be between the start and 65535)", rule.ServerPort, rule.ServerPortEnd)
+	}
+	return nil
+}
+
+// validateRule validates the type, remote IP, protocol and ports of a rule
+func validateRule(rule *models.FirewallRule) error {
+	if rule.Type != models.FirewallRuleTypeAllow && rule.Type != models.FirewallRuleTypeBlock {
+		return errors.Errorf("invalid rule type: %s (must be 'allow' or 'block')", rule.Type)
+	}
+	if err := ValidateIP(rule.RemoteIP); err != nil {
+		return errors.Wrap(err, "invalid remote IP")
+	}
+	if err := validateProtocol(rule.Protocol); err != nil {
+		return err
+	}
+	return validatePorts(rule)
+}
+
 // buildIptablesRuleArgs builds iptables command arguments to prevent command injection
 // Validates all inputs before building the command
 // buildIptablesRuleArgs, getChainLength, calculateRulePosition are now platform-specific
@@ -55,27 +104,21 @@ func (m *Manager) SyncRules(serverUUID string) error {
 
 	if len(rules) == 0 {
 		log.WithField("server", serverUUID).Debug("no firewall rules to sync")
-		return nil
 	}
 
-	// Apply rules in priority order (using unlocked version since we already have the lock)
-	appliedCount := 0
-	failedCount := 0
-	for _, rule := range rules {
-		if err := m.applyRuleUnlocked(&rule); err != nil {
-			log.WithError(err).WithField("rule_id", rule.ID).Warn("failed to apply firewall rule during sync")
-			failedCount++
-			// Continue with other rules
-		} else {
-			appliedCount++
-		}
+	// Replace the applied rules with the rules in priority order (using unlocked
+	// version since we already have the lock), backends that support it do this
+	// atomically
+	appliedCount, err := m.replaceRulesUnlocked(serverUUID, rules)
+	if err != nil {
+		return errors.Wrap(err, "failed to sync firewall rules")
 	}
 
 	log.WithFields(log.Fields{
 		"server":  serverUUID,
 		"total":   len(rules),
 		"applied": appliedCount,
-		"failed":  failedCount,
+		"failed":  len(rules) - appliedCount,
 	}).Info("synced firewall rules")
 
 	return nil
@@ -94,22 +137,16 @@ func (m *Manager) GetRules(serverUUID string) ([]models.FirewallRule, error) {
 
 // CreateRule creates a new firewall rule
 func (m *Manager) CreateRule(rule *models.FirewallRule) error {
-	// Validate rule type
-	if rule.Type != models.FirewallRuleTypeAllow && rule.Type != models.FirewallRuleTypeBlock {
-		return errors.Errorf("invalid rule type: %s (must be 'allow' or 'block')", rule.Type)
-	}
-
-	// Validate protocol
+	// Validate rule
 	if rule.Protocol == "" {
 		rule.Protocol = "tcp"
 	}
-	if rule.Protocol != "tcp" && rule.Protocol != "udp" {
-		return errors.Errorf("invalid protocol: %s (must be 'tcp' or 'udp')", rule.Protocol)
+	// A range of a single port is stored as that port
+	if rule.ServerPortEnd == rule.ServerPort {
+		rule.ServerPortEnd = 0
 	}
-
-	// Validate port range
-	if rule.ServerPort < 1 || rule.ServerPort > 65535 {
-		return errors.Errorf("invalid port: %d (must be between 1 and 65535)", rule.ServerPort)
+	if err := validateRule(rule); err != nil {
+		return err
 	}
 
 	// Set default priority if not set
@@ -145,40 +182,46 @@ func (m *Manager) UpdateRule(ruleID uint, updates *models.FirewallRule) error {
 		return errors.Wrap(err, "failed to fetch firewall rule")
 	}
 
-	// Remove old rule from iptables
-	if err := m.RemoveRule(&existingRule); err != nil {
-		log.WithError(err).Warn("failed to remove old firewall rule during update")
-	}
-
 	// Update fields
+	updatedRule := existingRule
 	if updates.RemoteIP != "" {
-		existingRule.RemoteIP = updates.RemoteIP
+		updatedRule.RemoteIP = updates.RemoteIP
 	}
 	if updates.ServerPort != 0 {
-		existingRule.ServerPort = updates.ServerPort
+		// Changing the port replaces the whole range
+		updatedRule.ServerPort = updates.ServerPort
+		updatedRule.ServerPortEnd = updates.ServerPortEnd
+	}
+	if updatedRule.ServerPortEnd == updatedRule.ServerPort {
+		updatedRule.ServerPortEnd = 0
 	}
 	if updates.Priority != 0 {
-		existingRule.Priority = updates.Priority
+		updatedRule.Priority = updates.Priority
 	}
 	if updates.Type != "" {
-		existingRule.Type = updates.Type
+		updatedRule.Type = updates.Type
 	}
 	if updates.Protocol != "" {
-		existingRule.Protocol = updates.Protocol
+		updatedRule.Protocol = updates.Protocol
 	}
 
-	// Validate updated rule
-	if existingRule.Type != models.FirewallRuleTypeAllow && existingRule.Type != models.FirewallRuleTypeBlock {
-		return errors.Errorf("invalid rule type: %s", existingRule.Type)
+	// Validate updated rule before the old one is removed
+	if err := validateRule(&updatedRule); err != nil {
+		return err
+	}
+
+	// Remove old rule from iptables
+	if err := m.RemoveRule(&existingRule); err != nil {
+		log.WithError(err).Warn("failed to remove old firewall rule during update")
 	}
 
 	// Save to database
-	if err := database.Instance().Save(&existingRule).Error; err != nil {
+	if err := database.Instance().Save(&updatedRule).Error; err != nil {
 		return errors.Wrap(err, "failed to update firewall rule")
 	}
 
 	// Apply new rule to iptables
-	if err := m.ApplyRule(&existingRule); err != nil {
+	if err := m.ApplyRule(&updatedRule); err != nil {
 		return errors.Wrap(err, "failed to apply updated firewall rule to iptables")
 	}
 
@@ -245,10 +288,13 @@ func (m *Manager) GetRuleByID(ruleID uint) (*models.FirewallRule, error) {
 	return &rule, nil
 }
 
-// GetRulesByPort returns all firewall rules for a specific port
+// GetRulesByPort returns all firewall rules for a specific port, including the
+// rules for a port range containing it
 func (m *Manager) GetRulesByPort(serverUUID string, port int) ([]models.FirewallRule, error) {
 	var rules []models.FirewallRule
-	if err := database.Instance().Where("server_uuid = ? AND server_port = ? AND deleted_at IS NULL", serverUUID, port).
+	if err := database.Instance().
+		Where("server_uuid = ? AND deleted_at IS NULL", serverUUID).
+		Where("server_port = ? OR (server_port <= ? AND server_port_end >= ?)", port, port, port).
 		Order("priority ASC, created_at ASC").
 		Find(&rules).Error; err != nil {
 		return nil, errors.Wrap(err, "failed to fetch firewall rules")
@@ -269,8 +315,8 @@ func (m *Manager) CleanupInvalidPortRules(serverUUID string, validPorts map[int]
 
 	removedCount := 0
 	for _, rule := range rules {
-		// Check if the port is still valid
-		if !validPorts[rule.ServerPort] {
+		// Check if every port of the rule is still valid
+		if !portsAllocated(rule, validPorts) {
 			// Remove from iptables (lock already held, use unlocked version)
 			if err := m.removeRuleUnlocked(&rule); err != nil {
 				log.WithError(err).WithField("rule_id", rule.ID).Warn("failed to remove invalid firewall rule from iptables")
@@ -294,6 +340,17 @@ func (m *Manager) CleanupInvalidPortRules(serverUUID string, validPorts map[int]
 	return nil
 }
 
+// portsAllocated returns true if every port a rule applies to is one of the
+// valid ports
+func portsAllocated(rule models.FirewallRule, validPorts map[int]bool) bool {
+	for port := rule.ServerPort; port <= rule.LastPort(); port++ {
+		if !validPorts[port] {
+			return false
+		}
+	}
+	return true
+}
+
 // DeleteAllRulesForServer deletes all firewall rules for a server
 func (m *Manager) DeleteAllRulesForServer(serverUUID string) error {
 	m.mu.Lock()
@@ -305,11 +362,9 @@ func (m *Manager) DeleteAllRulesForServer(serverUUID string) error {
 		return errors.Wrap(err, "failed to fetch firewall rules for deletion")
 	}
 
-	// Remove each rule from iptables
-	for _, rule := range rules {
-		if err := m.RemoveRule(&rule); err != nil {
-			log.WithError(err).WithField("rule_id", rule.ID).Warn("failed to remove firewall rule from iptables during server deletion")
-		}
+	// Remove the rules from the firewall (lock already held, use unlocked version)
+	if err := m.removeServerRulesUnlocked(serverUUID, rules); err != nil {
+		log.WithError(err).WithField("server", serverUUID).Warn("failed to remove firewall rules during server deletion")
 	}
 
 	// Soft delete all rules from database
@@ -354,19 +409,11 @@ func (m *Manager) RebuildAllRules() error {
 	totalApplied := 0
 	totalFailed := 0
 	for serverUUID, rules := range serverRules {
-		appliedCount := 0
-		failedCount := 0
-		for _, rule := range rules {
-			if err := m.applyRuleUnlocked(&rule); err != nil {
-				log.WithError(err).WithFields(log.Fields{
-					"rule_id": rule.ID,
-					"server":  serverUUID,
-				}).Warn("failed to apply firewall rule during rebuild")
-				failedCount++
-			} else {
-				appliedCount++
-			}
+		appliedCount, err := m.replaceRulesUnlocked(serverUUID, rules)
+		if err != nil {
+			log.WithError(err).WithField("server", serverUUID).Warn("failed to apply firewall rules during rebuild")
 		}
+		failedCount := len(rules) - appliedCount
 		totalApplied += appliedCount
 		totalFailed += failedCount
 		log.WithFields(log.Fields{
@@ -386,6 +433,35 @@ func (m *Manager) RebuildAllRules() error {
 	return nil
 }
 
+// Allows returns true if a connection from the IP address using the protocol is
+// allowed by the rules, which must be ordered by priority. The first rule that
+// matches decides, in the same way as the iptables chain the rules are applied
+// to, and connections that match no rule are allowed.
+func Allows(rules []models.FirewallRule, ip net.IP, protocol string) bool {
+	for _, rule := range rules {
+		if !slices.Contains(ruleProtocols(&rule), protocol) {
+			continue
+		}
+		if !ruleMatchesIP(rule.RemoteIP, ip) {
+			continue
+		}
+		return rule.Type == models.FirewallRuleTypeAllow
+	}
+	return true
+}
+
+// ruleMatchesIP returns true if the IP address is the remote IP of a rule, or
+// falls inside it when the rule uses CIDR notation.
+func ruleMatchesIP(remote string, ip net.IP) bool {
+	if _, network, err := net.ParseCIDR(remote); err == nil {
+		return network.Contains(ip)
+	}
+	if r := net.ParseIP(remote); r != nil {
+		return r.Equal(ip)
+	}
+	return false
+}
+
 // ValidateIP validates an IP address or CIDR notation
 func ValidateIP(ip string) error {
 	if ip == "" {
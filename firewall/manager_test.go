@@ -0,0 +1,92 @@
+package firewall
+
+import (
+	"net"
+	"testing"
+
+	"github.com/priyxstudio/propel/environment"
+	"github.com/priyxstudio/propel/internal/models"
+)
+
+func TestValidateRule(t *testing.T) {
+	rule := func(protocol string, start, end int) *models.FirewallRule {
+		return &models.FirewallRule{
+			RemoteIP:      "2001:db8::/32",
+			ServerPort:    start,
+			ServerPortEnd: end,
+			Type:          models.FirewallRuleTypeBlock,
+			Protocol:      protocol,
+		}
+	}
+	tests := []struct {
+		name    string
+		rule    *models.FirewallRule
+		wantErr bool
+	}{
+		{"single port", rule("tcp", 25565, 0), false},
+		{"both protocols", rule("both", 25565, 0), false},
+		{"port range", rule("udp", 27015, 27020), false},
+		{"invalid protocol", rule("icmp", 25565, 0), true},
+		{"reversed range", rule("tcp", 27020, 27015), true},
+		{"range past the last port", rule("tcp", 65530, 65536), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateRule(tt.rule); (err != nil) != tt.wantErr {
+				t.Errorf("validateRule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsIPv6(t *testing.T) {
+	for remote, want := range map[string]bool{
+		"203.0.113.7":    false,
+		"203.0.113.0/24": false,
+		"2001:db8::1":    true,
+		"2001:db8::/32":  true,
+		"::ffff:1.2.3.4": false,
+	} {
+		if got := isIPv6(remote); got != want {
+			t.Errorf("isIPv6(%q) = %v, want %v", remote, got, want)
+		}
+	}
+}
+
+func TestAllows(t *testing.T) {
+	rules := []models.FirewallRule{
+		{RemoteIP: "203.0.113.7", Type: models.FirewallRuleTypeAllow, Protocol: "both"},
+		{RemoteIP: "203.0.113.0/24", Type: models.FirewallRuleTypeBlock, Protocol: "tcp"},
+		{RemoteIP: "2001:db8::/32", Type: models.FirewallRuleTypeBlock, Protocol: "udp"},
+	}
+	tests := []struct {
+		ip       string
+		protocol string
+		want     bool
+	}{
+		{"203.0.113.7", "udp", true},
+		{"203.0.113.8", "tcp", false},
+		{"203.0.113.8", "udp", true},
+		{"2001:db8::1", "udp", false},
+		{"2001:db9::1", "udp", true},
+	}
+	for _, tt := range tests {
+		if got := Allows(rules, net.ParseIP(tt.ip), tt.protocol); got != tt.want {
+			t.Errorf("Allows(%s, %s) = %v, want %v", tt.ip, tt.protocol, got, tt.want)
+		}
+	}
+}
+
+func TestValidateRuleForServer(t *testing.T) {
+	allocations := &environment.Allocations{
+		Mappings: map[string][]int{"0.0.0.0": {27015, 27016, 27017}},
+	}
+	rule := &models.FirewallRule{ServerPort: 27015, ServerPortEnd: 27017}
+	if !ValidateRuleForServer(allocations, rule) {
+		t.Error("expected a range of allocated ports to be valid")
+	}
+	rule.ServerPortEnd = 27018
+	if ValidateRuleForServer(allocations, rule) {
+		t.Error("expected a range containing a port that is not allocated to be invalid")
+	}
+}
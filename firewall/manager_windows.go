@@ -35,4 +35,14 @@ func (m *Manager) removeRuleUnlocked(rule *models.FirewallRule) error {
 	return nil
 }
 
+// replaceRulesUnlocked replaces the rules of a server without locking.
+func (m *Manager) replaceRulesUnlocked(serverUUID string, rules []models.FirewallRule) (int, error) {
+	log.Debug("firewall management is not currently supported on Windows (no-op)")
+	return len(rules), nil
+}
 
+// removeServerRulesUnlocked removes every rule of a server without locking.
+func (m *Manager) removeServerRulesUnlocked(serverUUID string, rules []models.FirewallRule) error {
+	log.Debug("firewall management is not currently supported on Windows (no-op)")
+	return nil
+}
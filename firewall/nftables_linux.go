@@ -0,0 +1,334 @@
+//go:build linux
+
+package firewall
+
+import (
+	"net"
+	"sort"
+	"strconv"
+
+	"emperror.dev/errors"
+	"github.com/apex/log"
+	"github.com/google/nftables"
+	"github.com/google/nftables/binaryutil"
+	"github.com/google/nftables/expr"
+	"github.com/google/nftables/userdata"
+	"golang.org/x/sys/unix"
+
+	"github.com/priyxstudio/propel/internal/database"
+	"github.com/priyxstudio/propel/internal/models"
+)
+
+// The names of the nftables objects owned by the daemon.
+const (
+	nftablesTable       = "propel"
+	nftablesBaseChain   = "prerouting"
+	nftablesChainPrefix = "server-"
+)
+
+// nftablesBackend applies firewall rules over netlink. Every server has its own
+// chain in the inet table of the daemon which the prerouting chain jumps to, the
+// chain of a server is replaced in a single transaction whenever its rules
+// change so that the kernel never sees a partial set of rules.
+//
+// The prerouting chain uses the raw priority so that, like the raw PREROUTING
+// chain used by the iptables backend, the original destination port is matched
+// before Docker rewrites it.
+type nftablesBackend struct {
+	table *nftables.Table
+	base  *nftables.Chain
+}
+
+// newNftablesBackend creates the table and prerouting chain of the daemon if they
+// do not exist yet, which also checks that nftables can be used. It also returns
+// true if the table did not exist before.
+func newNftablesBackend() (*nftablesBackend, bool, error) {
+	table := &nftables.Table{Family: nftables.TableFamilyINet, Name: nftablesTable}
+	policy := nftables.ChainPolicyAccept
+	b := &nftablesBackend{
+		table: table,
+		base: &nftables.Chain{
+			Name:     nftablesBaseChain,
+			Table:    table,
+			Type:     nftables.ChainTypeFilter,
+			Hooknum:  nftables.ChainHookPrerouting,
+			Priority: nftables.ChainPriorityRaw,
+			Policy:   &policy,
+		},
+	}
+
+	c, err := nftables.New()
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed to open nftables connection")
+	}
+	_, err = c.ListTableOfFamily(table.Name, table.Family)
+	created := err != nil
+	c.AddTable(b.table)
+	c.AddChain(b.base)
+	if err := c.Flush(); err != nil {
+		return nil, false, errors.Wrap(err, "failed to create nftables table")
+	}
+	return b, created, nil
+}
+
+func (b *nftablesBackend) name() string {
+	return "nftables"
+}
+
+// serverChain returns the chain holding the rules of a server
+func (b *nftablesBackend) serverChain(serverUUID string) *nftables.Chain {
+	return &nftables.Chain{Name: nftablesChainPrefix + serverUUID, Table: b.table}
+}
+
+// jumpRule returns the rule of the prerouting chain that jumps to the chain of a
+// server, or nil if there is none. Jump rules carry the UUID of their server as
+// their comment.
+func (b *nftablesBackend) jumpRule(c *nftables.Conn, serverUUID string) (*nftables.Rule, error) {
+	rules, err := c.GetRules(b.table, b.base)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list nftables rules")
+	}
+	for _, r := range rules {
+		if comment, ok := userdata.GetString(r.UserData, userdata.TypeComment); ok && comment == serverUUID {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
+
+// loadServerRules returns the valid rules of a server stored in the database,
+// ordered by priority
+func loadServerRules(serverUUID string) ([]models.FirewallRule, error) {
+	var rules []models.FirewallRule
+	if err := database.Instance().Where("server_uuid = ? AND deleted_at IS NULL", serverUUID).
+		Order("priority ASC, created_at ASC").
+		Find(&rules).Error; err != nil {
+		return nil, errors.Wrap(err, "failed to fetch firewall rules")
+	}
+	valid := rules[:0]
+	for _, rule := range rules {
+		if err := validateRule(&rule); err == nil {
+			valid = append(valid, rule)
+		}
+	}
+	return valid, nil
+}
+
+// applyRule rebuilds the chain of the server of the rule, the rule is added in
+// order of priority if it has not been stored yet
+func (b *nftablesBackend) applyRule(rule *models.FirewallRule) error {
+	rules, err := loadServerRules(rule.ServerUUID)
+	if err != nil {
+		return err
+	}
+	found := false
+	for i := range rules {
+		if rules[i].ID == rule.ID {
+			rules[i] = *rule
+			found = true
+		}
+	}
+	if !found {
+		rules = append(rules, *rule)
+		sort.SliceStable(rules, func(i, j int) bool {
+			return rules[i].Priority < rules[j].Priority
+		})
+	}
+	if _, err := b.replaceRules(rule.ServerUUID, rules); err != nil {
+		return errors.Wrapf(err, "failed to apply firewall rule %d", rule.ID)
+	}
+	return nil
+}
+
+// removeRule rebuilds the chain of the server of the rule without it
+func (b *nftablesBackend) removeRule(rule *models.FirewallRule) error {
+	rules, err := loadServerRules(rule.ServerUUID)
+	if err != nil {
+		return err
+	}
+	remaining := rules[:0]
+	for _, r := range rules {
+		if r.ID != rule.ID {
+			remaining = append(remaining, r)
+		}
+	}
+	if _, err := b.replaceRules(rule.ServerUUID, remaining); err != nil {
+		return errors.Wrapf(err, "failed to remove firewall rule %d", rule.ID)
+	}
+	return nil
+}
+
+// replaceRules atomically replaces the chain of a server with the rules, the
+// chain is removed when there are no rules left
+func (b *nftablesBackend) replaceRules(serverUUID string, rules []models.FirewallRule) (int, error) {
+	if len(rules) == 0 {
+		return 0, b.removeServer(serverUUID, nil)
+	}
+
+	c, err := nftables.New()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to open nftables connection")
+	}
+	jump, err := b.jumpRule(c, serverUUID)
+	if err != nil {
+		return 0, err
+	}
+
+	chain := b.serverChain(serverUUID)
+	c.AddTable(b.table)
+	c.AddChain(b.base)
+	c.AddChain(chain)
+	c.FlushChain(chain)
+	for _, rule := range rules {
+		exprs, err := ruleExprs(&rule)
+		if err != nil {
+			return 0, errors.Wrapf(err, "failed to build firewall rule %d", rule.ID)
+		}
+		for _, e := range exprs {
+			c.AddRule(&nftables.Rule{
+				Table:    b.table,
+				Chain:    chain,
+				Exprs:    e,
+				UserData: userdata.AppendString(nil, userdata.TypeComment, "rule "+strconv.FormatUint(uint64(rule.ID), 10)),
+			})
+		}
+	}
+	if jump == nil {
+		c.AddRule(&nftables.Rule{
+			Table:    b.table,
+			Chain:    b.base,
+			Exprs:    []expr.Any{&expr.Verdict{Kind: expr.VerdictJump, Chain: chain.Name}},
+			UserData: userdata.AppendString(nil, userdata.TypeComment, serverUUID),
+		})
+	}
+	if err := c.Flush(); err != nil {
+		return 0, errors.Wrap(err, "failed to replace nftables rules")
+	}
+
+	log.WithFields(log.Fields{
+		"server": serverUUID,
+		"rules":  len(rules),
+	}).Debug("replaced nftables chain of server")
+
+	return len(rules), nil
+}
+
+// removeServer removes the chain of a server and the rule jumping to it
+func (b *nftablesBackend) removeServer(serverUUID string, _ []models.FirewallRule) error {
+	c, err := nftables.New()
+	if err != nil {
+		return errors.Wrap(err, "failed to open nftables connection")
+	}
+	jump, err := b.jumpRule(c, serverUUID)
+	if err != nil {
+		return err
+	}
+	chain := b.serverChain(serverUUID)
+	if _, err := c.ListChain(b.table, chain.Name); err != nil {
+		// The chain does not exist, so at most a stale jump rule is left
+		if jump == nil {
+			return nil
+		}
+		chain = nil
+	}
+
+	if jump != nil {
+		if err := c.DelRule(jump); err != nil {
+			return errors.Wrap(err, "failed to remove nftables jump rule")
+		}
+	}
+	if chain != nil {
+		c.FlushChain(chain)
+		c.DelChain(chain)
+	}
+	if err := c.Flush(); err != nil {
+		return errors.Wrap(err, "failed to remove nftables chain of server")
+	}
+	return nil
+}
+
+// ruleExprs returns the expressions of a rule, one list for each protocol the
+// rule is applied for
+func ruleExprs(rule *models.FirewallRule) ([][]expr.Any, error) {
+	addr, mask, err := remoteNetwork(rule.RemoteIP)
+	if err != nil {
+		return nil, err
+	}
+
+	family, offset := byte(unix.NFPROTO_IPV4), uint32(12)
+	if len(addr) == net.IPv6len {
+		family, offset = unix.NFPROTO_IPV6, 8
+	}
+	verdict := expr.VerdictDrop
+	if rule.Type == models.FirewallRuleTypeAllow {
+		verdict = expr.VerdictAccept
+	}
+
+	var out [][]expr.Any
+	for _, protocol := range ruleProtocols(rule) {
+		l4 := byte(unix.IPPROTO_TCP)
+		if protocol == "udp" {
+			l4 = unix.IPPROTO_UDP
+		}
+
+		e := []expr.Any{
+			&expr.Meta{Key: expr.MetaKeyNFPROTO, Register: 1},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{family}},
+			&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{l4}},
+			&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseNetworkHeader, Offset: offset, Len: uint32(len(addr))},
+		}
+		if ones, bits := mask.Size(); ones != bits {
+			e = append(e, &expr.Bitwise{
+				SourceRegister: 1,
+				DestRegister:   1,
+				Len:            uint32(len(addr)),
+				Mask:           mask,
+				Xor:            make([]byte, len(addr)),
+			})
+		}
+		e = append(e,
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: addr},
+			&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseTransportHeader, Offset: 2, Len: 2},
+		)
+		if rule.LastPort() == rule.ServerPort {
+			e = append(e, &expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: binaryutil.BigEndian.PutUint16(uint16(rule.ServerPort))})
+		} else {
+			e = append(e, &expr.Range{
+				Op:       expr.CmpOpEq,
+				Register: 1,
+				FromData: binaryutil.BigEndian.PutUint16(uint16(rule.ServerPort)),
+				ToData:   binaryutil.BigEndian.PutUint16(uint16(rule.LastPort())),
+			})
+		}
+		e = append(e, &expr.Counter{}, &expr.Verdict{Kind: verdict})
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// remoteNetwork returns the network address and mask of the remote IP of a rule,
+// a single address is treated as a network containing only itself. IPv4
+// addresses are returned in their 4 byte form.
+func remoteNetwork(remote string) (net.IP, net.IPMask, error) {
+	var ip net.IP
+	var mask net.IPMask
+	if _, network, err := net.ParseCIDR(remote); err == nil {
+		ip, mask = network.IP, network.Mask
+	} else if ip = net.ParseIP(remote); ip != nil {
+		mask = net.CIDRMask(128, 128)
+	} else {
+		return nil, nil, errors.Errorf("invalid IP address or CIDR: %s", remote)
+	}
+
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+		if len(mask) == net.IPv6len {
+			mask = mask[12:]
+		}
+	}
+	if len(mask) != len(ip) {
+		return nil, nil, errors.Errorf("invalid IP address or CIDR: %s", remote)
+	}
+	return ip.Mask(mask), mask, nil
+}
@@ -0,0 +1,117 @@
+package firewall
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/nftables/expr"
+	"golang.org/x/sys/unix"
+
+	"github.com/priyxstudio/propel/internal/models"
+)
+
+func TestIsIptablesNft(t *testing.T) {
+	for version, want := range map[string]bool{
+		"iptables v1.8.9 (nf_tables)\n": true,
+		"iptables v1.8.7 (legacy)\n":    false,
+		"iptables v1.6.1\n":             false,
+	} {
+		if got := isIptablesNft(version); got != want {
+			t.Errorf("isIptablesNft(%q) = %v, want %v", version, got, want)
+		}
+	}
+}
+
+func TestRemoteNetwork(t *testing.T) {
+	tests := []struct {
+		remote string
+		addr   []byte
+		mask   []byte
+	}{
+		{"203.0.113.7", []byte{203, 0, 113, 7}, []byte{255, 255, 255, 255}},
+		{"203.0.113.7/24", []byte{203, 0, 113, 0}, []byte{255, 255, 255, 0}},
+		{"2001:db8::1/32", []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, []byte{255, 255, 255, 255, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}},
+	}
+	for _, tt := range tests {
+		addr, mask, err := remoteNetwork(tt.remote)
+		if err != nil {
+			t.Fatalf("remoteNetwork(%q) error = %v", tt.remote, err)
+		}
+		if !reflect.DeepEqual([]byte(addr), tt.addr) || !reflect.DeepEqual([]byte(mask), tt.mask) {
+			t.Errorf("remoteNetwork(%q) = %v %v, want %v %v", tt.remote, addr, mask, tt.addr, tt.mask)
+		}
+	}
+	if _, _, err := remoteNetwork("example.com"); err == nil {
+		t.Error("expected an error for a remote that is not an IP address")
+	}
+}
+
+func TestRuleExprs(t *testing.T) {
+	rule := &models.FirewallRule{
+		RemoteIP:   "203.0.113.7",
+		ServerPort: 25565,
+		Type:       models.FirewallRuleTypeBlock,
+		Protocol:   "tcp",
+	}
+	exprs, err := ruleExprs(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]expr.Any{{
+		&expr.Meta{Key: expr.MetaKeyNFPROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{unix.NFPROTO_IPV4}},
+		&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{unix.IPPROTO_TCP}},
+		&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseNetworkHeader, Offset: 12, Len: 4},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{203, 0, 113, 7}},
+		&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseTransportHeader, Offset: 2, Len: 2},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{0x63, 0xdd}},
+		&expr.Counter{},
+		&expr.Verdict{Kind: expr.VerdictDrop},
+	}}
+	if !reflect.DeepEqual(exprs, want) {
+		t.Errorf("ruleExprs() = %#v, want %#v", exprs, want)
+	}
+}
+
+func TestRuleExprsRangeBothIPv6(t *testing.T) {
+	rule := &models.FirewallRule{
+		RemoteIP:      "2001:db8::/32",
+		ServerPort:    27015,
+		ServerPortEnd: 27020,
+		Type:          models.FirewallRuleTypeAllow,
+		Protocol:      "both",
+	}
+	exprs, err := ruleExprs(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exprs) != 2 {
+		t.Fatalf("expected a list of expressions for each protocol, got %d", len(exprs))
+	}
+	for i, l4 := range []byte{unix.IPPROTO_TCP, unix.IPPROTO_UDP} {
+		e := exprs[i]
+		if c := e[1].(*expr.Cmp); c.Data[0] != unix.NFPROTO_IPV6 {
+			t.Errorf("expected the rule to match IPv6, got family %d", c.Data[0])
+		}
+		if c := e[3].(*expr.Cmp); c.Data[0] != l4 {
+			t.Errorf("expected protocol %d, got %d", l4, c.Data[0])
+		}
+		if p := e[4].(*expr.Payload); p.Offset != 8 || p.Len != 16 {
+			t.Errorf("expected the IPv6 source address to be loaded, got offset %d length %d", p.Offset, p.Len)
+		}
+		if _, ok := e[5].(*expr.Bitwise); !ok {
+			t.Errorf("expected the network to be masked, got %T", e[5])
+		}
+		r, ok := e[8].(*expr.Range)
+		if !ok {
+			t.Fatalf("expected a port range, got %T", e[8])
+		}
+		if !reflect.DeepEqual(r.FromData, []byte{0x69, 0x87}) || !reflect.DeepEqual(r.ToData, []byte{0x69, 0x8c}) {
+			t.Errorf("unexpected port range %v-%v", r.FromData, r.ToData)
+		}
+		if v := e[len(e)-1].(*expr.Verdict); v.Kind != expr.VerdictAccept {
+			t.Errorf("expected an accept verdict, got %d", v.Kind)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package firewall
 
 import (
 	"github.com/priyxstudio/propel/environment"
+	"github.com/priyxstudio/propel/internal/models"
 )
 
 // ValidatePortForServer validates that a port is allocated to a server
@@ -27,4 +28,13 @@ func ValidatePortForServer(allocations *environment.Allocations, port int) bool
 	return false
 }
 
-
+// ValidateRuleForServer validates that every port a rule applies to is allocated
+// to a server
+func ValidateRuleForServer(allocations *environment.Allocations, rule *models.FirewallRule) bool {
+	for port := rule.ServerPort; port <= rule.LastPort(); port++ {
+		if !ValidatePortForServer(allocations, port) {
+			return false
+		}
+	}
+	return true
+}
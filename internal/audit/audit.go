@@ -0,0 +1,266 @@
+// Package audit keeps an append-only record of the API requests made to Wings
+// and the commands executed on the host through it.
+//
+// Entries are written as JSON lines to "audit.log" beneath the audit directory
+// in the configured log directory. Once the active log grows beyond the
+// configured size it is rotated into a timestamped, gzip compressed file, and
+// old logs are removed once they exceed the configured age or file limits.
+// Entries may also be forwarded to a syslog server in the background as they
+// are written.
+package audit
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/apex/log"
+	"github.com/goccy/go-json"
+
+	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/internal/rotatelog"
+)
+
+const (
+	// CurrentFile is the name of the audit log currently being written to.
+	CurrentFile = "audit.log"
+
+	rotatedPrefix = "audit-"
+)
+
+// EntryType describes what an audit entry records.
+type EntryType string
+
+const (
+	// TypeRequest entries record a single request made to the API.
+	TypeRequest EntryType = "request"
+	// TypeCommand entries record a single command executed on the host.
+	TypeCommand EntryType = "command"
+)
+
+// Outcome describes the result of an audited action.
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	OutcomeFailure Outcome = "failure"
+	OutcomeDenied  Outcome = "denied"
+)
+
+// Actor types describe who performed an audited action. Node requests are
+// authenticated with the node token, which is only known to the Panel, while
+// user requests are authenticated with a JWT the Panel issued to a user.
+const (
+	ActorNode      = "node"
+	ActorUser      = "user"
+	ActorTransfer  = "transfer"
+	ActorAnonymous = "anonymous"
+)
+
+// Entry is a single record in the audit log.
+type Entry struct {
+	Time      time.Time `json:"time"`
+	Type      EntryType `json:"type"`
+	RequestID string    `json:"request_id,omitempty"`
+
+	// The request that was made, Route is the pattern that matched the request
+	// while Path is the path that was actually requested.
+	Method string `json:"method,omitempty"`
+	Route  string `json:"route,omitempty"`
+	Path   string `json:"path,omitempty"`
+
+	// The server the action was performed against, if any.
+	Server string `json:"server,omitempty"`
+
+	// Who performed the action and where they performed it from.
+	Actor     string `json:"actor,omitempty"`
+	ActorType string `json:"actor_type"`
+	IP        string `json:"ip"`
+
+	// The result of the action and how long it took to complete.
+	Status   int     `json:"status,omitempty"`
+	Outcome  Outcome `json:"outcome"`
+	Duration int64   `json:"duration_ms"`
+
+	// The host command that was executed and its exit code, for command entries.
+	Command  string `json:"command,omitempty"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+}
+
+// OutcomeForStatus returns the outcome of a request based on its response
+// status code.
+func OutcomeForStatus(status int) Outcome {
+	switch {
+	case status == 401 || status == 403:
+		return OutcomeDenied
+	case status >= 400:
+		return OutcomeFailure
+	}
+	return OutcomeSuccess
+}
+
+// File describes a single audit log file on the disk.
+type File = rotatelog.File
+
+// Directory returns the directory where the audit logs are stored.
+func Directory() string {
+	return filepath.Join(config.Get().System.LogDirectory, "audit")
+}
+
+func dir() rotatelog.Dir {
+	return rotatelog.Dir{Path: Directory(), Current: CurrentFile, Prefix: rotatedPrefix}
+}
+
+func limits(cfg config.AuditLogConfiguration) rotatelog.Limits {
+	return rotatelog.Limits{MaxSize: cfg.MaxSize, MaxAge: cfg.MaxAge, MaxFiles: cfg.MaxFiles}
+}
+
+// List returns all the audit log files, ordered from oldest to newest. The
+// active log, if any, is always the last entry.
+func List() ([]File, error) {
+	return dir().List()
+}
+
+// Prune removes rotated audit logs that are older than the configured maximum
+// age, and then the oldest remaining logs beyond the maximum file count.
+func Prune() error {
+	return dir().Prune(limits(config.Get().System.AuditLog))
+}
+
+// std appends entries to the active audit log, rotating and pruning the files
+// as needed.
+var std rotatelog.Writer
+
+// Log records the entry in the audit log. If the audit log is disabled this is
+// a no-op. Failures are logged rather than returned since they should never
+// cause the audited action itself to fail.
+func Log(e Entry) {
+	cfg := config.Get().System.AuditLog
+	if !cfg.Enabled {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		log.WithField("error", err).Error("audit: failed to encode entry")
+		return
+	}
+
+	if err := std.Write(dir(), limits(cfg), append(b, '\n')); err != nil {
+		log.WithField("error", err).Error("audit: failed to write entry")
+	}
+
+	// Forwarding happens in the background so that a slow syslog server does
+	// not hold up the request being audited.
+	if cfg.Syslog.Enabled {
+		fwd.enqueue(b)
+	}
+}
+
+// Close closes the active audit log and the syslog connection if they are open.
+func Close() error {
+	fwd.close()
+	return std.Close()
+}
+
+// Query describes the entries to return when searching the audit log. Any
+// zero value fields are not used to filter the entries.
+type Query struct {
+	Since   time.Time
+	Until   time.Time
+	Type    EntryType
+	Server  string
+	Actor   string
+	Outcome Outcome
+	Limit   int
+}
+
+func (q Query) matches(e Entry) bool {
+	return (q.Since.IsZero() || !e.Time.Before(q.Since)) &&
+		(q.Until.IsZero() || !e.Time.After(q.Until)) &&
+		(q.Type == "" || e.Type == q.Type) &&
+		(q.Server == "" || e.Server == q.Server) &&
+		(q.Actor == "" || e.Actor == q.Actor) &&
+		(q.Outcome == "" || e.Outcome == q.Outcome)
+}
+
+// Search returns the entries in the audit log that match the query, newest
+// first. The files are read from newest to oldest, stopping once enough
+// entries have been found or the remaining files are older than the query.
+func Search(q Query) ([]Entry, error) {
+	files, err := List()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Entry, 0)
+	for i := len(files) - 1; i >= 0; i-- {
+		f := files[i]
+		// The modification time of a file is the time of the last entry that was
+		// written to it, so if it is before the start of the range every earlier
+		// file will be as well.
+		if !q.Since.IsZero() && f.ModifiedAt.Before(q.Since) {
+			break
+		}
+		entries, err := readFile(filepath.Join(Directory(), f.Name), f.Compressed, q)
+		if err != nil {
+			return nil, err
+		}
+		for j := len(entries) - 1; j >= 0; j-- {
+			out = append(out, entries[j])
+			if q.Limit > 0 && len(out) >= q.Limit {
+				return out, nil
+			}
+		}
+	}
+	return out, nil
+}
+
+// readFile returns the entries in the file that match the query, oldest first.
+// Lines that cannot be decoded, such as one that is partially written, are
+// skipped.
+func readFile(p string, compressed bool, q Query) ([]Entry, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if compressed {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, errors.Wrap(err, "audit: failed to open compressed file")
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if q.matches(e) {
+			entries = append(entries, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "audit: failed to read file")
+	}
+	return entries, nil
+}
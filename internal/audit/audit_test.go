@@ -0,0 +1,154 @@
+package audit
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/priyxstudio/propel/config"
+)
+
+func setupConfig(t *testing.T) {
+	t.Helper()
+	config.Set(&config.Configuration{
+		AuthenticationToken: "abc",
+		System: config.SystemConfiguration{
+			LogDirectory: t.TempDir(),
+			AuditLog: config.AuditLogConfiguration{
+				Enabled:  true,
+				MaxSize:  10,
+				MaxFiles: 2,
+			},
+		},
+	})
+	t.Cleanup(func() { _ = Close() })
+}
+
+func TestOutcomeForStatus(t *testing.T) {
+	cases := map[int]Outcome{
+		200: OutcomeSuccess,
+		204: OutcomeSuccess,
+		302: OutcomeSuccess,
+		400: OutcomeFailure,
+		401: OutcomeDenied,
+		403: OutcomeDenied,
+		404: OutcomeFailure,
+		500: OutcomeFailure,
+	}
+	for status, expected := range cases {
+		if actual := OutcomeForStatus(status); actual != expected {
+			t.Errorf("expected status %d to be %q, got %q", status, expected, actual)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	setupConfig(t)
+
+	start := time.Now().Add(-time.Minute)
+	for i := 0; i < 5; i++ {
+		Log(Entry{
+			Time:      start.Add(time.Duration(i) * time.Second),
+			Type:      TypeRequest,
+			Route:     "/api/servers/:server",
+			Server:    []string{"a", "b"}[i%2],
+			ActorType: ActorNode,
+			Outcome:   OutcomeSuccess,
+		})
+	}
+	Log(Entry{Time: start.Add(time.Second * 10), Type: TypeCommand, Command: "uptime", ActorType: ActorNode, Outcome: OutcomeFailure})
+
+	entries, err := Search(Query{})
+	if err != nil {
+		t.Fatalf("unexpected error searching: %v", err)
+	}
+	if len(entries) != 6 {
+		t.Fatalf("expected 6 entries, got %d", len(entries))
+	}
+	if entries[0].Type != TypeCommand {
+		t.Errorf("expected the newest entry first, got %q", entries[0].Type)
+	}
+
+	entries, err = Search(Query{Server: "a", Limit: 2})
+	if err != nil {
+		t.Fatalf("unexpected error searching: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Server != "a" || !entries[0].Time.After(entries[1].Time) {
+		t.Errorf("expected the two newest entries for server a, got %+v", entries)
+	}
+
+	entries, err = Search(Query{Outcome: OutcomeFailure, Since: start.Add(time.Second * 5)})
+	if err != nil {
+		t.Fatalf("unexpected error searching: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Command != "uptime" {
+		t.Errorf("expected only the failed command, got %+v", entries)
+	}
+}
+
+func TestSearchRotated(t *testing.T) {
+	setupConfig(t)
+
+	Log(Entry{Type: TypeRequest, Route: "/first", ActorType: ActorNode, Outcome: OutcomeSuccess})
+	if err := std.Rotate(dir(), limits(config.Get().System.AuditLog)); err != nil {
+		t.Fatalf("unexpected error rotating: %v", err)
+	}
+	Log(Entry{Type: TypeRequest, Route: "/second", ActorType: ActorNode, Outcome: OutcomeSuccess})
+
+	// Compression of the rotated file happens in the background, so wait for it
+	// to complete before searching.
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		files, err := List()
+		if err != nil {
+			t.Fatalf("unexpected error listing files: %v", err)
+		}
+		if len(files) == 2 && files[0].Compressed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("rotated file was not compressed: %+v", files)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	entries, err := Search(Query{})
+	if err != nil {
+		t.Fatalf("unexpected error searching: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Route != "/second" || entries[1].Route != "/first" {
+		t.Errorf("expected entries from both files newest first, got %+v", entries)
+	}
+}
+
+func TestLogForwardsToSyslog(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	setupConfig(t)
+	cfg := config.Get()
+	cfg.System.AuditLog.Syslog = config.AuditSyslogConfiguration{
+		Enabled: true,
+		Network: "udp",
+		Address: pc.LocalAddr().String(),
+		Tag:     "propel-audit",
+	}
+	config.Set(cfg)
+
+	Log(Entry{Type: TypeCommand, Command: "uptime", ActorType: ActorNode, Outcome: OutcomeSuccess})
+
+	_ = pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 4096)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("expected the entry to be forwarded: %v", err)
+	}
+	msg := string(buf[:n])
+	if !strings.HasPrefix(msg, "<38>") || !strings.Contains(msg, "propel-audit[") || !strings.Contains(msg, `"command":"uptime"`) {
+		t.Errorf("unexpected syslog message %q", msg)
+	}
+}
@@ -0,0 +1,125 @@
+package audit
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/apex/log"
+
+	"github.com/priyxstudio/propel/config"
+)
+
+const (
+	// syslogQueueSize is the number of entries that may be waiting to be
+	// forwarded to syslog before new entries are dropped.
+	syslogQueueSize = 1024
+
+	// syslogTimeout bounds how long connecting to and writing to the syslog
+	// server may take.
+	syslogTimeout = 5 * time.Second
+
+	// syslogPriority is the priority entries are sent with, LOG_AUTH|LOG_INFO.
+	syslogPriority = 4<<3 | 6
+)
+
+// forwarder sends entries to syslog from a single goroutine so that a slow or
+// unreachable syslog server never delays the audited action. Entries are queued
+// and dropped once the queue is full.
+type forwarder struct {
+	once    sync.Once
+	queue   chan []byte
+	dropped atomic.Uint64
+
+	mu   sync.Mutex
+	conn net.Conn
+	cfg  config.AuditSyslogConfiguration
+}
+
+var fwd forwarder
+
+// Dropped returns the number of entries that were not forwarded to syslog
+// because the queue was full.
+func Dropped() uint64 {
+	return fwd.dropped.Load()
+}
+
+// enqueue queues the entry to be forwarded, dropping it if the queue is full.
+func (f *forwarder) enqueue(b []byte) {
+	f.once.Do(func() {
+		f.queue = make(chan []byte, syslogQueueSize)
+		go f.run()
+	})
+	select {
+	case f.queue <- b:
+	default:
+		if n := f.dropped.Add(1); n == 1 || n%100 == 0 {
+			log.WithField("dropped", n).Warn("audit: syslog queue is full, dropping entries")
+		}
+	}
+}
+
+func (f *forwarder) run() {
+	for b := range f.queue {
+		cfg := config.Get().System.AuditLog.Syslog
+		if !cfg.Enabled {
+			continue
+		}
+		if err := f.send(cfg, b); err != nil {
+			log.WithField("error", err).Warn("audit: failed to forward entry to syslog")
+		}
+	}
+}
+
+// send writes a single entry to syslog. The connection is re-established if the
+// configuration changed or the last write failed.
+func (f *forwarder) send(cfg config.AuditSyslogConfiguration, b []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.conn != nil && f.cfg != cfg {
+		_ = f.conn.Close()
+		f.conn = nil
+	}
+	if f.conn == nil {
+		c, err := dialSyslog(cfg)
+		if err != nil {
+			return err
+		}
+		f.conn = c
+		f.cfg = cfg
+	}
+
+	_ = f.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+	local := cfg.Network == "" && cfg.Address == ""
+	if _, err := f.conn.Write(formatSyslog(cfg.Tag, local, time.Now(), b)); err != nil {
+		_ = f.conn.Close()
+		f.conn = nil
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// close closes the syslog connection if it is open.
+func (f *forwarder) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.conn != nil {
+		_ = f.conn.Close()
+		f.conn = nil
+	}
+}
+
+// formatSyslog formats a message in the same way as the log/syslog package, the
+// local syslog daemon does not expect the hostname to be included.
+func formatSyslog(tag string, local bool, t time.Time, b []byte) []byte {
+	if local {
+		return fmt.Appendf(nil, "<%d>%s %s[%d]: %s\n", syslogPriority, t.Format(time.Stamp), tag, os.Getpid(), b)
+	}
+	hostname, _ := os.Hostname()
+	return fmt.Appendf(nil, "<%d>%s %s %s[%d]: %s\n", syslogPriority, t.Format(time.RFC3339), hostname, tag, os.Getpid(), b)
+}
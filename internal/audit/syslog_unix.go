@@ -0,0 +1,34 @@
+//go:build !windows
+
+package audit
+
+import (
+	"net"
+
+	"emperror.dev/errors"
+
+	"github.com/priyxstudio/propel/config"
+)
+
+// localSyslogPaths are the sockets the local syslog daemon may listen on.
+var localSyslogPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// dialSyslog connects to the configured syslog server, or the local syslog
+// daemon if no address is configured.
+func dialSyslog(cfg config.AuditSyslogConfiguration) (net.Conn, error) {
+	if cfg.Network == "" && cfg.Address == "" {
+		for _, network := range []string{"unixgram", "unix"} {
+			for _, p := range localSyslogPaths {
+				if c, err := net.DialTimeout(network, p, syslogTimeout); err == nil {
+					return c, nil
+				}
+			}
+		}
+		return nil, errors.New("audit: failed to connect to syslog: no local syslog daemon found")
+	}
+	c, err := net.DialTimeout(cfg.Network, cfg.Address, syslogTimeout)
+	if err != nil {
+		return nil, errors.Wrap(err, "audit: failed to connect to syslog")
+	}
+	return c, nil
+}
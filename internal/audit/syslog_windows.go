@@ -0,0 +1,16 @@
+//go:build windows
+
+package audit
+
+import (
+	"net"
+
+	"emperror.dev/errors"
+
+	"github.com/priyxstudio/propel/config"
+)
+
+// dialSyslog always returns an error since syslog is not available on Windows.
+func dialSyslog(_ config.AuditSyslogConfiguration) (net.Conn, error) {
+	return nil, errors.New("audit: syslog forwarding is not supported on windows")
+}
@@ -0,0 +1,45 @@
+package cron
+
+import (
+	"context"
+	"time"
+
+	"emperror.dev/errors"
+
+	"github.com/priyxstudio/propel/proxy"
+	"github.com/priyxstudio/propel/server"
+	"github.com/priyxstudio/propel/system"
+)
+
+// certificateRenewInterval is how often the proxy certificates are checked for
+// renewal. Certificates are renewed well before they expire so a failed renewal
+// is retried many times before it matters.
+const certificateRenewInterval = time.Hour * 12
+
+type certificateCron struct {
+	mu      *system.AtomicBool
+	manager *server.Manager
+}
+
+// Run renews the proxy certificates that are close to expiring, emitting an
+// event for the server of each certificate that could not be renewed.
+func (cc *certificateCron) Run(ctx context.Context) error {
+	if !cc.mu.SwapIf(true) {
+		return errors.WithStack(ErrCronRunning)
+	}
+	defer cc.mu.Store(false)
+
+	failures, err := proxy.RenewCertificates(ctx)
+	for _, f := range failures {
+		s, ok := cc.manager.Get(f.Certificate.ServerUUID)
+		if !ok {
+			continue
+		}
+		s.Events().Publish(server.CertificateRenewalFailedEvent, map[string]interface{}{
+			"domain":     f.Certificate.Domain,
+			"expires_at": f.Certificate.ExpiresAt,
+			"error":      f.Err.Error(),
+		})
+	}
+	return err
+}
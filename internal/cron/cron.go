@@ -49,6 +49,30 @@ func Scheduler(ctx context.Context, m *server.Manager) (gocron.Scheduler, error)
 		max:     config.Get().System.ActivitySendCount,
 	}
 
+	transcripts := transcriptCron{
+		mu:      system.NewAtomicBool(false),
+		manager: m,
+	}
+
+	stats := statsCron{
+		mu:      system.NewAtomicBool(false),
+		manager: m,
+	}
+
+	traffic := trafficCron{
+		mu:      system.NewAtomicBool(false),
+		manager: m,
+	}
+
+	webhooks := webhookCron{
+		mu: system.NewAtomicBool(false),
+	}
+
+	certificates := certificateCron{
+		mu:      system.NewAtomicBool(false),
+		manager: m,
+	}
+
 	l := log.WithField("subsystem", "cron")
 
 	interval := time.Duration(config.Get().System.ActivitySendInterval) * time.Second
@@ -90,6 +114,99 @@ func Scheduler(ctx context.Context, m *server.Manager) (gocron.Scheduler, error)
 		return nil, errors.Wrap(err, "cron: failed to create sftp job")
 	}
 
+	// Console transcript job
+	_, err = s.NewJob(
+		gocron.DurationJob(time.Hour),
+		gocron.NewTask(func() {
+			l.WithField("cron", "transcripts").Debug("pruning console transcripts")
+			if err := transcripts.Run(ctx); err != nil {
+				if errors.Is(err, ErrCronRunning) {
+					l.WithField("cron", "transcripts").Warn("console transcript process is already running, skipping...")
+				} else {
+					l.WithField("cron", "transcripts").WithField("error", err).Error("console transcript process failed to execute")
+				}
+			}
+		}),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "cron: failed to create console transcript job")
+	}
+
+	// Stats history job
+	if config.Get().System.StatsHistory.Enabled {
+		flush := time.Duration(max(config.Get().System.StatsHistory.FlushInterval, 1)) * time.Second
+		_, err = s.NewJob(
+			gocron.DurationJob(flush),
+			gocron.NewTask(func() {
+				if err := stats.Run(ctx); err != nil {
+					if errors.Is(err, ErrCronRunning) {
+						l.WithField("cron", "stats").Warn("stats history process is already running, skipping...")
+					} else {
+						l.WithField("cron", "stats").WithField("error", err).Error("stats history process failed to execute")
+					}
+				}
+			}),
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "cron: failed to create stats history job")
+		}
+	}
+
+	// Network traffic job
+	_, err = s.NewJob(
+		gocron.DurationJob(trafficFlushInterval),
+		gocron.NewTask(func() {
+			if err := traffic.Run(ctx); err != nil {
+				if errors.Is(err, ErrCronRunning) {
+					l.WithField("cron", "traffic").Warn("network traffic process is already running, skipping...")
+				} else {
+					l.WithField("cron", "traffic").WithField("error", err).Error("network traffic process failed to execute")
+				}
+			}
+		}),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "cron: failed to create network traffic job")
+	}
+
+	// Webhook delivery job
+	if config.Get().System.Webhooks.Enabled {
+		_, err = s.NewJob(
+			gocron.DurationJob(webhookQueueInterval),
+			gocron.NewTask(func() {
+				if err := webhooks.Run(ctx); err != nil {
+					if errors.Is(err, ErrCronRunning) {
+						l.WithField("cron", "webhooks").Debug("webhook delivery process is already running, skipping...")
+					} else {
+						l.WithField("cron", "webhooks").WithField("error", err).Error("webhook delivery process failed to execute")
+					}
+				}
+			}),
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "cron: failed to create webhook delivery job")
+		}
+	}
+
+	// Proxy certificate renewal job
+	_, err = s.NewJob(
+		gocron.DurationJob(certificateRenewInterval),
+		gocron.NewTask(func() {
+			l.WithField("cron", "certificates").Debug("renewing proxy certificates")
+			if err := certificates.Run(ctx); err != nil {
+				if errors.Is(err, ErrCronRunning) {
+					l.WithField("cron", "certificates").Warn("certificate renewal process is already running, skipping...")
+				} else {
+					l.WithField("cron", "certificates").WithField("error", err).Error("certificate renewal process failed to execute")
+				}
+			}
+		}),
+		gocron.WithStartAt(gocron.WithStartImmediately()),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "cron: failed to create certificate renewal job")
+	}
+
 	return s, nil
 }
 
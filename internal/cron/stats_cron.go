@@ -0,0 +1,45 @@
+package cron
+
+import (
+	"context"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/apex/log"
+
+	"github.com/priyxstudio/propel/server"
+	"github.com/priyxstudio/propel/system"
+)
+
+type statsCron struct {
+	mu         *system.AtomicBool
+	manager    *server.Manager
+	lastPruned time.Time
+}
+
+// Run writes the resource usage samples collected for each server to the
+// database, and removes any samples that have exceeded their retention once an
+// hour.
+func (sc *statsCron) Run(ctx context.Context) error {
+	if !sc.mu.SwapIf(true) {
+		return errors.WithStack(ErrCronRunning)
+	}
+	defer sc.mu.Store(false)
+
+	for _, s := range sc.manager.All() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := s.FlushStatsHistory(); err != nil {
+			log.WithField("server", s.ID()).WithField("error", err).Warn("cron: failed to flush stats history")
+		}
+	}
+
+	if time.Since(sc.lastPruned) >= time.Hour {
+		if err := server.PruneStatsHistory(); err != nil {
+			return err
+		}
+		sc.lastPruned = time.Now()
+	}
+	return nil
+}
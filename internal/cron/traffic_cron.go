@@ -0,0 +1,40 @@
+package cron
+
+import (
+	"context"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/apex/log"
+
+	"github.com/priyxstudio/propel/server"
+	"github.com/priyxstudio/propel/system"
+)
+
+// trafficFlushInterval is how often the network traffic totals for each server
+// are written to the database.
+const trafficFlushInterval = time.Minute
+
+type trafficCron struct {
+	mu      *system.AtomicBool
+	manager *server.Manager
+}
+
+// Run writes the network traffic totals for each server to the database so that
+// they are kept if the daemon is restarted.
+func (tc *trafficCron) Run(ctx context.Context) error {
+	if !tc.mu.SwapIf(true) {
+		return errors.WithStack(ErrCronRunning)
+	}
+	defer tc.mu.Store(false)
+
+	for _, s := range tc.manager.All() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := s.FlushTraffic(); err != nil {
+			log.WithField("server", s.ID()).WithField("error", err).Warn("cron: failed to flush network traffic")
+		}
+	}
+	return nil
+}
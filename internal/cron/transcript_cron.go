@@ -0,0 +1,38 @@
+package cron
+
+import (
+	"context"
+
+	"emperror.dev/errors"
+	"github.com/apex/log"
+
+	"github.com/priyxstudio/propel/server"
+	"github.com/priyxstudio/propel/server/transcript"
+	"github.com/priyxstudio/propel/system"
+)
+
+type transcriptCron struct {
+	mu      *system.AtomicBool
+	manager *server.Manager
+}
+
+// Run removes any console transcripts that have exceeded the configured age or
+// file limits. Pruning also happens whenever a transcript is rotated, but a
+// server that produces little output may never rotate again, so this ensures
+// old transcripts are still cleaned up in that case.
+func (tc *transcriptCron) Run(ctx context.Context) error {
+	if !tc.mu.SwapIf(true) {
+		return errors.WithStack(ErrCronRunning)
+	}
+	defer tc.mu.Store(false)
+
+	for _, s := range tc.manager.All() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := transcript.Prune(s.ID()); err != nil {
+			log.WithField("server", s.ID()).WithField("error", err).Warn("cron: failed to prune console transcripts")
+		}
+	}
+	return nil
+}
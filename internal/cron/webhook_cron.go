@@ -0,0 +1,41 @@
+package cron
+
+import (
+	"context"
+	"time"
+
+	"emperror.dev/errors"
+
+	"github.com/priyxstudio/propel/server"
+	"github.com/priyxstudio/propel/system"
+)
+
+// The interval at which the webhook delivery queue is processed.
+const webhookQueueInterval = time.Second * 5
+
+type webhookCron struct {
+	mu         *system.AtomicBool
+	lastPruned time.Time
+}
+
+// Run attempts each queued webhook delivery that is due, and removes completed
+// deliveries that have exceeded their retention from the delivery log once an
+// hour.
+func (wc *webhookCron) Run(ctx context.Context) error {
+	if !wc.mu.SwapIf(true) {
+		return errors.WithStack(ErrCronRunning)
+	}
+	defer wc.mu.Store(false)
+
+	if err := server.ProcessWebhookDeliveries(ctx); err != nil {
+		return err
+	}
+
+	if time.Since(wc.lastPruned) >= time.Hour {
+		if err := server.PruneWebhookDeliveries(); err != nil {
+			return err
+		}
+		wc.lastPruned = time.Now()
+	}
+	return nil
+}
@@ -49,6 +49,15 @@ func Initialize() error {
 		&models.Activity{},
 		&models.Module{},
 		&models.FirewallRule{},
+		&models.ConsoleTrigger{},
+		&models.CrashReport{},
+		&models.StatsSample{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+		&models.NetworkTraffic{},
+		&models.Proxy{},
+		&models.Certificate{},
+		&models.StreamProxy{},
 	); err != nil {
 		return errors.WithStack(err)
 	}
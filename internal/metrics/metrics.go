@@ -0,0 +1,261 @@
+// Package metrics implements the small subset of the Prometheus text exposition
+// format needed to expose node and server metrics to a scraper, along with the
+// collectors used to instrument long-running operations within the daemon.
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The content type of the exposition format written by a Writer.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DurationBuckets are the histogram buckets, in seconds, used for operations
+// such as backups and transfers that can take anywhere from a few seconds to
+// multiple hours to complete.
+var DurationBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600, 7200, 14400}
+
+var (
+	// BackupDuration tracks the time taken to generate server backups.
+	BackupDuration = NewHistogram("propel_backup_duration_seconds", "Time taken to generate server backups.", DurationBuckets, "status")
+
+	// TransferDuration tracks the time taken to send or receive server transfers.
+	TransferDuration = NewHistogram("propel_transfer_duration_seconds", "Time taken to complete server transfers.", DurationBuckets, "direction", "status")
+
+	// SftpSessions tracks the number of SFTP sessions that are currently open.
+	SftpSessions = NewGauge("propel_server_sftp_sessions", "Number of open SFTP sessions for the server.", "server")
+)
+
+// Collector is implemented by any metric that can write itself to a Writer.
+type Collector interface {
+	Collect(w *Writer)
+}
+
+// Label is a single label pair attached to a sample.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Writer writes metric families and their samples using the Prometheus text
+// exposition format. Errors are tracked internally and returned by Flush.
+type Writer struct {
+	w *bufio.Writer
+}
+
+// NewWriter returns a new Writer that writes to the given io.Writer.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Family writes the HELP and TYPE lines for a metric family. This must be
+// called before any samples for the family are written.
+func (w *Writer) Family(name, typ, help string) {
+	w.w.WriteString("# HELP " + name + " " + escapeHelp(help) + "\n")
+	w.w.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+// Sample writes a single sample for a metric with the labels provided.
+func (w *Writer) Sample(name string, value float64, labels ...Label) {
+	w.w.WriteString(name)
+	if len(labels) > 0 {
+		w.w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.w.WriteByte(',')
+			}
+			w.w.WriteString(l.Name + "=\"" + escapeLabel(l.Value) + "\"")
+		}
+		w.w.WriteByte('}')
+	}
+	w.w.WriteByte(' ')
+	w.w.WriteString(formatFloat(value))
+	w.w.WriteByte('\n')
+}
+
+// Flush writes any buffered data to the underlying writer.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// Write writes all the collectors tracked by this package to the writer.
+func Write(w *Writer) {
+	for _, c := range []Collector{BackupDuration, TransferDuration, SftpSessions} {
+		c.Collect(w)
+	}
+}
+
+// Gauge is a metric that tracks a single value per set of label values which
+// can go up and down.
+type Gauge struct {
+	mu     sync.Mutex
+	name   string
+	help   string
+	labels []string
+	series map[string]*gaugeSeries
+}
+
+type gaugeSeries struct {
+	values []string
+	value  float64
+}
+
+// NewGauge returns a new gauge with the given label names.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{name: name, help: help, labels: labels, series: make(map[string]*gaugeSeries)}
+}
+
+// Inc increments the gauge for the given label values by one.
+func (g *Gauge) Inc(values ...string) {
+	g.Add(1, values...)
+}
+
+// Dec decrements the gauge for the given label values by one.
+func (g *Gauge) Dec(values ...string) {
+	g.Add(-1, values...)
+}
+
+// Add adds the given value to the gauge for the label values provided. Series
+// that return to zero are removed entirely so that values for servers which no
+// longer exist on the node are not exposed forever.
+func (g *Gauge) Add(v float64, values ...string) {
+	key := strings.Join(values, "\xff")
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s, ok := g.series[key]
+	if !ok {
+		s = &gaugeSeries{values: values}
+		g.series[key] = s
+	}
+	s.value += v
+	if s.value == 0 {
+		delete(g.series, key)
+	}
+}
+
+// Collect writes the gauge to the writer.
+func (g *Gauge) Collect(w *Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	w.Family(g.name, "gauge", g.help)
+	for _, key := range sortedKeys(g.series) {
+		s := g.series[key]
+		w.Sample(g.name, s.value, labelPairs(g.labels, s.values)...)
+	}
+}
+
+// Histogram tracks the distribution of observed values in a set of buckets for
+// each set of label values.
+type Histogram struct {
+	mu      sync.Mutex
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	values []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram returns a new histogram using the given buckets, which must be
+// sorted in increasing order, and label names.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogramSeries)}
+}
+
+// Observe records a value in the histogram for the given label values.
+func (h *Histogram) Observe(v float64, values ...string) {
+	key := strings.Join(values, "\xff")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{values: values, counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, b := range h.buckets {
+		if v <= b {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+// Collect writes the histogram to the writer.
+func (h *Histogram) Collect(w *Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	w.Family(h.name, "histogram", h.help)
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		labels := labelPairs(h.labels, s.values)
+		for i, b := range h.buckets {
+			w.Sample(h.name+"_bucket", float64(s.counts[i]), append(labels, Label{"le", formatFloat(b)})...)
+		}
+		w.Sample(h.name+"_bucket", float64(s.count), append(labels, Label{"le", "+Inf"})...)
+		w.Sample(h.name+"_sum", s.sum, labels...)
+		w.Sample(h.name+"_count", float64(s.count), labels...)
+	}
+}
+
+func labelPairs(names []string, values []string) []Label {
+	pairs := make([]Label, 0, len(names)+1)
+	for i, n := range names {
+		var v string
+		if i < len(values) {
+			v = values[i]
+		}
+		pairs = append(pairs, Label{n, v})
+	}
+	return pairs
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
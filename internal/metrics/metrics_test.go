@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestMetrics(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("Writer", func() {
+		g.It("writes samples with escaped labels", func() {
+			var buf bytes.Buffer
+			w := NewWriter(&buf)
+			w.Family("test_metric", "gauge", "A test\nmetric.")
+			w.Sample("test_metric", 1.5, Label{"server", `a"b\c`})
+			w.Sample("test_metric", 2)
+			g.Assert(w.Flush()).IsNil()
+
+			g.Assert(buf.String()).Equal("# HELP test_metric A test\\nmetric.\n" +
+				"# TYPE test_metric gauge\n" +
+				"test_metric{server=\"a\\\"b\\\\c\"} 1.5\n" +
+				"test_metric 2\n")
+		})
+	})
+
+	g.Describe("Gauge", func() {
+		g.It("removes series that return to zero", func() {
+			gauge := NewGauge("test_sessions", "Sessions.", "server")
+			gauge.Inc("one")
+			gauge.Inc("one")
+			gauge.Inc("two")
+			gauge.Dec("two")
+
+			var buf bytes.Buffer
+			w := NewWriter(&buf)
+			gauge.Collect(w)
+			g.Assert(w.Flush()).IsNil()
+
+			g.Assert(buf.String()).Equal("# HELP test_sessions Sessions.\n" +
+				"# TYPE test_sessions gauge\n" +
+				"test_sessions{server=\"one\"} 2\n")
+		})
+	})
+
+	g.Describe("Histogram", func() {
+		g.It("writes cumulative buckets", func() {
+			h := NewHistogram("test_duration_seconds", "Duration.", []float64{1, 10}, "status")
+			h.Observe(0.5, "ok")
+			h.Observe(5, "ok")
+			h.Observe(50, "ok")
+
+			var buf bytes.Buffer
+			w := NewWriter(&buf)
+			h.Collect(w)
+			g.Assert(w.Flush()).IsNil()
+
+			g.Assert(buf.String()).Equal("# HELP test_duration_seconds Duration.\n" +
+				"# TYPE test_duration_seconds histogram\n" +
+				"test_duration_seconds_bucket{status=\"ok\",le=\"1\"} 1\n" +
+				"test_duration_seconds_bucket{status=\"ok\",le=\"10\"} 2\n" +
+				"test_duration_seconds_bucket{status=\"ok\",le=\"+Inf\"} 3\n" +
+				"test_duration_seconds_sum{status=\"ok\"} 55.5\n" +
+				"test_duration_seconds_count{status=\"ok\"} 3\n")
+		})
+	})
+}
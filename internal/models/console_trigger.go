@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ConsoleTriggerAction represents the action performed when a console trigger matches
+type ConsoleTriggerAction string
+
+const (
+	ConsoleTriggerActionCommand ConsoleTriggerAction = "command"
+	ConsoleTriggerActionRestart ConsoleTriggerAction = "restart"
+	ConsoleTriggerActionStop    ConsoleTriggerAction = "stop"
+	ConsoleTriggerActionBackup  ConsoleTriggerAction = "backup"
+	ConsoleTriggerActionWebhook ConsoleTriggerAction = "webhook"
+)
+
+// IsValid checks if the console trigger action is one that is supported
+func (a ConsoleTriggerAction) IsValid() bool {
+	switch a {
+	case ConsoleTriggerActionCommand,
+		ConsoleTriggerActionRestart,
+		ConsoleTriggerActionStop,
+		ConsoleTriggerActionBackup,
+		ConsoleTriggerActionWebhook:
+		return true
+	}
+	return false
+}
+
+// ConsoleTrigger represents a user defined rule that performs an action whenever a
+// line of console output for a server matches the pattern
+type ConsoleTrigger struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Server UUID that this trigger applies to
+	ServerUUID string `gorm:"index;not null" json:"server_uuid"`
+
+	// Human readable name for the trigger
+	Name string `json:"name"`
+
+	// Regular expression that console output lines are matched against
+	Pattern string `gorm:"not null" json:"pattern"`
+
+	// Action to perform when the pattern matches
+	Action ConsoleTriggerAction `gorm:"not null" json:"action"`
+
+	// Payload for the action, the command to send for "command" actions or the
+	// URL to deliver to for "webhook" actions
+	Payload string `json:"payload"`
+
+	// Cooldown is the minimum number of seconds between two executions of the trigger
+	Cooldown int `gorm:"not null" json:"cooldown"`
+
+	// Whether or not the trigger is currently evaluated
+	Enabled bool `gorm:"not null" json:"enabled"`
+}
+
+// TableName specifies the table name for GORM
+func (ConsoleTrigger) TableName() string {
+	return "console_triggers"
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"github.com/priyxstudio/propel/environment"
+)
+
+// CrashReportOutcome describes what the daemon did in response to a crash
+type CrashReportOutcome string
+
+const (
+	CrashReportOutcomeRestarted CrashReportOutcome = "restarted"
+	CrashReportOutcomeDelayed   CrashReportOutcome = "delayed"
+	CrashReportOutcomeGaveUp    CrashReportOutcome = "gave_up"
+
+	// The outcomes a report is updated to when the restart did not happen, the
+	// report is stored before the restart is attempted
+	CrashReportOutcomeCancelled     CrashReportOutcome = "cancelled"
+	CrashReportOutcomeRestartFailed CrashReportOutcome = "restart_failed"
+)
+
+// CrashReport captures the state of a server process at the time it crashed
+type CrashReport struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Server UUID that crashed
+	ServerUUID string `gorm:"index;not null" json:"server_uuid"`
+
+	// Exit code of the process and whether it was killed for running out of memory
+	ExitCode  uint32 `gorm:"not null" json:"exit_code"`
+	OOMKilled bool   `gorm:"not null" json:"oom_killed"`
+
+	// The last lines of console output before the crash occurred
+	Logs []string `gorm:"serializer:json" json:"logs"`
+
+	// The last resource usage reported for the process before it crashed
+	Stats     environment.Stats `gorm:"serializer:json" json:"stats"`
+	DiskBytes int64             `json:"disk_bytes"`
+
+	// What was done in response to the crash, and the delay in seconds before the
+	// server was restarted for delayed restarts
+	Outcome      CrashReportOutcome `gorm:"not null" json:"outcome"`
+	RestartDelay int                `json:"restart_delay"`
+}
+
+// TableName specifies the table name for GORM
+func (CrashReport) TableName() string {
+	return "crash_reports"
+}
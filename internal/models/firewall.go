@@ -27,9 +27,14 @@ type FirewallRule struct {
 	// Remote IP address (CIDR notation supported, e.g., "192.168.1.1/32" or "192.168.1.0/24")
 	RemoteIP string `gorm:"not null" json:"remote_ip"`
 
-	// Server port this rule applies to
+	// Server port this rule applies to, or the first port of the range when
+	// ServerPortEnd is set
 	ServerPort int `gorm:"not null" json:"server_port"`
 
+	// Last port of the range this rule applies to (0 when the rule applies to a
+	// single port)
+	ServerPortEnd int `gorm:"default:0;not null" json:"server_port_end"`
+
 	// Priority determines the order rules are applied (lower number = higher priority)
 	Priority int `gorm:"default:100;not null" json:"priority"`
 
@@ -40,6 +45,19 @@ type FirewallRule struct {
 	Protocol string `gorm:"default:tcp;not null" json:"protocol"`
 }
 
+// LastPort returns the last port the rule applies to.
+func (r FirewallRule) LastPort() int {
+	if r.ServerPortEnd > r.ServerPort {
+		return r.ServerPortEnd
+	}
+	return r.ServerPort
+}
+
+// CoversPort returns true if the port is one of the ports the rule applies to.
+func (r FirewallRule) CoversPort(port int) bool {
+	return port >= r.ServerPort && port <= r.LastPort()
+}
+
 // TableName specifies the table name for GORM
 func (FirewallRule) TableName() string {
 	return "firewall_rules"
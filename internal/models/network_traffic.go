@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// NetworkTraffic is the cumulative network traffic of a server during a single
+// calendar month.
+type NetworkTraffic struct {
+	ServerUUID string `gorm:"primaryKey" json:"-"`
+
+	// The month the traffic was recorded in, formatted as "2006-01" in UTC
+	Month string `gorm:"primaryKey" json:"month"`
+
+	RxBytes   uint64    `gorm:"not null" json:"rx_bytes"`
+	TxBytes   uint64    `gorm:"not null" json:"tx_bytes"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// The counters last reported by the running container, these allow accounting
+	// to continue without counting traffic twice if the daemon restarts while the
+	// container keeps running
+	LastRxBytes uint64 `gorm:"not null" json:"-"`
+	LastTxBytes uint64 `gorm:"not null" json:"-"`
+}
+
+// TableName specifies the table name for GORM
+func (NetworkTraffic) TableName() string {
+	return "network_traffic"
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Proxy represents a domain that is reverse proxied to a server
+type Proxy struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Server UUID that this proxy forwards requests to
+	ServerUUID string `gorm:"index;not null" json:"server_uuid"`
+
+	// Domain requests are matched on, using the Host header or the TLS server name
+	Domain string `gorm:"index;not null" json:"domain"`
+
+	// Address of the server that requests are forwarded to
+	IP   string `gorm:"not null" json:"ip"`
+	Port string `gorm:"not null" json:"port"`
+
+	// SSL serves the domain over HTTPS, using a certificate requested from the ACME
+	// server when UseLetsEncrypt is set or the certificate that was uploaded otherwise
+	SSL            bool   `json:"ssl"`
+	UseLetsEncrypt bool   `json:"use_lets_encrypt"`
+	ClientEmail    string `json:"client_email"`
+}
+
+// TableName specifies the table name for GORM
+func (Proxy) TableName() string {
+	return "proxies"
+}
+
+// Certificate represents a certificate used to serve a proxied domain over HTTPS
+type Certificate struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Server UUID that the domain is proxied to
+	ServerUUID string `gorm:"index;not null" json:"server_uuid"`
+
+	// Domain the certificate was issued for
+	Domain string `gorm:"index;not null" json:"domain"`
+
+	// Managed certificates were requested from the ACME server using the account of
+	// Email and are renewed before they expire, others were uploaded
+	Managed bool   `json:"managed"`
+	Email   string `json:"email"`
+
+	// Paths the certificate and private key are stored at
+	CertPath string `gorm:"not null" json:"-"`
+	KeyPath  string `gorm:"not null" json:"-"`
+
+	// Expiry of the certificate, and when it was last renewed
+	ExpiresAt time.Time  `json:"expires_at"`
+	RenewedAt *time.Time `json:"renewed_at"`
+
+	// LastError is the reason the last renewal failed, empty if it succeeded
+	LastError string `json:"last_error"`
+}
+
+// TableName specifies the table name for GORM
+func (Certificate) TableName() string {
+	return "proxy_certificates"
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/priyxstudio/propel/environment"
+)
+
+// StatsSample is a single point in the resource usage history of a server. The
+// samples for each resolution are stored as a ring buffer, where the slot for a
+// sample is derived from its timestamp so that new samples overwrite the oldest
+// ones once the configured retention has been reached.
+type StatsSample struct {
+	ServerUUID string `gorm:"primaryKey" json:"-"`
+
+	// The resolution of the sample in seconds, and the position of the sample
+	// within the ring buffer for that resolution
+	Resolution int   `gorm:"primaryKey;autoIncrement:false;index:idx_stats_samples_resolution_time,priority:1" json:"-"`
+	Slot       int64 `gorm:"primaryKey;autoIncrement:false" json:"-"`
+
+	// The start of the period covered by this sample
+	Timestamp time.Time `gorm:"not null;index:idx_stats_samples_resolution_time,priority:2" json:"timestamp"`
+
+	// The average CPU and memory usage over the period, and the last reported
+	// memory limit, network counters and disk usage
+	CpuAbsolute float64                  `json:"cpu_absolute"`
+	Memory      uint64                   `json:"memory_bytes"`
+	MemoryLimit uint64                   `json:"memory_limit_bytes"`
+	Network     environment.NetworkStats `gorm:"embedded;embeddedPrefix:network_" json:"network"`
+	Disk        int64                    `json:"disk_bytes"`
+}
+
+// TableName specifies the table name for GORM
+func (StatsSample) TableName() string {
+	return "stats_samples"
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StreamProxy represents a public port whose TCP or UDP traffic is forwarded to a
+// port allocated to a server
+type StreamProxy struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Server UUID that traffic is forwarded to
+	ServerUUID string `gorm:"index;not null" json:"server_uuid"`
+
+	// Protocol (tcp/udp/both) - defaults to tcp
+	Protocol string `gorm:"default:tcp;not null" json:"protocol"`
+
+	// Address traffic is accepted on
+	ListenIP   string `gorm:"not null" json:"listen_ip"`
+	ListenPort int    `gorm:"not null" json:"listen_port"`
+
+	// Port allocated to the server that traffic is forwarded to
+	ServerPort int `gorm:"not null" json:"server_port"`
+
+	// ProxyProtocol sends an HAProxy PROXY protocol v2 header to the server so that
+	// it sees the address of the client rather than the address of the proxy
+	ProxyProtocol bool `json:"proxy_protocol"`
+}
+
+// TableName specifies the table name for GORM
+func (StreamProxy) TableName() string {
+	return "stream_proxies"
+}
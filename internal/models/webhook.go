@@ -0,0 +1,106 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WebhookFormat represents the payload format used when delivering a webhook
+type WebhookFormat string
+
+const (
+	WebhookFormatJSON    WebhookFormat = "json"
+	WebhookFormatDiscord WebhookFormat = "discord"
+	WebhookFormatSlack   WebhookFormat = "slack"
+)
+
+// IsValid checks if the webhook format is one that is supported
+func (f WebhookFormat) IsValid() bool {
+	switch f {
+	case WebhookFormatJSON, WebhookFormatDiscord, WebhookFormatSlack:
+		return true
+	}
+	return false
+}
+
+// Webhook represents a user defined endpoint that is notified of lifecycle events
+// for a single server
+type Webhook struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Server UUID that this webhook applies to
+	ServerUUID string `gorm:"index;not null" json:"server_uuid"`
+
+	// Human readable name for the webhook
+	Name string `json:"name"`
+
+	// URL that events are delivered to, and the format of the payload
+	URL    string        `gorm:"not null" json:"url"`
+	Format WebhookFormat `gorm:"not null" json:"format"`
+
+	// Secret used to sign deliveries, this is never returned by the API
+	Secret string `json:"-"`
+
+	// Events that are delivered to the webhook, every event is delivered when empty
+	Events []string `gorm:"serializer:json" json:"events"`
+
+	// Whether or not events are currently delivered to the webhook
+	Enabled bool `gorm:"not null" json:"enabled"`
+}
+
+// TableName specifies the table name for GORM
+func (Webhook) TableName() string {
+	return "webhooks"
+}
+
+// WebhookDeliveryStatus represents the state of a single webhook delivery
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryDelivered WebhookDeliveryStatus = "delivered"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is a queued delivery of an event to a webhook endpoint. Pending
+// deliveries form the delivery queue, and completed ones are kept as the delivery
+// log until they are pruned.
+type WebhookDelivery struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Server UUID that the event occurred for
+	ServerUUID string `gorm:"index;not null" json:"server_uuid"`
+
+	// The per-server webhook this delivery is for, or zero for node level webhooks
+	WebhookID uint `gorm:"index" json:"webhook_id"`
+
+	// The event being delivered and where it is being delivered to
+	Event  string        `gorm:"not null" json:"event"`
+	URL    string        `gorm:"not null" json:"url"`
+	Format WebhookFormat `gorm:"not null" json:"format"`
+
+	// The rendered body of the request, and its signature if the webhook has a secret
+	Payload   string `json:"payload"`
+	Signature string `json:"-"`
+
+	// The current state of the delivery and when it will next be attempted
+	Status        WebhookDeliveryStatus `gorm:"index:idx_webhook_deliveries_queue,priority:1;not null" json:"status"`
+	NextAttemptAt time.Time             `gorm:"index:idx_webhook_deliveries_queue,priority:2" json:"next_attempt_at"`
+
+	// The outcome of the most recent attempt
+	Attempts     int        `gorm:"not null" json:"attempts"`
+	ResponseCode int        `json:"response_code"`
+	LastError    string     `json:"last_error"`
+	DeliveredAt  *time.Time `json:"delivered_at"`
+}
+
+// TableName specifies the table name for GORM
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
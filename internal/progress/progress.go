@@ -44,6 +44,12 @@ func (p *Progress) SetTotal(total uint64) {
 	atomic.StoreUint64(&p.total, total)
 }
 
+// Add adds to the number of bytes written without any data being written, such
+// as when data written previously is skipped.
+func (p *Progress) Add(n uint64) {
+	atomic.AddUint64(&p.written, n)
+}
+
 // Write totals the number of bytes that have been written to the writer.
 func (p *Progress) Write(v []byte) (int, error) {
 	n := len(v)
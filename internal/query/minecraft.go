@@ -0,0 +1,108 @@
+package query
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+
+	"emperror.dev/errors"
+	"github.com/goccy/go-json"
+)
+
+// The largest status response that will be read from a Minecraft server, this
+// is generous enough for servers that include a favicon in the response.
+const maxMinecraftResponse = 1024 * 1024
+
+// queryMinecraft performs a Java Edition server list ping over the connection.
+// See https://wiki.vg/Server_List_Ping for details on the protocol.
+func queryMinecraft(conn net.Conn, address string) (*Result, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// Handshake packet with the next state set to "status", followed by the
+	// status request packet.
+	var hs bytes.Buffer
+	hs.WriteByte(0x00)
+	writeVarInt(&hs, -1)
+	writeVarInt(&hs, int32(len(host)))
+	hs.WriteString(host)
+	_ = binary.Write(&hs, binary.BigEndian, uint16(port))
+	writeVarInt(&hs, 1)
+
+	var req bytes.Buffer
+	writeVarInt(&req, int32(hs.Len()))
+	req.Write(hs.Bytes())
+	writeVarInt(&req, 1)
+	req.WriteByte(0x00)
+	if _, err := conn.Write(req.Bytes()); err != nil {
+		return nil, errors.Wrap(err, "query: failed to send status request")
+	}
+
+	r := bufio.NewReader(conn)
+	length, err := readVarInt(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "query: failed to read status response")
+	}
+	if length <= 0 || length > maxMinecraftResponse {
+		return nil, errors.New("query: invalid status response length")
+	}
+	lr := bufio.NewReader(io.LimitReader(r, int64(length)))
+	if id, err := readVarInt(lr); err != nil || id != 0x00 {
+		return nil, errors.New("query: unexpected status response packet")
+	}
+	n, err := readVarInt(lr)
+	if err != nil || n < 0 || n > length {
+		return nil, errors.New("query: invalid status response payload")
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(lr, b); err != nil {
+		return nil, errors.Wrap(err, "query: failed to read status response")
+	}
+
+	var status struct {
+		Players struct {
+			Online int `json:"online"`
+			Max    int `json:"max"`
+		} `json:"players"`
+	}
+	if err := json.Unmarshal(b, &status); err != nil {
+		return nil, errors.Wrap(err, "query: failed to decode status response")
+	}
+	return &Result{Players: status.Players.Online, MaxPlayers: status.Players.Max}, nil
+}
+
+func writeVarInt(w *bytes.Buffer, v int32) {
+	u := uint32(v)
+	for {
+		if u&^0x7f == 0 {
+			w.WriteByte(byte(u))
+			return
+		}
+		w.WriteByte(byte(u&0x7f | 0x80))
+		u >>= 7
+	}
+}
+
+func readVarInt(r io.ByteReader) (int32, error) {
+	var v uint32
+	for i := 0; i < 5; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		v |= uint32(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			return int32(v), nil
+		}
+	}
+	return 0, errors.New("query: varint is too long")
+}
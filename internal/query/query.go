@@ -0,0 +1,75 @@
+// Package query implements lightweight status queries against running game
+// servers so that the daemon can determine how many players are connected.
+package query
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"emperror.dev/errors"
+)
+
+// Protocol is the query protocol used to communicate with a game server.
+type Protocol string
+
+const (
+	// Minecraft uses the Java Edition server list ping over TCP.
+	Minecraft Protocol = "minecraft"
+	// Source uses the Valve A2S_INFO query over UDP.
+	Source Protocol = "source"
+)
+
+// The maximum amount of time a query may take when the context provided does
+// not already have a deadline set.
+const defaultTimeout = time.Second * 5
+
+// ErrUnknownProtocol is returned when a query is performed with a protocol that
+// is not supported.
+var ErrUnknownProtocol = errors.Sentinel("query: unknown protocol")
+
+// Result is the response from a successful query.
+type Result struct {
+	Players    int `json:"players"`
+	MaxPlayers int `json:"max_players"`
+}
+
+// IsValid returns true if the protocol is one that is supported.
+func (p Protocol) IsValid() bool {
+	return p == Minecraft || p == Source
+}
+
+// Query performs a status query against the game server at the given address
+// using the protocol provided.
+func Query(ctx context.Context, p Protocol, address string) (*Result, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultTimeout)
+		defer cancel()
+	}
+
+	var network string
+	switch p {
+	case Minecraft:
+		network = "tcp"
+	case Source:
+		network = "udp"
+	default:
+		return nil, ErrUnknownProtocol
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, errors.Wrap(err, "query: failed to connect to server")
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if p == Minecraft {
+		return queryMinecraft(conn, address)
+	}
+	return querySource(conn)
+}
@@ -0,0 +1,108 @@
+package query
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+// serveMinecraft accepts a single connection and responds to a status request
+// with the provided JSON payload.
+func serveMinecraft(g *goblin.G, payload string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	g.Assert(err).IsNil()
+
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		// Handshake followed by the status request.
+		for i := 0; i < 2; i++ {
+			n, err := readVarInt(r)
+			if err != nil {
+				return
+			}
+			if _, err := io.CopyN(io.Discard, r, int64(n)); err != nil {
+				return
+			}
+		}
+
+		var body bytes.Buffer
+		body.WriteByte(0x00)
+		writeVarInt(&body, int32(len(payload)))
+		body.WriteString(payload)
+
+		var res bytes.Buffer
+		writeVarInt(&res, int32(body.Len()))
+		res.Write(body.Bytes())
+		_, _ = conn.Write(res.Bytes())
+	}()
+
+	return l.Addr().String()
+}
+
+// serveSource responds to A2S_INFO requests, first issuing a challenge.
+func serveSource(g *goblin.G, players byte, max byte) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	g.Assert(err).IsNil()
+
+	go func() {
+		defer conn.Close()
+		buf := make([]byte, 1400)
+		for i := 0; i < 2; i++ {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n == len(sourceInfoRequest) {
+				_, _ = conn.WriteTo([]byte{0xff, 0xff, 0xff, 0xff, 'A', 1, 2, 3, 4}, addr)
+				continue
+			}
+			res := []byte{0xff, 0xff, 0xff, 0xff, 'I', 17}
+			res = append(res, []byte("Server\x00de_dust2\x00csgo\x00Counter-Strike\x00")...)
+			res = append(res, 0xda, 0x02, players, max, 0)
+			_, _ = conn.WriteTo(res, addr)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func TestQuery(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("Query", func() {
+		g.It("reads the players from a minecraft server", func() {
+			addr := serveMinecraft(g, `{"version":{"name":"1.20.4","protocol":765},"players":{"max":20,"online":3}}`)
+
+			res, err := Query(context.Background(), Minecraft, addr)
+			g.Assert(err).IsNil()
+			g.Assert(res.Players).Equal(3)
+			g.Assert(res.MaxPlayers).Equal(20)
+		})
+
+		g.It("reads the players from a source server after a challenge", func() {
+			addr := serveSource(g, 7, 24)
+
+			res, err := Query(context.Background(), Source, addr)
+			g.Assert(err).IsNil()
+			g.Assert(res.Players).Equal(7)
+			g.Assert(res.MaxPlayers).Equal(24)
+		})
+
+		g.It("rejects an unknown protocol", func() {
+			_, err := Query(context.Background(), "gopher", "127.0.0.1:1")
+			g.Assert(err).Equal(ErrUnknownProtocol)
+		})
+	})
+}
@@ -0,0 +1,67 @@
+package query
+
+import (
+	"bytes"
+	"net"
+
+	"emperror.dev/errors"
+)
+
+var sourceInfoRequest = append([]byte{0xff, 0xff, 0xff, 0xff, 'T'}, []byte("Source Engine Query\x00")...)
+
+// querySource performs an A2S_INFO query over the connection, answering the
+// challenge that newer servers respond with before returning the details.
+// See https://developer.valvesoftware.com/wiki/Server_queries for details.
+func querySource(conn net.Conn) (*Result, error) {
+	req := sourceInfoRequest
+	buf := make([]byte, 1400)
+	for attempt := 0; attempt < 2; attempt++ {
+		if _, err := conn.Write(req); err != nil {
+			return nil, errors.Wrap(err, "query: failed to send info request")
+		}
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, errors.Wrap(err, "query: failed to read info response")
+		}
+		b := buf[:n]
+		if len(b) < 5 || !bytes.Equal(b[:4], []byte{0xff, 0xff, 0xff, 0xff}) {
+			return nil, errors.New("query: unexpected info response")
+		}
+		switch b[4] {
+		case 'A':
+			// The server responded with a challenge that must be appended to the
+			// request before it will return the server details.
+			if len(b) < 9 {
+				return nil, errors.New("query: invalid challenge response")
+			}
+			req = append(append([]byte{}, sourceInfoRequest...), b[5:9]...)
+			continue
+		case 'I':
+			return parseSourceInfo(b[5:])
+		default:
+			return nil, errors.New("query: unexpected info response")
+		}
+	}
+	return nil, errors.New("query: server did not respond to challenge")
+}
+
+// parseSourceInfo extracts the player counts from an A2S_INFO response body.
+func parseSourceInfo(b []byte) (*Result, error) {
+	// Skip the protocol version, then the name, map, folder and game strings.
+	if len(b) < 1 {
+		return nil, errors.New("query: truncated info response")
+	}
+	b = b[1:]
+	for i := 0; i < 4; i++ {
+		end := bytes.IndexByte(b, 0x00)
+		if end < 0 {
+			return nil, errors.New("query: truncated info response")
+		}
+		b = b[end+1:]
+	}
+	// Followed by the two byte application ID, players and max players.
+	if len(b) < 4 {
+		return nil, errors.New("query: truncated info response")
+	}
+	return &Result{Players: int(b[2]), MaxPlayers: int(b[3])}, nil
+}
@@ -0,0 +1,280 @@
+// Package rotatelog implements the append-only log files used for the audit log
+// and console transcripts.
+//
+// Lines are appended to a single active file in a directory. Once the active
+// file grows beyond the configured size it is rotated into a timestamped, gzip
+// compressed file, and rotated files are removed once they exceed the
+// configured age or file limits.
+package rotatelog
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/apex/log"
+)
+
+const (
+	rotatedSuffix = ".log.gz"
+	rotatedLayout = "20060102T150405.000000000Z"
+)
+
+// File describes a single log file on the disk.
+type File struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	Compressed bool      `json:"compressed"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+// Limits controls when the active file is rotated and how many rotated files
+// are kept. Any zero value disables that limit.
+type Limits struct {
+	// MaxSize is the size in MiB the active file can reach before it is rotated.
+	MaxSize int64
+	// MaxAge is the number of days rotated files are kept.
+	MaxAge int
+	// MaxFiles is the number of rotated files that are kept.
+	MaxFiles int
+}
+
+// Dir describes a directory of log files. Current is the name of the active
+// file, and rotated files are named using Prefix followed by the time they were
+// rotated.
+type Dir struct {
+	Path    string
+	Current string
+	Prefix  string
+}
+
+// IsLogFile returns true if the name is one that could have been written to
+// the directory.
+func (d Dir) IsLogFile(name string) bool {
+	if filepath.Base(name) != name {
+		return false
+	}
+	return name == d.Current || (strings.HasPrefix(name, d.Prefix) && strings.HasSuffix(name, rotatedSuffix))
+}
+
+// List returns all the log files in the directory, ordered from oldest to
+// newest. The active file, if any, is always the last entry.
+func (d Dir) List() ([]File, error) {
+	entries, err := os.ReadDir(d.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []File{}, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+
+	var current *File
+	out := make([]File, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !d.IsLogFile(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		f := File{
+			Name:       e.Name(),
+			Size:       info.Size(),
+			Compressed: strings.HasSuffix(e.Name(), rotatedSuffix),
+			ModifiedAt: info.ModTime(),
+		}
+		if f.Name == d.Current {
+			current = &f
+			continue
+		}
+		out = append(out, f)
+	}
+	// The rotated file names embed the time they were rotated, so sorting them
+	// by name also sorts them chronologically.
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+	if current != nil {
+		out = append(out, *current)
+	}
+	return out, nil
+}
+
+// Prune removes rotated files that are older than the maximum age, and then the
+// oldest remaining files beyond the maximum file count.
+func (d Dir) Prune(l Limits) error {
+	files, err := d.List()
+	if err != nil {
+		return err
+	}
+
+	keep := make([]File, 0, len(files))
+	for _, f := range files {
+		if !f.Compressed {
+			continue
+		}
+		if l.MaxAge > 0 && time.Since(f.ModifiedAt) > time.Duration(l.MaxAge)*time.Hour*24 {
+			if err := os.Remove(filepath.Join(d.Path, f.Name)); err != nil && !os.IsNotExist(err) {
+				return errors.WithStack(err)
+			}
+			continue
+		}
+		keep = append(keep, f)
+	}
+
+	if l.MaxFiles > 0 && len(keep) > l.MaxFiles {
+		for _, f := range keep[:len(keep)-l.MaxFiles] {
+			if err := os.Remove(filepath.Join(d.Path, f.Name)); err != nil && !os.IsNotExist(err) {
+				return errors.WithStack(err)
+			}
+		}
+	}
+	return nil
+}
+
+// Writer appends lines to the active file of a directory, rotating and pruning
+// the files as needed. The directory and limits are passed on every call since
+// they are read from the configuration, which may change at runtime. The zero
+// value is ready to use.
+type Writer struct {
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// Write appends b to the active file, which is opened if needed, and rotates
+// the file once it has grown beyond the maximum size. The caller is responsible
+// for terminating the line.
+func (w *Writer) Write(d Dir, l Limits, b []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		if err := w.open(d); err != nil {
+			return err
+		}
+	}
+
+	n, err := w.f.Write(b)
+	w.size += int64(n)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if l.MaxSize > 0 && w.size >= l.MaxSize*1024*1024 {
+		return w.rotate(d, l)
+	}
+	return nil
+}
+
+// Rotate closes the active file and moves it aside so that a new one is started
+// with the next write. This is a no-op if there is no active file.
+func (w *Writer) Rotate(d Dir, l Limits) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		if _, err := os.Stat(filepath.Join(d.Path, d.Current)); err != nil {
+			return nil
+		}
+	}
+	return w.rotate(d, l)
+}
+
+// Close closes the active file if it is open.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f = nil
+	w.size = 0
+	return errors.WithStack(err)
+}
+
+func (w *Writer) open(d Dir) error {
+	if err := os.MkdirAll(d.Path, 0o700); err != nil {
+		return errors.Wrap(err, "rotatelog: failed to create directory")
+	}
+	f, err := os.OpenFile(filepath.Join(d.Path, d.Current), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return errors.Wrap(err, "rotatelog: failed to open file")
+	}
+	st, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return errors.WithStack(err)
+	}
+	w.f = f
+	w.size = st.Size()
+	return nil
+}
+
+// rotate must be called while holding the writer lock. The active file is
+// renamed synchronously so that writes can continue immediately, while the
+// compression and pruning are handled in the background.
+func (w *Writer) rotate(d Dir, l Limits) error {
+	if w.f != nil {
+		if err := w.f.Close(); err != nil {
+			log.WithField("directory", d.Path).WithField("error", err).Warn("rotatelog: failed to close file before rotation")
+		}
+		w.f = nil
+		w.size = 0
+	}
+
+	name := d.Prefix + time.Now().UTC().Format(rotatedLayout)
+	tmp := filepath.Join(d.Path, name+".log")
+	if err := os.Rename(filepath.Join(d.Path, d.Current), tmp); err != nil {
+		return errors.Wrap(err, "rotatelog: failed to rotate file")
+	}
+
+	go func() {
+		if err := compress(tmp, filepath.Join(d.Path, name+rotatedSuffix)); err != nil {
+			log.WithField("directory", d.Path).WithField("error", err).Warn("rotatelog: failed to compress rotated file")
+		}
+		if err := d.Prune(l); err != nil {
+			log.WithField("directory", d.Path).WithField("error", err).Warn("rotatelog: failed to prune old files")
+		}
+	}()
+
+	return nil
+}
+
+// compress gzips the source file into the destination and removes the source
+// once it has been fully written.
+func compress(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(dst)
+		return errors.WithStack(err)
+	}
+	if err := gz.Close(); err != nil {
+		_ = out.Close()
+		_ = os.Remove(dst)
+		return errors.WithStack(err)
+	}
+	if err := out.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Remove(src))
+}
@@ -0,0 +1,71 @@
+package rotatelog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIsLogFile(t *testing.T) {
+	d := Dir{Path: t.TempDir(), Current: "test.log", Prefix: "test-"}
+	for name, want := range map[string]bool{
+		"test.log":                                 true,
+		"test-20240101T000000.000000000Z.log.gz":   true,
+		"test-20240101T000000.000000000Z.log":      false,
+		"other.log":                                false,
+		"../test.log":                              false,
+		"test-x/../../etc/passwd.log.gz":           false,
+		"test-20240101T000000.000000000Z.log.gz/x": false,
+	} {
+		if got := d.IsLogFile(name); got != want {
+			t.Errorf("IsLogFile(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestWriterRotateAndPrune(t *testing.T) {
+	d := Dir{Path: t.TempDir(), Current: "test.log", Prefix: "test-"}
+	l := Limits{MaxFiles: 2}
+
+	var w Writer
+	defer w.Close()
+	for i := 0; i < 3; i++ {
+		if err := w.Write(d, l, []byte("line\n")); err != nil {
+			t.Fatalf("unexpected error writing: %v", err)
+		}
+		if err := w.Rotate(d, l); err != nil {
+			t.Fatalf("unexpected error rotating: %v", err)
+		}
+		// Rotated names are based on the current time, make sure they never collide.
+		time.Sleep(time.Millisecond)
+	}
+
+	// Compression happens in the background, wait for the temporary files to be
+	// cleaned up before pruning.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		matches, _ := filepath.Glob(filepath.Join(d.Path, "*[0-9]Z.log"))
+		if len(matches) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for rotated files to be compressed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := d.Prune(l); err != nil {
+		t.Fatalf("unexpected error pruning: %v", err)
+	}
+
+	files, err := d.List()
+	if err != nil {
+		t.Fatalf("unexpected error listing: %v", err)
+	}
+	if len(files) != 2 || !files[0].Compressed || files[0].Name >= files[1].Name {
+		t.Fatalf("expected the two newest rotated files, got %+v", files)
+	}
+	if _, err := os.Stat(filepath.Join(d.Path, d.Current)); !os.IsNotExist(err) {
+		t.Errorf("expected the active file to have been rotated, got %v", err)
+	}
+}
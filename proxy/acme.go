@@ -0,0 +1,250 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"emperror.dev/errors"
+	"github.com/apex/log"
+	"github.com/go-acme/lego/v4/certcrypto"
+	"github.com/go-acme/lego/v4/certificate"
+	"github.com/go-acme/lego/v4/challenge/http01"
+	"github.com/go-acme/lego/v4/challenge/tlsalpn01"
+	"github.com/go-acme/lego/v4/lego"
+	"github.com/go-acme/lego/v4/registration"
+
+	"github.com/priyxstudio/propel/config"
+)
+
+// nginxChallengePort is the port HTTP-01 challenges are answered on when nginx
+// serves the proxied domains.
+const nginxChallengePort = "81"
+
+// acmeUser is an account on the ACME server.
+type acmeUser struct {
+	email        string
+	registration *registration.Resource
+	key          crypto.PrivateKey
+}
+
+func (u *acmeUser) GetEmail() string {
+	return u.email
+}
+
+func (u *acmeUser) GetRegistration() *registration.Resource {
+	return u.registration
+}
+
+func (u *acmeUser) GetPrivateKey() crypto.PrivateKey {
+	return u.key
+}
+
+// acmeManager requests certificates from the ACME server, answering the HTTP-01
+// and TLS-ALPN-01 challenges from the listeners of the built-in proxy rather than
+// starting servers of its own.
+type acmeManager struct {
+	// mu serialises requests to the ACME server.
+	mu      sync.Mutex
+	clients map[string]*lego.Client
+
+	challengeMu sync.RWMutex
+	// tokens are the key authorizations of the pending HTTP-01 challenges.
+	tokens map[string]string
+	// alpn are the certificates of the pending TLS-ALPN-01 challenges.
+	alpn map[string]*tls.Certificate
+}
+
+func newACMEManager() *acmeManager {
+	return &acmeManager{
+		clients: make(map[string]*lego.Client),
+		tokens:  make(map[string]string),
+		alpn:    make(map[string]*tls.Certificate),
+	}
+}
+
+// accountKey returns the private key of the ACME account of an email address,
+// generating and storing one if the account has not been used before. The
+// returned bool is true if the key was generated.
+func accountKey(email string) (crypto.PrivateKey, bool, error) {
+	sum := sha256.Sum256([]byte(strings.ToLower(email)))
+	p := filepath.Join(certificateDirectory(), "accounts", hex.EncodeToString(sum[:8])+".key")
+
+	if b, err := os.ReadFile(p); err == nil {
+		block, _ := pem.Decode(b)
+		if block == nil {
+			return nil, false, errors.Errorf("proxy: invalid account key %s", p)
+		}
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, false, errors.WithStack(err)
+		}
+		return key, false, nil
+	} else if !os.IsNotExist(err) {
+		return nil, false, errors.WithStack(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+	if err := os.WriteFile(p, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+	return key, true, nil
+}
+
+// client returns the ACME client of an email address, registering the account
+// with the ACME server if it has not been used before. This must be called while
+// holding the lock.
+func (a *acmeManager) client(email string) (*lego.Client, error) {
+	if c, ok := a.clients[email]; ok {
+		return c, nil
+	}
+
+	key, created, err := accountKey(email)
+	if err != nil {
+		return nil, err
+	}
+	user := &acmeUser{email: email, key: key}
+
+	cfg := lego.NewConfig(user)
+	cfg.CADirURL = config.Get().System.Proxy.ACMEDirectory
+	cfg.Certificate.KeyType = certcrypto.EC256
+	c, err := lego.NewClient(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "proxy: failed to create ACME client")
+	}
+	if Builtin() {
+		if err := c.Challenge.SetHTTP01Provider(&httpProvider{a}); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if err := c.Challenge.SetTLSALPN01Provider(&alpnProvider{a}); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	} else {
+		// The nginx site files pass the HTTP-01 challenges through to this port.
+		if err := c.Challenge.SetHTTP01Provider(http01.NewProviderServer("", nginxChallengePort)); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	var reg *registration.Resource
+	if !created {
+		reg, err = c.Registration.ResolveAccountByKey()
+	}
+	if created || err != nil {
+		reg, err = c.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
+		if err != nil {
+			return nil, errors.Wrap(err, "proxy: failed to register ACME account")
+		}
+	}
+	user.registration = reg
+
+	a.clients[email] = c
+	return c, nil
+}
+
+// obtain requests a certificate for the domain from the ACME server, returning
+// the PEM encoded certificate bundle and private key.
+func (a *acmeManager) obtain(domain, email string) ([]byte, []byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	c, err := a.client(email)
+	if err != nil {
+		return nil, nil, errors.Wrap(ErrCertificateRequest, err.Error())
+	}
+
+	log.WithField("domain", domain).Info("proxy: requesting certificate")
+	res, err := c.Certificate.Obtain(certificate.ObtainRequest{
+		Domains: []string{domain},
+		Bundle:  true,
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(ErrCertificateRequest, err.Error())
+	}
+	return res.Certificate, res.PrivateKey, nil
+}
+
+// ObtainCertificate requests a certificate for the domain from the ACME server
+// using the account of the email address, returning the PEM encoded certificate
+// bundle and private key.
+func ObtainCertificate(domain, email string) ([]byte, []byte, error) {
+	return Get().acme.obtain(domain, email)
+}
+
+// token returns the key authorization of a pending HTTP-01 challenge.
+func (a *acmeManager) token(token string) (string, bool) {
+	a.challengeMu.RLock()
+	defer a.challengeMu.RUnlock()
+	v, ok := a.tokens[token]
+	return v, ok
+}
+
+// alpnCertificate returns the certificate of a pending TLS-ALPN-01 challenge.
+func (a *acmeManager) alpnCertificate(domain string) *tls.Certificate {
+	a.challengeMu.RLock()
+	defer a.challengeMu.RUnlock()
+	return a.alpn[strings.ToLower(domain)]
+}
+
+// httpProvider answers HTTP-01 challenges from the HTTP listener of the proxy.
+type httpProvider struct {
+	a *acmeManager
+}
+
+func (p *httpProvider) Present(_, token, keyAuth string) error {
+	p.a.challengeMu.Lock()
+	defer p.a.challengeMu.Unlock()
+	p.a.tokens[token] = keyAuth
+	return nil
+}
+
+func (p *httpProvider) CleanUp(_, token, _ string) error {
+	p.a.challengeMu.Lock()
+	defer p.a.challengeMu.Unlock()
+	delete(p.a.tokens, token)
+	return nil
+}
+
+// alpnProvider answers TLS-ALPN-01 challenges from the HTTPS listener of the
+// proxy.
+type alpnProvider struct {
+	a *acmeManager
+}
+
+func (p *alpnProvider) Present(domain, _, keyAuth string) error {
+	cert, err := tlsalpn01.ChallengeCert(domain, keyAuth)
+	if err != nil {
+		return err
+	}
+	p.a.challengeMu.Lock()
+	defer p.a.challengeMu.Unlock()
+	p.a.alpn[strings.ToLower(domain)] = cert
+	return nil
+}
+
+func (p *alpnProvider) CleanUp(domain, _, _ string) error {
+	p.a.challengeMu.Lock()
+	defer p.a.challengeMu.Unlock()
+	delete(p.a.alpn, strings.ToLower(domain))
+	return nil
+}
@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+
+	"emperror.dev/errors"
+	"github.com/apex/log"
+
+	"github.com/priyxstudio/propel/config"
+)
+
+// certificateDirectory returns the directory the certificates of the built-in
+// proxy are stored in.
+func certificateDirectory() string {
+	cfg := config.Get().System
+	if cfg.Proxy.CertificateDirectory != "" {
+		return cfg.Proxy.CertificateDirectory
+	}
+	return filepath.Join(cfg.RootDirectory, "certificates")
+}
+
+// domainDirectory returns the directory the certificate of a domain is stored
+// in. The domain must have been normalized.
+func domainDirectory(domain string) string {
+	return filepath.Join(certificateDirectory(), domain)
+}
+
+// certificatePaths returns the paths of the certificate and private key of a
+// domain.
+func certificatePaths(domain string) (string, string) {
+	dir := domainDirectory(domain)
+	return filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+}
+
+// parseCertificate parses a PEM encoded certificate and private key, filling in
+// the parsed leaf certificate.
+func parseCertificate(certPEM, keyPEM []byte) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidProxy, err.Error())
+	}
+	if cert.Leaf == nil {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, errors.Wrap(ErrInvalidProxy, err.Error())
+		}
+		cert.Leaf = leaf
+	}
+	return &cert, nil
+}
+
+// loadCertificate reads the certificate of a domain from the disk, using the
+// paths it was recorded with.
+func loadCertificate(domain string) (*tls.Certificate, error) {
+	certPath, keyPath := certificatePaths(domain)
+	if c, err := certificateRecord(domain); err != nil {
+		return nil, err
+	} else if c != nil {
+		certPath, keyPath = c.CertPath, c.KeyPath
+	}
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return parseCertificate(certPEM, keyPEM)
+}
+
+// writeCertificate writes a certificate and private key to the disk.
+func writeCertificate(certPath, keyPath string, certPEM, keyPEM []byte) error {
+	if err := os.MkdirAll(filepath.Dir(certPath), 0o700); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0o700); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.WriteFile(certPath, certPEM, 0o644); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0o600); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// saveCertificate checks that the certificate and private key of a domain are
+// valid and writes them to the disk.
+func saveCertificate(domain string, certPEM, keyPEM []byte) (*tls.Certificate, error) {
+	cert, err := parseCertificate(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	certPath, keyPath := certificatePaths(domain)
+	if err := writeCertificate(certPath, keyPath, certPEM, keyPEM); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// removeCertificate removes the certificate of a domain from the disk.
+func removeCertificate(domain string) {
+	if err := os.RemoveAll(domainDirectory(domain)); err != nil {
+		log.WithField("domain", domain).WithError(err).Warn("proxy: failed to remove certificate")
+	}
+}
@@ -0,0 +1,285 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"emperror.dev/errors"
+	"github.com/apex/log"
+
+	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/internal/database"
+	"github.com/priyxstudio/propel/internal/models"
+)
+
+// The values of the proxy mode configuration option.
+const (
+	// ModeNginx writes a site file for each proxied domain to an existing nginx
+	// install.
+	ModeNginx = "nginx"
+	// ModeBuiltin proxies requests from the daemon itself using Manager.
+	ModeBuiltin = "builtin"
+)
+
+var (
+	// ErrDomainInUse is returned when a domain is already proxied to another
+	// server.
+	ErrDomainInUse = errors.Sentinel("proxy: domain is already proxied to another server")
+	// ErrInvalidProxy is returned when a proxy definition has an invalid domain,
+	// address or certificate.
+	ErrInvalidProxy = errors.Sentinel("proxy: invalid proxy definition")
+	// ErrCertificateRequest is returned when a certificate could not be obtained
+	// from the ACME server.
+	ErrCertificateRequest = errors.Sentinel("proxy: failed to request certificate")
+)
+
+// Builtin returns true if proxied domains are served by the built-in proxy
+// rather than nginx.
+func Builtin() bool {
+	return config.Get().System.Proxy.Mode == ModeBuiltin
+}
+
+// route is a proxied domain along with the reverse proxy that forwards requests
+// for it.
+type route struct {
+	proxy   models.Proxy
+	handler *httputil.ReverseProxy
+}
+
+// Manager keeps track of the proxied domains and their certificates, and serves
+// them from the HTTP and HTTPS listeners of the built-in proxy.
+type Manager struct {
+	mu     sync.RWMutex
+	routes map[string]*route
+	certs  map[string]*tls.Certificate
+
+	acme *acmeManager
+}
+
+var (
+	instance     *Manager
+	instanceOnce sync.Once
+)
+
+// Get returns the proxy manager of the daemon.
+func Get() *Manager {
+	instanceOnce.Do(func() {
+		instance = newManager()
+	})
+	return instance
+}
+
+func newManager() *Manager {
+	return &Manager{
+		routes: make(map[string]*route),
+		certs:  make(map[string]*tls.Certificate),
+		acme:   newACMEManager(),
+	}
+}
+
+// normalizeDomain lowercases the domain and strips a trailing dot, returning an
+// error if it is not a valid host name. Domains are used in paths on the disk so
+// this must be checked before anything else is done with them.
+func normalizeDomain(domain string) (string, error) {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if domain == "" || len(domain) > 253 {
+		return "", errors.Wrap(ErrInvalidProxy, "domain must be between 1 and 253 characters")
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return "", errors.Wrapf(ErrInvalidProxy, "invalid domain %q", domain)
+		}
+		for _, r := range label {
+			if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+				return "", errors.Wrapf(ErrInvalidProxy, "invalid domain %q", domain)
+			}
+		}
+	}
+	return domain, nil
+}
+
+// newRoute returns the route for a proxy, checking that it forwards requests to
+// a valid address.
+func newRoute(p models.Proxy) (*route, error) {
+	if net.ParseIP(p.IP) == nil {
+		return nil, errors.Wrapf(ErrInvalidProxy, "invalid ip %q", p.IP)
+	}
+	if port, err := strconv.Atoi(p.Port); err != nil || port < 1 || port > 65535 {
+		return nil, errors.Wrapf(ErrInvalidProxy, "invalid port %q", p.Port)
+	}
+	target := &url.URL{Scheme: "http", Host: net.JoinHostPort(p.IP, p.Port)}
+	return &route{
+		proxy: p,
+		handler: &httputil.ReverseProxy{
+			Rewrite: func(r *httputil.ProxyRequest) {
+				r.SetURL(target)
+				r.Out.Host = r.In.Host
+				r.SetXForwarded()
+			},
+		},
+	}, nil
+}
+
+// Load reads every proxy definition from the database along with the
+// certificates of the domains served over HTTPS.
+func (m *Manager) Load() error {
+	var proxies []models.Proxy
+	if err := database.Instance().Find(&proxies).Error; err != nil {
+		return errors.Wrap(err, "proxy: failed to fetch proxies")
+	}
+
+	routes := make(map[string]*route, len(proxies))
+	certs := make(map[string]*tls.Certificate)
+	for _, p := range proxies {
+		r, err := newRoute(p)
+		if err != nil {
+			log.WithField("domain", p.Domain).WithError(err).Warn("proxy: skipping invalid proxy definition")
+			continue
+		}
+		routes[p.Domain] = r
+		if !p.SSL {
+			continue
+		}
+		cert, err := loadCertificate(p.Domain)
+		if err != nil {
+			log.WithField("domain", p.Domain).WithError(err).Warn("proxy: failed to load certificate, the domain will not be served over HTTPS")
+			continue
+		}
+		certs[p.Domain] = cert
+	}
+
+	m.mu.Lock()
+	m.routes = routes
+	m.certs = certs
+	m.mu.Unlock()
+
+	log.WithField("proxies", len(routes)).Debug("proxy: loaded proxy definitions")
+	return nil
+}
+
+// Create stores a proxy definition and starts serving the domain. Certificates
+// are requested from the ACME server when the proxy uses Let's Encrypt, or taken
+// from certPEM and keyPEM otherwise. A domain that is already proxied to the
+// same server is replaced.
+func (m *Manager) Create(p models.Proxy, certPEM, keyPEM []byte) error {
+	if err := checkDomain(&p); err != nil {
+		return err
+	}
+	domain := p.Domain
+
+	r, err := newRoute(p)
+	if err != nil {
+		return err
+	}
+
+	var cert *tls.Certificate
+	if p.SSL {
+		if p.UseLetsEncrypt {
+			certPEM, keyPEM, err = m.acme.obtain(domain, p.ClientEmail)
+			if err != nil {
+				return err
+			}
+		}
+		if cert, err = saveCertificate(domain, certPEM, keyPEM); err != nil {
+			return err
+		}
+		certPath, keyPath := certificatePaths(domain)
+		err = RecordCertificate(&models.Certificate{
+			ServerUUID: p.ServerUUID,
+			Domain:     domain,
+			Managed:    p.UseLetsEncrypt,
+			Email:      p.ClientEmail,
+			CertPath:   certPath,
+			KeyPath:    keyPath,
+		}, certPEM)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := Save(&p); err != nil {
+		return err
+	}
+	r.proxy = p
+
+	m.mu.Lock()
+	m.routes[domain] = r
+	if cert != nil {
+		m.certs[domain] = cert
+	} else {
+		delete(m.certs, domain)
+	}
+	m.mu.Unlock()
+
+	if cert == nil {
+		if err := forgetCertificate(domain); err != nil {
+			return err
+		}
+		removeCertificate(domain)
+	}
+	return nil
+}
+
+// Delete stops serving a domain of the server on the given port and removes its
+// certificate. Nothing is done if there is no such proxy.
+func (m *Manager) Delete(serverUUID, domain, port string) error {
+	proxies, err := Remove(serverUUID, domain, port)
+	m.drop(proxies)
+	return err
+}
+
+// DeleteServer stops serving every domain proxied to the server, this is called
+// when the server is deleted or transferred to another node.
+func (m *Manager) DeleteServer(serverUUID string) error {
+	proxies, err := RemoveServer(serverUUID)
+	m.drop(proxies)
+	return err
+}
+
+// drop stops serving the domains of proxies that have been removed.
+func (m *Manager) drop(proxies []models.Proxy) {
+	for _, p := range proxies {
+		m.mu.Lock()
+		delete(m.routes, p.Domain)
+		delete(m.certs, p.Domain)
+		m.mu.Unlock()
+
+		removeCertificate(p.Domain)
+		log.WithFields(log.Fields{"domain": p.Domain, "server_id": p.ServerUUID}).Info("proxy: removed proxied domain")
+	}
+}
+
+// setCertificate replaces the certificate a domain is served with, this is done
+// when the certificate is renewed.
+func (m *Manager) setCertificate(domain string, cert *tls.Certificate) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.routes[domain]; ok {
+		m.certs[domain] = cert
+	}
+}
+
+// lookup returns the route for the host of a request, ignoring the port.
+func (m *Manager) lookup(host string) *route {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.routes[host]
+}
+
+// certificate returns the certificate of a domain, or nil if it is not served
+// over HTTPS.
+func (m *Manager) certificate(domain string) *tls.Certificate {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.certs[strings.TrimSuffix(strings.ToLower(domain), ".")]
+}
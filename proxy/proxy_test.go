@@ -0,0 +1,166 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-acme/lego/v4/challenge/tlsalpn01"
+
+	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/internal/models"
+)
+
+func TestNormalizeDomain(t *testing.T) {
+	for in, want := range map[string]string{
+		"Example.COM":       "example.com",
+		"play.example.com.": "play.example.com",
+		"a-b.example.com":   "a-b.example.com",
+	} {
+		got, err := normalizeDomain(in)
+		if err != nil || got != want {
+			t.Fatalf("normalizeDomain(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "../etc", "example..com", "-a.example.com", "exa mple.com", "a/b.com"} {
+		if _, err := normalizeDomain(in); err == nil {
+			t.Fatalf("expected %q to be rejected", in)
+		}
+	}
+}
+
+func newTestManager(t *testing.T, p models.Proxy) *Manager {
+	config.Set(&config.Configuration{
+		AuthenticationToken: "abc",
+		System:              config.SystemConfiguration{Proxy: config.ProxyConfiguration{HTTPSPort: 443}},
+	})
+
+	m := newManager()
+	r, err := newRoute(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.routes[p.Domain] = r
+	return m
+}
+
+func TestServeHTTP(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Host+" "+r.Header.Get("X-Forwarded-For"))
+	}))
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+
+	m := newTestManager(t, models.Proxy{Domain: "play.example.com", IP: u.Hostname(), Port: u.Port()})
+
+	serve := func(host, path string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "http://"+host+path, nil)
+		w := httptest.NewRecorder()
+		m.serveHTTP(w, r)
+		return w
+	}
+
+	if w := serve("play.example.com", "/"); w.Code != http.StatusOK || w.Body.String() != "play.example.com 192.0.2.1" {
+		t.Fatalf("unexpected proxied response: %d %q", w.Code, w.Body.String())
+	}
+	if w := serve("other.example.com", "/"); w.Code != http.StatusNotFound {
+		t.Fatalf("expected unknown domain to return 404, got %d", w.Code)
+	}
+
+	_ = (&httpProvider{m.acme}).Present("play.example.com", "token", "token.key")
+	if w := serve("play.example.com", challengePrefix+"token"); w.Body.String() != "token.key" {
+		t.Fatalf("expected challenge to be answered, got %q", w.Body.String())
+	}
+
+	// Domains served over HTTPS are redirected once they have a certificate.
+	m.routes["play.example.com"].proxy.SSL = true
+	m.certs["play.example.com"] = &tls.Certificate{}
+	w := serve("play.example.com", "/maps?x=1")
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "https://play.example.com/maps?x=1" {
+		t.Fatalf("unexpected redirect: %d %q", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestGetCertificate(t *testing.T) {
+	m := newTestManager(t, models.Proxy{Domain: "play.example.com", IP: "127.0.0.1", Port: "8080", SSL: true})
+	cert := &tls.Certificate{}
+	m.certs["play.example.com"] = cert
+
+	if c, err := m.getCertificate(&tls.ClientHelloInfo{ServerName: "PLAY.example.com"}); err != nil || c != cert {
+		t.Fatalf("expected certificate of the domain, got %v", err)
+	}
+	if _, err := m.getCertificate(&tls.ClientHelloInfo{ServerName: "other.example.com"}); err == nil {
+		t.Fatal("expected unknown domain to have no certificate")
+	}
+
+	hello := &tls.ClientHelloInfo{ServerName: "play.example.com", SupportedProtos: []string{tlsalpn01.ACMETLS1Protocol}}
+	if _, err := m.getCertificate(hello); err == nil {
+		t.Fatal("expected no certificate without a pending challenge")
+	}
+	if err := (&alpnProvider{m.acme}).Present("play.example.com", "token", "token.key"); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := m.getCertificate(hello); err != nil || c == cert {
+		t.Fatalf("expected challenge certificate, got %v", err)
+	}
+}
+
+func TestCertificateExpiry(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"play.example.com"},
+		NotBefore:    expires.AddDate(0, -3, 0),
+		NotAfter:     expires,
+	}, &x509.Certificate{SerialNumber: big.NewInt(1)}, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The leaf certificate is found after any other blocks in the bundle.
+	bundle := append(pem.EncodeToMemory(&pem.Block{Type: "EC PARAMETERS", Bytes: []byte{0x06}}), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	got, err := certificateExpiry(bundle)
+	if err != nil || !got.Equal(expires) {
+		t.Fatalf("certificateExpiry() = %v, %v; want %v", got, err, expires)
+	}
+	if _, err := certificateExpiry([]byte("not a certificate")); err == nil {
+		t.Fatal("expected invalid certificate to be rejected")
+	}
+}
+
+func TestCertificateStatus(t *testing.T) {
+	config.Set(&config.Configuration{
+		AuthenticationToken: "abc",
+		System:              config.SystemConfiguration{Proxy: config.ProxyConfiguration{RenewBefore: 30}},
+	})
+	now := time.Now()
+
+	for _, tc := range []struct {
+		cert models.Certificate
+		want string
+	}{
+		{models.Certificate{Managed: true, ExpiresAt: now.AddDate(0, 0, 60)}, CertificateValid},
+		{models.Certificate{Managed: true, ExpiresAt: now.AddDate(0, 0, 10)}, CertificateExpiring},
+		{models.Certificate{Managed: true, ExpiresAt: now.AddDate(0, 0, 10), LastError: "timeout"}, CertificateRenewalFailed},
+		{models.Certificate{Managed: false, ExpiresAt: now.AddDate(0, 0, 10), LastError: "timeout"}, CertificateExpiring},
+		{models.Certificate{Managed: true, ExpiresAt: now.Add(-time.Minute), LastError: "timeout"}, CertificateExpired},
+	} {
+		if got := certificateStatus(tc.cert, now); got != tc.want {
+			t.Fatalf("certificateStatus(%+v) = %q, want %q", tc.cert, got, tc.want)
+		}
+	}
+}
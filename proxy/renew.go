@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"context"
+	"os/exec"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/apex/log"
+
+	"github.com/priyxstudio/propel/internal/database"
+	"github.com/priyxstudio/propel/internal/models"
+)
+
+// RenewalFailure is a managed certificate that could not be renewed.
+type RenewalFailure struct {
+	Certificate models.Certificate
+	Err         error
+}
+
+// RenewCertificates requests a new certificate for every managed certificate
+// that expires within the configured number of days, returning the certificates
+// that could not be renewed. Failures are recorded on the certificate and retried
+// on the next run.
+func RenewCertificates(ctx context.Context) ([]RenewalFailure, error) {
+	var certs []models.Certificate
+	err := database.Instance().
+		Where("managed = ? AND expires_at < ?", true, time.Now().Add(renewBefore()).UTC()).
+		Order("expires_at ASC").
+		Find(&certs).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "proxy: failed to fetch certificates")
+	}
+
+	var failures []RenewalFailure
+	var renewed bool
+	for _, c := range certs {
+		if ctx.Err() != nil {
+			return failures, ctx.Err()
+		}
+		if err := renew(&c); err != nil {
+			log.WithField("domain", c.Domain).WithError(err).Error("proxy: failed to renew certificate")
+			c.LastError = err.Error()
+			if err := database.Instance().Model(&c).Update("last_error", c.LastError).Error; err != nil {
+				log.WithField("domain", c.Domain).WithError(err).Warn("proxy: failed to record certificate renewal failure")
+			}
+			failures = append(failures, RenewalFailure{Certificate: c, Err: err})
+			continue
+		}
+		renewed = true
+		log.WithFields(log.Fields{"domain": c.Domain, "expires_at": c.ExpiresAt}).Info("proxy: renewed certificate")
+	}
+
+	if renewed && !Builtin() {
+		if err := exec.Command("systemctl", "reload", "nginx").Run(); err != nil {
+			log.WithError(err).Warn("proxy: failed to reload nginx after renewing certificates")
+		}
+	}
+	return failures, nil
+}
+
+// renew requests a new certificate for a managed certificate, writing it over the
+// previous certificate and serving it from the built-in proxy.
+func renew(c *models.Certificate) error {
+	certPEM, keyPEM, err := ObtainCertificate(c.Domain, c.Email)
+	if err != nil {
+		return err
+	}
+	cert, err := parseCertificate(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	if err := writeCertificate(c.CertPath, c.KeyPath, certPEM, keyPEM); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	c.RenewedAt = &now
+	if err := RecordCertificate(c, certPEM); err != nil {
+		return err
+	}
+	if Builtin() {
+		Get().setCertificate(c.Domain, cert)
+	}
+	return nil
+}
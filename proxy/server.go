@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/apex/log"
+	"github.com/go-acme/lego/v4/challenge/tlsalpn01"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/priyxstudio/propel/config"
+)
+
+// challengePrefix is the path HTTP-01 challenge tokens are requested beneath.
+const challengePrefix = "/.well-known/acme-challenge/"
+
+// serveHTTP answers HTTP-01 challenges, redirects domains served over HTTPS and
+// proxies the rest.
+func (m *Manager) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if token, ok := strings.CutPrefix(r.URL.Path, challengePrefix); ok {
+		if keyAuth, ok := m.acme.token(token); ok {
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte(keyAuth))
+			return
+		}
+	}
+
+	rt := m.lookup(r.Host)
+	if rt == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if rt.proxy.SSL && m.certificate(rt.proxy.Domain) != nil {
+		host := rt.proxy.Domain
+		if port := config.Get().System.Proxy.HTTPSPort; port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+		return
+	}
+	rt.handler.ServeHTTP(w, r)
+}
+
+// serveHTTPS proxies requests for domains served over HTTPS.
+func (m *Manager) serveHTTPS(w http.ResponseWriter, r *http.Request) {
+	rt := m.lookup(r.Host)
+	if rt == nil || !rt.proxy.SSL {
+		http.NotFound(w, r)
+		return
+	}
+	rt.handler.ServeHTTP(w, r)
+}
+
+// getCertificate picks the certificate for a TLS connection using the server
+// name it was opened for, answering TLS-ALPN-01 challenges.
+func (m *Manager) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if slices.Contains(hello.SupportedProtos, tlsalpn01.ACMETLS1Protocol) {
+		if cert := m.acme.alpnCertificate(hello.ServerName); cert != nil {
+			return cert, nil
+		}
+		return nil, errors.Errorf("proxy: no pending challenge for %q", hello.ServerName)
+	}
+	if cert := m.certificate(hello.ServerName); cert != nil {
+		return cert, nil
+	}
+	return nil, errors.Errorf("proxy: no certificate for %q", hello.ServerName)
+}
+
+// Run loads the proxy definitions and serves them until the context is done.
+// Certificates are renewed by the renewal job of the cron scheduler.
+func (m *Manager) Run(ctx context.Context) error {
+	cfg := config.Get().System.Proxy
+	if err := m.Load(); err != nil {
+		return err
+	}
+
+	httpServer := &http.Server{
+		Addr:              net.JoinHostPort(cfg.BindAddress, strconv.Itoa(cfg.HTTPPort)),
+		Handler:           http.HandlerFunc(m.serveHTTP),
+		ReadHeaderTimeout: time.Second * 10,
+		IdleTimeout:       time.Minute,
+	}
+	httpsServer := &http.Server{
+		Addr:              net.JoinHostPort(cfg.BindAddress, strconv.Itoa(cfg.HTTPSPort)),
+		Handler:           http.HandlerFunc(m.serveHTTPS),
+		ReadHeaderTimeout: time.Second * 10,
+		IdleTimeout:       time.Minute,
+		TLSConfig: &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			NextProtos:     []string{"h2", "http/1.1", tlsalpn01.ACMETLS1Protocol},
+			GetCertificate: m.getCertificate,
+		},
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		log.WithField("listen", httpServer.Addr).Info("proxy: listening for HTTP connections")
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			return errors.Wrap(err, "proxy: failed to start HTTP server")
+		}
+		return nil
+	})
+	g.Go(func() error {
+		log.WithField("listen", httpsServer.Addr).Info("proxy: listening for HTTPS connections")
+		if err := httpsServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+			return errors.Wrap(err, "proxy: failed to start HTTPS server")
+		}
+		return nil
+	})
+	g.Go(func() error {
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+		_ = httpServer.Shutdown(sctx)
+		_ = httpsServer.Shutdown(sctx)
+		return nil
+	})
+	return g.Wait()
+}
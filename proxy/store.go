@@ -0,0 +1,263 @@
+package proxy
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"time"
+
+	"emperror.dev/errors"
+
+	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/internal/database"
+	"github.com/priyxstudio/propel/internal/models"
+)
+
+// The status of the certificate of a proxied domain.
+const (
+	// CertificateValid is a certificate that is not due to be renewed yet.
+	CertificateValid = "valid"
+	// CertificateExpiring is a certificate that expires within the renewal window,
+	// managed certificates are renewed by the next run of the renewal job.
+	CertificateExpiring = "expiring"
+	// CertificateExpired is a certificate that has expired.
+	CertificateExpired = "expired"
+	// CertificateRenewalFailed is a managed certificate whose last renewal failed.
+	CertificateRenewalFailed = "renewal_failed"
+)
+
+// Entry is a domain proxied to a server.
+type Entry struct {
+	Domain string `json:"domain"`
+	IP     string `json:"ip"`
+	Port   string `json:"port"`
+	SSL    bool   `json:"ssl"`
+	// Certificate is the certificate the domain is served with, this is nil if
+	// the domain is not served over HTTPS.
+	Certificate *CertificateInfo `json:"certificate"`
+}
+
+// CertificateInfo is the state of the certificate of a proxied domain.
+type CertificateInfo struct {
+	Managed   bool       `json:"managed"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RenewedAt *time.Time `json:"renewed_at"`
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// renewBefore returns how long before they expire managed certificates are
+// renewed.
+func renewBefore() time.Duration {
+	return time.Duration(config.Get().System.Proxy.RenewBefore) * time.Hour * 24
+}
+
+// certificateStatus returns the status of a certificate at the given time.
+func certificateStatus(c models.Certificate, now time.Time) string {
+	switch {
+	case !c.ExpiresAt.After(now):
+		return CertificateExpired
+	case c.Managed && c.LastError != "":
+		return CertificateRenewalFailed
+	case c.ExpiresAt.Before(now.Add(renewBefore())):
+		return CertificateExpiring
+	default:
+		return CertificateValid
+	}
+}
+
+// lookup returns the definition of a proxied domain, or nil if the domain is
+// not proxied.
+func lookup(domain string) (*models.Proxy, error) {
+	var p models.Proxy
+	tx := database.Instance().Where("domain = ?", domain).Limit(1).Find(&p)
+	if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "proxy: failed to fetch proxy")
+	}
+	if tx.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &p, nil
+}
+
+// checkDomain normalizes the domain of a proxy definition, returning an error if
+// it is invalid or already proxied to another server.
+func checkDomain(p *models.Proxy) error {
+	domain, err := normalizeDomain(p.Domain)
+	if err != nil {
+		return err
+	}
+	p.Domain = domain
+
+	existing, err := lookup(domain)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		if existing.ServerUUID != p.ServerUUID {
+			return ErrDomainInUse
+		}
+		p.ID = existing.ID
+		p.CreatedAt = existing.CreatedAt
+	}
+	return nil
+}
+
+// Save stores a proxy definition, replacing the definition of the domain if it
+// is already proxied to the same server. This only records the definition, the
+// built-in proxy starts serving domains through Manager.Create.
+func Save(p *models.Proxy) error {
+	if err := checkDomain(p); err != nil {
+		return err
+	}
+	if err := database.Instance().Save(p).Error; err != nil {
+		return errors.Wrap(err, "proxy: failed to save proxy")
+	}
+	return nil
+}
+
+// Remove deletes the definition of a domain of the server on the given port, and
+// the record of its certificate, returning the removed definitions.
+func Remove(serverUUID, domain, port string) ([]models.Proxy, error) {
+	domain, err := normalizeDomain(domain)
+	if err != nil {
+		return nil, err
+	}
+	var proxies []models.Proxy
+	if err := database.Instance().Where("server_uuid = ? AND domain = ? AND port = ?", serverUUID, domain, port).Find(&proxies).Error; err != nil {
+		return nil, errors.Wrap(err, "proxy: failed to fetch proxy")
+	}
+	return removeProxies(proxies)
+}
+
+// RemoveServer deletes the definitions of every domain proxied to the server,
+// and the records of their certificates, returning the removed definitions.
+func RemoveServer(serverUUID string) ([]models.Proxy, error) {
+	var proxies []models.Proxy
+	if err := database.Instance().Where("server_uuid = ?", serverUUID).Find(&proxies).Error; err != nil {
+		return nil, errors.Wrap(err, "proxy: failed to fetch proxies")
+	}
+	return removeProxies(proxies)
+}
+
+// removeProxies deletes the proxy definitions, returning those that were
+// deleted before an error occurred.
+func removeProxies(proxies []models.Proxy) ([]models.Proxy, error) {
+	for i, p := range proxies {
+		if err := database.Instance().Delete(&p).Error; err != nil {
+			return proxies[:i], errors.Wrap(err, "proxy: failed to delete proxy")
+		}
+		if err := forgetCertificate(p.Domain); err != nil {
+			return proxies[:i+1], err
+		}
+	}
+	return proxies, nil
+}
+
+// certificateExpiry returns the expiry of the first certificate in a PEM encoded
+// bundle.
+func certificateExpiry(certPEM []byte) (time.Time, error) {
+	for {
+		var block *pem.Block
+		block, certPEM = pem.Decode(certPEM)
+		if block == nil {
+			return time.Time{}, errors.Wrap(ErrInvalidProxy, "no certificate found")
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		leaf, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return time.Time{}, errors.Wrap(ErrInvalidProxy, err.Error())
+		}
+		return leaf.NotAfter.UTC(), nil
+	}
+}
+
+// RecordCertificate records the certificate that a domain is served with,
+// replacing any previous certificate of the domain. The expiry is read from the
+// certificate itself.
+func RecordCertificate(c *models.Certificate, certPEM []byte) error {
+	domain, err := normalizeDomain(c.Domain)
+	if err != nil {
+		return err
+	}
+	c.Domain = domain
+	expires, err := certificateExpiry(certPEM)
+	if err != nil {
+		return err
+	}
+	c.ExpiresAt = expires
+	c.LastError = ""
+
+	existing, err := certificateRecord(c.Domain)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		c.ID = existing.ID
+		c.CreatedAt = existing.CreatedAt
+		if c.RenewedAt == nil {
+			c.RenewedAt = existing.RenewedAt
+		}
+	}
+	if err := database.Instance().Save(c).Error; err != nil {
+		return errors.Wrap(err, "proxy: failed to save certificate")
+	}
+	return nil
+}
+
+// certificateRecord returns the record of the certificate of a domain, or nil if
+// there is none.
+func certificateRecord(domain string) (*models.Certificate, error) {
+	var c models.Certificate
+	tx := database.Instance().Where("domain = ?", domain).Limit(1).Find(&c)
+	if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "proxy: failed to fetch certificate")
+	}
+	if tx.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &c, nil
+}
+
+// forgetCertificate removes the record of the certificate of a domain.
+func forgetCertificate(domain string) error {
+	if err := database.Instance().Where("domain = ?", domain).Delete(&models.Certificate{}).Error; err != nil {
+		return errors.Wrap(err, "proxy: failed to delete certificate")
+	}
+	return nil
+}
+
+// List returns the domains proxied to a server along with the state of their
+// certificates.
+func List(serverUUID string) ([]Entry, error) {
+	var proxies []models.Proxy
+	if err := database.Instance().Where("server_uuid = ?", serverUUID).Order("domain ASC").Find(&proxies).Error; err != nil {
+		return nil, errors.Wrap(err, "proxy: failed to fetch proxies")
+	}
+	var certs []models.Certificate
+	if err := database.Instance().Where("server_uuid = ?", serverUUID).Find(&certs).Error; err != nil {
+		return nil, errors.Wrap(err, "proxy: failed to fetch certificates")
+	}
+	byDomain := make(map[string]models.Certificate, len(certs))
+	for _, c := range certs {
+		byDomain[c.Domain] = c
+	}
+
+	now := time.Now()
+	entries := make([]Entry, 0, len(proxies))
+	for _, p := range proxies {
+		e := Entry{Domain: p.Domain, IP: p.IP, Port: p.Port, SSL: p.SSL}
+		if c, ok := byDomain[p.Domain]; ok && p.SSL {
+			e.Certificate = &CertificateInfo{
+				Managed:   c.Managed,
+				ExpiresAt: c.ExpiresAt,
+				RenewedAt: c.RenewedAt,
+				Status:    certificateStatus(c, now),
+				Error:     c.LastError,
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
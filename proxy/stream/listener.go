@@ -0,0 +1,249 @@
+package stream
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/apex/log"
+
+	"github.com/priyxstudio/propel/internal/models"
+)
+
+// dialTimeout is how long connecting to the server port may take.
+const dialTimeout = time.Second * 10
+
+// udpBufferSize is the size of the largest UDP packet that is forwarded.
+const udpBufferSize = 64 * 1024
+
+// listener accepts the traffic of a stream proxy and forwards it to the server.
+type listener struct {
+	stream  models.StreamProxy
+	resolve Resolver
+	tcp     net.Listener
+	udp     net.PacketConn
+
+	rulesMu     sync.Mutex
+	rules       []models.FirewallRule
+	rulesLoaded time.Time
+
+	sessionsMu sync.Mutex
+	sessions   map[string]*udpSession
+	timeout    time.Duration
+	limit      int
+	dropped    uint64
+}
+
+// udpSession is a client of a UDP stream proxy along with the connection its
+// packets are forwarded to the server on.
+type udpSession struct {
+	client   net.Addr
+	upstream net.Conn
+	header   []byte
+
+	mu   sync.Mutex
+	seen time.Time
+}
+
+// close stops accepting traffic and closes every UDP session, TCP connections
+// that are already open are left to finish.
+func (l *listener) close() {
+	if l.tcp != nil {
+		_ = l.tcp.Close()
+	}
+	if l.udp != nil {
+		_ = l.udp.Close()
+	}
+	l.sessionsMu.Lock()
+	for k, s := range l.sessions {
+		_ = s.upstream.Close()
+		delete(l.sessions, k)
+	}
+	l.sessionsMu.Unlock()
+}
+
+// target returns the address traffic is forwarded to.
+func (l *listener) target() (string, bool) {
+	if l.resolve == nil {
+		return "", false
+	}
+	return l.resolve(l.stream.ServerUUID, l.stream.ServerPort)
+}
+
+func (l *listener) logger() *log.Entry {
+	return log.WithFields(log.Fields{"server": l.stream.ServerUUID, "listen_port": l.stream.ListenPort})
+}
+
+// serveTCP accepts connections until the listener is closed.
+func (l *listener) serveTCP() {
+	for {
+		c, err := l.tcp.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			l.logger().WithError(err).Warn("stream: failed to accept connection")
+			time.Sleep(time.Millisecond * 100)
+			continue
+		}
+		go l.handleTCP(c)
+	}
+}
+
+// handleTCP forwards a connection to the server until either side closes it.
+func (l *listener) handleTCP(c net.Conn) {
+	defer c.Close()
+
+	if !l.allowed(c.RemoteAddr(), "tcp") {
+		return
+	}
+	addr, ok := l.target()
+	if !ok {
+		l.logger().Debug("stream: server port is not allocated, dropping connection")
+		return
+	}
+	up, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		l.logger().WithError(err).Debug("stream: failed to connect to server")
+		return
+	}
+	defer up.Close()
+
+	if l.stream.ProxyProtocol {
+		if _, err := up.Write(proxyHeader(c.RemoteAddr(), c.LocalAddr())); err != nil {
+			return
+		}
+	}
+
+	done := make(chan struct{}, 2)
+	pipe := func(dst, src net.Conn) {
+		_, _ = io.Copy(dst, src)
+		// Let the other side know that no more data is coming while still
+		// allowing the response to be read.
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			_ = cw.CloseWrite()
+		}
+		done <- struct{}{}
+	}
+	go pipe(up, c)
+	go pipe(c, up)
+	<-done
+	<-done
+}
+
+// serveUDP reads packets until the listener is closed, forwarding them to the
+// server using a connection for each client so that responses can be sent back
+// to it.
+func (l *listener) serveUDP() {
+	buf := make([]byte, udpBufferSize)
+	for {
+		n, addr, err := l.udp.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			l.logger().WithError(err).Warn("stream: failed to read packet")
+			continue
+		}
+
+		s := l.session(addr)
+		if s == nil {
+			continue
+		}
+		s.touch()
+
+		packet := buf[:n]
+		if s.header != nil {
+			packet = append(append(make([]byte, 0, len(s.header)+n), s.header...), packet...)
+		}
+		if _, err := s.upstream.Write(packet); err != nil {
+			l.logger().WithError(err).Debug("stream: failed to forward packet to server")
+		}
+	}
+}
+
+// session returns the session of a client, starting one if this is the first
+// packet from it. Nil is returned if the client is not allowed to connect.
+func (l *listener) session(addr net.Addr) *udpSession {
+	key := addr.String()
+
+	l.sessionsMu.Lock()
+	defer l.sessionsMu.Unlock()
+
+	if s, ok := l.sessions[key]; ok {
+		return s
+	}
+	// Every session holds a socket and a goroutine, so the number of them is
+	// limited to stop clients, or spoofed source addresses, from exhausting them.
+	if l.limit > 0 && len(l.sessions) >= l.limit {
+		l.dropped++
+		if l.dropped == 1 || l.dropped%1000 == 0 {
+			l.logger().WithField("sessions", len(l.sessions)).WithField("dropped", l.dropped).Warn("stream: too many UDP sessions, dropping packets from new clients")
+		}
+		return nil
+	}
+	if !l.allowed(addr, "udp") {
+		return nil
+	}
+	target, ok := l.target()
+	if !ok {
+		return nil
+	}
+	up, err := net.DialTimeout("udp", target, dialTimeout)
+	if err != nil {
+		l.logger().WithError(err).Debug("stream: failed to connect to server")
+		return nil
+	}
+
+	s := &udpSession{client: addr, upstream: up, seen: time.Now()}
+	if l.stream.ProxyProtocol {
+		s.header = proxyHeader(addr, l.udp.LocalAddr())
+	}
+	l.sessions[key] = s
+	go l.replies(key, s)
+	return s
+}
+
+// replies sends the packets the server sends to a session back to its client,
+// ending the session once it has been idle for the session timeout.
+func (l *listener) replies(key string, s *udpSession) {
+	defer func() {
+		l.sessionsMu.Lock()
+		if l.sessions[key] == s {
+			delete(l.sessions, key)
+		}
+		l.sessionsMu.Unlock()
+		_ = s.upstream.Close()
+	}()
+
+	buf := make([]byte, udpBufferSize)
+	for {
+		_ = s.upstream.SetReadDeadline(time.Now().Add(l.timeout))
+		n, err := s.upstream.Read(buf)
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() && time.Since(s.lastSeen()) < l.timeout {
+				continue
+			}
+			return
+		}
+		s.touch()
+		if _, err := l.udp.WriteTo(buf[:n], s.client); err != nil {
+			return
+		}
+	}
+}
+
+func (s *udpSession) touch() {
+	s.mu.Lock()
+	s.seen = time.Now()
+	s.mu.Unlock()
+}
+
+func (s *udpSession) lastSeen() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seen
+}
@@ -0,0 +1,63 @@
+package stream
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+// proxySignature is the signature that starts every PROXY protocol v2 header.
+var proxySignature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// The values of the fields of a PROXY protocol v2 header.
+const (
+	proxyVersionCommand = 0x21 // Version 2, PROXY command.
+	proxyFamilyInet     = 0x10
+	proxyFamilyInet6    = 0x20
+	proxyTransportTCP   = 0x01
+	proxyTransportUDP   = 0x02
+)
+
+// proxyHeader returns the PROXY protocol v2 header announcing a connection from
+// src to dst. Addresses of mixed families are both sent as IPv6 addresses.
+func proxyHeader(src, dst net.Addr) []byte {
+	srcIP, srcPort, transport := addrParts(src)
+	dstIP, dstPort, _ := addrParts(dst)
+
+	family := byte(proxyFamilyInet)
+	s4, d4 := srcIP.To4(), dstIP.To4()
+	if s4 == nil || d4 == nil {
+		family = proxyFamilyInet6
+		srcIP, dstIP = srcIP.To16(), dstIP.To16()
+	} else {
+		srcIP, dstIP = s4, d4
+	}
+	if srcIP == nil {
+		srcIP = net.IPv6zero
+	}
+	if dstIP == nil {
+		dstIP = net.IPv6zero
+	}
+
+	length := len(srcIP) + len(dstIP) + 4
+	b := make([]byte, 0, len(proxySignature)+4+length)
+	b = append(b, proxySignature...)
+	b = append(b, proxyVersionCommand, family|transport)
+	b = binary.BigEndian.AppendUint16(b, uint16(length))
+	b = append(b, srcIP...)
+	b = append(b, dstIP...)
+	b = binary.BigEndian.AppendUint16(b, uint16(srcPort))
+	b = binary.BigEndian.AppendUint16(b, uint16(dstPort))
+	return b
+}
+
+// addrParts returns the IP address, port and PROXY protocol transport of an
+// address.
+func addrParts(addr net.Addr) (net.IP, int, byte) {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP, a.Port, proxyTransportTCP
+	case *net.UDPAddr:
+		return a.IP, a.Port, proxyTransportUDP
+	}
+	return nil, 0, proxyTransportTCP
+}
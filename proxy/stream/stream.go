@@ -0,0 +1,301 @@
+package stream
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/apex/log"
+
+	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/firewall"
+	"github.com/priyxstudio/propel/internal/database"
+	"github.com/priyxstudio/propel/internal/models"
+)
+
+var (
+	// ErrInvalidStream is returned when a stream proxy has an invalid protocol or
+	// address.
+	ErrInvalidStream = errors.Sentinel("stream: invalid stream proxy")
+	// ErrPortInUse is returned when another stream proxy already listens on the
+	// address of a stream proxy.
+	ErrPortInUse = errors.Sentinel("stream: port is already used by another stream proxy")
+	// ErrStreamNotFound is returned when a stream proxy does not exist for the
+	// server it is requested for.
+	ErrStreamNotFound = errors.Sentinel("stream: stream proxy not found")
+)
+
+// rulesRefreshInterval is how long the firewall rules of a stream proxy are
+// cached for before they are read again.
+const rulesRefreshInterval = time.Second * 10
+
+// Resolver returns the address a port allocated to a server is reached at, or
+// false if the server does not exist or the port is not allocated to it.
+type Resolver func(serverUUID string, port int) (string, bool)
+
+// Manager runs the listeners of the stream proxies, forwarding TCP connections
+// and UDP packets from a public port to a port allocated to a server.
+type Manager struct {
+	mu        sync.Mutex
+	resolve   Resolver
+	listeners map[uint]*listener
+}
+
+var (
+	instance     *Manager
+	instanceOnce sync.Once
+)
+
+// Get returns the stream proxy manager of the daemon.
+func Get() *Manager {
+	instanceOnce.Do(func() {
+		instance = &Manager{listeners: make(map[uint]*listener)}
+	})
+	return instance
+}
+
+// SetResolver sets the function used to find the address traffic is forwarded
+// to. This must be called before any stream proxy is started.
+func (m *Manager) SetResolver(r Resolver) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resolve = r
+}
+
+// protocols returns the protocols used by a stream proxy.
+func protocols(p string) []string {
+	if p == "both" {
+		return []string{"tcp", "udp"}
+	}
+	return []string{p}
+}
+
+// validate checks the protocol and addresses of a stream proxy, filling in the
+// defaults.
+func validate(s *models.StreamProxy) error {
+	if s.Protocol == "" {
+		s.Protocol = "tcp"
+	}
+	if s.Protocol != "tcp" && s.Protocol != "udp" && s.Protocol != "both" {
+		return errors.Wrapf(ErrInvalidStream, "invalid protocol: %s (must be 'tcp', 'udp' or 'both')", s.Protocol)
+	}
+	if s.ListenIP == "" {
+		s.ListenIP = config.Get().System.Proxy.BindAddress
+	}
+	if net.ParseIP(s.ListenIP) == nil {
+		return errors.Wrapf(ErrInvalidStream, "invalid listen ip: %s", s.ListenIP)
+	}
+	if s.ListenPort < 1 || s.ListenPort > 65535 {
+		return errors.Wrapf(ErrInvalidStream, "invalid listen port: %d (must be between 1 and 65535)", s.ListenPort)
+	}
+	if s.ServerPort < 1 || s.ServerPort > 65535 {
+		return errors.Wrapf(ErrInvalidStream, "invalid server port: %d (must be between 1 and 65535)", s.ServerPort)
+	}
+	return nil
+}
+
+// overlaps returns true if two stream proxies cannot listen at the same time
+// because they use the same port and protocol on overlapping addresses.
+func overlaps(a, b models.StreamProxy) bool {
+	if a.ListenPort != b.ListenPort {
+		return false
+	}
+	ai, bi := net.ParseIP(a.ListenIP), net.ParseIP(b.ListenIP)
+	if !ai.Equal(bi) && !ai.IsUnspecified() && !bi.IsUnspecified() {
+		return false
+	}
+	for _, p := range protocols(a.Protocol) {
+		for _, q := range protocols(b.Protocol) {
+			if p == q {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Load starts the listeners of every stream proxy stored in the database.
+func (m *Manager) Load() error {
+	var streams []models.StreamProxy
+	if err := database.Instance().Find(&streams).Error; err != nil {
+		return errors.Wrap(err, "stream: failed to fetch stream proxies")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range streams {
+		if _, ok := m.listeners[s.ID]; ok {
+			continue
+		}
+		l, err := m.startLocked(s)
+		if err != nil {
+			log.WithFields(log.Fields{"server": s.ServerUUID, "listen_port": s.ListenPort}).WithError(err).Warn("stream: failed to start stream proxy")
+			continue
+		}
+		m.listeners[s.ID] = l
+	}
+	log.WithField("streams", len(m.listeners)).Debug("stream: started stream proxies")
+	return nil
+}
+
+// List returns the stream proxies of a server.
+func (m *Manager) List(serverUUID string) ([]models.StreamProxy, error) {
+	var streams []models.StreamProxy
+	if err := database.Instance().Where("server_uuid = ?", serverUUID).Order("listen_port ASC").Find(&streams).Error; err != nil {
+		return nil, errors.Wrap(err, "stream: failed to fetch stream proxies")
+	}
+	return streams, nil
+}
+
+// Create stores a stream proxy and starts listening on its port. The server
+// port must have been checked to be allocated to the server.
+func (m *Manager) Create(s *models.StreamProxy) error {
+	if err := validate(s); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var streams []models.StreamProxy
+	if err := database.Instance().Where("listen_port = ?", s.ListenPort).Find(&streams).Error; err != nil {
+		return errors.Wrap(err, "stream: failed to fetch stream proxies")
+	}
+	for _, other := range streams {
+		if overlaps(*s, other) {
+			return ErrPortInUse
+		}
+	}
+
+	if err := database.Instance().Create(s).Error; err != nil {
+		return errors.Wrap(err, "stream: failed to create stream proxy")
+	}
+	l, err := m.startLocked(*s)
+	if err != nil {
+		// Remove the stream proxy again if the port cannot be listened on.
+		if delErr := database.Instance().Unscoped().Delete(s).Error; delErr != nil {
+			log.WithError(delErr).WithField("stream_id", s.ID).Error("stream: failed to rollback stream proxy creation")
+		}
+		return err
+	}
+	m.listeners[s.ID] = l
+	return nil
+}
+
+// Delete stops a stream proxy of the server and removes it.
+func (m *Manager) Delete(serverUUID string, id uint) error {
+	var s models.StreamProxy
+	tx := database.Instance().Where("id = ? AND server_uuid = ?", id, serverUUID).Limit(1).Find(&s)
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "stream: failed to fetch stream proxy")
+	}
+	if tx.RowsAffected == 0 {
+		return ErrStreamNotFound
+	}
+	return m.remove([]models.StreamProxy{s})
+}
+
+// DeleteServer stops and removes every stream proxy of the server, this is
+// called when the server is deleted or transferred to another node.
+func (m *Manager) DeleteServer(serverUUID string) error {
+	streams, err := m.List(serverUUID)
+	if err != nil {
+		return err
+	}
+	return m.remove(streams)
+}
+
+// Prune stops and removes the stream proxies of the server that forward to a
+// port that is no longer allocated to it.
+func (m *Manager) Prune(serverUUID string, validPorts map[int]bool) error {
+	streams, err := m.List(serverUUID)
+	if err != nil {
+		return err
+	}
+	var invalid []models.StreamProxy
+	for _, s := range streams {
+		if !validPorts[s.ServerPort] {
+			invalid = append(invalid, s)
+		}
+	}
+	return m.remove(invalid)
+}
+
+func (m *Manager) remove(streams []models.StreamProxy) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range streams {
+		if l, ok := m.listeners[s.ID]; ok {
+			l.close()
+			delete(m.listeners, s.ID)
+		}
+		if err := database.Instance().Delete(&s).Error; err != nil {
+			return errors.Wrap(err, "stream: failed to delete stream proxy")
+		}
+		log.WithFields(log.Fields{"server": s.ServerUUID, "listen_port": s.ListenPort, "protocol": s.Protocol}).Info("stream: removed stream proxy")
+	}
+	return nil
+}
+
+// startLocked starts listening for a stream proxy. This must be called while
+// holding the lock.
+func (m *Manager) startLocked(s models.StreamProxy) (*listener, error) {
+	l := &listener{
+		stream:   s,
+		resolve:  m.resolve,
+		sessions: make(map[string]*udpSession),
+		timeout:  time.Duration(max(config.Get().System.Proxy.UDPSessionTimeout, 1)) * time.Second,
+		limit:    config.Get().System.Proxy.UDPMaxSessions,
+	}
+	addr := net.JoinHostPort(s.ListenIP, strconv.Itoa(s.ListenPort))
+	for _, p := range protocols(s.Protocol) {
+		var err error
+		if p == "tcp" {
+			l.tcp, err = net.Listen("tcp", addr)
+		} else {
+			l.udp, err = net.ListenPacket("udp", addr)
+		}
+		if err != nil {
+			l.close()
+			return nil, errors.Wrapf(err, "stream: failed to listen on %s/%s", addr, p)
+		}
+	}
+	if l.tcp != nil {
+		go l.serveTCP()
+	}
+	if l.udp != nil {
+		go l.serveUDP()
+	}
+	log.WithFields(log.Fields{"server": s.ServerUUID, "listen": addr, "protocol": s.Protocol, "server_port": s.ServerPort}).Info("stream: listening for stream proxy")
+	return l, nil
+}
+
+// allowed returns true if the firewall rules of the server port allow traffic
+// from the address using the protocol. The rules are only read again once they
+// have been cached for a while.
+func (l *listener) allowed(addr net.Addr, protocol string) bool {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip = a.IP
+	case *net.UDPAddr:
+		ip = a.IP
+	}
+
+	l.rulesMu.Lock()
+	if time.Since(l.rulesLoaded) > rulesRefreshInterval {
+		rules, err := firewall.NewManager().GetRulesByPort(l.stream.ServerUUID, l.stream.ServerPort)
+		if err != nil {
+			log.WithField("server", l.stream.ServerUUID).WithError(err).Warn("stream: failed to fetch firewall rules, using the previous rules")
+		} else {
+			l.rules = rules
+		}
+		l.rulesLoaded = time.Now()
+	}
+	rules := l.rules
+	l.rulesMu.Unlock()
+
+	return firewall.Allows(rules, ip, protocol)
+}
@@ -0,0 +1,129 @@
+package stream
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/priyxstudio/propel/internal/models"
+)
+
+func TestProxyHeader(t *testing.T) {
+	src := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51234}
+	dst := &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 25565}
+
+	want := append([]byte{}, proxySignature...)
+	want = append(want, 0x21, 0x11, 0x00, 0x0c)
+	want = append(want, 203, 0, 113, 7, 198, 51, 100, 1)
+	want = append(want, 0xc8, 0x22, 0x63, 0xdd)
+	if got := proxyHeader(src, dst); !bytes.Equal(got, want) {
+		t.Fatalf("proxyHeader() = %x, want %x", got, want)
+	}
+}
+
+func TestProxyHeaderFamilies(t *testing.T) {
+	tests := []struct {
+		name     string
+		src, dst net.Addr
+		family   byte
+		length   int
+	}{
+		{
+			name:   "udp over ipv4",
+			src:    &net.UDPAddr{IP: net.ParseIP("203.0.113.7"), Port: 1},
+			dst:    &net.UDPAddr{IP: net.ParseIP("198.51.100.1"), Port: 2},
+			family: 0x12,
+			length: 12,
+		},
+		{
+			name:   "tcp over ipv6",
+			src:    &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1},
+			dst:    &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 2},
+			family: 0x21,
+			length: 36,
+		},
+		{
+			name:   "mixed families",
+			src:    &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1},
+			dst:    &net.UDPAddr{IP: net.ParseIP("198.51.100.1"), Port: 2},
+			family: 0x22,
+			length: 36,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := proxyHeader(tt.src, tt.dst)
+			if !bytes.HasPrefix(h, proxySignature) {
+				t.Fatal("header does not start with the signature")
+			}
+			h = h[len(proxySignature):]
+			if h[1] != tt.family {
+				t.Errorf("family = %#x, want %#x", h[1], tt.family)
+			}
+			if l := int(h[2])<<8 | int(h[3]); l != tt.length || len(h)-4 != tt.length {
+				t.Errorf("length = %d (%d bytes), want %d", l, len(h)-4, tt.length)
+			}
+		})
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	s := func(ip string, port int, protocol string) models.StreamProxy {
+		return models.StreamProxy{ListenIP: ip, ListenPort: port, Protocol: protocol}
+	}
+	tests := []struct {
+		name string
+		a, b models.StreamProxy
+		want bool
+	}{
+		{"same address", s("10.0.0.1", 27015, "tcp"), s("10.0.0.1", 27015, "tcp"), true},
+		{"different port", s("10.0.0.1", 27015, "tcp"), s("10.0.0.1", 27016, "tcp"), false},
+		{"different protocol", s("10.0.0.1", 27015, "tcp"), s("10.0.0.1", 27015, "udp"), false},
+		{"both protocols", s("10.0.0.1", 27015, "both"), s("10.0.0.1", 27015, "udp"), true},
+		{"different ip", s("10.0.0.1", 27015, "tcp"), s("10.0.0.2", 27015, "tcp"), false},
+		{"wildcard ip", s("0.0.0.0", 27015, "tcp"), s("10.0.0.2", 27015, "tcp"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := overlaps(tt.a, tt.b); got != tt.want {
+				t.Errorf("overlaps() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionLimit(t *testing.T) {
+	upstream, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := &listener{
+		stream:      models.StreamProxy{ServerUUID: "abc", ServerPort: 25565},
+		resolve:     func(string, int) (string, bool) { return upstream.LocalAddr().String(), true },
+		udp:         pc,
+		rulesLoaded: time.Now(),
+		sessions:    make(map[string]*udpSession),
+		timeout:     time.Minute,
+		limit:       1,
+	}
+	defer l.close()
+
+	first := &net.UDPAddr{IP: net.ParseIP("203.0.113.7"), Port: 1}
+	s := l.session(first)
+	if s == nil {
+		t.Fatal("expected a session to be started for the first client")
+	}
+	if l.session(&net.UDPAddr{IP: net.ParseIP("203.0.113.8"), Port: 1}) != nil {
+		t.Error("expected no session to be started once the limit is reached")
+	}
+	if l.session(first) != s {
+		t.Error("expected the existing session to be returned for the first client")
+	}
+}
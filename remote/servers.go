@@ -177,6 +177,17 @@ func (c *client) SetBackupStatus(ctx context.Context, backup string, data Backup
 	return nil
 }
 
+// RequestBackup asks the Panel to start a backup of the server. Backups must be
+// created through the Panel so that it is aware of them.
+func (c *client) RequestBackup(ctx context.Context, uuid string, data CreateBackupRequest) error {
+	resp, err := c.Post(ctx, fmt.Sprintf("/servers/%s/backups", uuid), data)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
 // SendRestorationStatus triggers a request to the Panel to notify it that a
 // restoration has been completed and the server should be marked as being
 // activated again.
@@ -170,6 +170,12 @@ type BackupRequest struct {
 	Parts        []BackupPart `json:"parts"`
 }
 
+// CreateBackupRequest asks the Panel to create a backup of a server, the Panel
+// then requests the backup from Wings in the same way as a user created one.
+type CreateBackupRequest struct {
+	Name string `json:"name"`
+}
+
 type InstallStatusRequest struct {
 	Successful bool `json:"successful"`
 	Reinstall  bool `json:"reinstall"`
@@ -2,11 +2,15 @@ package router
 
 import (
 	"github.com/docker/docker/api/types/image"
+	"github.com/priyxstudio/propel/environment"
+	"github.com/priyxstudio/propel/internal/query"
 	"github.com/priyxstudio/propel/router/downloader"
 	"github.com/priyxstudio/propel/server"
 	"github.com/priyxstudio/propel/server/backup"
 	"github.com/priyxstudio/propel/server/filesystem"
 	"github.com/priyxstudio/propel/server/installer"
+	"github.com/priyxstudio/propel/server/transcript"
+	"github.com/priyxstudio/propel/server/transfer"
 )
 
 // ErrorResponse represents the common error payload returned by the API.
@@ -59,6 +63,19 @@ type ServerLogResponse struct {
 	Data []string `json:"data"`
 }
 
+// ServerLogHistoryResponse contains a single page of console history.
+type ServerLogHistoryResponse struct {
+	Data    []environment.LogEntry `json:"data"`
+	HasMore bool                   `json:"has_more"`
+	Before  string                 `json:"before,omitempty"`
+	After   string                 `json:"after,omitempty"`
+}
+
+// ServerTranscriptListResponse lists the console transcripts stored for a server.
+type ServerTranscriptListResponse struct {
+	Data []transcript.File `json:"data"`
+}
+
 // ServerInstallLogResponse contains the installation log output.
 type ServerInstallLogResponse struct {
 	Data string `json:"data"`
@@ -70,6 +87,16 @@ type ServerPowerRequest struct {
 	WaitSeconds int                `json:"wait_seconds"`
 }
 
+// ServerGracefulPowerRequest defines a graceful stop or restart request body.
+type ServerGracefulPowerRequest struct {
+	Action        server.PowerAction `json:"action"`
+	Countdown     int                `json:"countdown"`
+	Announcements []int              `json:"announcements"`
+	Message       string             `json:"message"`
+	Query         query.Protocol     `json:"query"`
+	QueryPort     int                `json:"query_port"`
+}
+
 // ServerCommandsRequest contains commands to execute on a server.
 type ServerCommandsRequest struct {
 	Commands []string `json:"commands"`
@@ -194,6 +221,17 @@ type ServerTransferRequest struct {
 	Token   string                  `json:"token" binding:"required"`
 	Backups []string                `json:"backups"`
 	Server  installer.ServerDetails `json:"server"`
+	// Live keeps the server running while its data is copied to the target node,
+	// only stopping it to send the files that changed in the meantime.
+	Live bool `json:"live"`
+}
+
+// ServerTransferStatusResponse describes the outgoing transfer of a server and
+// its place in the transfer queue of the node.
+type ServerTransferStatusResponse struct {
+	Status   string               `json:"status"`
+	Position int                  `json:"position"`
+	Queue    transfer.QueueStatus `json:"queue"`
 }
 
 
@@ -15,6 +15,10 @@ package router
 // @description Signed JWTs issued by the Panel for server-scoped operations (uploads, downloads, websockets). Pass in the `token` query parameter.
 // @in query
 // @name token
+// @securityDefinitions.apikey MetricsToken
+// @description Supply the metrics scrape token from `config.yml` using the `Authorization: Bearer <token>` header.
+// @in header
+// @name Authorization
 // @contact.name Mythical Ltd
 // @contact.url https://github.com/priyxstudio/propel
 // @produce json
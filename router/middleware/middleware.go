@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"emperror.dev/errors"
 	"github.com/apex/log"
@@ -13,6 +14,7 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/internal/audit"
 	"github.com/priyxstudio/propel/modules"
 	"github.com/priyxstudio/propel/remote"
 	"github.com/priyxstudio/propel/server"
@@ -37,6 +39,59 @@ func AttachRequestID() gin.HandlerFunc {
 	}
 }
 
+// AuditRequests records each request that matched a route in the audit log once
+// it has completed. This must be registered before CaptureErrors so that the
+// final response status is known when the entry is written. Metrics scrapes and
+// documentation requests are not recorded since they would drown out everything
+// else in the log.
+func AuditRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" || route == "/metrics" || strings.HasPrefix(route, "/api/docs") {
+			return
+		}
+
+		e := audit.Entry{
+			Time:      start,
+			Type:      audit.TypeRequest,
+			RequestID: c.GetString("request_id"),
+			Method:    c.Request.Method,
+			Route:     route,
+			Path:      c.Request.URL.Path,
+			Server:    c.GetString("audit_server"),
+			Actor:     c.GetString("audit_actor"),
+			ActorType: c.GetString("audit_actor_type"),
+			IP:        c.ClientIP(),
+			Status:    c.Writer.Status(),
+			Duration:  time.Since(start).Milliseconds(),
+		}
+		if e.Server == "" {
+			e.Server = c.Param("server")
+		}
+		if e.ActorType == "" {
+			e.ActorType = audit.ActorAnonymous
+		}
+		e.Outcome = audit.OutcomeForStatus(e.Status)
+		audit.Log(e)
+	}
+}
+
+// SetAuditActor records who made the request so that it is included in the audit
+// log entry for the request.
+func SetAuditActor(c *gin.Context, actorType string, actor string) {
+	c.Set("audit_actor_type", actorType)
+	c.Set("audit_actor", actor)
+}
+
+// SetAuditServer records the server a request was made against for requests that
+// do not include the server in their path, such as those using a signed URL.
+func SetAuditServer(c *gin.Context, uuid string) {
+	c.Set("audit_server", uuid)
+}
+
 // AttachServerManager attaches the server manager to the request context which
 // allows routes to access the underlying server collection.
 func AttachServerManager(m *server.Manager) gin.HandlerFunc {
@@ -186,6 +241,33 @@ func RequireAuthorization() gin.HandlerFunc {
 			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You are not authorized to access this endpoint."})
 			return
 		}
+		SetAuditActor(c, audit.ActorNode, config.Get().AuthenticationTokenId)
+		c.Next()
+	}
+}
+
+// RequireMetricsAuthorization authorizes requests to the metrics endpoint using
+// the scrape token configured for the node. If metrics are disabled, or no token
+// has been configured, the endpoint behaves as though it does not exist.
+func RequireMetricsAuthorization() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := config.Get().Api.Metrics
+		if !cfg.Enabled || cfg.Token == "" {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "The requested resource does not exist on this instance."})
+			return
+		}
+
+		auth := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
+		if len(auth) != 2 || auth[0] != "Bearer" {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "The required authorization heads were not present in the request."})
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(auth[1]), []byte(cfg.Token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You are not authorized to access this endpoint."})
+			return
+		}
 		c.Next()
 	}
 }
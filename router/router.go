@@ -24,7 +24,7 @@ func Configure(m *wserver.Manager, client remote.Client) *gin.Engine {
 	if err := router.SetTrustedProxies(config.Get().Api.TrustedProxies); err != nil {
 		panic(errors.WithStack(err))
 	}
-	router.Use(middleware.AttachRequestID(), middleware.CaptureErrors(), middleware.SetAccessControlHeaders())
+	router.Use(middleware.AttachRequestID(), middleware.AuditRequests(), middleware.CaptureErrors(), middleware.SetAccessControlHeaders())
 	router.Use(middleware.AttachServerManager(m), middleware.AttachApiClient(client))
 
 	// Initialize module manager and register modules
@@ -72,6 +72,15 @@ func Configure(m *wserver.Manager, client remote.Client) *gin.Engine {
 	// This request does not need the AuthorizationMiddleware as the panel should never call it
 	// and requests are authenticated through a JWT the panel issues to the other daemon.
 	router.POST("/api/transfers", postTransfers)
+	router.GET("/api/transfers/session", getTransferSession)
+	router.POST("/api/transfers/session", postTransferSession)
+	router.PUT("/api/transfers/chunks", putTransferChunk)
+	router.POST("/api/transfers/presync", postTransferPreSync)
+	router.POST("/api/transfers/complete", postTransferComplete)
+
+	// Metrics are scraped by monitoring systems which are authenticated using a
+	// separate token, so they should not be able to access any other routes.
+	router.GET("/metrics", middleware.RequireMetricsAuthorization(), getMetrics)
 
 	// All the routes beyond this mount will use an authorization middleware
 	// and will not be accessible without the correct Authorization header provided.
@@ -85,7 +94,9 @@ func Configure(m *wserver.Manager, client remote.Client) *gin.Engine {
 	protected.DELETE("/api/system/docker/image/prune", pruneDockerImages)
 	protected.GET("/api/system/ips", getSystemIps)
 	protected.GET("/api/system/utilization", getSystemUtilization)
+	protected.GET("/api/system/cpu", getSystemCpuPlacement)
 	protected.POST("/api/system/terminal/exec", postSystemHostCommand)
+	protected.GET("/api/system/audit", getSystemAuditLog)
 
 	// Configuration management routes (new, preserves comments)
 	protected.GET("/api/config", getConfigRaw)
@@ -95,8 +106,10 @@ func Configure(m *wserver.Manager, client remote.Client) *gin.Engine {
 
 	protected.GET("/api/servers", getAllServers)
 	protected.POST("/api/servers", postCreateServer)
+	protected.GET("/api/transfers/queue", getTransferQueue)
 	protected.DELETE("/api/transfers/:server", deleteTransfer)
 	protected.POST("/api/deauthorize-user", postDeauthorizeUser)
+	protected.GET("/api/webhooks/deliveries", getWebhookDeliveries)
 
 	// Module management routes
 	protected.GET("/api/modules", getModules)
@@ -117,8 +130,15 @@ func Configure(m *wserver.Manager, client remote.Client) *gin.Engine {
 		server.DELETE("", deleteServer)
 
 		server.GET("/logs", getServerLogs)
+		server.GET("/logs/history", getServerLogHistory)
+		server.GET("/logs/download", getServerLogDownload)
+		server.GET("/logs/transcripts", getServerTranscripts)
+		server.GET("/logs/transcripts/:file", getServerTranscript)
 		server.GET("/install-logs", getServerInstallLogs)
+		server.GET("/stats/history", getServerStatsHistory)
 		server.POST("/power", postServerPower)
+		server.POST("/power/graceful", postServerGracefulPower)
+		server.DELETE("/power/graceful", deleteServerGracefulPower)
 		server.POST("/commands", postServerCommands)
 		server.POST("/install", postServerInstall)
 		server.POST("/reinstall", postServerReinstall)
@@ -127,18 +147,25 @@ func Configure(m *wserver.Manager, client remote.Client) *gin.Engine {
 
 		// This archive request causes the archive to start being created
 		// this should only be triggered by the panel.
+		server.GET("/transfer", getServerTransfer)
 		server.POST("/transfer", postServerTransfer)
 		server.DELETE("/transfer", deleteServerTransfer)
 
 		// Reverse proxy routes
+		server.GET("/proxy", getServerProxies)
 		server.POST("/proxy/create", postServerProxyCreate)
 		server.POST("/proxy/delete", postServerProxyDelete)
+		server.GET("/proxy/streams", getServerProxyStreams)
+		server.POST("/proxy/streams", postServerProxyStream)
+		server.DELETE("/proxy/streams/:stream", deleteServerProxyStream)
 
 		// FastDL routes
 		server.GET("/fastdl", getServerFastDL)
 		server.PUT("/fastdl", putServerFastDL)
 		server.POST("/fastdl/enable", postServerFastDLEnable)
 		server.POST("/fastdl/disable", postServerFastDLDisable)
+		server.GET("/fastdl/cache", getServerFastDLCache)
+		server.DELETE("/fastdl/cache", deleteServerFastDLCache)
 
 		// Server import routes
 		server.POST("/import", postServerImport)
@@ -184,6 +211,28 @@ func Configure(m *wserver.Manager, client remote.Client) *gin.Engine {
 			firewallGroup.PUT("/:rule", putFirewallRule)
 			firewallGroup.DELETE("/:rule", deleteFirewallRule)
 		}
+
+		server.GET("/crashes", getServerCrashReports)
+		server.GET("/crashes/:crash", getServerCrashReport)
+
+		triggers := server.Group("/triggers")
+		{
+			triggers.GET("", getServerTriggers)
+			triggers.POST("", postServerTrigger)
+			triggers.GET("/:trigger", getServerTrigger)
+			triggers.PUT("/:trigger", putServerTrigger)
+			triggers.DELETE("/:trigger", deleteServerTrigger)
+		}
+
+		webhooks := server.Group("/webhooks")
+		{
+			webhooks.GET("", getServerWebhooks)
+			webhooks.POST("", postServerWebhook)
+			webhooks.GET("/deliveries", getServerWebhookDeliveries)
+			webhooks.GET("/:webhook", getServerWebhook)
+			webhooks.PUT("/:webhook", putServerWebhook)
+			webhooks.DELETE("/:webhook", deleteServerWebhook)
+		}
 	}
 
 	return router
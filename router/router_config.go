@@ -368,6 +368,24 @@ func generateConfigSchema() []ConfigSchemaField {
 						},
 					},
 				},
+				{
+					Key:         "metrics",
+					Type:        "object",
+					Description: "Prometheus metrics endpoint settings",
+					Fields: []ConfigSchemaField{
+						{
+							Key:         "enabled",
+							Type:        "boolean",
+							Description: "Expose node and server metrics at /metrics",
+							Default:     false,
+						},
+						{
+							Key:         "token",
+							Type:        "string",
+							Description: "Bearer token required to scrape the metrics endpoint",
+						},
+					},
+				},
 				{
 					Key:         "ssl",
 					Type:        "object",
@@ -498,6 +516,12 @@ func generateConfigSchema() []ConfigSchemaField {
 					Description: "Number of log lines to send on websocket connect",
 					Default:     150,
 				},
+				{
+					Key:         "websocket_log_max_count",
+					Type:        "integer",
+					Description: "Maximum number of log lines a websocket client may request",
+					Default:     1000,
+				},
 				{
 					Key:         "sftp",
 					Type:        "object",
@@ -546,6 +570,316 @@ func generateConfigSchema() []ConfigSchemaField {
 							Description: "Timeout between crashes in seconds",
 							Default:     60,
 						},
+						{
+							Key:         "strategy",
+							Type:        "string",
+							Description: "Restart strategy after a crash (timeout or backoff)",
+							Default:     "timeout",
+						},
+						{
+							Key:         "max_restarts",
+							Type:        "integer",
+							Description: "Crashes allowed within the window before giving up",
+							Default:     5,
+						},
+						{
+							Key:         "window",
+							Type:        "integer",
+							Description: "Window in seconds used to count crashes",
+							Default:     600,
+						},
+						{
+							Key:         "backoff_initial",
+							Type:        "integer",
+							Description: "Delay in seconds before the first restart",
+							Default:     5,
+						},
+						{
+							Key:         "backoff_max",
+							Type:        "integer",
+							Description: "Maximum delay in seconds between restarts",
+							Default:     300,
+						},
+						{
+							Key:         "backoff_multiplier",
+							Type:        "number",
+							Description: "Multiplier applied to the delay after each crash",
+							Default:     2,
+						},
+						{
+							Key:         "report_lines",
+							Type:        "integer",
+							Description: "Console lines captured in each crash report",
+							Default:     100,
+						},
+						{
+							Key:         "max_reports",
+							Type:        "integer",
+							Description: "Crash reports kept for each server",
+							Default:     25,
+						},
+					},
+				},
+				{
+					Key:         "graceful_stop",
+					Type:        "object",
+					Description: "Graceful stop and restart countdown settings",
+					Fields: []ConfigSchemaField{
+						{
+							Key:         "countdown",
+							Type:        "integer",
+							Description: "Seconds to wait before stopping the server",
+							Default:     60,
+						},
+						{
+							Key:         "announcements",
+							Type:        "array",
+							Description: "Seconds remaining at which the countdown is announced",
+							Default:     []int{60, 30, 10, 5, 4, 3, 2, 1},
+						},
+						{
+							Key:         "message",
+							Type:        "string",
+							Description: "Console command used to announce the countdown ({action} and {seconds} are replaced)",
+							Default:     "say Server will {action} in {seconds} seconds!",
+						},
+						{
+							Key:         "query",
+							Type:        "string",
+							Description: "Player query protocol used to skip the countdown when nobody is online (minecraft or source)",
+						},
+					},
+				},
+				{
+					Key:         "start_admission",
+					Type:        "object",
+					Description: "Memory admission control for server starts",
+					Fields: []ConfigSchemaField{
+						{
+							Key:         "enabled",
+							Type:        "boolean",
+							Description: "Check committed memory before starting a server",
+							Default:     true,
+						},
+						{
+							Key:         "overcommit_ratio",
+							Type:        "number",
+							Description: "Multiple of host memory that may be committed to running servers",
+							Default:     1.0,
+						},
+						{
+							Key:         "reserved",
+							Type:        "integer",
+							Description: "Memory in MiB kept for the host and never committed to servers",
+							Default:     512,
+						},
+						{
+							Key:         "mode",
+							Type:        "string",
+							Description: "Whether starts that do not fit wait in a queue or are rejected (queue or reject)",
+							Default:     "queue",
+						},
+						{
+							Key:         "queue_timeout",
+							Type:        "integer",
+							Description: "Seconds a start may wait in the queue before failing",
+							Default:     600,
+						},
+					},
+				},
+				{
+					Key:         "boot_queue",
+					Type:        "object",
+					Description: "Staggered restore of running servers when the daemon boots",
+					Fields: []ConfigSchemaField{
+						{
+							Key:         "concurrency",
+							Type:        "integer",
+							Description: "Number of servers that may be starting at the same time",
+							Default:     2,
+						},
+						{
+							Key:         "timeout",
+							Type:        "integer",
+							Description: "Seconds to wait for a server to reach running before starting the next",
+							Default:     120,
+						},
+					},
+				},
+				{
+					Key:         "webhooks",
+					Type:        "object",
+					Description: "Server lifecycle event webhook settings",
+					Fields: []ConfigSchemaField{
+						{
+							Key:         "enabled",
+							Type:        "boolean",
+							Description: "Deliver server events to webhooks",
+							Default:     true,
+						},
+						{
+							Key:         "endpoints",
+							Type:        "array",
+							Description: "Node level webhooks that receive events for every server (url, format, secret and events)",
+						},
+						{
+							Key:         "max_attempts",
+							Type:        "integer",
+							Description: "Attempts made for a delivery before it is marked as failed",
+							Default:     8,
+						},
+						{
+							Key:         "backoff_initial",
+							Type:        "integer",
+							Description: "Delay in seconds before the first retry of a delivery",
+							Default:     5,
+						},
+						{
+							Key:         "backoff_max",
+							Type:        "integer",
+							Description: "Maximum delay in seconds between retries",
+							Default:     600,
+						},
+						{
+							Key:         "timeout",
+							Type:        "integer",
+							Description: "Seconds to wait for a webhook to respond",
+							Default:     10,
+						},
+						{
+							Key:         "retention",
+							Type:        "integer",
+							Description: "Days to keep completed deliveries in the delivery log",
+							Default:     7,
+						},
+					},
+				},
+				{
+					Key:         "audit_log",
+					Type:        "object",
+					Description: "Audit log of API requests and host commands",
+					Fields: []ConfigSchemaField{
+						{
+							Key:         "enabled",
+							Type:        "boolean",
+							Description: "Record API requests and host commands",
+							Default:     true,
+						},
+						{
+							Key:         "max_size",
+							Type:        "integer",
+							Description: "Size in MiB at which the audit log is rotated",
+							Default:     50,
+						},
+						{
+							Key:         "max_age",
+							Type:        "integer",
+							Description: "Days to keep rotated audit logs",
+							Default:     90,
+						},
+						{
+							Key:         "max_files",
+							Type:        "integer",
+							Description: "Maximum number of rotated audit logs",
+							Default:     30,
+						},
+						{
+							Key:         "syslog",
+							Type:        "object",
+							Description: "Forward audit entries to syslog",
+							Fields: []ConfigSchemaField{
+								{
+									Key:         "enabled",
+									Type:        "boolean",
+									Description: "Forward each audit entry to syslog",
+									Default:     false,
+								},
+								{
+									Key:         "network",
+									Type:        "string",
+									Description: "Syslog network (udp, tcp or empty for the local daemon)",
+								},
+								{
+									Key:         "address",
+									Type:        "string",
+									Description: "Syslog server address, such as 10.0.0.1:514",
+								},
+								{
+									Key:         "tag",
+									Type:        "string",
+									Description: "Program name attached to forwarded entries",
+									Default:     "propel-audit",
+								},
+							},
+						},
+					},
+				},
+				{
+					Key:         "console_transcripts",
+					Type:        "object",
+					Description: "Persistent console transcript settings",
+					Fields: []ConfigSchemaField{
+						{
+							Key:         "enabled",
+							Type:        "boolean",
+							Description: "Persist server console output to disk",
+							Default:     true,
+						},
+						{
+							Key:         "max_size",
+							Type:        "integer",
+							Description: "Size in MiB at which a transcript is rotated",
+							Default:     10,
+						},
+						{
+							Key:         "max_age",
+							Type:        "integer",
+							Description: "Days to keep rotated transcripts",
+							Default:     14,
+						},
+						{
+							Key:         "max_files",
+							Type:        "integer",
+							Description: "Maximum number of rotated transcripts per server",
+							Default:     10,
+						},
+					},
+				},
+				{
+					Key:         "stats_history",
+					Type:        "object",
+					Description: "Resource usage history settings",
+					Fields: []ConfigSchemaField{
+						{
+							Key:         "enabled",
+							Type:        "boolean",
+							Description: "Store the resource usage of servers over time",
+							Default:     true,
+						},
+						{
+							Key:         "second_samples",
+							Type:        "integer",
+							Description: "Per-second samples kept for each server",
+							Default:     3600,
+						},
+						{
+							Key:         "minute_samples",
+							Type:        "integer",
+							Description: "Per-minute samples kept for each server",
+							Default:     1440,
+						},
+						{
+							Key:         "hour_samples",
+							Type:        "integer",
+							Description: "Per-hour samples kept for each server",
+							Default:     720,
+						},
+						{
+							Key:         "flush_interval",
+							Type:        "integer",
+							Description: "Seconds between writes of samples to the database",
+							Default:     10,
+						},
 					},
 				},
 				{
@@ -584,6 +918,103 @@ func generateConfigSchema() []ConfigSchemaField {
 							Description: "Network I/O download limit in MiB/s (0 = unlimited)",
 							Default:     0,
 						},
+						{
+							Key:         "chunk_size",
+							Type:        "integer",
+							Description: "Size in MiB of each chunk sent during a resumable transfer",
+							Default:     16,
+						},
+						{
+							Key:         "max_retries",
+							Type:        "integer",
+							Description: "Number of times a failed transfer request is retried before the transfer fails",
+							Default:     10,
+						},
+						{
+							Key:         "resume_window",
+							Type:        "integer",
+							Description: "Hours a partially received transfer is kept so that it can be resumed",
+							Default:     24,
+						},
+						{
+							Key:         "upload_limit",
+							Type:        "integer",
+							Description: "Network I/O upload limit in MiB/s for each outgoing transfer (0 = unlimited)",
+							Default:     0,
+						},
+						{
+							Key:         "max_concurrent",
+							Type:        "integer",
+							Description: "Number of outgoing transfers that can run at once, others wait in a queue (0 = unlimited)",
+							Default:     0,
+						},
+						{
+							Key:         "windows",
+							Type:        "array",
+							Description: "Daily time ranges in which queued transfers may start, such as 22:00-06:00 (empty = any time)",
+						},
+					},
+				},
+				{
+					Key:         "proxy",
+					Type:        "object",
+					Description: "Reverse proxy settings",
+					Fields: []ConfigSchemaField{
+						{
+							Key:         "mode",
+							Type:        "string",
+							Description: "What serves proxied domains: nginx or builtin",
+							Default:     "nginx",
+						},
+						{
+							Key:         "bind_address",
+							Type:        "string",
+							Description: "Address the built-in proxy listens on",
+							Default:     "0.0.0.0",
+						},
+						{
+							Key:         "http_port",
+							Type:        "integer",
+							Description: "HTTP port of the built-in proxy",
+							Default:     80,
+						},
+						{
+							Key:         "https_port",
+							Type:        "integer",
+							Description: "HTTPS port of the built-in proxy",
+							Default:     443,
+						},
+						{
+							Key:         "acme_directory",
+							Type:        "string",
+							Description: "ACME directory URL certificates are requested from",
+							Default:     "https://acme-v02.api.letsencrypt.org/directory",
+						},
+						{
+							Key:         "renew_before",
+							Type:        "integer",
+							Description: "Days before expiry that certificates are renewed",
+							Default:     30,
+						},
+						{
+							Key:         "udp_session_timeout",
+							Type:        "integer",
+							Description: "Seconds a client of a UDP stream proxy is remembered after its last packet",
+							Default:     120,
+						},
+					},
+				},
+				{
+					Key:         "firewall",
+					Type:        "object",
+					Description: "Firewall settings",
+					Fields: []ConfigSchemaField{
+						{
+							Key:         "backend",
+							Type:        "string",
+							Description: "What applies firewall rules: auto, nftables or iptables",
+							Default:     "auto",
+						},
 					},
 				},
 				{
@@ -678,6 +1109,24 @@ func generateConfigSchema() []ConfigSchemaField {
 					Type:        "boolean",
 					Description: "Enable native KVM support",
 				},
+				{
+					Key:         "cpu_placement",
+					Type:        "object",
+					Description: "CPU thread placement for server containers",
+					Fields: []ConfigSchemaField{
+						{
+							Key:         "mode",
+							Type:        "string",
+							Description: "Placement mode (manual or auto)",
+							Default:     "manual",
+						},
+						{
+							Key:         "reserved",
+							Type:        "string",
+							Description: "Threads never assigned to servers in auto mode",
+						},
+					},
+				},
 			},
 		},
 		{
@@ -10,6 +10,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
+	"github.com/priyxstudio/propel/internal/audit"
 	"github.com/priyxstudio/propel/router/middleware"
 	"github.com/priyxstudio/propel/router/tokens"
 	"github.com/priyxstudio/propel/server/backup"
@@ -35,6 +36,8 @@ func getDownloadBackup(c *gin.Context) {
 		middleware.CaptureAndAbort(c, err)
 		return
 	}
+	middleware.SetAuditActor(c, audit.ActorUser, "")
+	middleware.SetAuditServer(c, token.ServerUuid)
 
 	// Validate that the BackupUuid field is actually a UUID and not some random characters or a
 	// file path.
@@ -107,6 +110,8 @@ func getDownloadFile(c *gin.Context) {
 		middleware.CaptureAndAbort(c, err)
 		return
 	}
+	middleware.SetAuditActor(c, audit.ActorUser, "")
+	middleware.SetAuditServer(c, token.ServerUuid)
 
 	s, ok := manager.Get(token.ServerUuid)
 	if !ok || !token.IsUniqueRequest() {
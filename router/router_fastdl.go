@@ -42,7 +42,7 @@ func getServerFastDL(c *gin.Context) {
 		wingsCfg := config.Get()
 		fastdlCfg := wingsCfg.System.FastDL
 		
-		// FastDL uses HTTP only (no SSL) via nginx
+		// FastDL uses HTTP only (no SSL)
 		baseURL := strings.TrimSuffix(wingsCfg.PanelLocation, "/api")
 		// Extract hostname from panel location
 		panelURL := strings.TrimPrefix(baseURL, "http://")
@@ -51,13 +51,14 @@ func getServerFastDL(c *gin.Context) {
 			panelURL = panelURL[:idx]
 		}
 		
-		// Build URL: http://hostname:port/{server-uuid}/{directory}
+		// Build URL: http://hostname:port/{server-uuid}/{directory}, the built-in
+		// server already serves files from the FastDL directory of the server.
 		response.URL = "http://" + panelURL
 		if fastdlCfg.Port != 80 {
 			response.URL += ":" + fmt.Sprintf("%d", fastdlCfg.Port)
 		}
 		response.URL += "/" + s.ID()
-		if cfg.FastDL.Directory != "" {
+		if cfg.FastDL.Directory != "" && !fastdl.Builtin() {
 			response.URL += "/" + strings.TrimPrefix(cfg.FastDL.Directory, "/")
 		}
 	}
@@ -102,15 +103,10 @@ func putServerFastDL(c *gin.Context) {
 	// Update server configuration
 	s.Config().SetFastDL(data.Enabled, data.Directory)
 
-	// Regenerate nginx config if FastDL is enabled
-	cfg := config.Get()
-	if cfg.System.FastDL.Enabled {
-		manager := middleware.ExtractManager(c)
-		if err := fastdl.GenerateNginxConfig(manager); err != nil {
-			s.Log().WithError(err).Warn("failed to regenerate nginx config after FastDL update")
-		} else {
-			fastdl.ReloadNginx()
-		}
+	// Apply the change, which regenerates the nginx config unless the built-in
+	// server is used.
+	if err := fastdl.Reload(middleware.ExtractManager(c)); err != nil {
+		s.Log().WithError(err).Warn("failed to regenerate nginx config after FastDL update")
 	}
 
 	// Return updated configuration
@@ -152,20 +148,52 @@ func postServerFastDLEnable(c *gin.Context) {
 	// Update server configuration
 	s.Config().SetFastDL(true, data.Directory)
 
-	// Regenerate nginx config if FastDL is enabled
-	cfg := config.Get()
-	if cfg.System.FastDL.Enabled {
-		manager := middleware.ExtractManager(c)
-		if err := fastdl.GenerateNginxConfig(manager); err != nil {
-			s.Log().WithError(err).Warn("failed to regenerate nginx config after FastDL enable")
-		} else {
-			fastdl.ReloadNginx()
-		}
+	// Apply the change, which regenerates the nginx config unless the built-in
+	// server is used.
+	if err := fastdl.Reload(middleware.ExtractManager(c)); err != nil {
+		s.Log().WithError(err).Warn("failed to regenerate nginx config after FastDL enable")
 	}
 
 	getServerFastDL(c)
 }
 
+// getServerFastDLCache returns the state of the compressed copies of files kept
+// for a server by the built-in FastDL server.
+// @Summary Get server FastDL cache stats
+// @Tags Servers
+// @Produce json
+// @Param server path string true "Server identifier"
+// @Success 200 {object} fastdl.CacheStats
+// @Failure 404 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/servers/{server}/fastdl/cache [get]
+func getServerFastDLCache(c *gin.Context) {
+	s := ExtractServer(c)
+
+	c.JSON(http.StatusOK, fastdl.Cache().Stats(s.ID()))
+}
+
+// deleteServerFastDLCache removes the compressed copies of files kept for a
+// server, they are created again as the files are requested.
+// @Summary Purge server FastDL cache
+// @Tags Servers
+// @Param server path string true "Server identifier"
+// @Success 204 {string} string "No Content"
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/servers/{server}/fastdl/cache [delete]
+func deleteServerFastDLCache(c *gin.Context) {
+	s := ExtractServer(c)
+
+	if err := fastdl.Cache().Purge(s.ID()); err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
 // postServerFastDLDisable disables FastDL for a server.
 // @Summary Disable FastDL for server
 // @Tags Servers
@@ -181,15 +209,15 @@ func postServerFastDLDisable(c *gin.Context) {
 	// Update server configuration
 	s.Config().SetFastDL(false, "")
 
-	// Regenerate nginx config if FastDL is enabled
-	cfg := config.Get()
-	if cfg.System.FastDL.Enabled {
-		manager := middleware.ExtractManager(c)
-		if err := fastdl.GenerateNginxConfig(manager); err != nil {
-			s.Log().WithError(err).Warn("failed to regenerate nginx config after FastDL disable")
-		} else {
-			fastdl.ReloadNginx()
-		}
+	// The compressed copies of its files are no longer needed.
+	if err := fastdl.Cache().Purge(s.ID()); err != nil {
+		s.Log().WithError(err).Warn("failed to purge FastDL cache after FastDL disable")
+	}
+
+	// Apply the change, which regenerates the nginx config unless the built-in
+	// server is used.
+	if err := fastdl.Reload(middleware.ExtractManager(c)); err != nil {
+		s.Log().WithError(err).Warn("failed to regenerate nginx config after FastDL disable")
 	}
 
 	getServerFastDL(c)
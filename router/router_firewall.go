@@ -17,13 +17,15 @@ func getFirewallManager() *firewall.Manager {
 	return firewall.NewManager()
 }
 
-// FirewallRuleRequest represents a request to create or update a firewall rule
+// FirewallRuleRequest represents a request to create or update a firewall rule,
+// setting server_port_end makes the rule apply to every port from server_port to it
 type FirewallRuleRequest struct {
-	RemoteIP   string                  `json:"remote_ip" binding:"required"`
-	ServerPort int                     `json:"server_port" binding:"required,min=1,max=65535"`
-	Priority   int                     `json:"priority" binding:"min=0,max=10000"`
-	Type       models.FirewallRuleType `json:"type" binding:"required,oneof=allow block"`
-	Protocol   string                  `json:"protocol" binding:"omitempty,oneof=tcp udp"`
+	RemoteIP      string                  `json:"remote_ip" binding:"required"`
+	ServerPort    int                     `json:"server_port" binding:"required,min=1,max=65535"`
+	ServerPortEnd int                     `json:"server_port_end" binding:"omitempty,min=1,max=65535"`
+	Priority      int                     `json:"priority" binding:"min=0,max=10000"`
+	Type          models.FirewallRuleType `json:"type" binding:"required,oneof=allow block"`
+	Protocol      string                  `json:"protocol" binding:"omitempty,oneof=tcp udp both"`
 }
 
 // FirewallRuleResponse represents a firewall rule in API responses
@@ -125,15 +127,6 @@ func postFirewallRule(c *gin.Context) {
 		return
 	}
 
-	// Validate that the server has access to the requested port
-	allocations := s.Config().Allocations
-	if !firewall.ValidatePortForServer(&allocations, req.ServerPort) {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Error: "server does not have access to the specified port",
-		})
-		return
-	}
-
 	// Set default protocol if not provided
 	if req.Protocol == "" {
 		req.Protocol = "tcp"
@@ -145,12 +138,26 @@ func postFirewallRule(c *gin.Context) {
 	}
 
 	rule := &models.FirewallRule{
-		ServerUUID: serverUUID,
-		RemoteIP:   req.RemoteIP,
-		ServerPort: req.ServerPort,
-		Priority:   req.Priority,
-		Type:       req.Type,
-		Protocol:   req.Protocol,
+		ServerUUID:    serverUUID,
+		RemoteIP:      req.RemoteIP,
+		ServerPort:    req.ServerPort,
+		ServerPortEnd: req.ServerPortEnd,
+		Priority:      req.Priority,
+		Type:          req.Type,
+		Protocol:      req.Protocol,
+	}
+
+	// Validate that the server has access to every requested port
+	if req.ServerPortEnd != 0 && req.ServerPortEnd < req.ServerPort {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "server_port_end must not be lower than server_port"})
+		return
+	}
+	allocations := s.Config().Allocations
+	if !firewall.ValidateRuleForServer(&allocations, rule) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error: "server does not have access to the specified port",
+		})
+		return
 	}
 
 	if err := getFirewallManager().CreateRule(rule); err != nil {
@@ -213,10 +220,25 @@ func putFirewallRule(c *gin.Context) {
 		}
 	}
 
-	// Validate that the server has access to the requested port if port is being updated
+	// Build update object
+	updates := &models.FirewallRule{
+		RemoteIP:      req.RemoteIP,
+		ServerPort:    req.ServerPort,
+		ServerPortEnd: req.ServerPortEnd,
+		Priority:      req.Priority,
+		Type:          req.Type,
+		Protocol:      req.Protocol,
+	}
+
+	// Validate that the server has access to every port of the rule if the ports
+	// are being updated
 	if req.ServerPort != 0 {
+		if req.ServerPortEnd != 0 && req.ServerPortEnd < req.ServerPort {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "server_port_end must not be lower than server_port"})
+			return
+		}
 		allocations := s.Config().Allocations
-		if !firewall.ValidatePortForServer(&allocations, req.ServerPort) {
+		if !firewall.ValidateRuleForServer(&allocations, updates) {
 			c.JSON(http.StatusBadRequest, ErrorResponse{
 				Error: "server does not have access to the specified port",
 			})
@@ -224,15 +246,6 @@ func putFirewallRule(c *gin.Context) {
 		}
 	}
 
-	// Build update object
-	updates := &models.FirewallRule{
-		RemoteIP:   req.RemoteIP,
-		ServerPort: req.ServerPort,
-		Priority:   req.Priority,
-		Type:       req.Type,
-		Protocol:   req.Protocol,
-	}
-
 	if err := getFirewallManager().UpdateRule(uint(ruleID), updates); err != nil {
 		middleware.CaptureAndAbort(c, err)
 		return
@@ -0,0 +1,156 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/apex/log"
+	"github.com/gin-gonic/gin"
+
+	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/environment"
+	"github.com/priyxstudio/propel/internal/metrics"
+	"github.com/priyxstudio/propel/router/middleware"
+	"github.com/priyxstudio/propel/server"
+	"github.com/priyxstudio/propel/system"
+)
+
+// The states reported for each server, a sample is written for every state so
+// that the current one can be selected in queries without knowing it up front.
+var metricsServerStates = []string{
+	environment.ProcessOfflineState,
+	environment.ProcessStartingState,
+	environment.ProcessRunningState,
+	environment.ProcessStoppingState,
+}
+
+// getMetrics returns node and server metrics in the Prometheus text format.
+// @Summary Get Prometheus metrics
+// @Description Returns node and per-server metrics in the Prometheus text exposition format. This endpoint is authenticated using the metrics scrape token rather than the node token, and is only available when metrics are enabled.
+// @Tags System
+// @Produce plain
+// @Success 200 {string} string "Prometheus metrics"
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Security MetricsToken
+// @Router /metrics [get]
+func getMetrics(c *gin.Context) {
+	c.Header("Content-Type", metrics.ContentType)
+	c.Status(http.StatusOK)
+
+	w := metrics.NewWriter(c.Writer)
+	writeNodeMetrics(w)
+	writeServerMetrics(w, middleware.ExtractManager(c).All())
+	metrics.Write(w)
+	if err := w.Flush(); err != nil {
+		log.WithField("error", err).Debug("failed to write metrics response")
+	}
+}
+
+// writeNodeMetrics writes the utilization of the node itself. If utilization
+// cannot be determined the error is logged and the node metrics are skipped so
+// that the server metrics can still be scraped.
+func writeNodeMetrics(w *metrics.Writer) {
+	cfg := config.Get()
+	u, err := system.GetSystemUtilization(
+		cfg.System.RootDirectory,
+		cfg.System.LogDirectory,
+		cfg.System.Data,
+		cfg.System.ArchiveDirectory,
+		cfg.System.BackupDirectory,
+		cfg.System.TmpDirectory,
+	)
+	if err != nil {
+		log.WithField("error", err).Warn("failed to collect node utilization for metrics")
+		return
+	}
+
+	w.Family("propel_node_cpu_percent", "gauge", "CPU usage of the node as a percentage.")
+	w.Sample("propel_node_cpu_percent", u.CpuPercent)
+	w.Family("propel_node_load_average", "gauge", "Load average of the node.")
+	w.Sample("propel_node_load_average", u.LoadAvg1, metrics.Label{Name: "period", Value: "1m"})
+	w.Sample("propel_node_load_average", u.LoadAvg5, metrics.Label{Name: "period", Value: "5m"})
+	w.Sample("propel_node_load_average", u.LoadAvg15, metrics.Label{Name: "period", Value: "15m"})
+	w.Family("propel_node_memory_total_bytes", "gauge", "Total memory of the node in bytes.")
+	w.Sample("propel_node_memory_total_bytes", float64(u.MemoryTotal))
+	w.Family("propel_node_memory_used_bytes", "gauge", "Memory in use on the node in bytes.")
+	w.Sample("propel_node_memory_used_bytes", float64(u.MemoryUsed))
+	w.Family("propel_node_swap_total_bytes", "gauge", "Total swap of the node in bytes.")
+	w.Sample("propel_node_swap_total_bytes", float64(u.SwapTotal))
+	w.Family("propel_node_swap_used_bytes", "gauge", "Swap in use on the node in bytes.")
+	w.Sample("propel_node_swap_used_bytes", float64(u.SwapUsed))
+	w.Family("propel_node_disk_total_bytes", "gauge", "Total size of the disks used by the daemon in bytes.")
+	for _, d := range u.DiskDetails {
+		w.Sample("propel_node_disk_total_bytes", float64(d.TotalSpace), metrics.Label{Name: "device", Value: d.Device}, metrics.Label{Name: "mountpoint", Value: d.Mountpoint})
+	}
+	w.Family("propel_node_disk_used_bytes", "gauge", "Space in use on the disks used by the daemon in bytes.")
+	for _, d := range u.DiskDetails {
+		w.Sample("propel_node_disk_used_bytes", float64(d.UsedSpace), metrics.Label{Name: "device", Value: d.Device}, metrics.Label{Name: "mountpoint", Value: d.Mountpoint})
+	}
+}
+
+// writeServerMetrics writes the resource usage and connection counts for every
+// server on the node.
+func writeServerMetrics(w *metrics.Writer, servers []*server.Server) {
+	type sample struct {
+		id    string
+		state string
+		ws    int
+		disk  int64
+		stats environment.Stats
+	}
+
+	samples := make([]sample, 0, len(servers))
+	for _, s := range servers {
+		samples = append(samples, sample{
+			id:    s.ID(),
+			state: s.Environment.State(),
+			ws:    s.Websockets().Len(),
+			disk:  s.Filesystem().CachedUsage(),
+			stats: s.Proc().Stats,
+		})
+	}
+
+	family := func(name, typ, help string, value func(sample) float64) {
+		w.Family(name, typ, help)
+		for _, s := range samples {
+			w.Sample(name, value(s), metrics.Label{Name: "server", Value: s.id})
+		}
+	}
+
+	family("propel_server_cpu_absolute", "gauge", "CPU usage of the server as a percentage of a single core.", func(s sample) float64 {
+		return s.stats.CpuAbsolute
+	})
+	family("propel_server_memory_bytes", "gauge", "Memory used by the server in bytes.", func(s sample) float64 {
+		return float64(s.stats.Memory)
+	})
+	family("propel_server_memory_limit_bytes", "gauge", "Memory limit of the server in bytes.", func(s sample) float64 {
+		return float64(s.stats.MemoryLimit)
+	})
+	family("propel_server_network_rx_bytes", "counter", "Bytes received by the server since it was started.", func(s sample) float64 {
+		return float64(s.stats.Network.RxBytes)
+	})
+	family("propel_server_network_tx_bytes", "counter", "Bytes transmitted by the server since it was started.", func(s sample) float64 {
+		return float64(s.stats.Network.TxBytes)
+	})
+	family("propel_server_disk_bytes", "gauge", "Disk space used by the server in bytes.", func(s sample) float64 {
+		return float64(s.disk)
+	})
+	family("propel_server_uptime_seconds", "gauge", "Time since the server process was started in seconds.", func(s sample) float64 {
+		return float64(s.stats.Uptime) / 1000
+	})
+	family("propel_server_websocket_connections", "gauge", "Number of open websocket connections for the server.", func(s sample) float64 {
+		return float64(s.ws)
+	})
+
+	w.Family("propel_server_state", "gauge", "Current state of the server, the sample for the active state is 1.")
+	for _, s := range samples {
+		for _, state := range metricsServerStates {
+			var v float64
+			if s.state == state {
+				v = 1
+			}
+			w.Sample("propel_server_state", v, metrics.Label{Name: "server", Value: s.id}, metrics.Label{Name: "state", Value: state})
+		}
+	}
+}
@@ -14,11 +14,14 @@ import (
 	"github.com/apex/log"
 	"github.com/gin-gonic/gin"
 
+	"github.com/priyxstudio/propel/fastdl"
 	"github.com/priyxstudio/propel/firewall"
+	"github.com/priyxstudio/propel/proxy/stream"
 	"github.com/priyxstudio/propel/router/downloader"
 	"github.com/priyxstudio/propel/router/middleware"
 	"github.com/priyxstudio/propel/router/tokens"
 	"github.com/priyxstudio/propel/server"
+	"github.com/priyxstudio/propel/server/transcript"
 	"github.com/priyxstudio/propel/server/transfer"
 )
 
@@ -168,6 +171,98 @@ func postServerPower(c *gin.Context) {
 	c.Status(http.StatusAccepted)
 }
 
+// postServerGracefulPower starts a countdown before stopping or restarting a server.
+// @Summary Gracefully stop or restart server
+// @Description Announces a countdown through the server console before stopping or restarting the server. If a player query is configured and reports no players online the countdown is skipped. Any values omitted use the node defaults.
+// @Tags Servers
+// @Accept json
+// @Param server path string true "Server identifier"
+// @Param payload body router.ServerGracefulPowerRequest true "Graceful power action"
+// @Success 202 {string} string "Accepted"
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/servers/{server}/power/graceful [post]
+func postServerGracefulPower(c *gin.Context) {
+	s := ExtractServer(c)
+
+	var data ServerGracefulPowerRequest
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	if data.Action != server.PowerActionStop && data.Action != server.PowerActionRestart {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "The power action provided was not valid, should be one of \"stop\", \"restart\"",
+		})
+		return
+	}
+	if data.Countdown < 0 || data.Countdown > 3600 {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "The countdown must be between 0 and 3600 seconds.",
+		})
+		return
+	}
+	if data.Query != "" && !data.Query.IsValid() {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "The query protocol provided was not valid, should be one of \"minecraft\", \"source\"",
+		})
+		return
+	}
+	if data.Action == server.PowerActionRestart && s.IsSuspended() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "Cannot start or restart a server that is suspended.",
+		})
+		return
+	}
+	if s.IsGracefullyStopping() {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "A graceful stop is already in progress for this server.",
+		})
+		return
+	}
+
+	opts := server.GracefulStopOptions{
+		Restart:       data.Action == server.PowerActionRestart,
+		Countdown:     data.Countdown,
+		Announcements: data.Announcements,
+		Message:       data.Message,
+		Query:         data.Query,
+		QueryPort:     data.QueryPort,
+	}
+	go func(s *server.Server) {
+		if err := s.GracefulStop(opts); err != nil && !errors.Is(err, server.ErrGracefulStopPending) {
+			s.Log().WithFields(log.Fields{"action": data.Action, "error": err}).
+				Error("encountered error processing a graceful power action in the background")
+		}
+	}(s)
+
+	c.Status(http.StatusAccepted)
+}
+
+// deleteServerGracefulPower cancels a running graceful stop or restart countdown.
+// @Summary Cancel graceful stop or restart
+// @Tags Servers
+// @Param server path string true "Server identifier"
+// @Success 204 "No Content"
+// @Failure 404 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/servers/{server}/power/graceful [delete]
+func deleteServerGracefulPower(c *gin.Context) {
+	s := ExtractServer(c)
+
+	if !s.CancelGracefulStop() {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "There is no graceful stop in progress for this server.",
+		})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
 // postServerCommands sends an array of commands to a running server instance.
 // @Summary Send console commands
 // @Tags Servers
@@ -246,6 +341,9 @@ func postServerSync(c *gin.Context) {
 	if err := firewallMgr.CleanupInvalidPortRules(s.ID(), validPorts); err != nil {
 		log.WithError(err).WithField("server", s.ID()).Warn("failed to cleanup invalid firewall rules during sync")
 	}
+	if err := stream.Get().Prune(s.ID(), validPorts); err != nil {
+		log.WithError(err).WithField("server", s.ID()).Warn("failed to cleanup invalid stream proxies during sync")
+	}
 
 	c.Status(http.StatusNoContent)
 }
@@ -389,6 +487,41 @@ func deleteServer(c *gin.Context) {
 		log.WithFields(log.Fields{"server_id": ID, "error": err}).Warn("failed to remove server install log during deletion process")
 	}
 
+	// Remove the persisted console transcripts for this server
+	if err := transcript.Remove(ID); err != nil {
+		log.WithFields(log.Fields{"server_id": ID, "error": err}).Warn("failed to remove server console transcripts during deletion process")
+	}
+
+	// Remove the console triggers for this server
+	if err := s.DeleteAllConsoleTriggers(); err != nil {
+		log.WithFields(log.Fields{"server_id": ID, "error": err}).Warn("failed to delete console triggers during server deletion")
+	}
+
+	// Remove the crash reports for this server
+	if err := s.DeleteAllCrashReports(); err != nil {
+		log.WithFields(log.Fields{"server_id": ID, "error": err}).Warn("failed to delete crash reports during server deletion")
+	}
+
+	// Remove all webhooks and queued deliveries for this server
+	if err := s.DeleteAllWebhooks(); err != nil {
+		log.WithFields(log.Fields{"server_id": ID, "error": err}).Warn("failed to delete webhooks during server deletion")
+	}
+
+	// Remove the recorded network traffic for this server
+	if err := s.DeleteAllTraffic(); err != nil {
+		log.WithFields(log.Fields{"server_id": ID, "error": err}).Warn("failed to delete network traffic during server deletion")
+	}
+
+	// Remove the stored stats history for this server
+	if err := s.DeleteAllStatsHistory(); err != nil {
+		log.WithFields(log.Fields{"server_id": ID, "error": err}).Warn("failed to delete stats history during server deletion")
+	}
+
+	// Remove the compressed FastDL files for this server
+	if err := fastdl.Cache().Purge(ID); err != nil {
+		log.WithFields(log.Fields{"server_id": ID, "error": err}).Warn("failed to purge FastDL cache during server deletion")
+	}
+
 	// Remove all firewall rules for this server
 	{
 		firewallMgr := firewall.NewManager()
@@ -398,10 +531,7 @@ func deleteServer(c *gin.Context) {
 	}
 
 	// Clean up proxy configurations and certificates for this server
-	serverIP := s.Config().Allocations.DefaultMapping.Ip
-	if serverIP != "" {
-		cleanupServerProxies(serverIP, s.Log())
-	}
+	removeServerProxies(s)
 
 	// Remove all server backups unless config setting is specified
 	if config.Get().System.Backups.RemoveBackupsOnServerDelete == true {
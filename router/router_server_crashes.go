@@ -0,0 +1,83 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+
+	"emperror.dev/errors"
+	"github.com/gin-gonic/gin"
+
+	"github.com/priyxstudio/propel/internal/models"
+	"github.com/priyxstudio/propel/router/middleware"
+	"github.com/priyxstudio/propel/server"
+)
+
+// CrashReportResponse represents a crash report in API responses
+type CrashReportResponse struct {
+	Data models.CrashReport `json:"data"`
+}
+
+// CrashReportsListResponse represents a list of crash reports
+type CrashReportsListResponse struct {
+	Data []models.CrashReport `json:"data"`
+
+	// Whether the crash handler has given up on restarting the server
+	IsCrashed bool `json:"is_crashed"`
+}
+
+// getServerCrashReports returns the stored crash reports for a server
+// @Summary List crash reports for a server
+// @Description Returns the crash reports stored for the server, newest first.
+// @Tags Servers
+// @Produce json
+// @Param server path string true "Server identifier"
+// @Success 200 {object} router.CrashReportsListResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/servers/{server}/crashes [get]
+func getServerCrashReports(c *gin.Context) {
+	s := middleware.ExtractServer(c)
+
+	reports, err := s.CrashReports()
+	if err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, CrashReportsListResponse{Data: reports, IsCrashed: s.IsCrashed()})
+}
+
+// getServerCrashReport returns a specific crash report
+// @Summary Get a crash report
+// @Tags Servers
+// @Produce json
+// @Param server path string true "Server identifier"
+// @Param crash path int true "Crash report ID"
+// @Success 200 {object} router.CrashReportResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/servers/{server}/crashes/{crash} [get]
+func getServerCrashReport(c *gin.Context) {
+	s := middleware.ExtractServer(c)
+
+	id, err := strconv.ParseUint(c.Param("crash"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid crash report ID"})
+		return
+	}
+
+	report, err := s.CrashReport(uint(id))
+	if err != nil {
+		if errors.Is(err, server.ErrCrashReportNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "crash report not found"})
+			return
+		}
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, CrashReportResponse{Data: *report})
+}
@@ -19,6 +19,7 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/internal/audit"
 	"github.com/priyxstudio/propel/internal/models"
 	"github.com/priyxstudio/propel/internal/ufs"
 	"github.com/priyxstudio/propel/router/downloader"
@@ -703,6 +704,8 @@ func postServerUploadFiles(c *gin.Context) {
 		middleware.CaptureAndAbort(c, err)
 		return
 	}
+	middleware.SetAuditActor(c, audit.ActorUser, token.UserUuid)
+	middleware.SetAuditServer(c, token.ServerUuid)
 
 	s, ok := manager.Get(token.ServerUuid)
 	if !ok || !token.IsUniqueRequest() {
@@ -0,0 +1,221 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/priyxstudio/propel/environment"
+	"github.com/priyxstudio/propel/router/middleware"
+	"github.com/priyxstudio/propel/server/transcript"
+)
+
+// getServerLogHistory pages through the complete console history of a server.
+// @Summary Page through server console history
+// @Description Returns a page of console output with timestamps. Pass the "before" cursor from a response to load older output, or the "after" cursor to load newer output.
+// @Tags Servers
+// @Produce json
+// @Param server path string true "Server identifier"
+// @Param limit query int false "Number of lines" minimum(1) maximum(1000)
+// @Param before query string false "Return lines logged before this RFC3339 timestamp"
+// @Param after query string false "Return lines logged after this RFC3339 timestamp"
+// @Param since query string false "Only include lines logged at or after this RFC3339 timestamp"
+// @Param until query string false "Only include lines logged at or before this RFC3339 timestamp"
+// @Param pattern query string false "Regular expression lines must match"
+// @Success 200 {object} router.ServerLogHistoryResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/servers/{server}/logs/history [get]
+func getServerLogHistory(c *gin.Context) {
+	s := middleware.ExtractServer(c)
+
+	history, ok := s.LogHistory()
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "This server environment does not support reading the console history.",
+		})
+		return
+	}
+
+	q := environment.LogQuery{}
+	q.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if q.Limit <= 0 {
+		q.Limit = 100
+	} else if q.Limit > 1000 {
+		q.Limit = 1000
+	}
+
+	for key, dst := range map[string]*time.Time{
+		"before": &q.Before,
+		"after":  &q.After,
+		"since":  &q.Since,
+		"until":  &q.Until,
+	} {
+		v := c.Query(key)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "The \"" + key + "\" parameter must be a valid RFC3339 timestamp.",
+			})
+			return
+		}
+		*dst = t
+	}
+
+	if !q.Before.IsZero() && !q.After.IsZero() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "Only one of \"before\" or \"after\" may be provided.",
+		})
+		return
+	}
+
+	if p := c.Query("pattern"); p != "" {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "The pattern provided is not a valid regular expression.",
+			})
+			return
+		}
+		q.Pattern = re
+	}
+
+	page, err := history.ReadLogPage(c.Request.Context(), q)
+	if err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	res := ServerLogHistoryResponse{Data: page.Entries, HasMore: page.HasMore}
+	if res.Data == nil {
+		res.Data = []environment.LogEntry{}
+	}
+	if before, after := page.Cursors(); !before.IsZero() {
+		res.Before = before.Format(time.RFC3339Nano)
+		res.After = after.Format(time.RFC3339Nano)
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// getServerLogDownload streams the complete console output of a server as a file.
+// @Summary Download server console log
+// @Tags Servers
+// @Produce plain
+// @Param server path string true "Server identifier"
+// @Param timestamps query bool false "Prefix each line with the time it was logged"
+// @Success 200 {file} file
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/servers/{server}/logs/download [get]
+func getServerLogDownload(c *gin.Context) {
+	s := middleware.ExtractServer(c)
+
+	history, ok := s.LogHistory()
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "This server environment does not support reading the console history.",
+		})
+		return
+	}
+
+	timestamps, _ := strconv.ParseBool(c.DefaultQuery("timestamps", "true"))
+
+	c.Header("Content-Disposition", "attachment; filename=\""+s.ID()+"-console.log\"")
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	if err := history.CopyLog(c.Request.Context(), c.Writer, timestamps); err != nil {
+		// Headers have already been sent at this point, so the best we can do is log the
+		// failure and terminate the response early.
+		s.Log().WithField("error", err).Warn("failed to stream console log to client")
+	}
+}
+
+// getServerTranscripts lists the persisted console transcripts for a server.
+// @Summary List server console transcripts
+// @Description Returns the console transcripts stored on disk for the server, ordered from oldest to newest. The active transcript is always the last entry.
+// @Tags Servers
+// @Produce json
+// @Param server path string true "Server identifier"
+// @Success 200 {object} router.ServerTranscriptListResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/servers/{server}/logs/transcripts [get]
+func getServerTranscripts(c *gin.Context) {
+	s := middleware.ExtractServer(c)
+
+	files, err := transcript.List(s.ID())
+	if err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ServerTranscriptListResponse{Data: files})
+}
+
+// getServerTranscript downloads a single persisted console transcript.
+// @Summary Download server console transcript
+// @Description Rotated transcripts are returned gzip compressed, the active transcript is returned as plain text.
+// @Tags Servers
+// @Produce plain
+// @Produce application/gzip
+// @Param server path string true "Server identifier"
+// @Param file path string true "Transcript file name"
+// @Success 200 {file} file
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/servers/{server}/logs/transcripts/{file} [get]
+func getServerTranscript(c *gin.Context) {
+	s := middleware.ExtractServer(c)
+
+	name := c.Param("file")
+	p, err := transcript.Path(s.ID(), name)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "The requested transcript does not exist.",
+		})
+		return
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "The requested transcript does not exist.",
+			})
+			return
+		}
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+	defer f.Close()
+
+	contentType := "text/plain; charset=utf-8"
+	if strings.HasSuffix(name, ".gz") {
+		contentType = "application/gzip"
+	}
+
+	c.Header("Content-Disposition", "attachment; filename=\""+s.ID()+"-"+name+"\"")
+	c.Header("Content-Type", contentType)
+	c.Status(http.StatusOK)
+
+	if _, err := io.Copy(c.Writer, f); err != nil {
+		s.Log().WithField("error", err).Warn("failed to stream console transcript to client")
+	}
+}
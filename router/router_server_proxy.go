@@ -1,23 +1,21 @@
 package router
 
 import (
-	"crypto"
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 
+	"emperror.dev/errors"
 	"github.com/apex/log"
 	"github.com/gin-gonic/gin"
-	"github.com/go-acme/lego/v4/certcrypto"
-	"github.com/go-acme/lego/v4/certificate"
-	"github.com/go-acme/lego/v4/challenge/http01"
-	"github.com/go-acme/lego/v4/lego"
-	"github.com/go-acme/lego/v4/registration"
+
+	"github.com/priyxstudio/propel/internal/models"
+	"github.com/priyxstudio/propel/proxy"
+	"github.com/priyxstudio/propel/proxy/stream"
+	"github.com/priyxstudio/propel/router/middleware"
+	"github.com/priyxstudio/propel/server"
 )
 
 // isNginxInstalled checks if nginx is installed and available on the system.
@@ -139,20 +137,41 @@ func cleanupServerProxies(serverIP string, logger *log.Entry) {
 	}
 }
 
-type LetsEncryptUser struct {
-	Email        string
-	Registration *registration.Resource
-	key          crypto.PrivateKey
+// removeServerProxies stops proxying every domain of the server, using the
+// built-in proxy or nginx depending on the proxy mode. This is called during
+// server deletion or transfer.
+func removeServerProxies(s *server.Server) {
+	if err := stream.Get().DeleteServer(s.ID()); err != nil {
+		s.Log().WithField("error", err).Warn("failed to remove stream proxies during server cleanup")
+	}
+	if proxy.Builtin() {
+		if err := proxy.Get().DeleteServer(s.ID()); err != nil {
+			s.Log().WithField("error", err).Warn("failed to remove proxies during server cleanup")
+		}
+		return
+	}
+	if serverIP := s.Config().Allocations.DefaultMapping.Ip; serverIP != "" {
+		cleanupServerProxies(serverIP, s.Log())
+	}
+	if _, err := proxy.RemoveServer(s.ID()); err != nil {
+		s.Log().WithField("error", err).Warn("failed to remove proxy records during server cleanup")
+	}
 }
 
-func (u *LetsEncryptUser) GetEmail() string {
-	return u.Email
-}
-func (u LetsEncryptUser) GetRegistration() *registration.Resource {
-	return u.Registration
-}
-func (u *LetsEncryptUser) GetPrivateKey() crypto.PrivateKey {
-	return u.key
+// abortWithProxyError responds to a request that failed to change a proxy of
+// the built-in proxy.
+func abortWithProxyError(c *gin.Context, s *server.Server, err error) {
+	switch {
+	case errors.Is(err, proxy.ErrDomainInUse):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "This domain is already in use by another server."})
+	case errors.Is(err, proxy.ErrInvalidProxy):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, proxy.ErrCertificateRequest):
+		s.Log().WithField("error", err).Error("failed to obtain certificate")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to request certificate"})
+	default:
+		middleware.CaptureAndAbort(c, err)
+	}
 }
 
 // postServerProxyCreate creates a reverse proxy configuration for a server.
@@ -165,12 +184,18 @@ func (u *LetsEncryptUser) GetPrivateKey() crypto.PrivateKey {
 // @Success 202 "Accepted"
 // @Failure 400 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse "Conflict - domain is proxied to another server"
 // @Failure 503 {object} ErrorResponse "Service Unavailable - nginx not installed"
 // @Security NodeToken
 // @Router /api/servers/{server}/proxy/create [post]
 func postServerProxyCreate(c *gin.Context) {
 	s := ExtractServer(c)
 
+	if proxy.Builtin() {
+		postServerProxyCreateBuiltin(c, s)
+		return
+	}
+
 	// Check if nginx is installed before proceeding
 	if !isNginxInstalled() {
 		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
@@ -195,6 +220,17 @@ func postServerProxyCreate(c *gin.Context) {
 		return
 	}
 
+	// Record the proxy so that it is listed and removed along with the server, it
+	// is only marked as using SSL once the certificate has been saved.
+	p := models.Proxy{ServerUUID: s.ID(), Domain: data.Domain, IP: data.IP, Port: data.Port}
+	if err := proxy.Save(&p); err != nil {
+		if errors.Is(err, proxy.ErrDomainInUse) {
+			abortWithProxyError(c, s, err)
+			return
+		}
+		s.Log().WithField("error", err).Warn("failed to record proxy")
+	}
+
 	nginxconfig := []byte(`server {
 		listen 80;
 		server_name ` + data.Domain + `;
@@ -236,57 +272,8 @@ func postServerProxyCreate(c *gin.Context) {
 	if data.Ssl {
 
 		if data.UseLetsEncrypt {
-			privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-			if err != nil {
-				s.Log().WithField("error", err).Error("failed to generate private key for Let's Encrypt")
-				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-					"error": "Failed to generate private key",
-				})
-				return
-			}
-
-			letsEncryptUser := LetsEncryptUser{
-				Email: data.ClientEmail,
-				key:   privateKey,
-			}
-
-			config := lego.NewConfig(&letsEncryptUser)
-			config.Certificate.KeyType = certcrypto.RSA2048
-
-			client, err := lego.NewClient(config)
-			if err != nil {
-				s.Log().WithField("error", err).Error("failed to create lego client")
-				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-					"error": "Failed to request certificate",
-				})
-				return
-			}
-
-			err = client.Challenge.SetHTTP01Provider(http01.NewProviderServer("", "81"))
-			if err != nil {
-				s.Log().WithField("error", err).Error("failed to set HTTP01 provider")
-				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-					"error": "Failed to request certificate",
-				})
-				return
-			}
-
-			reg, err := client.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
-			if err != nil {
-				s.Log().WithField("error", err).Error("failed to register account")
-				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-					"error": "Failed to request certificate",
-				})
-				return
-			}
-			letsEncryptUser.Registration = reg
-
-			request := certificate.ObtainRequest{
-				Domains: []string{data.Domain},
-				Bundle:  true,
-			}
-
-			cert, err := client.Certificate.Obtain(request)
+			var err error
+			certfile, keyfile, err = proxy.ObtainCertificate(data.Domain, data.ClientEmail)
 			if err != nil {
 				s.Log().WithField("error", err).Error("failed to obtain certificate")
 				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
@@ -294,9 +281,6 @@ func postServerProxyCreate(c *gin.Context) {
 				})
 				return
 			}
-
-			certfile = []byte(cert.Certificate)
-			keyfile = []byte(cert.PrivateKey)
 		} else {
 			certfile = []byte(data.SslCert)
 			keyfile = []byte(data.SslKey)
@@ -334,6 +318,18 @@ func postServerProxyCreate(c *gin.Context) {
 			return
 		}
 
+		record := models.Certificate{
+			ServerUUID: s.ID(),
+			Domain:     data.Domain,
+			Managed:    data.UseLetsEncrypt,
+			Email:      data.ClientEmail,
+			CertPath:   certPath,
+			KeyPath:    keyPath,
+		}
+		if err := proxy.RecordCertificate(&record, certfile); err != nil {
+			s.Log().WithField("error", err).Warn("failed to record certificate")
+		}
+
 		nginxconfig = []byte(`server {
 	listen 80;
 	server_name ` + data.Domain + `;
@@ -370,6 +366,13 @@ server {
 
 		restartcmd := exec.Command("systemctl", "reload", "nginx")
 		restartcmd.Run()
+
+		p.SSL = true
+		p.UseLetsEncrypt = data.UseLetsEncrypt
+		p.ClientEmail = data.ClientEmail
+		if err := proxy.Save(&p); err != nil {
+			s.Log().WithField("error", err).Warn("failed to record proxy")
+		}
 	}
 
 	c.Status(http.StatusAccepted)
@@ -391,6 +394,11 @@ server {
 func postServerProxyDelete(c *gin.Context) {
 	s := ExtractServer(c)
 
+	if proxy.Builtin() {
+		postServerProxyDeleteBuiltin(c, s)
+		return
+	}
+
 	// Check if nginx is installed before proceeding
 	if !isNginxInstalled() {
 		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
@@ -429,9 +437,88 @@ func postServerProxyDelete(c *gin.Context) {
 		}
 	}
 
+	if _, err := proxy.Remove(s.ID(), data.Domain, data.Port); err != nil {
+		s.Log().WithField("error", err).Warn("failed to remove proxy record")
+	}
+
 	cmd := exec.Command("systemctl", "reload", "nginx")
 	cmd.Run()
 
 	c.Status(http.StatusAccepted)
 }
 
+// postServerProxyCreateBuiltin creates a proxy using the built-in proxy, which
+// takes the same request as the nginx backend.
+func postServerProxyCreateBuiltin(c *gin.Context, s *server.Server) {
+	var data struct {
+		Domain         string `json:"domain"`
+		IP             string `json:"ip"`
+		Port           string `json:"port"`
+		Ssl            bool   `json:"ssl"`
+		UseLetsEncrypt bool   `json:"use_lets_encrypt"`
+		ClientEmail    string `json:"client_email"`
+		SslCert        string `json:"ssl_cert"`
+		SslKey         string `json:"ssl_key"`
+	}
+
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	p := models.Proxy{
+		ServerUUID:     s.ID(),
+		Domain:         data.Domain,
+		IP:             data.IP,
+		Port:           data.Port,
+		SSL:            data.Ssl,
+		UseLetsEncrypt: data.Ssl && data.UseLetsEncrypt,
+		ClientEmail:    data.ClientEmail,
+	}
+	if err := proxy.Get().Create(p, []byte(data.SslCert), []byte(data.SslKey)); err != nil {
+		abortWithProxyError(c, s, err)
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
+
+// postServerProxyDeleteBuiltin deletes a proxy of the built-in proxy.
+func postServerProxyDeleteBuiltin(c *gin.Context, s *server.Server) {
+	var data struct {
+		Domain string `json:"domain"`
+		Port   string `json:"port"`
+	}
+
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	if err := proxy.Get().Delete(s.ID(), data.Domain, data.Port); err != nil {
+		abortWithProxyError(c, s, err)
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
+
+// getServerProxies lists the domains proxied to a server.
+// @Summary List server proxies
+// @Description Lists the domains proxied to the server along with the expiry and status of their certificates. The status is one of valid, expiring, expired or renewal_failed.
+// @Tags Server Proxy
+// @Produce json
+// @Param server path string true "Server identifier"
+// @Success 200 {array} proxy.Entry
+// @Failure 500 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/servers/{server}/proxy [get]
+func getServerProxies(c *gin.Context) {
+	s := ExtractServer(c)
+
+	entries, err := proxy.List(s.ID())
+	if err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
@@ -0,0 +1,147 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+
+	"emperror.dev/errors"
+	"github.com/gin-gonic/gin"
+
+	"github.com/priyxstudio/propel/firewall"
+	"github.com/priyxstudio/propel/internal/models"
+	"github.com/priyxstudio/propel/proxy/stream"
+	"github.com/priyxstudio/propel/router/middleware"
+)
+
+// StreamProxyRequest represents a request to create a stream proxy
+type StreamProxyRequest struct {
+	Protocol      string `json:"protocol" binding:"omitempty,oneof=tcp udp both"`
+	ListenIP      string `json:"listen_ip" binding:"omitempty,ip"`
+	ListenPort    int    `json:"listen_port" binding:"required,min=1,max=65535"`
+	ServerPort    int    `json:"server_port" binding:"required,min=1,max=65535"`
+	ProxyProtocol bool   `json:"proxy_protocol"`
+}
+
+// StreamProxyResponse represents a stream proxy in API responses
+type StreamProxyResponse struct {
+	Data models.StreamProxy `json:"data"`
+}
+
+// StreamProxiesListResponse represents a list of stream proxies
+type StreamProxiesListResponse struct {
+	Data []models.StreamProxy `json:"data"`
+}
+
+// abortWithStreamError responds with the status matching a stream proxy error.
+func abortWithStreamError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, stream.ErrInvalidStream):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, stream.ErrPortInUse):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, stream.ErrStreamNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "stream proxy not found"})
+	default:
+		middleware.CaptureAndAbort(c, err)
+	}
+}
+
+// getServerProxyStreams returns the stream proxies of a server
+// @Summary List stream proxies for a server
+// @Tags Proxy
+// @Produce json
+// @Param server path string true "Server identifier"
+// @Success 200 {object} router.StreamProxiesListResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/servers/{server}/proxy/streams [get]
+func getServerProxyStreams(c *gin.Context) {
+	s := middleware.ExtractServer(c)
+
+	streams, err := stream.Get().List(s.ID())
+	if err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, StreamProxiesListResponse{Data: streams})
+}
+
+// postServerProxyStream creates a stream proxy forwarding a public port to a port
+// allocated to the server
+// @Summary Create a stream proxy
+// @Tags Proxy
+// @Accept json
+// @Produce json
+// @Param server path string true "Server identifier"
+// @Param request body router.StreamProxyRequest true "Stream proxy"
+// @Success 201 {object} router.StreamProxyResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/servers/{server}/proxy/streams [post]
+func postServerProxyStream(c *gin.Context) {
+	s := middleware.ExtractServer(c)
+
+	var req StreamProxyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Validate that the server has access to the port traffic is forwarded to
+	allocations := s.Config().Allocations
+	if !firewall.ValidatePortForServer(&allocations, req.ServerPort) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error: "server does not have access to the specified port",
+		})
+		return
+	}
+
+	sp := &models.StreamProxy{
+		ServerUUID:    s.ID(),
+		Protocol:      req.Protocol,
+		ListenIP:      req.ListenIP,
+		ListenPort:    req.ListenPort,
+		ServerPort:    req.ServerPort,
+		ProxyProtocol: req.ProxyProtocol,
+	}
+	if err := stream.Get().Create(sp); err != nil {
+		abortWithStreamError(c, err)
+		return
+	}
+
+	s.Log().WithField("listen_port", sp.ListenPort).WithField("server_port", sp.ServerPort).Info("created stream proxy")
+	c.JSON(http.StatusCreated, StreamProxyResponse{Data: *sp})
+}
+
+// deleteServerProxyStream stops and removes a stream proxy of the server
+// @Summary Delete a stream proxy
+// @Tags Proxy
+// @Produce json
+// @Param server path string true "Server identifier"
+// @Param stream path int true "Stream proxy ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/servers/{server}/proxy/streams/{stream} [delete]
+func deleteServerProxyStream(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("stream"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid stream proxy ID"})
+		return
+	}
+
+	s := middleware.ExtractServer(c)
+	if err := stream.Get().Delete(s.ID(), uint(id)); err != nil {
+		abortWithStreamError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
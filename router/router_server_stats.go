@@ -0,0 +1,96 @@
+package router
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/internal/models"
+	"github.com/priyxstudio/propel/router/middleware"
+	"github.com/priyxstudio/propel/server"
+)
+
+// StatsHistoryResponse represents the resource usage history of a server
+type StatsHistoryResponse struct {
+	// The resolution of the returned samples
+	Resolution string               `json:"resolution"`
+	Data       []models.StatsSample `json:"data"`
+}
+
+var statsHistoryResolutions = map[string]int{
+	"1s": server.StatsResolutionSecond,
+	"1m": server.StatsResolutionMinute,
+	"1h": server.StatsResolutionHour,
+}
+
+// getServerStatsHistory returns the stored resource usage history for a server.
+// @Summary Get server resource usage history
+// @Description Returns the resource usage samples stored for the server at the given resolution, oldest first. When no range is provided the full retention for the resolution is returned.
+// @Tags Servers
+// @Produce json
+// @Param server path string true "Server identifier"
+// @Param resolution query string false "Sample resolution" Enums(1s, 1m, 1h) default(1m)
+// @Param from query string false "Only include samples at or after this RFC3339 timestamp"
+// @Param to query string false "Only include samples at or before this RFC3339 timestamp"
+// @Success 200 {object} router.StatsHistoryResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/servers/{server}/stats/history [get]
+func getServerStatsHistory(c *gin.Context) {
+	s := middleware.ExtractServer(c)
+
+	if !config.Get().System.StatsHistory.Enabled {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "Resource usage history is not enabled on this node.",
+		})
+		return
+	}
+
+	name := c.DefaultQuery("resolution", "1m")
+	resolution, ok := statsHistoryResolutions[name]
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "The \"resolution\" parameter must be one of 1s, 1m or 1h.",
+		})
+		return
+	}
+
+	to := time.Now()
+	from := to.Add(-time.Duration(server.StatsSamples(resolution)*resolution) * time.Second)
+	for key, dst := range map[string]*time.Time{"from": &from, "to": &to} {
+		v := c.Query(key)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "The \"" + key + "\" parameter must be a valid RFC3339 timestamp.",
+			})
+			return
+		}
+		*dst = t
+	}
+
+	if from.After(to) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "The \"from\" parameter must not be after the \"to\" parameter.",
+		})
+		return
+	}
+
+	samples, err := s.StatsHistory(resolution, from, to)
+	if err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+	if samples == nil {
+		samples = []models.StatsSample{}
+	}
+
+	c.JSON(http.StatusOK, StatsHistoryResponse{Resolution: name, Data: samples})
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/priyxstudio/propel/environment"
 	"github.com/priyxstudio/propel/firewall"
+	"github.com/priyxstudio/propel/internal/metrics"
 	"github.com/priyxstudio/propel/router/middleware"
 	"github.com/priyxstudio/propel/server"
 	"github.com/priyxstudio/propel/server/transfer"
@@ -65,26 +66,68 @@ func postServerTransfer(c *gin.Context) {
 
 	// Ensure the server is offline. Sometimes a "No such container" error gets through
 	// which means the server is already stopped. We can ignore that.
-	if s.Environment.State() != environment.ProcessOfflineState {
+	stop := func(ctx context.Context) error {
+		if s.Environment.State() == environment.ProcessOfflineState {
+			return nil
+		}
 		if err := s.Environment.WaitForStop(
-			s.Context(),
+			ctx,
 			time.Second*15,
 			false,
 		); err != nil && !strings.Contains(strings.ToLower(err.Error()), "no such container") {
-			s.SetTransferring(false)
-			middleware.CaptureAndAbort(c, errors.Wrap(err, "failed to stop server for transfer"))
-			return
+			return err
 		}
+		return nil
 	}
 
 	// Create a new transfer instance for this server.
 	trnsfr := transfer.New(context.Background(), s)
 	transfer.Outgoing().Add(trnsfr)
 
+	// Transfers that have to wait in the queue keep the server running until they
+	// can start. Live transfers only stop the server once its data has been copied
+	// to the target node.
+	admitted := transfer.Outgoing().Enqueue(trnsfr)
+	if admitted && !data.Live {
+		if err := stop(s.Context()); err != nil {
+			transfer.Outgoing().Remove(trnsfr)
+			s.SetTransferring(false)
+			middleware.CaptureAndAbort(c, errors.Wrap(err, "failed to stop server for transfer"))
+			return
+		}
+	}
+
 	go func() {
 		defer transfer.Outgoing().Remove(trnsfr)
 
-		if _, err := trnsfr.PushArchiveToTarget(data.URL, data.Token, data.Backups); err != nil {
+		if !admitted {
+			err := transfer.Outgoing().Wait(trnsfr.Context(), trnsfr)
+			if err == nil && !data.Live {
+				if err = stop(trnsfr.Context()); err != nil {
+					err = errors.Wrap(err, "failed to stop server for transfer")
+				}
+			}
+			if err != nil {
+				notifyPanelOfFailure()
+				if err == context.Canceled {
+					trnsfr.Log().Debug("canceled while queued")
+					trnsfr.SendMessage("Canceled.")
+					return
+				}
+				trnsfr.Log().WithError(err).Error("failed to start queued transfer")
+				return
+			}
+		}
+
+		start := time.Now()
+		var err error
+		if data.Live {
+			err = trnsfr.PushLiveToTarget(data.URL, data.Token, data.Backups, stop)
+		} else {
+			err = trnsfr.PushToTarget(data.URL, data.Token, data.Backups)
+		}
+		if err != nil {
+			metrics.TransferDuration.Observe(time.Since(start).Seconds(), "outgoing", "failed")
 			notifyPanelOfFailure()
 
 			if err == context.Canceled {
@@ -96,6 +139,7 @@ func postServerTransfer(c *gin.Context) {
 			trnsfr.Log().WithError(err).Error("failed to push archive to target")
 			return
 		}
+		metrics.TransferDuration.Observe(time.Since(start).Seconds(), "outgoing", "successful")
 
 		// Transfer successful - clean up firewall rules since server is moving to another node
 		firewallMgr := firewall.NewManager()
@@ -106,10 +150,7 @@ func postServerTransfer(c *gin.Context) {
 		}
 
 		// Clean up proxy configurations and certificates since server is moving to another node
-		serverIP := s.Config().Allocations.DefaultMapping.Ip
-		if serverIP != "" {
-			cleanupServerProxies(serverIP, s.Log())
-		}
+		removeServerProxies(s)
 
 		// DO NOT NOTIFY THE PANEL OF SUCCESS HERE. The only node that should send
 		// a success status is the destination node.  When we send a failure status,
@@ -123,6 +164,34 @@ func postServerTransfer(c *gin.Context) {
 	c.Status(http.StatusAccepted)
 }
 
+// getServerTransfer returns the status of the outgoing transfer of a server,
+// including its position if it is waiting in the transfer queue.
+// @Summary Get server transfer status
+// @Tags Transfers
+// @Produce json
+// @Param server path string true "Server identifier"
+// @Success 200 {object} router.ServerTransferStatusResponse
+// @Failure 404 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/servers/{server}/transfer [get]
+func getServerTransfer(c *gin.Context) {
+	s := ExtractServer(c)
+
+	trnsfr := transfer.Outgoing().Get(s.ID())
+	if trnsfr == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "Server is not currently being transferred.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ServerTransferStatusResponse{
+		Status:   trnsfr.Status().String(),
+		Position: transfer.Outgoing().Position(s.ID()),
+		Queue:    transfer.Outgoing().Queue(),
+	})
+}
+
 // deleteServerTransfer cancels an outgoing transfer for a server.
 // @Summary Cancel server transfer
 // @Tags Transfers
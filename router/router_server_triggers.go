@@ -0,0 +1,225 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+
+	"emperror.dev/errors"
+	"github.com/gin-gonic/gin"
+
+	"github.com/priyxstudio/propel/internal/models"
+	"github.com/priyxstudio/propel/router/middleware"
+	"github.com/priyxstudio/propel/server"
+)
+
+// ConsoleTriggerRequest represents a request to create or update a console trigger
+type ConsoleTriggerRequest struct {
+	Name     string                      `json:"name" binding:"max=191"`
+	Pattern  string                      `json:"pattern" binding:"required"`
+	Action   models.ConsoleTriggerAction `json:"action" binding:"required,oneof=command restart stop backup webhook"`
+	Payload  string                      `json:"payload"`
+	Cooldown *int                        `json:"cooldown" binding:"omitempty,min=0,max=86400"`
+	Enabled  *bool                       `json:"enabled"`
+}
+
+// ConsoleTriggerResponse represents a console trigger in API responses
+type ConsoleTriggerResponse struct {
+	Data models.ConsoleTrigger `json:"data"`
+}
+
+// ConsoleTriggersListResponse represents a list of console triggers
+type ConsoleTriggersListResponse struct {
+	Data []models.ConsoleTrigger `json:"data"`
+}
+
+// apply copies the request values onto the trigger, using the defaults for any
+// optional values that were not provided.
+func (r ConsoleTriggerRequest) apply(t *models.ConsoleTrigger) {
+	t.Name = r.Name
+	t.Pattern = r.Pattern
+	t.Action = r.Action
+	t.Payload = r.Payload
+	t.Cooldown = 60
+	if r.Cooldown != nil {
+		t.Cooldown = *r.Cooldown
+	}
+	t.Enabled = true
+	if r.Enabled != nil {
+		t.Enabled = *r.Enabled
+	}
+}
+
+// getConsoleTrigger returns the console trigger referenced in the request path,
+// aborting the request if it does not exist for the server.
+func getConsoleTrigger(c *gin.Context, s *server.Server) (*models.ConsoleTrigger, bool) {
+	id, err := strconv.ParseUint(c.Param("trigger"), 10, 32)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "invalid trigger ID"})
+		return nil, false
+	}
+	t, err := s.ConsoleTrigger(uint(id))
+	if err != nil {
+		if errors.Is(err, server.ErrConsoleTriggerNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: "console trigger not found"})
+		} else {
+			middleware.CaptureAndAbort(c, err)
+		}
+		return nil, false
+	}
+	return t, true
+}
+
+// getServerTriggers returns all console triggers for a server
+// @Summary List console triggers for a server
+// @Tags Servers
+// @Produce json
+// @Param server path string true "Server identifier"
+// @Success 200 {object} router.ConsoleTriggersListResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/servers/{server}/triggers [get]
+func getServerTriggers(c *gin.Context) {
+	s := middleware.ExtractServer(c)
+
+	triggers, err := s.ConsoleTriggers()
+	if err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ConsoleTriggersListResponse{Data: triggers})
+}
+
+// getServerTrigger returns a specific console trigger
+// @Summary Get a console trigger
+// @Tags Servers
+// @Produce json
+// @Param server path string true "Server identifier"
+// @Param trigger path int true "Trigger ID"
+// @Success 200 {object} router.ConsoleTriggerResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/servers/{server}/triggers/{trigger} [get]
+func getServerTrigger(c *gin.Context) {
+	s := middleware.ExtractServer(c)
+
+	t, ok := getConsoleTrigger(c, s)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, ConsoleTriggerResponse{Data: *t})
+}
+
+// postServerTrigger creates a new console trigger
+// @Summary Create a console trigger
+// @Description Creates a trigger that performs an action whenever a line of console output matches the pattern. The payload is the command to send for "command" actions, or the URL to deliver to for "webhook" actions.
+// @Tags Servers
+// @Accept json
+// @Produce json
+// @Param server path string true "Server identifier"
+// @Param trigger body router.ConsoleTriggerRequest true "Console trigger configuration"
+// @Success 201 {object} router.ConsoleTriggerResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/servers/{server}/triggers [post]
+func postServerTrigger(c *gin.Context) {
+	s := middleware.ExtractServer(c)
+
+	var req ConsoleTriggerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var t models.ConsoleTrigger
+	req.apply(&t)
+	if err := server.ValidateConsoleTrigger(&t); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := s.SaveConsoleTrigger(&t); err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, ConsoleTriggerResponse{Data: t})
+}
+
+// putServerTrigger updates an existing console trigger
+// @Summary Update a console trigger
+// @Tags Servers
+// @Accept json
+// @Produce json
+// @Param server path string true "Server identifier"
+// @Param trigger path int true "Trigger ID"
+// @Param body body router.ConsoleTriggerRequest true "Console trigger configuration"
+// @Success 200 {object} router.ConsoleTriggerResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/servers/{server}/triggers/{trigger} [put]
+func putServerTrigger(c *gin.Context) {
+	s := middleware.ExtractServer(c)
+
+	t, ok := getConsoleTrigger(c, s)
+	if !ok {
+		return
+	}
+
+	var req ConsoleTriggerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	req.apply(t)
+	if err := server.ValidateConsoleTrigger(t); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := s.SaveConsoleTrigger(t); err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ConsoleTriggerResponse{Data: *t})
+}
+
+// deleteServerTrigger deletes a console trigger
+// @Summary Delete a console trigger
+// @Tags Servers
+// @Produce json
+// @Param server path string true "Server identifier"
+// @Param trigger path int true "Trigger ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/servers/{server}/triggers/{trigger} [delete]
+func deleteServerTrigger(c *gin.Context) {
+	s := middleware.ExtractServer(c)
+
+	t, ok := getConsoleTrigger(c, s)
+	if !ok {
+		return
+	}
+
+	if err := s.DeleteConsoleTrigger(t.ID); err != nil {
+		if errors.Is(err, server.ErrConsoleTriggerNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "console trigger not found"})
+			return
+		}
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,309 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+
+	"emperror.dev/errors"
+	"github.com/gin-gonic/gin"
+
+	"github.com/priyxstudio/propel/internal/models"
+	"github.com/priyxstudio/propel/router/middleware"
+	"github.com/priyxstudio/propel/server"
+)
+
+// WebhookRequest represents a request to create or update a webhook
+type WebhookRequest struct {
+	Name    string               `json:"name" binding:"max=191"`
+	URL     string               `json:"url" binding:"required,url"`
+	Format  models.WebhookFormat `json:"format" binding:"omitempty,oneof=json discord slack"`
+	Secret  *string              `json:"secret"`
+	Events  []string             `json:"events"`
+	Enabled *bool                `json:"enabled"`
+}
+
+// WebhookResponse represents a webhook in API responses
+type WebhookResponse struct {
+	Data models.Webhook `json:"data"`
+}
+
+// WebhooksListResponse represents a list of webhooks
+type WebhooksListResponse struct {
+	Data []models.Webhook `json:"data"`
+}
+
+// WebhookDeliveriesListResponse represents a list of webhook deliveries
+type WebhookDeliveriesListResponse struct {
+	Data []models.WebhookDelivery `json:"data"`
+}
+
+// apply copies the request values onto the webhook, using the defaults for any
+// optional values that were not provided. The secret is only changed when one
+// is provided, so that updates do not need to resend it.
+func (r WebhookRequest) apply(w *models.Webhook) {
+	w.Name = r.Name
+	w.URL = r.URL
+	w.Format = models.WebhookFormatJSON
+	if r.Format != "" {
+		w.Format = r.Format
+	}
+	if r.Secret != nil {
+		w.Secret = *r.Secret
+	}
+	w.Events = r.Events
+	w.Enabled = true
+	if r.Enabled != nil {
+		w.Enabled = *r.Enabled
+	}
+}
+
+// deliveriesLimit returns the number of deliveries requested, defaulting to 50
+// and capped at 500.
+func deliveriesLimit(c *gin.Context) int {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 {
+		return 50
+	}
+	return min(limit, 500)
+}
+
+// getWebhook returns the webhook referenced in the request path, aborting the
+// request if it does not exist for the server.
+func getWebhook(c *gin.Context, s *server.Server) (*models.Webhook, bool) {
+	id, err := strconv.ParseUint(c.Param("webhook"), 10, 32)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "invalid webhook ID"})
+		return nil, false
+	}
+	w, err := s.Webhook(uint(id))
+	if err != nil {
+		if errors.Is(err, server.ErrWebhookNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, ErrorResponse{Error: "webhook not found"})
+		} else {
+			middleware.CaptureAndAbort(c, err)
+		}
+		return nil, false
+	}
+	return w, true
+}
+
+// getServerWebhooks returns all webhooks for a server
+// @Summary List webhooks for a server
+// @Tags Servers
+// @Produce json
+// @Param server path string true "Server identifier"
+// @Success 200 {object} router.WebhooksListResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/servers/{server}/webhooks [get]
+func getServerWebhooks(c *gin.Context) {
+	s := middleware.ExtractServer(c)
+
+	webhooks, err := s.Webhooks()
+	if err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, WebhooksListResponse{Data: webhooks})
+}
+
+// getServerWebhook returns a specific webhook
+// @Summary Get a webhook
+// @Tags Servers
+// @Produce json
+// @Param server path string true "Server identifier"
+// @Param webhook path int true "Webhook ID"
+// @Success 200 {object} router.WebhookResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/servers/{server}/webhooks/{webhook} [get]
+func getServerWebhook(c *gin.Context) {
+	s := middleware.ExtractServer(c)
+
+	w, ok := getWebhook(c, s)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, WebhookResponse{Data: *w})
+}
+
+// postServerWebhook creates a new webhook
+// @Summary Create a webhook
+// @Description Creates a webhook that is notified of lifecycle events for the server. Events may be any of server.status, server.crashed, server.installed, backup.completed, backup.failed, transfer.status and proxy.certificate_failed, every event is delivered when none are provided. When a secret is set each delivery is signed with HMAC-SHA256 in the X-Propel-Signature header.
+// @Tags Servers
+// @Accept json
+// @Produce json
+// @Param server path string true "Server identifier"
+// @Param webhook body router.WebhookRequest true "Webhook configuration"
+// @Success 201 {object} router.WebhookResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/servers/{server}/webhooks [post]
+func postServerWebhook(c *gin.Context) {
+	s := middleware.ExtractServer(c)
+
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var w models.Webhook
+	req.apply(&w)
+	if err := server.ValidateWebhook(&w); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := s.SaveWebhook(&w); err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, WebhookResponse{Data: w})
+}
+
+// putServerWebhook updates an existing webhook
+// @Summary Update a webhook
+// @Description Updates a webhook. The existing secret is kept when no secret is provided, pass an empty string to remove it.
+// @Tags Servers
+// @Accept json
+// @Produce json
+// @Param server path string true "Server identifier"
+// @Param webhook path int true "Webhook ID"
+// @Param body body router.WebhookRequest true "Webhook configuration"
+// @Success 200 {object} router.WebhookResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/servers/{server}/webhooks/{webhook} [put]
+func putServerWebhook(c *gin.Context) {
+	s := middleware.ExtractServer(c)
+
+	w, ok := getWebhook(c, s)
+	if !ok {
+		return
+	}
+
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	req.apply(w)
+	if err := server.ValidateWebhook(w); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := s.SaveWebhook(w); err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, WebhookResponse{Data: *w})
+}
+
+// deleteServerWebhook deletes a webhook
+// @Summary Delete a webhook
+// @Tags Servers
+// @Produce json
+// @Param server path string true "Server identifier"
+// @Param webhook path int true "Webhook ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/servers/{server}/webhooks/{webhook} [delete]
+func deleteServerWebhook(c *gin.Context) {
+	s := middleware.ExtractServer(c)
+
+	w, ok := getWebhook(c, s)
+	if !ok {
+		return
+	}
+
+	if err := s.DeleteWebhook(w.ID); err != nil {
+		if errors.Is(err, server.ErrWebhookNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "webhook not found"})
+			return
+		}
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// getServerWebhookDeliveries returns the webhook delivery log for a server
+// @Summary List webhook deliveries for a server
+// @Description Returns the most recent webhook deliveries for the server, newest first, including those queued for node level webhooks.
+// @Tags Servers
+// @Produce json
+// @Param server path string true "Server identifier"
+// @Param webhook query int false "Only include deliveries for this webhook"
+// @Param limit query int false "Number of deliveries" minimum(1) maximum(500)
+// @Success 200 {object} router.WebhookDeliveriesListResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/servers/{server}/webhooks/deliveries [get]
+func getServerWebhookDeliveries(c *gin.Context) {
+	s := middleware.ExtractServer(c)
+
+	var webhook uint64
+	if v := c.Query("webhook"); v != "" {
+		var err error
+		if webhook, err = strconv.ParseUint(v, 10, 32); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid webhook ID"})
+			return
+		}
+	}
+
+	deliveries, err := s.WebhookDeliveries(uint(webhook), deliveriesLimit(c))
+	if err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, WebhookDeliveriesListResponse{Data: deliveries})
+}
+
+// getWebhookDeliveries returns the webhook delivery log for the node
+// @Summary List webhook deliveries for the node
+// @Description Returns the most recent webhook deliveries for every server on the node, newest first.
+// @Tags System
+// @Produce json
+// @Param status query string false "Only include deliveries with this status" Enums(pending, delivered, failed)
+// @Param limit query int false "Number of deliveries" minimum(1) maximum(500)
+// @Success 200 {object} router.WebhookDeliveriesListResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/webhooks/deliveries [get]
+func getWebhookDeliveries(c *gin.Context) {
+	status := models.WebhookDeliveryStatus(c.Query("status"))
+	switch status {
+	case "", models.WebhookDeliveryPending, models.WebhookDeliveryDelivered, models.WebhookDeliveryFailed:
+	default:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid delivery status"})
+		return
+	}
+
+	deliveries, err := server.WebhookDeliveries(status, deliveriesLimit(c))
+	if err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, WebhookDeliveriesListResponse{Data: deliveries})
+}
@@ -12,6 +12,7 @@ import (
 	ws "github.com/gorilla/websocket"
 	"golang.org/x/time/rate"
 
+	"github.com/priyxstudio/propel/internal/audit"
 	"github.com/priyxstudio/propel/router/middleware"
 	"github.com/priyxstudio/propel/router/websocket"
 	"github.com/priyxstudio/propel/server"
@@ -73,6 +74,14 @@ func getServerWebsocket(c *gin.Context) {
 	}
 	defer handler.Connection.Close()
 
+	// The connection is authenticated by a message sent over the socket, so the user
+	// is only known once the connection has been closed.
+	defer func() {
+		if j := handler.GetJwt(); j != nil {
+			middleware.SetAuditActor(c, audit.ActorUser, j.UserUUID)
+		}
+	}()
+
 	// Track this open connection on the server so that we can close them all programmatically
 	// if the server is deleted.
 	s.Websockets().Push(handler.Uuid(), &cancel)
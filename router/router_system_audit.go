@@ -0,0 +1,86 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/priyxstudio/propel/internal/audit"
+	"github.com/priyxstudio/propel/router/middleware"
+)
+
+// AuditLogResponse represents a page of audit log entries
+type AuditLogResponse struct {
+	Data []audit.Entry `json:"data"`
+}
+
+// getSystemAuditLog searches the audit log for the node.
+// @Summary Search the audit log
+// @Description Returns the entries in the audit log that match the filters provided, newest first. The log records every API request made to the node and every command executed on the host.
+// @Tags System
+// @Produce json
+// @Param since query string false "Only include entries at or after this RFC3339 timestamp"
+// @Param until query string false "Only include entries at or before this RFC3339 timestamp"
+// @Param type query string false "Entry type" Enums(request, command)
+// @Param server query string false "Only include entries for this server"
+// @Param actor query string false "Only include entries for this actor"
+// @Param outcome query string false "Entry outcome" Enums(success, failure, denied)
+// @Param limit query int false "Number of entries" minimum(1) maximum(1000)
+// @Success 200 {object} router.AuditLogResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security NodeToken
+// @Router /api/system/audit [get]
+func getSystemAuditLog(c *gin.Context) {
+	q := audit.Query{
+		Type:    audit.EntryType(c.Query("type")),
+		Server:  c.Query("server"),
+		Actor:   c.Query("actor"),
+		Outcome: audit.Outcome(c.Query("outcome")),
+	}
+
+	switch q.Type {
+	case "", audit.TypeRequest, audit.TypeCommand:
+	default:
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "invalid entry type"})
+		return
+	}
+	switch q.Outcome {
+	case "", audit.OutcomeSuccess, audit.OutcomeFailure, audit.OutcomeDenied:
+	default:
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "invalid outcome"})
+		return
+	}
+
+	q.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if q.Limit <= 0 {
+		q.Limit = 100
+	} else if q.Limit > 1000 {
+		q.Limit = 1000
+	}
+
+	for key, dst := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		v := c.Query(key)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "The \"" + key + "\" parameter must be a valid RFC3339 timestamp.",
+			})
+			return
+		}
+		*dst = t
+	}
+
+	entries, err := audit.Search(q)
+	if err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, AuditLogResponse{Data: entries})
+}
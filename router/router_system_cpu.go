@@ -0,0 +1,48 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/apex/log"
+	"github.com/gin-gonic/gin"
+
+	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/server"
+	"github.com/priyxstudio/propel/system"
+)
+
+// CpuPlacementResponse describes the CPU topology of the node and the threads
+// assigned to each server.
+type CpuPlacementResponse struct {
+	Mode       string                         `json:"mode"`
+	Reserved   string                         `json:"reserved"`
+	Topology   *system.CPUTopology            `json:"topology,omitempty"`
+	Placements map[string]server.CpuPlacement `json:"placements"`
+}
+
+// getSystemCpuPlacement returns the CPU topology and current thread placement.
+// @Summary Get CPU topology and placement
+// @Description Returns the CPU and NUMA topology of the node along with the placement mode, the topology is omitted if it cannot be read. When automatic placement is enabled the threads assigned to each server are included, keyed by server UUID.
+// @Tags System
+// @Produce json
+// @Success 200 {object} router.CpuPlacementResponse
+// @Security NodeToken
+// @Router /api/system/cpu [get]
+func getSystemCpuPlacement(c *gin.Context) {
+	// The topology is omitted rather than failing the request when it cannot be
+	// read, such as when running inside a container.
+	var topology *system.CPUTopology
+	if t, err := system.GetCPUTopology(); err != nil {
+		log.WithField("error", err).Warn("failed to read CPU topology")
+	} else {
+		topology = &t
+	}
+
+	cfg := config.Get().Docker.CpuPlacement
+	c.JSON(http.StatusOK, CpuPlacementResponse{
+		Mode:       cfg.Mode,
+		Reserved:   cfg.Reserved,
+		Topology:   topology,
+		Placements: server.CpuPlacements(),
+	})
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/internal/audit"
 	"github.com/priyxstudio/propel/router/middleware"
 )
 
@@ -157,6 +158,25 @@ func sanitizeWorkingDirectory(path string, systemCfg config.SystemConfiguration)
 	return cleaned, nil
 }
 
+// auditHostCommand records a command executed on the host in the audit log. This
+// is separate to the entry for the request itself so that commands can be found
+// without searching through every request made to the node.
+func auditHostCommand(c *gin.Context, command string, outcome audit.Outcome, exitCode *int, duration time.Duration) {
+	audit.Log(audit.Entry{
+		Time:      time.Now().Add(-duration),
+		Type:      audit.TypeCommand,
+		RequestID: c.GetString("request_id"),
+		Route:     c.FullPath(),
+		Actor:     c.GetString("audit_actor"),
+		ActorType: c.GetString("audit_actor_type"),
+		IP:        c.ClientIP(),
+		Outcome:   outcome,
+		Duration:  duration.Milliseconds(),
+		Command:   command,
+		ExitCode:  exitCode,
+	})
+}
+
 // postSystemHostCommand executes a command on the host system synchronously and returns the output.
 // @Summary Execute host command
 // @Description Runs a command on the host operating system using the configured shell and returns stdout/stderr.
@@ -191,6 +211,7 @@ func postSystemHostCommand(c *gin.Context) {
 	}
 
 	if isCommandDisabled(req.Command, cfg.System.HostTerminal.DisabledCommands) {
+		auditHostCommand(c, req.Command, audit.OutcomeDenied, nil, 0)
 		c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{Error: "command execution is disabled"})
 		return
 	}
@@ -252,6 +273,7 @@ func postSystemHostCommand(c *gin.Context) {
 		response.TimedOut = true
 		response.ExitCode = -1
 		logger.WithField("duration", duration.String()).Warn("host command timed out")
+		auditHostCommand(c, req.Command, audit.OutcomeFailure, &response.ExitCode, duration)
 		c.AbortWithStatusJSON(http.StatusGatewayTimeout, response)
 		return
 	}
@@ -268,6 +290,12 @@ func postSystemHostCommand(c *gin.Context) {
 		logger.WithField("duration", duration.String()).Info("host command executed successfully")
 	}
 
+	outcome := audit.OutcomeSuccess
+	if response.ExitCode != 0 {
+		outcome = audit.OutcomeFailure
+	}
+	auditHostCommand(c, req.Command, outcome, &response.ExitCode, duration)
+
 	c.JSON(http.StatusOK, response)
 }
 
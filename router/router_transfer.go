@@ -13,6 +13,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/apex/log"
 	"github.com/gin-gonic/gin"
@@ -20,10 +21,13 @@ import (
 
 	"github.com/priyxstudio/propel/config"
 	"github.com/priyxstudio/propel/firewall"
+	"github.com/priyxstudio/propel/internal/audit"
+	"github.com/priyxstudio/propel/internal/metrics"
 	"github.com/priyxstudio/propel/router/middleware"
 	"github.com/priyxstudio/propel/router/tokens"
 	"github.com/priyxstudio/propel/server"
 	"github.com/priyxstudio/propel/server/installer"
+	"github.com/priyxstudio/propel/server/transcript"
 	"github.com/priyxstudio/propel/server/transfer"
 )
 
@@ -44,27 +48,11 @@ func postTransfers(c *gin.Context) {
 	cfg := config.Get()
 	enforceChecksums := cfg.System.Transfers.PerformChecksumChecks
 
-	auth := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
-	if len(auth) != 2 || auth[0] != "Bearer" {
-		c.Header("WWW-Authenticate", "Bearer")
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-			"error": "The required authorization heads were not present in the request.",
-		})
-		return
-	}
-
-	token := tokens.TransferPayload{}
-	if err := tokens.ParseToken([]byte(auth[1]), &token); err != nil {
-		middleware.CaptureAndAbort(c, err)
+	u, ok := parseTransferToken(c)
+	if !ok {
 		return
 	}
-
 	manager := middleware.ExtractManager(c)
-	u, err := uuid.Parse(token.Subject)
-	if err != nil {
-		middleware.CaptureAndAbort(c, err)
-		return
-	}
 
 	// Get or create a new transfer instance for this server.
 	var (
@@ -104,6 +92,11 @@ func postTransfers(c *gin.Context) {
 		// We add the transfer to the list of transfers once we have a server instance to use.
 		trnsfr.Server = i.Server()
 		transfer.Incoming().Add(trnsfr)
+	} else if trnsfr.State != nil {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "A resumable transfer is already in progress for this server.",
+		})
+		return
 	} else {
 		ctx, cancel = context.WithCancel(trnsfr.Context())
 		defer cancel()
@@ -113,42 +106,10 @@ func postTransfers(c *gin.Context) {
 	// the transfer.
 
 	successful := false
-	defer func(ctx context.Context, trnsfr *transfer.Transfer) {
-		// Remove the transfer from the list of incoming transfers.
-		transfer.Incoming().Remove(trnsfr)
-
-		if !successful {
-			trnsfr.Server.Events().Publish(server.TransferStatusEvent, "failure")
-			// Clean up firewall rules if transfer failed
-			firewallMgr := firewall.NewManager()
-			if err := firewallMgr.DeleteAllRulesForServer(trnsfr.Server.ID()); err != nil {
-				trnsfr.Log().WithError(err).Warn("failed to delete firewall rules for failed transfer")
-			}
-			manager.Remove(func(match *server.Server) bool {
-				return match.ID() == trnsfr.Server.ID()
-			})
-		}
-
-		if err := manager.Client().SetTransferStatus(context.Background(), trnsfr.Server.ID(), successful); err != nil {
-			// Only delete the files if the transfer actually failed, otherwise we could have
-			// unrecoverable data-loss.
-			if !successful && err != nil {
-				// Delete all extracted files.
-				go func(trnsfr *transfer.Transfer) {
-					_ = trnsfr.Server.Filesystem().UnixFS().Close()
-					if err := os.RemoveAll(trnsfr.Server.Filesystem().Path()); err != nil && !os.IsNotExist(err) {
-						trnsfr.Log().WithError(err).Warn("failed to delete local server files")
-					}
-				}(trnsfr)
-			}
-
-			trnsfr.Log().WithField("status", successful).WithError(err).Error("failed to set transfer status on panel")
-			return
-		}
-
-		trnsfr.Server.SetTransferring(false)
-		trnsfr.Server.Events().Publish(server.TransferStatusEvent, "success")
-	}(ctx, trnsfr)
+	start := time.Now()
+	defer func() {
+		finishIncomingTransfer(manager, trnsfr, successful, start)
+	}()
 
 	mediaType, params, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
 	if err != nil {
@@ -277,6 +238,15 @@ out:
 
 				trnsfr.Log().WithField("path", installLogPath).Debug("install logs saved successfully")
 
+			case strings.HasPrefix(name, "console_transcript_"):
+				file := strings.TrimPrefix(name, "console_transcript_")
+				trnsfr.Log().WithField("file", file).Debug("received console transcript")
+
+				// Don't fail transfer for console transcripts, just log and continue
+				if err := transcript.Import(trnsfr.Server.ID(), file, p); err != nil {
+					trnsfr.Log().WithField("file", file).WithError(err).Warn("failed to save console transcript, skipping")
+				}
+
 			case strings.HasPrefix(name, "backup_"):
 				backupName := strings.TrimPrefix(name, "backup_")
 				trnsfr.Log().WithField("backup", backupName).Debug("received backup file")
@@ -422,6 +392,99 @@ out:
 	c.Status(http.StatusAccepted)
 }
 
+// parseTransferToken validates the transfer token sent by the source node,
+// returning the UUID of the server being transferred.
+func parseTransferToken(c *gin.Context) (uuid.UUID, bool) {
+	auth := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
+	if len(auth) != 2 || auth[0] != "Bearer" {
+		c.Header("WWW-Authenticate", "Bearer")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "The required authorization heads were not present in the request.",
+		})
+		return uuid.UUID{}, false
+	}
+
+	token := tokens.TransferPayload{}
+	if err := tokens.ParseToken([]byte(auth[1]), &token); err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return uuid.UUID{}, false
+	}
+	middleware.SetAuditActor(c, audit.ActorTransfer, token.Issuer)
+	middleware.SetAuditServer(c, token.Subject)
+
+	u, err := uuid.Parse(token.Subject)
+	if err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return uuid.UUID{}, false
+	}
+	return u, true
+}
+
+// finishIncomingTransfer handles the result of an incoming transfer, notifying
+// the Panel and removing the server from this node if the transfer failed.
+func finishIncomingTransfer(manager *server.Manager, trnsfr *transfer.Transfer, successful bool, start time.Time) {
+	if !trnsfr.MarkFinished() {
+		return
+	}
+
+	// Remove the transfer from the list of incoming transfers.
+	transfer.Incoming().Remove(trnsfr)
+	if trnsfr.State != nil {
+		if err := trnsfr.State.Remove(); err != nil {
+			trnsfr.Log().WithError(err).Warn("failed to remove received transfer data")
+		}
+	}
+
+	status := "failed"
+	if successful {
+		status = "successful"
+	}
+	metrics.TransferDuration.Observe(time.Since(start).Seconds(), "incoming", status)
+
+	if !successful {
+		trnsfr.Server.Events().Publish(server.TransferStatusEvent, "failure")
+		// Clean up firewall rules if transfer failed
+		firewallMgr := firewall.NewManager()
+		if err := firewallMgr.DeleteAllRulesForServer(trnsfr.Server.ID()); err != nil {
+			trnsfr.Log().WithError(err).Warn("failed to delete firewall rules for failed transfer")
+		}
+		manager.Remove(func(match *server.Server) bool {
+			return match.ID() == trnsfr.Server.ID()
+		})
+	}
+
+	if err := manager.Client().SetTransferStatus(context.Background(), trnsfr.Server.ID(), successful); err != nil {
+		// Only delete the files if the transfer actually failed, otherwise we could have
+		// unrecoverable data-loss.
+		if !successful && err != nil {
+			// Delete all extracted files.
+			go func(trnsfr *transfer.Transfer) {
+				_ = trnsfr.Server.Filesystem().UnixFS().Close()
+				if err := os.RemoveAll(trnsfr.Server.Filesystem().Path()); err != nil && !os.IsNotExist(err) {
+					trnsfr.Log().WithError(err).Warn("failed to delete local server files")
+				}
+			}(trnsfr)
+		}
+
+		trnsfr.Log().WithField("status", successful).WithError(err).Error("failed to set transfer status on panel")
+		return
+	}
+
+	trnsfr.Server.SetTransferring(false)
+	trnsfr.Server.Events().Publish(server.TransferStatusEvent, "success")
+}
+
+// getTransferQueue returns the queue of outgoing transfers on this node.
+// @Summary Get outgoing transfer queue
+// @Tags Transfers
+// @Produce json
+// @Success 200 {object} transfer.QueueStatus
+// @Security NodeToken
+// @Router /api/transfers/queue [get]
+func getTransferQueue(c *gin.Context) {
+	c.JSON(http.StatusOK, transfer.Outgoing().Queue())
+}
+
 // deleteTransfer cancels an incoming transfer for a server.
 // @Summary Cancel incoming transfer
 // @Tags Transfers
@@ -450,6 +513,12 @@ func deleteTransfer(c *gin.Context) {
 
 	trnsfr.Cancel()
 
+	// Resumable transfers are not tied to a single request which would clean up
+	// after the transfer when it is cancelled, so this is done here instead.
+	if trnsfr.State != nil {
+		finishIncomingTransfer(middleware.ExtractManager(c), trnsfr, false, trnsfr.State.CreatedAt)
+	}
+
 	c.Status(http.StatusAccepted)
 }
 
@@ -0,0 +1,297 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/router/middleware"
+	"github.com/priyxstudio/propel/server"
+	"github.com/priyxstudio/propel/server/transfer"
+)
+
+// The interval at which transfers that were not resumed within the resume window
+// are removed.
+const transferExpiryInterval = time.Minute * 10
+
+// ExpireTransfers periodically fails the resumable transfers being received
+// that the source node has not resumed within the resume window, and removes
+// the archives staged for outgoing transfers that were not completed within it.
+// This runs until the context is canceled.
+func ExpireTransfers(ctx context.Context, manager *server.Manager) {
+	ticker := time.NewTicker(transferExpiryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, trnsfr := range transfer.ExpiredIncoming() {
+			trnsfr.Log().Warn("resumable transfer was not resumed within the resume window, removing it")
+			trnsfr.Cancel()
+			finishIncomingTransfer(manager, trnsfr, false, trnsfr.State.CreatedAt)
+		}
+		transfer.RemoveExpiredStaged()
+	}
+}
+
+// resumableTransfer returns the resumable transfer being received for the
+// server, aborting the request if there is none.
+func resumableTransfer(c *gin.Context, id string) *transfer.Transfer {
+	trnsfr := transfer.Incoming().Get(id)
+	if trnsfr == nil || trnsfr.State == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "There is no resumable transfer in progress for this server.",
+		})
+		return nil
+	}
+	return trnsfr
+}
+
+// getTransferSession returns the offsets received so far for a resumable
+// transfer, which the source node resumes the transfer from. This is also used
+// by the source node to check that resumable transfers are supported.
+// @Summary Get resumable transfer offsets
+// @Tags Transfers
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {object} transfer.Offsets
+// @Failure 401 {object} ErrorResponse
+// @Security ServerJWT
+// @Router /api/transfers/session [get]
+func getTransferSession(c *gin.Context) {
+	u, ok := parseTransferToken(c)
+	if !ok {
+		return
+	}
+	trnsfr := transfer.Incoming().Get(u.String())
+	if trnsfr == nil || trnsfr.State == nil {
+		c.JSON(http.StatusOK, transfer.Offsets{Files: map[string]int64{}})
+		return
+	}
+	c.JSON(http.StatusOK, trnsfr.State.Offsets())
+}
+
+// postTransferSession starts or resumes a resumable transfer using the manifest
+// of files sent by the source node.
+// @Summary Start resumable transfer
+// @Tags Transfers
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param manifest body transfer.Manifest true "Files being transferred"
+// @Success 200 {object} transfer.Offsets
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Security ServerJWT
+// @Router /api/transfers/session [post]
+func postTransferSession(c *gin.Context) {
+	u, ok := parseTransferToken(c)
+	if !ok {
+		return
+	}
+	var manifest transfer.Manifest
+	if err := c.BindJSON(&manifest); err != nil {
+		return
+	}
+
+	trnsfr := transfer.Incoming().Get(u.String())
+	if trnsfr == nil {
+		var err error
+		trnsfr, err = transfer.NewIncoming(c.Request.Context(), middleware.ExtractManager(c), u.String())
+		if err != nil {
+			middleware.CaptureAndAbort(c, err)
+			return
+		}
+	} else if trnsfr.State == nil {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "A transfer is already in progress for this server.",
+		})
+		return
+	}
+
+	if err := trnsfr.State.Reconcile(manifest); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	offsets := trnsfr.State.Offsets()
+	trnsfr.Log().WithField("files", len(manifest.Files)).Info("received manifest for resumable transfer")
+	c.JSON(http.StatusOK, offsets)
+}
+
+// putTransferChunk receives a chunk of a file during a resumable transfer. If
+// the chunk does not start at the offset received so far a conflict is returned
+// with the offset the source node should continue from.
+// @Summary Receive resumable transfer chunk
+// @Tags Transfers
+// @Accept application/octet-stream
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param file query string true "Name of the file in the manifest"
+// @Param offset query int true "Offset of the chunk in the file"
+// @Success 200 {object} transfer.ChunkResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} transfer.ChunkResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Security ServerJWT
+// @Router /api/transfers/chunks [put]
+func putTransferChunk(c *gin.Context) {
+	u, ok := parseTransferToken(c)
+	if !ok {
+		return
+	}
+	trnsfr := resumableTransfer(c, u.String())
+	if trnsfr == nil {
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.Query("offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "A valid offset must be provided."})
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, transfer.MaxChunkSize+1))
+	if err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+	if len(data) > transfer.MaxChunkSize {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "The chunk is larger than the maximum chunk size."})
+		return
+	}
+
+	received, err := trnsfr.State.WriteChunk(c.Query("file"), offset, data, c.GetHeader(transfer.ChunkChecksumHeader))
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, transfer.ChunkResponse{Offset: received})
+	case errors.Is(err, transfer.ErrChunkOffset):
+		c.JSON(http.StatusConflict, transfer.ChunkResponse{Offset: received, Error: err.Error()})
+	case errors.Is(err, transfer.ErrChunkChecksum):
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, transfer.ErrUnknownFile):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		middleware.CaptureAndAbort(c, err)
+	}
+}
+
+// postTransferPreSync imports the files received while the server was still
+// running on the source node during a live transfer. Once imported, the rest of
+// the transfer only contains the files changed since then. Repeating this after
+// the files have been imported has no effect.
+// @Summary Import live transfer pre-sync
+// @Tags Transfers
+// @Param Authorization header string true "Bearer token"
+// @Success 204 {string} string "No Content"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ServerJWT
+// @Router /api/transfers/presync [post]
+func postTransferPreSync(c *gin.Context) {
+	u, ok := parseTransferToken(c)
+	if !ok {
+		return
+	}
+	trnsfr := resumableTransfer(c, u.String())
+	if trnsfr == nil {
+		return
+	}
+	manager := middleware.ExtractManager(c)
+
+	if err := trnsfr.State.Verify(config.Get().System.Transfers.PerformChecksumChecks); err != nil {
+		if !errors.Is(err, transfer.ErrIncomplete) {
+			trnsfr.Log().WithError(err).Error("live transfer pre-sync failed verification")
+			finishIncomingTransfer(manager, trnsfr, false, trnsfr.State.CreatedAt)
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithCancel(trnsfr.Context())
+	defer cancel()
+	if err := trnsfr.ImportStaged(ctx); err != nil {
+		finishIncomingTransfer(manager, trnsfr, false, trnsfr.State.CreatedAt)
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+	if err := trnsfr.State.CompletePreSync(); err != nil {
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+	trnsfr.Log().Info("imported live transfer pre-sync")
+	c.Status(http.StatusNoContent)
+}
+
+// postTransferComplete finishes a resumable transfer once every file has been
+// received, importing the server on this node.
+// @Summary Complete resumable transfer
+// @Tags Transfers
+// @Param Authorization header string true "Bearer token"
+// @Success 202 {string} string "Accepted"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security ServerJWT
+// @Router /api/transfers/complete [post]
+func postTransferComplete(c *gin.Context) {
+	u, ok := parseTransferToken(c)
+	if !ok {
+		return
+	}
+	trnsfr := resumableTransfer(c, u.String())
+	if trnsfr == nil {
+		return
+	}
+	manager := middleware.ExtractManager(c)
+
+	if err := trnsfr.State.Verify(config.Get().System.Transfers.PerformChecksumChecks); err != nil {
+		// A file that is missing data can still be resumed, but one that has been
+		// received in full with the wrong checksum cannot.
+		if !errors.Is(err, transfer.ErrIncomplete) {
+			trnsfr.Log().WithError(err).Error("resumable transfer failed verification")
+			finishIncomingTransfer(manager, trnsfr, false, trnsfr.State.CreatedAt)
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithCancel(trnsfr.Context())
+	defer cancel()
+	if err := trnsfr.ImportStaged(ctx); err != nil {
+		finishIncomingTransfer(manager, trnsfr, false, trnsfr.State.CreatedAt)
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	// Ensure the server environment gets configured.
+	if err := trnsfr.Server.CreateEnvironment(); err != nil {
+		finishIncomingTransfer(manager, trnsfr, false, trnsfr.State.CreatedAt)
+		middleware.CaptureAndAbort(c, err)
+		return
+	}
+
+	finishIncomingTransfer(manager, trnsfr, true, trnsfr.State.CreatedAt)
+	trnsfr.Log().Debug("done!")
+
+	// Start the server again if it was running when a live transfer began.
+	if trnsfr.State.Manifest.Start && !trnsfr.Server.IsTransferring() {
+		go func(s *server.Server) {
+			if err := s.HandlePowerAction(server.PowerActionStart, 30); err != nil {
+				s.Log().WithError(err).Error("failed to start server after live transfer")
+			}
+		}(trnsfr.Server)
+	}
+	c.Status(http.StatusAccepted)
+}
@@ -76,6 +76,7 @@ var e = []string{
 	server.BackupRestoreCompletedEvent,
 	server.TransferLogsEvent,
 	server.TransferStatusEvent,
+	server.CertificateRenewalFailedEvent,
 }
 
 // ListenForServerEvents will listen for different events happening on a server
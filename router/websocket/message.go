@@ -11,6 +11,8 @@ const (
 	SendServerLogsEvent        = "send logs"
 	SendCommandEvent           = "send command"
 	SendStatsEvent             = "send stats"
+	GracefulPowerEvent         = "graceful power"
+	CancelGracefulPowerEvent   = "cancel graceful power"
 	ErrorEvent                 = "daemon error"
 	JwtErrorEvent              = "jwt error"
 	ThrottledEvent             = Event("throttled")
@@ -20,7 +22,7 @@ type Message struct {
 	// The event to perform.
 	Event Event `json:"event"`
 
-	// The data to pass along, only used by power/command currently. Other requests
+	// The data to pass along, only used by power/command/logs currently. Other requests
 	// should either omit the field or pass an empty value as it is ignored.
 	Args []string `json:"args,omitempty"`
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -395,6 +396,56 @@ func (h *Handler) HandleInbound(ctx context.Context, m Message) error {
 
 			return err
 		}
+	case GracefulPowerEvent:
+		{
+			action := server.PowerAction(strings.Join(m.Args, ""))
+
+			var opts server.GracefulStopOptions
+			permission := PermissionSendPowerStop
+			switch action {
+			case server.PowerActionStop:
+			case server.PowerActionRestart:
+				opts.Restart = true
+				permission = PermissionSendPowerRestart
+			default:
+				return nil
+			}
+
+			if !h.GetJwt().HasPermission(permission) {
+				return nil
+			}
+
+			if h.server.IsGracefullyStopping() {
+				m, _ := h.GetErrorMessage("a graceful stop is already in progress for this server")
+				_ = h.SendJson(Message{
+					Event: ErrorEvent,
+					Args:  []string{m},
+				})
+				return nil
+			}
+
+			h.server.SaveActivity(h.ra, models.Event(server.ActivityPowerPrefix+"graceful-"+action), nil)
+
+			// The countdown blocks until it has completed, so run it in the background
+			// to avoid holding up any other messages from the client.
+			go func(s *server.Server) {
+				if err := s.GracefulStop(opts); err != nil && !errors.Is(err, server.ErrGracefulStopPending) {
+					s.Log().WithField("error", err).Error("encountered error processing a graceful power action")
+				}
+			}(h.server)
+
+			return nil
+		}
+	case CancelGracefulPowerEvent:
+		{
+			if !h.GetJwt().HasPermission(PermissionSendPowerStop) && !h.GetJwt().HasPermission(PermissionSendPowerRestart) {
+				return nil
+			}
+
+			h.server.CancelGracefulStop()
+
+			return nil
+		}
 	case SendServerLogsEvent:
 		{
 			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
@@ -403,7 +454,16 @@ func (h *Handler) HandleInbound(ctx context.Context, m Message) error {
 				return nil
 			}
 
-			logs, err := h.server.Environment.Readlog(config.Get().System.WebsocketLogCount)
+			// Clients may optionally request a specific number of lines, which is capped
+			// by the configured maximum for the node.
+			count := config.Get().System.WebsocketLogCount
+			if len(m.Args) > 0 {
+				if n, err := strconv.Atoi(m.Args[0]); err == nil && n > 0 {
+					count = min(n, config.Get().System.WebsocketLogMaxCount)
+				}
+			}
+
+			logs, err := h.server.Environment.Readlog(count)
 			if err != nil {
 				return err
 			}
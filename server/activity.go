@@ -21,6 +21,8 @@ const (
 	ActivitySftpDelete          = models.Event("server:sftp.delete")
 	ActivityFileUploaded        = models.Event("server:file.uploaded")
 	ActivityServerCrashed       = models.Event("server:crashed")
+	ActivityServerUnhealthy     = models.Event("server:unhealthy")
+	ActivityConsoleTrigger      = models.Event("server:console.trigger")
 )
 
 // RequestActivity is a wrapper around a LoggedEvent that is able to track additional request
@@ -0,0 +1,271 @@
+package server
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/shirou/gopsutil/v3/mem"
+
+	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/environment"
+)
+
+var (
+	// ErrInsufficientMemory is returned when a server cannot be started because
+	// the node does not have enough uncommitted memory for it.
+	ErrInsufficientMemory = errors.Sentinel("server: not enough memory available on the node to start the server")
+
+	// ErrStartQueueTimeout is returned when a server waited in the start queue for
+	// longer than the configured timeout.
+	ErrStartQueueTimeout = errors.Sentinel("server: timed out waiting in the start queue for memory to become available")
+
+	// ErrStartQueueCancelled is returned when a server waiting in the start queue
+	// is stopped before it could be started.
+	ErrStartQueueCancelled = errors.Sentinel("server: start was cancelled while waiting in the start queue")
+)
+
+// The status values emitted with a StartQueueEvent.
+const (
+	StartQueueQueued    = "queued"
+	StartQueueAdmitted  = "admitted"
+	StartQueueRejected  = "rejected"
+	StartQueueCancelled = "cancelled"
+	StartQueueTimeout   = "timeout"
+)
+
+// admissionPollInterval is how often a queued start checks the memory on the
+// node again, since the memory used by servers without a limit changes without
+// any event being emitted.
+const admissionPollInterval = time.Second * 5
+
+// StartQueuePayload is emitted with a StartQueueEvent to keep websocket clients
+// informed about the position of a server waiting to start.
+type StartQueuePayload struct {
+	Status         string `json:"status"`
+	Position       int    `json:"position"`
+	RequiredBytes  int64  `json:"required_bytes"`
+	AvailableBytes int64  `json:"available_bytes"`
+}
+
+// admissionTicket is a server waiting in the start queue.
+type admissionTicket struct {
+	id     string
+	cancel context.CancelFunc
+}
+
+// startAdmission decides whether a server may start based on the memory that
+// is committed to the servers already running on the node. Starts that do not
+// fit either wait in a queue, in the order they were requested, or are rejected
+// depending on the configuration.
+type startAdmission struct {
+	mu      sync.Mutex
+	servers func() []*Server
+	queue   []*admissionTicket
+
+	// The memory reserved for servers that have been admitted but have not yet
+	// changed state, these are not otherwise counted as committed.
+	reserved map[string]int64
+
+	// Closed and replaced whenever the committed memory or queue changes, waking
+	// every queued start so that it can check again.
+	wake chan struct{}
+
+	// The total memory of the host in bytes, replaced in tests.
+	hostMemory func() (uint64, error)
+}
+
+var admission = &startAdmission{
+	reserved: make(map[string]int64),
+	wake:     make(chan struct{}),
+	hostMemory: func() (uint64, error) {
+		v, err := mem.VirtualMemory()
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+		return v.Total, nil
+	},
+}
+
+// setServers sets the function used to list every server on the node.
+func (a *startAdmission) setServers(fn func() []*Server) {
+	a.mu.Lock()
+	a.servers = fn
+	a.mu.Unlock()
+}
+
+// broadcastLocked wakes every queued start. This must be called while holding
+// the lock.
+func (a *startAdmission) broadcastLocked() {
+	close(a.wake)
+	a.wake = make(chan struct{})
+}
+
+// broadcast wakes every queued start so that it checks the memory again.
+func (a *startAdmission) broadcast() {
+	a.mu.Lock()
+	a.broadcastLocked()
+	a.mu.Unlock()
+}
+
+// availableLocked returns the memory in bytes that can still be committed to a
+// server. The committed memory is the bounded memory limit, which includes the
+// container overhead, of every server that is not offline. Servers without a
+// memory limit are counted using their current usage. This must be called while
+// holding the lock.
+func (a *startAdmission) availableLocked(id string) (int64, error) {
+	total, err := a.hostMemory()
+	if err != nil {
+		return 0, err
+	}
+	cfg := config.Get().System.StartAdmission
+	ratio := cfg.OvercommitRatio
+	if ratio <= 0 {
+		ratio = 1
+	}
+	available := int64(float64(total)*ratio) - cfg.Reserved*1024*1024
+
+	if a.servers != nil {
+		for _, s := range a.servers() {
+			if s.ID() == id || s.Environment == nil || s.Environment.State() == environment.ProcessOfflineState {
+				continue
+			}
+			if s.MemoryLimit() > 0 {
+				available -= s.Config().Build.BoundedMemoryLimit()
+			} else {
+				available -= int64(s.Proc().Memory)
+			}
+		}
+	}
+	for sid, v := range a.reserved {
+		if sid != id {
+			available -= v
+		}
+	}
+	return available, nil
+}
+
+// positionLocked returns the position of a ticket in the queue starting at 1, or
+// 0 if it is not queued. This must be called while holding the lock.
+func (a *startAdmission) positionLocked(t *admissionTicket) int {
+	return slices.Index(a.queue, t) + 1
+}
+
+// removeLocked removes a ticket from the queue. This must be called while
+// holding the lock.
+func (a *startAdmission) removeLocked(t *admissionTicket) {
+	if i := slices.Index(a.queue, t); i >= 0 {
+		a.queue = slices.Delete(a.queue, i, i+1)
+		a.broadcastLocked()
+	}
+}
+
+// admit blocks until the server may start, reserving the memory for it. Once
+// the server has been started release must be called, at which point the memory
+// is counted using the server state instead.
+func (a *startAdmission) admit(ctx context.Context, s *Server) error {
+	cfg := config.Get().System.StartAdmission
+	if !cfg.Enabled || s.MemoryLimit() <= 0 {
+		return nil
+	}
+	required := s.Config().Build.BoundedMemoryLimit()
+
+	timeout := time.Duration(cfg.QueueTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = time.Minute * 10
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	t := &admissionTicket{id: s.ID(), cancel: cancel}
+
+	var last int
+	a.mu.Lock()
+	for {
+		available, err := a.availableLocked(t.id)
+		if err != nil {
+			a.removeLocked(t)
+			a.mu.Unlock()
+			return errors.WrapIf(err, "server: failed to determine available memory")
+		}
+
+		pos := a.positionLocked(t)
+		if required <= available && (pos == 1 || len(a.queue) == 0) {
+			a.removeLocked(t)
+			a.reserved[t.id] = required
+			a.mu.Unlock()
+			if last > 0 {
+				s.publishStartQueue(StartQueueAdmitted, 0, required, available)
+			}
+			return nil
+		}
+
+		if cfg.Mode == "reject" {
+			a.mu.Unlock()
+			s.publishStartQueue(StartQueueRejected, 0, required, available)
+			s.PublishConsoleOutputFromDaemon("Not enough memory is available on the node to start this server.")
+			return ErrInsufficientMemory
+		}
+
+		if pos == 0 {
+			a.queue = append(a.queue, t)
+			pos = len(a.queue)
+			s.Log().WithField("position", pos).Info("not enough memory available to start server, waiting in start queue")
+			s.PublishConsoleOutputFromDaemon("Not enough memory is available on the node, waiting in the start queue...")
+		}
+		wake := a.wake
+		a.mu.Unlock()
+
+		if pos != last {
+			s.publishStartQueue(StartQueueQueued, pos, required, available)
+			last = pos
+		}
+
+		select {
+		case <-ctx.Done():
+			a.mu.Lock()
+			a.removeLocked(t)
+			a.mu.Unlock()
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				s.publishStartQueue(StartQueueTimeout, 0, required, available)
+				return ErrStartQueueTimeout
+			}
+			s.publishStartQueue(StartQueueCancelled, 0, required, available)
+			return ErrStartQueueCancelled
+		case <-wake:
+		case <-time.After(admissionPollInterval):
+		}
+		a.mu.Lock()
+	}
+}
+
+// release removes the memory reserved for a server when it was admitted.
+func (a *startAdmission) release(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.reserved[id]; ok {
+		delete(a.reserved, id)
+		a.broadcastLocked()
+	}
+}
+
+// cancel removes a server from the start queue if it is waiting in it.
+func (a *startAdmission) cancel(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, t := range a.queue {
+		if t.id == id {
+			t.cancel()
+		}
+	}
+}
+
+func (s *Server) publishStartQueue(status string, position int, required int64, available int64) {
+	s.Events().Publish(StartQueueEvent, StartQueuePayload{
+		Status:         status,
+		Position:       position,
+		RequiredBytes:  required,
+		AvailableBytes: max(available, 0),
+	})
+}
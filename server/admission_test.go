@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/franela/goblin"
+
+	"github.com/priyxstudio/propel/config"
+)
+
+func TestStartAdmission(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	const gib = 1024 * 1024 * 1024
+	newAdmission := func() *startAdmission {
+		return &startAdmission{
+			reserved:   make(map[string]int64),
+			wake:       make(chan struct{}),
+			hostMemory: func() (uint64, error) { return 8 * gib, nil },
+		}
+	}
+	newServer := func(id string, memory int64) *Server {
+		s, err := New(nil)
+		g.Assert(err).IsNil()
+		s.cfg.Uuid = id
+		s.cfg.Build.MemoryLimit = memory
+		return s
+	}
+
+	g.Describe("startAdmission", func() {
+		g.BeforeEach(func() {
+			config.Set(&config.Configuration{
+				AuthenticationToken: "abc",
+				System: config.SystemConfiguration{
+					StartAdmission: config.StartAdmissionConfiguration{
+						Enabled:         true,
+						OvercommitRatio: 1.5,
+						Reserved:        1024,
+						Mode:            "reject",
+					},
+				},
+			})
+		})
+
+		g.It("applies the overcommit ratio and reserved memory", func() {
+			a := newAdmission()
+			a.reserved["other"] = 2 * gib
+			available, err := a.availableLocked("self")
+			g.Assert(err).IsNil()
+			g.Assert(available).Equal(int64(12*gib - 1*gib - 2*gib))
+
+			available, err = a.availableLocked("other")
+			g.Assert(err).IsNil()
+			g.Assert(available).Equal(int64(11 * gib))
+		})
+
+		g.It("reserves memory for a server that fits", func() {
+			a := newAdmission()
+			s := newServer("a", 2048)
+			g.Assert(a.admit(context.Background(), s)).IsNil()
+			g.Assert(a.reserved["a"]).Equal(s.Config().Build.BoundedMemoryLimit())
+
+			a.release("a")
+			g.Assert(len(a.reserved)).Equal(0)
+		})
+
+		g.It("admits servers without a memory limit", func() {
+			a := newAdmission()
+			a.reserved["other"] = 11 * gib
+			g.Assert(a.admit(context.Background(), newServer("a", 0))).IsNil()
+		})
+	})
+}
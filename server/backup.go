@@ -11,6 +11,7 @@ import (
 	"github.com/docker/docker/client"
 
 	"github.com/priyxstudio/propel/environment"
+	"github.com/priyxstudio/propel/internal/metrics"
 	"github.com/priyxstudio/propel/remote"
 	"github.com/priyxstudio/propel/server/backup"
 )
@@ -67,8 +68,10 @@ func (s *Server) Backup(b backup.BackupInterface) error {
 		}
 	}
 
+	start := time.Now()
 	ad, err := b.Generate(s.Context(), s.Filesystem(), ignored)
 	if err != nil {
+		metrics.BackupDuration.Observe(time.Since(start).Seconds(), "failed")
 		if err := s.notifyPanelOfBackup(b.Identifier(), &backup.ArchiveDetails{}, false); err != nil {
 			s.Log().WithFields(log.Fields{
 				"backup": b.Identifier(),
@@ -91,6 +94,7 @@ func (s *Server) Backup(b backup.BackupInterface) error {
 
 	// Try to notify the panel about the status of this backup. If for some reason this request
 	// fails, delete the archive from the daemon and return that error up the chain to the caller.
+	metrics.BackupDuration.Observe(time.Since(start).Seconds(), "successful")
 	if notifyError := s.notifyPanelOfBackup(b.Identifier(), ad, true); notifyError != nil {
 		_ = b.Remove()
 
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+
+	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/environment"
+)
+
+// bootQueuePollInterval is how often a server started by the boot queue is
+// checked to see if it has reached the running state.
+const bootQueuePollInterval = time.Second
+
+// BootQueueEntry is a server that was running before the daemon stopped and
+// should be started again, along with the last state that was recorded for it.
+type BootQueueEntry struct {
+	Server *Server
+	State  string
+}
+
+// sortBootQueue orders the entries by the boot priority of the server, highest
+// first. Servers with the same priority are ordered by their last known state,
+// so that servers that had fully started are restored before those that were
+// still starting.
+func sortBootQueue(entries []BootQueueEntry) {
+	rank := func(state string) int {
+		if state == environment.ProcessRunningState {
+			return 0
+		}
+		return 1
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		pi, pj := entries[i].Server.BootPriority(), entries[j].Server.BootPriority()
+		if pi != pj {
+			return pi > pj
+		}
+		return rank(entries[i].State) < rank(entries[j].State)
+	})
+}
+
+// RunBootQueue starts the given servers in order of priority, limiting the number
+// of servers that are starting at the same time to avoid overwhelming the disk
+// and CPU of the node. A slot in the queue is only freed once the server it was
+// used for reaches the running state, or the configured timeout passes. This
+// blocks until every server has been started or the context is cancelled.
+func RunBootQueue(ctx context.Context, entries []BootQueueEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	cfg := config.Get().System.BootQueue
+	concurrency := max(cfg.Concurrency, 1)
+	timeout := time.Duration(max(cfg.Timeout, 1)) * time.Second
+
+	sortBootQueue(entries)
+	log.WithField("servers", len(entries)).WithField("concurrency", concurrency).Info("restoring previously running servers using boot queue")
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, concurrency)
+	for i, entry := range entries {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case slots <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(s *Server, position int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			s.Log().WithField("position", position).Info("starting server from boot queue")
+			if err := s.HandlePowerAction(PowerActionStart); err != nil {
+				s.Log().WithField("error", err).Warn("failed to return server to running state")
+				return
+			}
+			if !s.waitForRunning(ctx, timeout) {
+				s.Log().WithField("timeout", timeout).Warn("server did not reach running state before boot queue timeout, starting next server")
+			}
+		}(entry.Server, i+1)
+	}
+	wg.Wait()
+	log.Info("finished restoring servers from boot queue")
+}
+
+// waitForRunning blocks until the server reaches the running state, returning
+// false if it did not do so before the timeout. If the server stops while
+// waiting there is nothing left to wait for, so true is returned.
+func (s *Server) waitForRunning(ctx context.Context, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(bootQueuePollInterval)
+	defer ticker.Stop()
+	for {
+		switch s.Environment.State() {
+		case environment.ProcessRunningState, environment.ProcessOfflineState:
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// BootPriority returns the priority of the server when it is being restored as
+// the daemon boots.
+func (s *Server) BootPriority() int {
+	return s.Config().BootPriority
+}
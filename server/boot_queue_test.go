@@ -0,0 +1,39 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+
+	"github.com/priyxstudio/propel/environment"
+)
+
+func TestBootQueue(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	newServer := func(id string, priority int) *Server {
+		s, err := New(nil)
+		g.Assert(err).IsNil()
+		s.cfg.Uuid = id
+		s.cfg.BootPriority = priority
+		return s
+	}
+
+	g.Describe("sortBootQueue", func() {
+		g.It("orders by priority and then by last known state", func() {
+			entries := []BootQueueEntry{
+				{Server: newServer("a", 0), State: environment.ProcessStartingState},
+				{Server: newServer("b", 0), State: environment.ProcessRunningState},
+				{Server: newServer("c", 10), State: environment.ProcessStartingState},
+				{Server: newServer("d", -1), State: environment.ProcessRunningState},
+			}
+			sortBootQueue(entries)
+
+			var ids []string
+			for _, e := range entries {
+				ids = append(ids, e.Server.ID())
+			}
+			g.Assert(ids).Equal([]string{"c", "b", "a", "d"})
+		})
+	})
+}
@@ -19,6 +19,10 @@ type EggConfiguration struct {
 	// Features is a map of feature identifiers to a list of console output strings
 	// that should trigger a match (e.g., for things like EULA prompts).
 	Features map[string][]string `json:"features"`
+
+	// HealthCheck defines how the daemon checks that servers using the Egg are
+	// still responsive once they are running.
+	HealthCheck *HealthCheck `json:"health_check"`
 }
 
 func (egg *EggConfiguration) UnmarshalJSON(b []byte) (err error) {
@@ -34,6 +38,7 @@ func (egg *EggConfiguration) UnmarshalJSON(b []byte) (err error) {
 
 	egg.ID = AliasEggConfiguration.ID
 	egg.FileDenylist = AliasEggConfiguration.FileDenylist
+	egg.HealthCheck = AliasEggConfiguration.HealthCheck
 
 	return nil
 }
@@ -77,6 +82,14 @@ type Configuration struct {
 	Mounts                []Mount                 `json:"mounts"`
 	Egg                   EggConfiguration        `json:"egg,omitempty"`
 
+	// The order in which the server is started when the daemon boots and restores
+	// servers that were previously running. Higher priorities are started first.
+	BootPriority int `json:"boot_priority"`
+
+	// The health check for the server, this overrides any health check defined by
+	// the Egg.
+	HealthCheck *HealthCheck `json:"health_check,omitempty"`
+
 	Container struct {
 		// Defines the Docker image that will be used for this server
 		Image string `json:"image,omitempty"`
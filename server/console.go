@@ -8,6 +8,7 @@ import (
 	"github.com/mitchellh/colorstring"
 
 	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/server/transcript"
 	"github.com/priyxstudio/propel/system"
 )
 
@@ -23,10 +24,26 @@ func (s *Server) PublishConsoleOutputFromDaemon(data string) {
 	appNameSync.Do(func() {
 		appName = config.Get().AppName
 	})
-	s.Events().Publish(
-		ConsoleOutputEvent,
-		colorstring.Color(fmt.Sprintf("[yellow][bold][%s Daemon]:[default] %s", "Propel", data)),
-	)
+	line := colorstring.Color(fmt.Sprintf("[yellow][bold][%s Daemon]:[default] %s", "Propel", data))
+	s.writeTranscript([]byte(line))
+	s.Events().Publish(ConsoleOutputEvent, line)
+}
+
+// Transcript returns the writer used to persist the console output for the
+// server to the disk.
+func (s *Server) Transcript() *transcript.Writer {
+	s.transcriptOnce.Do(func() {
+		s.transcript = transcript.New(s.ID())
+	})
+	return s.transcript
+}
+
+// writeTranscript appends a line of console output to the server transcript.
+// Failures are logged but never interrupt the processing of console output.
+func (s *Server) writeTranscript(line []byte) {
+	if err := s.Transcript().WriteLine(line); err != nil {
+		s.Log().WithField("error", err).Warn("failed to write console output to transcript")
+	}
 }
 
 // Throttler returns the throttler instance for the server or creates a new one.
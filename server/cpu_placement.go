@@ -0,0 +1,371 @@
+package server
+
+import (
+	"context"
+	"runtime"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/apex/log"
+
+	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/environment"
+	"github.com/priyxstudio/propel/environment/docker"
+	"github.com/priyxstudio/propel/system"
+)
+
+const (
+	CpuPlacementDedicated = "dedicated"
+	CpuPlacementManual    = "manual"
+	CpuPlacementShared    = "shared"
+)
+
+// CpuPlacement is the set of CPU threads assigned to a server when automatic
+// placement is enabled.
+type CpuPlacement struct {
+	Threads string `json:"threads"`
+	Type    string `json:"type"`
+}
+
+// cpuPlacer assigns CPU threads to servers when the node is configured for
+// automatic placement. Servers with a CPU limit are given dedicated threads,
+// kept on a single NUMA node where possible, and no thread is ever dedicated to
+// more than one server. Every other server shares the threads that remain.
+type cpuPlacer struct {
+	mu       sync.Mutex
+	topology *system.CPUTopology
+
+	// The threads dedicated to a server by the placer, and those assigned by the
+	// Panel directly which are treated as dedicated as well.
+	dedicated map[string][]int
+	manual    map[string][]int
+
+	// The servers using the shared threads, these need to be updated whenever
+	// the shared threads change.
+	shared map[string]*Server
+}
+
+var placer = &cpuPlacer{
+	dedicated: make(map[string][]int),
+	manual:    make(map[string][]int),
+	shared:    make(map[string]*Server),
+}
+
+// CpuPlacements returns the CPU threads currently assigned to each server by
+// automatic placement.
+func CpuPlacements() map[string]CpuPlacement {
+	placer.mu.Lock()
+	defer placer.mu.Unlock()
+
+	out := make(map[string]CpuPlacement, len(placer.dedicated)+len(placer.manual)+len(placer.shared))
+	for id, cpus := range placer.dedicated {
+		out[id] = CpuPlacement{Threads: system.FormatCPUSet(cpus), Type: CpuPlacementDedicated}
+	}
+	for id, cpus := range placer.manual {
+		out[id] = CpuPlacement{Threads: system.FormatCPUSet(cpus), Type: CpuPlacementManual}
+	}
+	pool := system.FormatCPUSet(placer.poolLocked())
+	for id := range placer.shared {
+		out[id] = CpuPlacement{Threads: pool, Type: CpuPlacementShared}
+	}
+	return out
+}
+
+// load reads the topology of the host the first time it is needed. This must be
+// called while holding the lock.
+func (p *cpuPlacer) load() {
+	if p.topology != nil {
+		return
+	}
+	t, err := system.GetCPUTopology()
+	if err != nil || t.Threads() == 0 {
+		log.WithField("error", err).Warn("failed to read cpu topology, treating each thread as a separate core")
+		t = system.CPUTopology{Nodes: []system.NUMANode{{ID: 0}}}
+		for i := 0; i < runtime.NumCPU(); i++ {
+			t.Nodes[0].CPUs = append(t.Nodes[0].CPUs, system.CPU{ID: i, Core: i})
+		}
+	}
+	p.topology = &t
+}
+
+// available returns the threads that can be assigned to servers, which is every
+// thread on the host except those reserved in the configuration.
+func (p *cpuPlacer) available() map[int]struct{} {
+	reserved, err := system.ParseCPUSet(config.Get().Docker.CpuPlacement.Reserved)
+	if err != nil {
+		log.WithField("error", err).Warn("ignoring invalid reserved cpu threads")
+	}
+	out := make(map[int]struct{})
+	for _, node := range p.topology.Nodes {
+		for _, cpu := range node.CPUs {
+			if !slices.Contains(reserved, cpu.ID) {
+				out[cpu.ID] = struct{}{}
+			}
+		}
+	}
+	return out
+}
+
+// free returns the available threads that are not assigned to any server. This
+// must be called while holding the lock.
+func (p *cpuPlacer) free() map[int]struct{} {
+	out := p.available()
+	for _, m := range []map[string][]int{p.dedicated, p.manual} {
+		for _, cpus := range m {
+			for _, cpu := range cpus {
+				delete(out, cpu)
+			}
+		}
+	}
+	return out
+}
+
+// poolLocked returns the threads shared between the servers without dedicated
+// threads. If every thread has been dedicated the servers are allowed to use any
+// available thread, since a container must be able to run somewhere. This must
+// be called while holding the lock.
+func (p *cpuPlacer) poolLocked() []int {
+	p.load()
+	free := p.free()
+	if len(free) == 0 {
+		free = p.available()
+	}
+	out := make([]int, 0, len(free))
+	for cpu := range free {
+		out = append(out, cpu)
+	}
+	sort.Ints(out)
+	return out
+}
+
+// allocate picks the given number of free threads for a server. The threads are
+// taken from the single NUMA node that fits them most tightly, preferring whole
+// cores so that hyperthread siblings are not shared with another server. If no
+// single node has enough free threads they are spread across nodes, and if the
+// host does not have enough free threads nil is returned. This must be called
+// while holding the lock.
+func (p *cpuPlacer) allocate(n int) []int {
+	free := p.free()
+	if len(free) < n {
+		return nil
+	}
+
+	type nodeThreads struct {
+		cores [][]int
+		count int
+	}
+	nodes := make([]nodeThreads, 0, len(p.topology.Nodes))
+	for _, node := range p.topology.Nodes {
+		byCore := make(map[[2]int][]int)
+		siblings := make(map[[2]int]int)
+		var keys [][2]int
+		for _, cpu := range node.CPUs {
+			key := [2]int{cpu.Package, cpu.Core}
+			siblings[key]++
+			if _, ok := free[cpu.ID]; !ok {
+				continue
+			}
+			if _, ok := byCore[key]; !ok {
+				keys = append(keys, key)
+			}
+			byCore[key] = append(byCore[key], cpu.ID)
+		}
+		// Whole cores first, then cores that already have a thread in use.
+		sort.SliceStable(keys, func(i, j int) bool {
+			return len(byCore[keys[i]]) == siblings[keys[i]] && len(byCore[keys[j]]) != siblings[keys[j]]
+		})
+		var nt nodeThreads
+		for _, key := range keys {
+			nt.cores = append(nt.cores, byCore[key])
+			nt.count += len(byCore[key])
+		}
+		nodes = append(nodes, nt)
+	}
+
+	take := func(nt nodeThreads, n int) []int {
+		var out []int
+		for _, threads := range nt.cores {
+			for _, cpu := range threads {
+				if len(out) == n {
+					return out
+				}
+				out = append(out, cpu)
+			}
+		}
+		return out
+	}
+
+	best := -1
+	for i, nt := range nodes {
+		if nt.count >= n && (best == -1 || nt.count < nodes[best].count) {
+			best = i
+		}
+	}
+	if best != -1 {
+		return take(nodes[best], n)
+	}
+
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].count > nodes[j].count })
+	var out []int
+	for _, nt := range nodes {
+		out = append(out, take(nt, n-len(out))...)
+		if len(out) == n {
+			break
+		}
+	}
+	return out
+}
+
+// place assigns CPU threads to a server based on its limits, returning the
+// cpuset for the server and any other servers using the shared threads if they
+// were changed by the placement. A hint may be provided with the threads that
+// the container is currently using so that they are kept where possible.
+func (p *cpuPlacer) place(s *Server, limits environment.Limits, hint []int) (string, []*Server) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.load()
+
+	id := s.ID()
+	before := p.poolLocked()
+	previous := p.dedicated[id]
+	delete(p.dedicated, id)
+	delete(p.manual, id)
+	delete(p.shared, id)
+
+	var threads string
+	if limits.Threads != "" {
+		cpus, err := system.ParseCPUSet(limits.Threads)
+		if err != nil {
+			s.Log().WithField("error", err).Warn("server has invalid cpu threads configured")
+		}
+		p.manual[id] = cpus
+		threads = limits.Threads
+	} else if limits.CpuLimit > 0 {
+		n := int((limits.CpuLimit + 99) / 100)
+		cpus := p.reuse(previous, n)
+		if cpus == nil {
+			cpus = p.reuse(hint, n)
+		}
+		if cpus == nil {
+			cpus = p.allocate(n)
+		}
+		if cpus == nil {
+			s.Log().WithField("threads", n).Warn("not enough free cpu threads to dedicate to server, using shared threads")
+		} else {
+			p.dedicated[id] = cpus
+			threads = system.FormatCPUSet(cpus)
+		}
+	}
+	if threads == "" {
+		p.shared[id] = s
+		threads = system.FormatCPUSet(p.poolLocked())
+	}
+
+	return threads, p.changedLocked(before, id)
+}
+
+// reuse returns the given threads if they are all free and match the number of
+// threads required, otherwise nil. This must be called while holding the lock.
+func (p *cpuPlacer) reuse(cpus []int, n int) []int {
+	if len(cpus) != n {
+		return nil
+	}
+	free := p.free()
+	for _, cpu := range cpus {
+		if _, ok := free[cpu]; !ok {
+			return nil
+		}
+	}
+	return cpus
+}
+
+// release removes the threads assigned to a server, returning any servers using
+// the shared threads if they were changed.
+func (p *cpuPlacer) release(id string) []*Server {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.topology == nil {
+		return nil
+	}
+
+	before := p.poolLocked()
+	delete(p.dedicated, id)
+	delete(p.manual, id)
+	delete(p.shared, id)
+	return p.changedLocked(before, id)
+}
+
+// changedLocked returns the servers using the shared threads, other than the
+// given server, if the shared threads are different from those provided. This
+// must be called while holding the lock.
+func (p *cpuPlacer) changedLocked(before []int, id string) []*Server {
+	if slices.Equal(before, p.poolLocked()) {
+		return nil
+	}
+	out := make([]*Server, 0, len(p.shared))
+	for sid, s := range p.shared {
+		if sid != id {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// placedLimits returns the build limits for the server with the CPU threads set
+// by automatic placement, if it is enabled. Any servers using the shared threads
+// are updated if the placement changed them.
+func (s *Server) placedLimits() environment.Limits {
+	limits := s.Config().Build
+	if !config.Get().Docker.AutoCpuPlacement() {
+		return limits
+	}
+
+	var hint []int
+	if e, ok := s.Environment.(*docker.Environment); ok {
+		if c, err := e.ContainerInspect(context.Background()); err == nil && c.HostConfig != nil {
+			hint, _ = system.ParseCPUSet(c.HostConfig.CpusetCpus)
+		}
+	}
+
+	threads, changed := placer.place(s, limits, hint)
+	limits.Threads = threads
+	rebalanceSharedCpus(changed)
+	return limits
+}
+
+// releaseCpuPlacement frees the CPU threads assigned to the server, this is used
+// when the server is removed from the node.
+func (s *Server) releaseCpuPlacement() {
+	rebalanceSharedCpus(placer.release(s.ID()))
+}
+
+// rebalanceSharedCpus updates the servers using the shared threads after they
+// have changed. Servers that are running are updated in place, all others will
+// use the new threads when they are next started.
+func rebalanceSharedCpus(servers []*Server) {
+	if len(servers) == 0 {
+		return
+	}
+	placer.mu.Lock()
+	pool := system.FormatCPUSet(placer.poolLocked())
+	placer.mu.Unlock()
+
+	for _, s := range servers {
+		if s.Environment == nil {
+			continue
+		}
+		limits := s.Config().Build
+		limits.Threads = pool
+		s.Environment.Config().SetLimits(limits)
+		if s.Environment.State() == environment.ProcessOfflineState {
+			continue
+		}
+		go func(s *Server) {
+			s.Log().WithField("threads", pool).Debug("updating shared cpu threads for server")
+			if err := s.Environment.InSituUpdate(); err != nil {
+				s.Log().WithField("error", err).Warn("failed to update shared cpu threads for server")
+			}
+		}(s)
+	}
+}
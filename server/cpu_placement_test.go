@@ -0,0 +1,68 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+
+	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/system"
+)
+
+func TestCpuPlacer(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	// Two NUMA nodes, each with two cores of two hyperthreads.
+	topology := system.CPUTopology{Nodes: []system.NUMANode{
+		{ID: 0, CPUs: []system.CPU{{ID: 0, Core: 0}, {ID: 1, Core: 1}, {ID: 4, Core: 0}, {ID: 5, Core: 1}}},
+		{ID: 1, CPUs: []system.CPU{{ID: 2, Core: 0, Package: 1}, {ID: 3, Core: 1, Package: 1}, {ID: 6, Core: 0, Package: 1}, {ID: 7, Core: 1, Package: 1}}},
+	}}
+	newPlacer := func() *cpuPlacer {
+		return &cpuPlacer{
+			topology:  &topology,
+			dedicated: make(map[string][]int),
+			manual:    make(map[string][]int),
+			shared:    make(map[string]*Server),
+		}
+	}
+
+	g.Describe("cpuPlacer", func() {
+		g.BeforeEach(func() {
+			config.Set(&config.Configuration{AuthenticationToken: "abc"})
+		})
+
+		g.It("prefers whole cores on a single node", func() {
+			p := newPlacer()
+			g.Assert(p.allocate(2)).Equal([]int{0, 4})
+		})
+
+		g.It("fits threads on the node with the least free threads", func() {
+			p := newPlacer()
+			p.dedicated["a"] = []int{0, 4, 1}
+			g.Assert(p.allocate(1)).Equal([]int{5})
+		})
+
+		g.It("spreads threads across nodes when no single node fits", func() {
+			p := newPlacer()
+			p.dedicated["a"] = []int{0, 4}
+			p.dedicated["b"] = []int{2, 6}
+			g.Assert(len(p.allocate(3))).Equal(3)
+		})
+
+		g.It("never dedicates more threads than are free", func() {
+			p := newPlacer()
+			p.dedicated["a"] = []int{0, 1, 2, 3, 4, 5}
+			g.Assert(p.allocate(3) == nil).IsTrue()
+		})
+
+		g.It("excludes reserved and dedicated threads from the shared pool", func() {
+			cfg := config.Get()
+			cfg.Docker.CpuPlacement.Reserved = "0,4"
+			config.Set(cfg)
+
+			p := newPlacer()
+			p.dedicated["a"] = []int{1, 5}
+			g.Assert(p.poolLocked()).Equal([]int{2, 3, 6, 7})
+		})
+	})
+}
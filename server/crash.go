@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"sync"
@@ -19,6 +20,16 @@ type CrashHandler struct {
 
 	// Tracks the time of the last server crash event.
 	lastCrash time.Time
+
+	// Tracks the time of every crash within the configured window, used by the
+	// backoff strategy to determine the restart delay.
+	crashes []time.Time
+
+	// Set when the crash handler has given up on restarting the server.
+	crashed bool
+
+	// Cancels a delayed restart that has not been performed yet.
+	cancelRestart context.CancelFunc
 }
 
 // Returns the time of the last crash for this server instance.
@@ -36,6 +47,69 @@ func (cd *CrashHandler) SetLastCrash(t time.Time) {
 	cd.mu.Unlock()
 }
 
+// IsCrashed returns true if the crash handler gave up on restarting the server
+// after it crashed. This is reset the next time the server is started.
+func (cd *CrashHandler) IsCrashed() bool {
+	cd.mu.RLock()
+	defer cd.mu.RUnlock()
+
+	return cd.crashed
+}
+
+// SetCrashed sets whether the server is considered to be in a crashed state.
+func (cd *CrashHandler) SetCrashed(v bool) {
+	cd.mu.Lock()
+	cd.crashed = v
+	cd.mu.Unlock()
+}
+
+// CancelPendingRestart cancels a delayed restart that is waiting to be performed
+// for the server, if there is one.
+func (cd *CrashHandler) CancelPendingRestart() {
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+	if cd.cancelRestart != nil {
+		cd.cancelRestart()
+		cd.cancelRestart = nil
+	}
+}
+
+// recordCrash tracks a crash at the given time and returns the number of crashes
+// that have occurred within the window, including this one.
+func (cd *CrashHandler) recordCrash(t time.Time, window time.Duration) int {
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+
+	cd.lastCrash = t
+	crashes := cd.crashes[:0]
+	for _, c := range cd.crashes {
+		if t.Sub(c) < window {
+			crashes = append(crashes, c)
+		}
+	}
+	cd.crashes = append(crashes, t)
+	return len(cd.crashes)
+}
+
+// backoffDelay returns the delay before a server is restarted after the given
+// number of crashes within the configured window.
+func backoffDelay(cfg config.CrashDetection, count int) time.Duration {
+	delay := float64(cfg.BackoffInitial)
+	for i := 1; i < count; i++ {
+		delay *= cfg.BackoffMultiplier
+		if cfg.BackoffMax > 0 && delay >= float64(cfg.BackoffMax) {
+			break
+		}
+	}
+	if cfg.BackoffMax > 0 && delay > float64(cfg.BackoffMax) {
+		delay = float64(cfg.BackoffMax)
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return time.Duration(delay * float64(time.Second))
+}
+
 // Looks at the environment exit state to determine if the process exited cleanly or
 // if it was the result of an event that we should try to recover from.
 //
@@ -44,9 +118,9 @@ func (cd *CrashHandler) SetLastCrash(t time.Time) {
 // look at the exit state and check if it meets the criteria of being called a crash
 // by Wings.
 //
-// If the server is determined to have crashed, the process will be restarted and the
-// counter for the server will be incremented.
-func (s *Server) handleServerCrash() error {
+// If the server is determined to have crashed, a crash report is stored and the
+// process is restarted according to the configured restart strategy.
+func (s *Server) handleServerCrash(stats environment.Stats) error {
 	// No point in doing anything here if the server isn't currently offline, there
 	// is no reason to do a crash detection event. If the server crash detection is
 	// disabled we want to skip anything after this as well.
@@ -64,15 +138,21 @@ func (s *Server) handleServerCrash() error {
 		return errors.Wrap(err, "failed to get exit state for server process")
 	}
 
+	cfg := config.Get().System.CrashDetection
+
 	// If the system is not configured to detect a clean exit code as a crash, and the
 	// crash is not the result of the program running out of memory, do nothing.
-	if exitCode == 0 && !oomKilled && !config.Get().System.CrashDetection.DetectCleanExitAsCrash {
+	if exitCode == 0 && !oomKilled && !cfg.DetectCleanExitAsCrash {
 		s.Log().Debug("server exited with successful exit code; system is configured to not detect this as a crash")
 		return nil
 	}
 
 	// Get the last lines from the output before the crash so we can log it
-	logs, err := s.Environment.Readlog(config.Get().System.CrashActivityLogLines)
+	lines := config.Get().System.CrashActivityLogLines
+	if cfg.ReportLines > lines {
+		lines = cfg.ReportLines
+	}
+	logs, err := s.Environment.Readlog(lines)
 	if err != nil {
 		log.WithField("server_id", s.ID()).Warn("Faild to get the last lines out of the console for the activity logs")
 	}
@@ -81,28 +161,133 @@ func (s *Server) handleServerCrash() error {
 	s.PublishConsoleOutputFromDaemon(fmt.Sprintf("Exit code: %d", exitCode))
 	s.PublishConsoleOutputFromDaemon(fmt.Sprintf("Out of memory: %t", oomKilled))
 
+	report := &models.CrashReport{
+		ServerUUID: s.ID(),
+		ExitCode:   exitCode,
+		OOMKilled:  oomKilled,
+		Logs:       tailLines(logs, cfg.ReportLines),
+		Stats:      stats,
+		DiskBytes:  s.Filesystem().CachedUsage(),
+		Outcome:    models.CrashReportOutcomeRestarted,
+	}
+
 	c := s.crasher.LastCrashTime()
-	timeout := config.Get().System.CrashDetection.Timeout
+	now := time.Now()
 
-	// If the last crash time was within the last `timeout` seconds we do not want to perform
-	// an automatic reboot of the process. Return an error that can be handled.
-	//
-	// If timeout is set to 0, always reboot the server (this is probably a terrible idea, but some people want it)
-	if timeout != 0 && !c.IsZero() && c.Add(time.Second*time.Duration(config.Get().System.CrashDetection.Timeout)).After(time.Now()) {
-		s.PublishConsoleOutputFromDaemon("Aborting automatic restart, last crash occurred less than " + strconv.Itoa(timeout) + " seconds ago.")
-		return &crashTooFrequent{}
+	var delay time.Duration
+	if cfg.Strategy == "backoff" {
+		count := s.crasher.recordCrash(now, time.Second*time.Duration(cfg.Window))
+		if cfg.MaxRestarts > 0 && count > cfg.MaxRestarts {
+			s.PublishConsoleOutputFromDaemon(fmt.Sprintf("Aborting automatic restart, server has crashed %d times in the last %d seconds.", count, cfg.Window))
+			report.Outcome = models.CrashReportOutcomeGaveUp
+			s.saveCrashReport(report)
+			s.markCrashed()
+			return &crashTooFrequent{}
+		}
+		delay = backoffDelay(cfg, count)
+	} else {
+		timeout := cfg.Timeout
+
+		// If the last crash time was within the last `timeout` seconds we do not want to perform
+		// an automatic reboot of the process. Return an error that can be handled.
+		//
+		// If timeout is set to 0, always reboot the server (this is probably a terrible idea, but some people want it)
+		if timeout != 0 && !c.IsZero() && c.Add(time.Second*time.Duration(timeout)).After(now) {
+			s.PublishConsoleOutputFromDaemon("Aborting automatic restart, last crash occurred less than " + strconv.Itoa(timeout) + " seconds ago.")
+			report.Outcome = models.CrashReportOutcomeGaveUp
+			s.saveCrashReport(report)
+			s.markCrashed()
+			return &crashTooFrequent{}
+		}
+		s.crasher.SetLastCrash(now)
 	}
 
 	// Log that the server has crashed
 	s.SaveActivity(s.NewRequestActivity("", "127.0.0.1"), ActivityServerCrashed, models.ActivityMeta{
 		"exit_code": exitCode,
 		"oomkilled": oomKilled,
-		"logs":      logs,
+		"logs":      tailLines(logs, config.Get().System.CrashActivityLogLines),
 	})
 
-	s.crasher.SetLastCrash(time.Now())
+	// The report is stored before the restart so that it is available, and the
+	// webhooks are notified, while a delayed restart is still waiting. Only the
+	// outcome is updated once the restart has been attempted.
+	if delay > 0 {
+		report.Outcome = models.CrashReportOutcomeDelayed
+		report.RestartDelay = int(delay / time.Second)
+		s.saveCrashReport(report)
+		s.PublishConsoleOutputFromDaemon(fmt.Sprintf("Restarting server in %d seconds...", report.RestartDelay))
+		started, err := s.restartAfter(delay)
+		switch {
+		case err != nil:
+			s.updateCrashReportOutcome(report, models.CrashReportOutcomeRestartFailed)
+		case started:
+			s.updateCrashReportOutcome(report, models.CrashReportOutcomeRestarted)
+		default:
+			s.updateCrashReportOutcome(report, models.CrashReportOutcomeCancelled)
+		}
+		return err
+	}
+
+	s.saveCrashReport(report)
+	if err := s.HandlePowerAction(PowerActionStart); err != nil {
+		s.updateCrashReportOutcome(report, models.CrashReportOutcomeRestartFailed)
+		return errors.Wrap(err, "failed to start server after crash detection")
+	}
+	return nil
+}
+
+// restartAfter waits for the delay to pass and then starts the server, returning
+// false if the server was not started. The wait is cancelled if another power
+// action is performed for the server before the delay has passed, or if the
+// server is deleted.
+func (s *Server) restartAfter(delay time.Duration) (bool, error) {
+	ctx, cancel := context.WithCancel(s.Context())
+	defer cancel()
 
-	return errors.Wrap(s.HandlePowerAction(PowerActionStart), "failed to start server after crash detection")
+	s.crasher.CancelPendingRestart()
+	s.crasher.mu.Lock()
+	s.crasher.cancelRestart = cancel
+	s.crasher.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		s.Log().Debug("delayed restart after crash was cancelled")
+		return false, nil
+	case <-time.After(delay):
+	}
+
+	// Clear out the pending restart before starting the server, otherwise the power
+	// action would cancel itself.
+	s.crasher.mu.Lock()
+	s.crasher.cancelRestart = nil
+	s.crasher.mu.Unlock()
+
+	if ctx.Err() != nil || s.Environment.State() != environment.ProcessOfflineState {
+		return false, nil
+	}
+	if err := s.HandlePowerAction(PowerActionStart); err != nil {
+		return false, errors.Wrap(err, "failed to start server after crash detection")
+	}
+	return true, nil
+}
+
+// markCrashed flags the server as crashed once the crash handler has given up on
+// restarting it, and notifies any listeners.
+func (s *Server) markCrashed() {
+	s.crasher.SetCrashed(true)
+	s.Events().Publish(CrashedEvent, nil)
 }
 
+// IsCrashed returns true if the crash handler gave up on restarting the server.
+func (s *Server) IsCrashed() bool {
+	return s.crasher.IsCrashed()
+}
 
+// tailLines returns at most the last n lines from the slice.
+func tailLines(lines []string, n int) []string {
+	if n >= 0 && len(lines) > n {
+		return lines[len(lines)-n:]
+	}
+	return lines
+}
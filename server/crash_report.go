@@ -0,0 +1,83 @@
+package server
+
+import (
+	"emperror.dev/errors"
+	"gorm.io/gorm"
+
+	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/internal/database"
+	"github.com/priyxstudio/propel/internal/models"
+)
+
+// ErrCrashReportNotFound is returned when a crash report does not exist for the
+// server it is being requested for.
+var ErrCrashReportNotFound = errors.Sentinel("server: crash report not found")
+
+// CrashReports returns the stored crash reports for the server, newest first.
+func (s *Server) CrashReports() ([]models.CrashReport, error) {
+	var reports []models.CrashReport
+	if err := database.Instance().Where("server_uuid = ?", s.ID()).
+		Order("id DESC").
+		Find(&reports).Error; err != nil {
+		return nil, errors.Wrap(err, "failed to fetch crash reports")
+	}
+	return reports, nil
+}
+
+// CrashReport returns a single crash report for the server.
+func (s *Server) CrashReport(id uint) (*models.CrashReport, error) {
+	var r models.CrashReport
+	if err := database.Instance().Where("server_uuid = ?", s.ID()).First(&r, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCrashReportNotFound
+		}
+		return nil, errors.Wrap(err, "failed to fetch crash report")
+	}
+	return &r, nil
+}
+
+// DeleteAllCrashReports removes every crash report for the server, this is used
+// when the server is being deleted from the node.
+func (s *Server) DeleteAllCrashReports() error {
+	if err := database.Instance().Where("server_uuid = ?", s.ID()).Delete(&models.CrashReport{}).Error; err != nil {
+		return errors.Wrap(err, "failed to delete crash reports")
+	}
+	return nil
+}
+
+// saveCrashReport stores the crash report and then removes the oldest reports
+// for the server beyond the configured maximum. Errors are logged but are not
+// returned since a failure here should never prevent a server from restarting.
+func (s *Server) saveCrashReport(r *models.CrashReport) {
+	db := database.Instance()
+	if err := db.Create(r).Error; err != nil {
+		s.Log().WithField("error", err).Error("failed to save crash report")
+		return
+	}
+	s.notifyWebhooks(WebhookEventCrashed, r)
+
+	max := config.Get().System.CrashDetection.MaxReports
+	if max <= 0 {
+		return
+	}
+	keep := db.Model(&models.CrashReport{}).
+		Select("id").
+		Where("server_uuid = ?", s.ID()).
+		Order("id DESC").
+		Limit(max)
+	if err := db.Where("server_uuid = ? AND id NOT IN (?)", s.ID(), keep).Delete(&models.CrashReport{}).Error; err != nil {
+		s.Log().WithField("error", err).Warn("failed to prune old crash reports")
+	}
+}
+
+// updateCrashReportOutcome records what happened to the restart that followed
+// a stored crash report.
+func (s *Server) updateCrashReportOutcome(r *models.CrashReport, outcome models.CrashReportOutcome) {
+	if r.ID == 0 || r.Outcome == outcome {
+		return
+	}
+	r.Outcome = outcome
+	if err := database.Instance().Model(r).Update("outcome", outcome).Error; err != nil {
+		s.Log().WithField("error", err).Warn("failed to update crash report outcome")
+	}
+}
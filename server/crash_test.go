@@ -0,0 +1,51 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+
+	"github.com/priyxstudio/propel/config"
+)
+
+func TestCrashHandler(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("backoffDelay", func() {
+		cfg := config.CrashDetection{BackoffInitial: 5, BackoffMax: 60, BackoffMultiplier: 2}
+
+		g.It("grows exponentially with each crash", func() {
+			g.Assert(backoffDelay(cfg, 1)).Equal(time.Second * 5)
+			g.Assert(backoffDelay(cfg, 2)).Equal(time.Second * 10)
+			g.Assert(backoffDelay(cfg, 3)).Equal(time.Second * 20)
+		})
+
+		g.It("never exceeds the maximum delay", func() {
+			g.Assert(backoffDelay(cfg, 5)).Equal(time.Second * 60)
+			g.Assert(backoffDelay(cfg, 1000)).Equal(time.Second * 60)
+		})
+	})
+
+	g.Describe("CrashHandler", func() {
+		g.It("only counts crashes within the window", func() {
+			var cd CrashHandler
+			now := time.Now()
+
+			g.Assert(cd.recordCrash(now, time.Minute)).Equal(1)
+			g.Assert(cd.recordCrash(now.Add(time.Second*30), time.Minute)).Equal(2)
+			g.Assert(cd.recordCrash(now.Add(time.Second*75), time.Minute)).Equal(2)
+			g.Assert(cd.LastCrashTime()).Equal(now.Add(time.Second * 75))
+		})
+
+		g.It("cancels a pending restart", func() {
+			var cd CrashHandler
+			var cancelled bool
+			cd.cancelRestart = func() { cancelled = true }
+
+			cd.CancelPendingRestart()
+			g.Assert(cancelled).IsTrue()
+			g.Assert(cd.cancelRestart == nil).IsTrue()
+		})
+	})
+}
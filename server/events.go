@@ -7,21 +7,27 @@ import (
 
 // Defines all the possible output events for a server.
 const (
-	DaemonMessageEvent          = "daemon message"
-	InstallOutputEvent          = "install output"
-	InstallStartedEvent         = "install started"
-	InstallCompletedEvent       = "install completed"
-	ConsoleOutputEvent          = "console output"
-	StatusEvent                 = "status"
-	StatsEvent                  = "stats"
-	BackupRestoreCompletedEvent = "backup restore completed"
-	BackupCompletedEvent        = "backup completed"
-	TransferLogsEvent           = "transfer logs"
-	TransferStatusEvent         = "transfer status"
-	DeletedEvent                = "deleted"
-	FeatureMatchEvent           = "feature match"
-	ImportStartedEvent          = "import started"
-	ImportCompletedEvent        = "import completed"
+	DaemonMessageEvent            = "daemon message"
+	InstallOutputEvent            = "install output"
+	InstallStartedEvent           = "install started"
+	InstallCompletedEvent         = "install completed"
+	ConsoleOutputEvent            = "console output"
+	StatusEvent                   = "status"
+	StatsEvent                    = "stats"
+	BackupRestoreCompletedEvent   = "backup restore completed"
+	BackupCompletedEvent          = "backup completed"
+	TransferLogsEvent             = "transfer logs"
+	TransferStatusEvent           = "transfer status"
+	DeletedEvent                  = "deleted"
+	FeatureMatchEvent             = "feature match"
+	ImportStartedEvent            = "import started"
+	ImportCompletedEvent          = "import completed"
+	TriggerMatchEvent             = "trigger match"
+	CrashedEvent                  = "crashed"
+	GracefulStopEvent             = "graceful stop"
+	StartQueueEvent               = "start queue"
+	HealthEvent                   = "health"
+	CertificateRenewalFailedEvent = "certificate renewal failed"
 )
 
 // Events returns the server's emitter instance.
@@ -7,6 +7,7 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 
@@ -55,6 +56,30 @@ func (p *TarProgress) Write(v []byte) (int, error) {
 	return p.p.Write(v)
 }
 
+// FileState is the state of a file when it was added to an archive.
+type FileState struct {
+	Size    int64       `json:"size"`
+	ModTime int64       `json:"mod_time"`
+	Mode    fs.FileMode `json:"mode"`
+}
+
+// Snapshot records the state of every file added to an archive, keyed by the
+// path of the file relative to the base directory of the archive.
+type Snapshot map[string]FileState
+
+// Deleted returns the paths of the files in the snapshot that are not present
+// in the newer snapshot.
+func (s Snapshot) Deleted(newer Snapshot) []string {
+	var out []string
+	for p := range s {
+		if _, ok := newer[p]; !ok {
+			out = append(out, p)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
 type Archive struct {
 	// Filesystem to create the archive with.
 	Filesystem *Filesystem
@@ -74,6 +99,14 @@ type Archive struct {
 	// Progress wraps the writer of the archive to pass through the progress tracker.
 	Progress *progress.Progress
 
+	// Snapshot, if set, records the state of every file walked while creating
+	// the archive.
+	Snapshot Snapshot
+
+	// Since, if set, skips any file that has not changed since it was recorded in
+	// the snapshot, so that the archive only contains files added or changed.
+	Since Snapshot
+
 	w *TarProgress
 }
 
@@ -273,6 +306,14 @@ func (a *Archive) addToArchive(dirfd int, name, relative string, entry ufs.DirEn
 		return nil
 	}
 
+	state := FileState{Size: s.Size(), ModTime: s.ModTime().UnixNano(), Mode: s.Mode()}
+	if a.Snapshot != nil {
+		a.Snapshot[relative] = state
+	}
+	if prev, ok := a.Since[relative]; ok && prev == state {
+		return nil
+	}
+
 	// Resolve the symlink target if the file is a symlink.
 	var target string
 	if s.Mode()&fs.ModeSymlink != 0 {
@@ -84,6 +84,38 @@ func TestArchive_Stream(t *testing.T) {
 
 			g.Assert(files).Equal(expected)
 		})
+
+		g.It("archives only files changed since a snapshot", func() {
+			for _, name := range []string{"same.txt", "changed.txt", "deleted.txt"} {
+				r := strings.NewReader("hello, world!\n")
+				g.Assert(fs.Write(name, r, r.Size(), 0o644)).IsNil()
+			}
+
+			snapshot := Snapshot{}
+			a := &Archive{Filesystem: fs, Snapshot: snapshot}
+			g.Assert(a.Create(context.Background(), filepath.Join(rfs.root, "full.tar.gz"))).IsNil()
+			g.Assert(len(snapshot)).Equal(3)
+
+			r := strings.NewReader("hello, world! again\n")
+			g.Assert(fs.Write("changed.txt", r, r.Size(), 0o644)).IsNil()
+			r = strings.NewReader("new\n")
+			g.Assert(fs.Write("added.txt", r, r.Size(), 0o644)).IsNil()
+			g.Assert(fs.Delete("deleted.txt")).IsNil()
+
+			current := Snapshot{}
+			archivePath := filepath.Join(rfs.root, "delta.tar.gz")
+			a = &Archive{Filesystem: fs, Since: snapshot, Snapshot: current}
+			g.Assert(a.Create(context.Background(), archivePath)).IsNil()
+
+			genericFs, err := archives.FileSystem(context.Background(), archivePath, nil)
+			g.Assert(err).IsNil()
+			files, err := getFiles(genericFs.(iofs.ReadDirFS), ".")
+			g.Assert(err).IsNil()
+			sort.Strings(files)
+
+			g.Assert(files).Equal([]string{"added.txt", "changed.txt"})
+			g.Assert(snapshot.Deleted(current)).Equal([]string{"deleted.txt"})
+		})
 	})
 }
 
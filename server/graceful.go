@@ -0,0 +1,243 @@
+package server
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+
+	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/environment"
+	"github.com/priyxstudio/propel/internal/query"
+)
+
+// ErrGracefulStopPending is returned when a graceful stop or restart is requested
+// while the countdown for another is already running.
+var ErrGracefulStopPending = errors.Sentinel("server: a graceful stop is already in progress")
+
+// The status values emitted with a GracefulStopEvent.
+const (
+	GracefulStopStarted   = "started"
+	GracefulStopCountdown = "countdown"
+	GracefulStopCancelled = "cancelled"
+	GracefulStopCompleted = "completed"
+)
+
+// GracefulStopOptions configures a graceful stop or restart of a server. Any
+// value that is not set falls back to the configured defaults for the node.
+type GracefulStopOptions struct {
+	// Restart starts the server again once it has been stopped.
+	Restart bool `json:"restart"`
+
+	// Countdown is the number of seconds to wait before stopping the server.
+	Countdown int `json:"countdown"`
+
+	// Announcements are the number of seconds remaining at which the countdown
+	// message is sent to the server console.
+	Announcements []int `json:"announcements"`
+
+	// Message is the console command used to announce the countdown.
+	Message string `json:"message"`
+
+	// Query is the protocol used to check for connected players, and QueryPort
+	// is the port to query if it differs from the default allocation port.
+	Query     query.Protocol `json:"query"`
+	QueryPort int            `json:"query_port"`
+}
+
+// GracefulStopPayload is emitted with a GracefulStopEvent to keep websocket
+// clients informed about the progress of the countdown.
+type GracefulStopPayload struct {
+	Action    string `json:"action"`
+	Status    string `json:"status"`
+	Remaining int    `json:"remaining"`
+}
+
+// gracefulStop tracks the countdown that is currently running for a server.
+type gracefulStop struct {
+	mu     sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// release clears the running countdown if it is the one for the given context,
+// this avoids clearing a countdown that was started after this one was cancelled.
+func (gs *gracefulStop) release(ctx context.Context) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	if gs.ctx == ctx {
+		gs.ctx = nil
+		gs.cancel = nil
+	}
+}
+
+// withDefaults returns a copy of the options with any missing values replaced
+// by the configured defaults.
+func (o GracefulStopOptions) withDefaults() GracefulStopOptions {
+	cfg := config.Get().System.GracefulStop
+	if o.Countdown <= 0 {
+		o.Countdown = cfg.Countdown
+	}
+	if len(o.Announcements) == 0 {
+		o.Announcements = cfg.Announcements
+	}
+	if o.Message == "" {
+		o.Message = cfg.Message
+	}
+	if o.Query == "" {
+		o.Query = query.Protocol(cfg.Query)
+	}
+	return o
+}
+
+func (o GracefulStopOptions) action() string {
+	if o.Restart {
+		return PowerActionRestart
+	}
+	return PowerActionStop
+}
+
+// IsGracefullyStopping returns true if a graceful stop countdown is running.
+func (s *Server) IsGracefullyStopping() bool {
+	s.graceful.mu.Lock()
+	defer s.graceful.mu.Unlock()
+	return s.graceful.cancel != nil
+}
+
+// CancelGracefulStop cancels the graceful stop countdown for the server. Returns
+// false if there was no countdown running.
+func (s *Server) CancelGracefulStop() bool {
+	s.graceful.mu.Lock()
+	defer s.graceful.mu.Unlock()
+	if s.graceful.cancel == nil {
+		return false
+	}
+	s.graceful.cancel()
+	s.graceful.ctx = nil
+	s.graceful.cancel = nil
+	return true
+}
+
+// GracefulStop announces a countdown through the server console and then stops
+// or restarts the server once it has elapsed. If a player query is configured
+// and reports that nobody is online the countdown is skipped entirely. This
+// function blocks until the countdown has finished or has been cancelled.
+func (s *Server) GracefulStop(opts GracefulStopOptions) error {
+	opts = opts.withDefaults()
+	action := opts.action()
+
+	// There is nothing to count down if the server is not running, so just perform
+	// the power action directly.
+	if !s.IsRunning() {
+		return s.HandlePowerAction(PowerAction(action))
+	}
+
+	ctx, cancel := context.WithCancel(s.Context())
+	defer cancel()
+
+	s.graceful.mu.Lock()
+	if s.graceful.cancel != nil {
+		s.graceful.mu.Unlock()
+		return ErrGracefulStopPending
+	}
+	s.graceful.ctx = ctx
+	s.graceful.cancel = cancel
+	s.graceful.mu.Unlock()
+	defer s.graceful.release(ctx)
+
+	s.publishGracefulStop(action, GracefulStopStarted, opts.Countdown)
+	s.PublishConsoleOutputFromDaemon("Server will " + action + " in " + strconv.Itoa(opts.Countdown) + " seconds.")
+
+	if !s.countdown(ctx, opts) {
+		if s.Context().Err() == nil {
+			s.publishGracefulStop(action, GracefulStopCancelled, 0)
+			s.PublishConsoleOutputFromDaemon("Graceful " + action + " was cancelled.")
+		}
+		return nil
+	}
+
+	// Release the countdown before performing the power action so that it cannot
+	// be cancelled part way through stopping the server.
+	s.graceful.release(ctx)
+
+	s.publishGracefulStop(action, GracefulStopCompleted, 0)
+	return s.HandlePowerAction(PowerAction(action))
+}
+
+// countdown runs the countdown for a graceful stop, announcing the remaining
+// time through the console. Returns false if the countdown was cancelled or the
+// server stopped on its own before it finished.
+func (s *Server) countdown(ctx context.Context, opts GracefulStopOptions) bool {
+	action := opts.action()
+	if s.queryNoPlayers(ctx, opts) {
+		s.PublishConsoleOutputFromDaemon("No players are online, performing " + action + " immediately.")
+		return true
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for remaining := opts.Countdown; remaining > 0; remaining-- {
+		if slices.Contains(opts.Announcements, remaining) {
+			s.publishGracefulStop(action, GracefulStopCountdown, remaining)
+			msg := strings.NewReplacer("{action}", action, "{seconds}", strconv.Itoa(remaining)).Replace(opts.Message)
+			if err := s.Environment.SendCommand(msg); err != nil {
+				s.Log().WithField("error", err).Warn("failed to send graceful stop announcement to server")
+			}
+			if remaining != opts.Countdown && s.queryNoPlayers(ctx, opts) {
+				s.PublishConsoleOutputFromDaemon("No players are online, performing " + action + " immediately.")
+				return true
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+
+		if s.Environment.State() == environment.ProcessOfflineState {
+			return false
+		}
+	}
+	return true
+}
+
+// queryNoPlayers returns true if a player query is configured for the countdown
+// and it successfully reports that there are no players online. Any failure to
+// query the server is treated as there being players online.
+func (s *Server) queryNoPlayers(ctx context.Context, opts GracefulStopOptions) bool {
+	if opts.Query == "" {
+		return false
+	}
+	if !opts.Query.IsValid() {
+		s.Log().WithField("query", opts.Query).Warn("unknown query protocol configured for graceful stop")
+		return false
+	}
+
+	address, ok := s.localAddress(opts.QueryPort)
+	if !ok {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*3)
+	defer cancel()
+	res, err := query.Query(ctx, opts.Query, address)
+	if err != nil {
+		s.Log().WithField("error", err).Debug("failed to query server for players during graceful stop")
+		return false
+	}
+	return res.Players == 0
+}
+
+func (s *Server) publishGracefulStop(action string, status string, remaining int) {
+	s.Events().Publish(GracefulStopEvent, GracefulStopPayload{
+		Action:    action,
+		Status:    status,
+		Remaining: remaining,
+	})
+}
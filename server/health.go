@@ -0,0 +1,373 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+
+	"github.com/priyxstudio/propel/internal/models"
+	"github.com/priyxstudio/propel/internal/query"
+)
+
+// The types of health check that can be performed against a running server.
+const (
+	HealthCheckTCP       = "tcp"
+	HealthCheckMinecraft = "minecraft"
+	HealthCheckSource    = "source"
+	HealthCheckConsole   = "console"
+)
+
+// The actions that can be taken once a server fails too many health checks.
+const (
+	HealthActionRestart = "restart"
+	HealthActionKill    = "kill"
+)
+
+// The status values reported for the health of a server.
+const (
+	HealthDisabled  = "disabled"
+	HealthInactive  = "inactive"
+	HealthStarting  = "starting"
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+)
+
+// HealthCheck defines how the daemon checks that a running server is responsive.
+// It can be provided for an Egg, and overridden for a single server.
+type HealthCheck struct {
+	// Type is one of "tcp", "minecraft", "source" or "console".
+	Type string `json:"type"`
+
+	// Port is the port to check, if it differs from the default allocation.
+	Port int `json:"port,omitempty"`
+
+	// Pattern is the regular expression that console output must match for a
+	// console check to pass. A line matching it must be seen between each check.
+	Pattern string `json:"pattern,omitempty"`
+
+	// Command is sent to the console before each interval of a console check, to
+	// prompt the server to output a line matching the pattern.
+	Command string `json:"command,omitempty"`
+
+	// Interval is the number of seconds between checks, and Timeout the number of
+	// seconds a single check may take.
+	Interval int `json:"interval,omitempty"`
+	Timeout  int `json:"timeout,omitempty"`
+
+	// GracePeriod is the number of seconds after the server is running before the
+	// first check is performed.
+	GracePeriod int `json:"grace_period,omitempty"`
+
+	// Failures is the number of consecutive failed checks before Action, either
+	// "restart" or "kill", is taken.
+	Failures int    `json:"failures,omitempty"`
+	Action   string `json:"action,omitempty"`
+}
+
+// withDefaults returns a copy of the health check with any missing values set.
+func (hc HealthCheck) withDefaults() HealthCheck {
+	if hc.Interval <= 0 {
+		hc.Interval = 30
+	}
+	if hc.Timeout <= 0 {
+		hc.Timeout = 5
+	}
+	if hc.GracePeriod <= 0 {
+		hc.GracePeriod = 60
+	}
+	if hc.Failures <= 0 {
+		hc.Failures = 3
+	}
+	if hc.Action == "" {
+		hc.Action = HealthActionRestart
+	}
+	return hc
+}
+
+// Validate checks that the health check can be performed.
+func (hc HealthCheck) Validate() error {
+	switch hc.Type {
+	case HealthCheckTCP, HealthCheckMinecraft, HealthCheckSource:
+	case HealthCheckConsole:
+		if hc.Pattern == "" {
+			return errors.New("server: console health checks require a pattern")
+		}
+		if _, err := regexp.Compile(hc.Pattern); err != nil {
+			return errors.Wrap(err, "server: invalid health check pattern")
+		}
+	default:
+		return errors.Errorf("server: unknown health check type %q", hc.Type)
+	}
+	if hc.Action != "" && hc.Action != HealthActionRestart && hc.Action != HealthActionKill {
+		return errors.Errorf("server: unknown health check action %q", hc.Action)
+	}
+	return nil
+}
+
+// HealthStatus is the current health of a server as determined by its health
+// check.
+type HealthStatus struct {
+	Status    string     `json:"status"`
+	Type      string     `json:"type,omitempty"`
+	Failures  int        `json:"failures"`
+	LastCheck *time.Time `json:"last_check,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// healthMonitor runs the health checks for a server while it is running.
+type healthMonitor struct {
+	mu        sync.Mutex
+	cancel    context.CancelFunc
+	status    HealthStatus
+	pattern   *regexp.Regexp
+	heartbeat time.Time
+}
+
+// observe records a heartbeat if the console line matches the pattern of a
+// console health check.
+func (hm *healthMonitor) observe(line []byte) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	if hm.pattern != nil && hm.pattern.Match(line) {
+		hm.heartbeat = time.Now()
+	}
+}
+
+// HealthCheck returns the health check configured for the server, preferring
+// one set for the server itself over the one provided by the Egg.
+func (s *Server) HealthCheck() *HealthCheck {
+	cfg := s.Config()
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	if cfg.HealthCheck != nil && cfg.HealthCheck.Type != "" {
+		hc := *cfg.HealthCheck
+		return &hc
+	}
+	if cfg.Egg.HealthCheck != nil && cfg.Egg.HealthCheck.Type != "" {
+		hc := *cfg.Egg.HealthCheck
+		return &hc
+	}
+	return nil
+}
+
+// Health returns the current health status of the server.
+func (s *Server) Health() HealthStatus {
+	s.health.mu.Lock()
+	defer s.health.mu.Unlock()
+	if s.health.status.Status == "" {
+		if s.HealthCheck() == nil {
+			return HealthStatus{Status: HealthDisabled}
+		}
+		return HealthStatus{Status: HealthInactive}
+	}
+	return s.health.status
+}
+
+// startHealthChecks begins checking the health of the server, this is called
+// once the server reaches the running state.
+func (s *Server) startHealthChecks() {
+	hc := s.HealthCheck()
+
+	hm := &s.health
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	if hm.cancel != nil {
+		return
+	}
+	if hc == nil {
+		hm.status = HealthStatus{Status: HealthDisabled}
+		return
+	}
+	if err := hc.Validate(); err != nil {
+		s.Log().WithField("error", err).Warn("server has an invalid health check configured, not checking health")
+		hm.status = HealthStatus{Status: HealthDisabled, Type: hc.Type, LastError: err.Error()}
+		return
+	}
+
+	check := hc.withDefaults()
+	hm.pattern = nil
+	if check.Type == HealthCheckConsole {
+		hm.pattern = regexp.MustCompile(check.Pattern)
+	}
+	ctx, cancel := context.WithCancel(s.Context())
+	hm.cancel = cancel
+	hm.heartbeat = time.Now()
+	hm.status = HealthStatus{Status: HealthStarting, Type: check.Type}
+	go s.runHealthChecks(ctx, check)
+}
+
+// stopHealthChecks stops checking the health of the server, this is called when
+// the server is stopped.
+func (s *Server) stopHealthChecks() {
+	hm := &s.health
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	if hm.cancel != nil {
+		hm.cancel()
+		hm.cancel = nil
+	}
+	hm.pattern = nil
+	if hm.status.Status != "" && hm.status.Status != HealthDisabled {
+		hm.status.Status = HealthInactive
+	}
+}
+
+// runHealthChecks performs a health check at the configured interval until the
+// context is cancelled, taking the configured action once the server has failed
+// too many checks in a row.
+func (s *Server) runHealthChecks(ctx context.Context, hc HealthCheck) {
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(time.Duration(hc.GracePeriod) * time.Second):
+	}
+
+	last := time.Now()
+	s.sendHealthCommand(hc)
+
+	ticker := time.NewTicker(time.Duration(hc.Interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := s.probeHealth(ctx, hc, last)
+		if ctx.Err() != nil {
+			return
+		}
+		last = time.Now()
+
+		status, changed := s.recordHealth(hc, err, last)
+		if changed {
+			s.Events().Publish(HealthEvent, status)
+		}
+		if status.Failures >= hc.Failures {
+			s.recoverUnhealthy(hc, status)
+			return
+		}
+		s.sendHealthCommand(hc)
+	}
+}
+
+// sendHealthCommand sends the command for a console health check.
+func (s *Server) sendHealthCommand(hc HealthCheck) {
+	if hc.Type != HealthCheckConsole || hc.Command == "" {
+		return
+	}
+	if err := s.Environment.SendCommand(hc.Command); err != nil {
+		s.Log().WithField("error", err).Debug("failed to send health check command to server")
+	}
+}
+
+// probeHealth performs a single health check, returning an error if it failed.
+// For console checks the check passes if a heartbeat was seen after since.
+func (s *Server) probeHealth(ctx context.Context, hc HealthCheck, since time.Time) error {
+	if hc.Type == HealthCheckConsole {
+		s.health.mu.Lock()
+		heartbeat := s.health.heartbeat
+		s.health.mu.Unlock()
+		if heartbeat.Before(since) {
+			return errors.New("no console output matching the health check pattern was seen")
+		}
+		return nil
+	}
+
+	address, ok := s.localAddress(hc.Port)
+	if !ok {
+		return errors.New("server does not have a default allocation to check")
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(hc.Timeout)*time.Second)
+	defer cancel()
+
+	switch hc.Type {
+	case HealthCheckTCP:
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case HealthCheckMinecraft, HealthCheckSource:
+		_, err := query.Query(ctx, query.Protocol(hc.Type), address)
+		return err
+	}
+	return errors.Errorf("unknown health check type %q", hc.Type)
+}
+
+// recordHealth updates the health status with the result of a check, returning
+// the new status and whether the health of the server changed.
+func (s *Server) recordHealth(hc HealthCheck, err error, now time.Time) (HealthStatus, bool) {
+	s.health.mu.Lock()
+	defer s.health.mu.Unlock()
+
+	st := &s.health.status
+	previous := st.Status
+	st.LastCheck = &now
+	if err != nil {
+		st.Failures++
+		st.LastError = err.Error()
+		st.Status = HealthUnhealthy
+		s.Log().WithField("failures", st.Failures).WithField("error", err).Debug("server failed health check")
+	} else {
+		st.Failures = 0
+		st.LastError = ""
+		st.Status = HealthHealthy
+	}
+	return *st, previous != st.Status
+}
+
+// recoverUnhealthy takes the configured action for a server that has failed too
+// many health checks in a row. The server is killed rather than stopped since a
+// hung process is unlikely to respond to the stop command.
+func (s *Server) recoverUnhealthy(hc HealthCheck, status HealthStatus) {
+	s.Log().WithField("failures", status.Failures).WithField("action", hc.Action).Warn("server failed consecutive health checks, taking recovery action")
+	s.PublishConsoleOutputFromDaemon(fmt.Sprintf("Server failed %d consecutive health checks (%s), performing %s.", status.Failures, status.LastError, hc.Action))
+	s.SaveActivity(s.NewRequestActivity("", "127.0.0.1"), ActivityServerUnhealthy, models.ActivityMeta{
+		"failures": status.Failures,
+		"error":    status.LastError,
+		"action":   hc.Action,
+	})
+	s.notifyWebhooks(WebhookEventUnhealthy, map[string]interface{}{
+		"failures": status.Failures,
+		"error":    status.LastError,
+		"action":   hc.Action,
+	})
+
+	if err := s.HandlePowerAction(PowerActionTerminate); err != nil {
+		s.Log().WithField("error", err).Error("failed to kill unhealthy server")
+		return
+	}
+	if hc.Action != HealthActionRestart {
+		return
+	}
+	if err := s.HandlePowerAction(PowerActionStart, 30); err != nil {
+		s.Log().WithField("error", err).Error("failed to restart unhealthy server")
+	}
+}
+
+// localAddress returns the address used to reach the server from the daemon,
+// using the default allocation unless a port is given. Allocations bound to
+// every interface are reached through the loopback address.
+func (s *Server) localAddress(port int) (string, bool) {
+	mapping := s.Config().Allocations.DefaultMapping
+	if mapping == nil {
+		return "", false
+	}
+	host := mapping.Ip
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	if port <= 0 {
+		port = mapping.Port
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port)), true
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+)
+
+func TestHealthCheck(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("HealthCheck", func() {
+		g.It("sets defaults for missing values", func() {
+			hc := HealthCheck{Type: HealthCheckTCP, Interval: 10}.withDefaults()
+			g.Assert(hc.Interval).Equal(10)
+			g.Assert(hc.Timeout).Equal(5)
+			g.Assert(hc.GracePeriod).Equal(60)
+			g.Assert(hc.Failures).Equal(3)
+			g.Assert(hc.Action).Equal(HealthActionRestart)
+		})
+
+		g.It("validates the check configuration", func() {
+			g.Assert(HealthCheck{Type: HealthCheckMinecraft}.Validate()).IsNil()
+			g.Assert(HealthCheck{Type: HealthCheckConsole, Pattern: "^pong$"}.Validate()).IsNil()
+			g.Assert(HealthCheck{Type: "http"}.Validate() != nil).IsTrue()
+			g.Assert(HealthCheck{Type: HealthCheckConsole}.Validate() != nil).IsTrue()
+			g.Assert(HealthCheck{Type: HealthCheckConsole, Pattern: "("}.Validate() != nil).IsTrue()
+			g.Assert(HealthCheck{Type: HealthCheckTCP, Action: "reboot"}.Validate() != nil).IsTrue()
+		})
+
+		g.It("prefers the server health check over the egg", func() {
+			s, err := New(nil)
+			g.Assert(err).IsNil()
+			g.Assert(s.HealthCheck() == nil).IsTrue()
+			g.Assert(s.Health().Status).Equal(HealthDisabled)
+
+			s.cfg.Egg.HealthCheck = &HealthCheck{Type: HealthCheckTCP}
+			g.Assert(s.HealthCheck().Type).Equal(HealthCheckTCP)
+			g.Assert(s.Health().Status).Equal(HealthInactive)
+
+			s.cfg.HealthCheck = &HealthCheck{Type: HealthCheckSource}
+			g.Assert(s.HealthCheck().Type).Equal(HealthCheckSource)
+		})
+	})
+
+	g.Describe("healthMonitor", func() {
+		g.It("records a heartbeat for matching console output", func() {
+			s, err := New(nil)
+			g.Assert(err).IsNil()
+			hc := HealthCheck{Type: HealthCheckConsole}
+			since := time.Now()
+
+			s.health.observe([]byte("pong"))
+			g.Assert(s.probeHealth(context.Background(), hc, since) != nil).IsTrue()
+
+			s.health.pattern = regexp.MustCompile("^pong$")
+			s.health.observe([]byte("ping"))
+			g.Assert(s.probeHealth(context.Background(), hc, since) != nil).IsTrue()
+			s.health.observe([]byte("pong"))
+			g.Assert(s.probeHealth(context.Background(), hc, since)).IsNil()
+		})
+
+		g.It("counts consecutive failures", func() {
+			s, err := New(nil)
+			g.Assert(err).IsNil()
+			hc := HealthCheck{Type: HealthCheckTCP}
+
+			st, changed := s.recordHealth(hc, errors.New("refused"), time.Now())
+			g.Assert(changed).IsTrue()
+			g.Assert(st.Failures).Equal(1)
+			st, changed = s.recordHealth(hc, errors.New("refused"), time.Now())
+			g.Assert(changed).IsFalse()
+			g.Assert(st.Failures).Equal(2)
+			g.Assert(st.Status).Equal(HealthUnhealthy)
+
+			st, changed = s.recordHealth(hc, nil, time.Now())
+			g.Assert(changed).IsTrue()
+			g.Assert(st.Failures).Equal(0)
+			g.Assert(st.Status).Equal(HealthHealthy)
+			g.Assert(st.LastError).Equal("")
+		})
+	})
+}
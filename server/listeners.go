@@ -71,6 +71,10 @@ func (s *Server) processConsoleOutputEvent(v []byte) {
 	// the console sending logic.
 	go s.onConsoleOutput(v)
 
+	// Persist the output before any throttling is applied so that the transcript
+	// always contains the complete console history for the server.
+	s.writeTranscript(v)
+
 	// If the console is being throttled, do nothing else with it, we don't want
 	// to waste time. This code previously terminated server instances after violating
 	// different throttle limits. That code was clunky and difficult to reason about,
@@ -95,6 +99,7 @@ func (s *Server) StartEventListeners() {
 	s.Log().Debug("registering event listeners: console, state, resources...")
 	s.Environment.Events().On(c)
 	s.Environment.SetLogCallback(s.processConsoleOutputEvent)
+	s.listenForWebhookEvents()
 
 	go func() {
 		for {
@@ -117,6 +122,8 @@ func (s *Server) StartEventListeners() {
 								return
 							}
 							s.resources.UpdateStats(stats.Data)
+							s.recordStatsHistory(stats.Data)
+							s.recordTraffic(stats.Data.Network)
 							// If there is no disk space available at this point, trigger the server
 							// disk limiter logic which will start to stop the running instance.
 							if !s.Filesystem().HasSpaceAvailable(true) {
@@ -166,6 +173,9 @@ func (s *Server) onConsoleOutput(data []byte) {
 	v := make([]byte, len(data))
 	copy(v, data)
 
+	// Record a heartbeat for the console health check, if one is configured.
+	s.health.observe(v)
+
 	// Check if the server is currently starting.
 	if s.Environment.State() == environment.ProcessStartingState {
 		// Check if we should strip ansi color codes.
@@ -192,6 +202,9 @@ func (s *Server) onConsoleOutput(data []byte) {
 		}
 	}
 
+	// Run the output through any user defined triggers for the server.
+	s.evaluateTriggers(v)
+
 	// Check if this Egg has Features configured that we need to listen for.
 	if EggConfiguration != nil {
 		// Check if we should strip ansi color codes.
@@ -43,7 +43,9 @@ func NewManager(ctx context.Context, client remote.Client) (*Manager, error) {
 // loading any of the servers from the disk. This allows the caller to set their
 // own servers into the collection as needed.
 func NewEmptyManager(client remote.Client) *Manager {
-	return &Manager{client: client}
+	m := &Manager{client: client}
+	admission.setServers(m.All)
+	return m
 }
 
 // Client returns the HTTP client interface that allows interaction with the
@@ -135,6 +137,8 @@ func (m *Manager) Remove(filter func(match *Server) bool) {
 	for _, v := range m.servers {
 		if !filter(v) {
 			r = append(r, v)
+		} else {
+			v.releaseCpuPlacement()
 		}
 	}
 	m.servers = r
@@ -235,6 +239,12 @@ func (m *Manager) InitServer(data remote.ServerConfigurationResponse) (*Server,
 		}
 	}
 
+	// The environment is required to find the threads currently in use by the
+	// container, so threads can only be placed once it has been created.
+	if config.Get().Docker.AutoCpuPlacement() {
+		s.Environment.Config().SetLimits(s.placedLimits())
+	}
+
 	// If the server's data directory exists, force disk usage calculation.
 	if _, err := os.Stat(s.Filesystem().Path()); err == nil {
 		s.Filesystem().HasSpaceAvailable(true)
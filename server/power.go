@@ -63,6 +63,17 @@ func (s *Server) HandlePowerAction(action PowerAction, waitSeconds ...int) error
 		return ErrServerIsInstalling
 	}
 
+	// Any power action supersedes a delayed restart that is waiting to be performed
+	// after the server crashed.
+	s.crasher.CancelPendingRestart()
+
+	// Stopping a server that is waiting in the start queue removes it from the
+	// queue, otherwise the stop could not acquire the lock until the start had
+	// either been admitted or timed out.
+	if !action.IsStart() {
+		admission.cancel(s.ID())
+	}
+
 	lockId, _ := uuid.NewUUID()
 	log := s.Log().WithField("lock_id", lockId.String()).WithField("action", action)
 
@@ -130,6 +141,7 @@ func (s *Server) HandlePowerAction(action PowerAction, waitSeconds ...int) error
 		if err := s.onBeforeStart(); err != nil {
 			return err
 		}
+		defer admission.release(s.ID())
 
 		return s.Environment.Start(s.Context())
 	case PowerActionStop:
@@ -157,6 +169,7 @@ func (s *Server) HandlePowerAction(action PowerAction, waitSeconds ...int) error
 		if err := s.onBeforeStart(); err != nil {
 			return err
 		}
+		defer admission.release(s.ID())
 
 		return s.Environment.Start(s.Context())
 	case PowerActionTerminate:
@@ -174,6 +187,9 @@ func (s *Server) onBeforeStart() error {
 		return errors.WithMessage(err, "unable to sync server data from Panel instance")
 	}
 
+	// The server is being started again, so it is no longer considered crashed.
+	s.crasher.SetCrashed(false)
+
 	// Disallow start & restart if the server is suspended. Do this check after performing a sync
 	// action with the Panel to ensure that we have the most up-to-date information for that server.
 	if s.IsSuspended() {
@@ -214,6 +230,13 @@ func (s *Server) onBeforeStart() error {
 		}
 	}
 
+	// Wait until the node has enough memory available to run the server. This is
+	// done last so that the memory is only reserved once the server is about to
+	// start, and uses the memory limit from the sync above.
+	if err := admission.admit(s.Context(), s); err != nil {
+		return err
+	}
+
 	s.Log().Info("completed server preflight, starting boot process...")
 	return nil
 }
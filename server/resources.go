@@ -24,6 +24,10 @@ type ResourceUsage struct {
 	// at all times. It is "manually" set whenever server.Proc() is called. This is kind of just a
 	// hacky solution for now to avoid passing events all over the place.
 	Disk int64 `json:"disk_bytes"`
+
+	// The network traffic used by the server during the current month, this is
+	// kept across restarts of both the server and the daemon.
+	Traffic TrafficUsage `json:"traffic"`
 }
 
 // Proc returns the current resource usage stats for the server instance. This returns
@@ -34,6 +38,7 @@ func (s *Server) Proc() ResourceUsage {
 	defer s.resources.mu.Unlock()
 	// Store the updated disk usage when requesting process usage.
 	atomic.StoreInt64(&s.resources.Disk, s.Filesystem().CachedUsage())
+	s.resources.Traffic = s.Traffic()
 	//goland:noinspection GoVetCopyLock
 	return s.resources
 }
@@ -45,6 +50,13 @@ func (ru *ResourceUsage) UpdateStats(stats environment.Stats) {
 	ru.mu.Unlock()
 }
 
+// Snapshot returns a copy of the most recent environment stats for the server.
+func (ru *ResourceUsage) Snapshot() environment.Stats {
+	ru.mu.RLock()
+	defer ru.mu.RUnlock()
+	return ru.Stats
+}
+
 // Reset resets the usages values to zero, used when a server is stopped to ensure we don't hold
 // onto any values incorrectly.
 func (ru *ResourceUsage) Reset() {
@@ -56,6 +68,7 @@ func (ru *ResourceUsage) Reset() {
 	ru.Uptime = 0
 	ru.Network.TxBytes = 0
 	ru.Network.RxBytes = 0
+	ru.Io = environment.IoStats{}
 }
 
 
@@ -24,6 +24,7 @@ import (
 	"github.com/priyxstudio/propel/events"
 	"github.com/priyxstudio/propel/remote"
 	"github.com/priyxstudio/propel/server/filesystem"
+	"github.com/priyxstudio/propel/server/transcript"
 	"github.com/priyxstudio/propel/system"
 )
 
@@ -73,6 +74,25 @@ type Server struct {
 	throttleOnce sync.Once
 	sftpBag      *system.ContextBag
 
+	// The transcript writer used to persist console output to the disk.
+	transcript     *transcript.Writer
+	transcriptOnce sync.Once
+
+	// The console triggers configured for the server.
+	triggers triggerSet
+
+	// The graceful stop countdown currently running for the server.
+	graceful gracefulStop
+
+	// The health checks being performed while the server is running.
+	health healthMonitor
+
+	// The resource usage samples awaiting storage in the stats history.
+	statsHistory statsHistory
+
+	// The network traffic used by the server during the current month.
+	traffic trafficCounter
+
 	// Tracks open websocket connections for the server.
 	wsBag       *WebsocketBag
 	wsBagLocker sync.Mutex
@@ -119,6 +139,9 @@ func (s *Server) CleanupForDestroy() {
 	s.DestroyAllSinks()
 	s.Websockets().CancelAll()
 	s.powerLock.Destroy()
+	if err := s.Transcript().Close(); err != nil {
+		s.Log().WithField("error", err).Warn("failed to close console transcript")
+	}
 }
 
 // ID returns the UUID for the server instance.
@@ -308,6 +331,13 @@ func (s *Server) ReadLogfile(len int) ([]string, error) {
 	return s.Environment.Readlog(len)
 }
 
+// LogHistory returns the console history for the server environment if the
+// environment supports paging through it.
+func (s *Server) LogHistory() (environment.LogHistory, bool) {
+	h, ok := s.Environment.(environment.LogHistory)
+	return h, ok
+}
+
 // Initializes a server instance. This will run through and ensure that the environment
 // for the server is setup, and that all of the necessary files are created.
 func (s *Server) CreateEnvironment() error {
@@ -382,10 +412,22 @@ func (s *Server) OnStateChange() {
 		s.Events().Publish(StatusEvent, st)
 	}
 
+	// Health checks are only performed while the server is running.
+	switch st {
+	case environment.ProcessRunningState:
+		s.startHealthChecks()
+	case environment.ProcessStoppingState, environment.ProcessOfflineState:
+		s.stopHealthChecks()
+	}
+
 	// Reset the resource usage to 0 when the process fully stops so that all the UI
 	// views in the Panel correctly display 0.
+	var lastStats environment.Stats
 	if st == environment.ProcessOfflineState {
+		lastStats = s.resources.Snapshot()
 		s.resources.Reset()
+		s.resetTrafficCounters()
+		admission.broadcast()
 		s.Events().Publish(StatsEvent, s.Proc())
 	}
 
@@ -401,7 +443,7 @@ func (s *Server) OnStateChange() {
 		s.Log().Info("detected server as entering a crashed state; running crash handler")
 
 		go func(server *Server) {
-			if err := server.handleServerCrash(); err != nil {
+			if err := server.handleServerCrash(lastStats); err != nil {
 				if IsTooFrequentCrashError(err) {
 					server.Log().Info("did not restart server after crash; occurred too soon after the last")
 				} else {
@@ -436,6 +478,8 @@ func (s *Server) IsRunning() bool {
 type APIResponse struct {
 	State         string        `json:"state"`
 	IsSuspended   bool          `json:"is_suspended"`
+	IsCrashed     bool          `json:"is_crashed"`
+	Health        HealthStatus  `json:"health"`
 	Utilization   ResourceUsage `json:"utilization"`
 	Configuration Configuration `json:"configuration"`
 }
@@ -446,6 +490,8 @@ func (s *Server) ToAPIResponse() APIResponse {
 	return APIResponse{
 		State:         s.Environment.State(),
 		IsSuspended:   s.IsSuspended(),
+		IsCrashed:     s.IsCrashed(),
+		Health:        s.Health(),
 		Utilization:   s.Proc(),
 		Configuration: *s.Config(),
 	}
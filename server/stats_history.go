@@ -0,0 +1,188 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"gorm.io/gorm/clause"
+
+	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/environment"
+	"github.com/priyxstudio/propel/internal/database"
+	"github.com/priyxstudio/propel/internal/models"
+)
+
+// The resolutions, in seconds, at which the resource usage history of a server
+// is stored.
+const (
+	StatsResolutionSecond = 1
+	StatsResolutionMinute = 60
+	StatsResolutionHour   = 3600
+)
+
+var statsResolutions = [...]int{StatsResolutionSecond, StatsResolutionMinute, StatsResolutionHour}
+
+// The maximum number of completed samples held in memory for a server while
+// waiting to be written to the database. If writes are failing the oldest
+// samples are dropped rather than allowing this to grow forever.
+const maxPendingStatsSamples = 3600
+
+// StatsSamples returns the number of samples kept for the given resolution.
+func StatsSamples(resolution int) int {
+	cfg := config.Get().System.StatsHistory
+	switch resolution {
+	case StatsResolutionSecond:
+		return cfg.SecondSamples
+	case StatsResolutionMinute:
+		return cfg.MinuteSamples
+	case StatsResolutionHour:
+		return cfg.HourSamples
+	}
+	return 0
+}
+
+// statsBucket accumulates the stats reported for a server during a single
+// period of a resolution.
+type statsBucket struct {
+	start  int64
+	n      int
+	cpu    float64
+	memory float64
+	last   environment.Stats
+	disk   int64
+}
+
+func (b *statsBucket) add(stats environment.Stats, disk int64) {
+	b.n++
+	b.cpu += stats.CpuAbsolute
+	b.memory += float64(stats.Memory)
+	b.last = stats
+	b.disk = disk
+}
+
+func (b *statsBucket) sample(resolution int) models.StatsSample {
+	return models.StatsSample{
+		Resolution:  resolution,
+		Timestamp:   time.Unix(b.start, 0).UTC(),
+		CpuAbsolute: b.cpu / float64(b.n),
+		Memory:      uint64(b.memory / float64(b.n)),
+		MemoryLimit: b.last.MemoryLimit,
+		Network:     b.last.Network,
+		Disk:        b.disk,
+	}
+}
+
+// statsHistory downsamples the stats reported for a server into each of the
+// stored resolutions. Completed samples are held until they are flushed to the
+// database.
+type statsHistory struct {
+	mu      sync.Mutex
+	buckets [len(statsResolutions)]statsBucket
+	pending []models.StatsSample
+}
+
+// record adds the reported stats to the bucket for each resolution. Any bucket
+// for a period that has ended is converted into a sample awaiting a flush.
+func (sh *statsHistory) record(stats environment.Stats, disk int64, now time.Time) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	for i, resolution := range statsResolutions {
+		b := &sh.buckets[i]
+		start := now.Unix() / int64(resolution) * int64(resolution)
+		if b.n > 0 && b.start != start {
+			sh.pending = append(sh.pending, b.sample(resolution))
+			*b = statsBucket{}
+		}
+		b.start = start
+		b.add(stats, disk)
+	}
+
+	if len(sh.pending) > maxPendingStatsSamples {
+		sh.pending = sh.pending[len(sh.pending)-maxPendingStatsSamples:]
+	}
+}
+
+// drain returns the completed samples and clears them from the history.
+func (sh *statsHistory) drain() []models.StatsSample {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	p := sh.pending
+	sh.pending = nil
+	return p
+}
+
+// recordStatsHistory records the stats reported by the environment into the
+// resource usage history for the server.
+func (s *Server) recordStatsHistory(stats environment.Stats) {
+	if !config.Get().System.StatsHistory.Enabled {
+		return
+	}
+	s.statsHistory.record(stats, s.Filesystem().CachedUsage(), time.Now())
+}
+
+// FlushStatsHistory writes the completed resource usage samples for the server
+// to the database. Each sample is written into the ring buffer slot for its
+// timestamp, replacing the sample that was previously stored in it.
+func (s *Server) FlushStatsHistory() error {
+	samples := s.statsHistory.drain()
+	if len(samples) == 0 {
+		return nil
+	}
+
+	rows := make([]models.StatsSample, 0, len(samples))
+	for _, sample := range samples {
+		n := int64(StatsSamples(sample.Resolution))
+		if n <= 0 {
+			continue
+		}
+		sample.ServerUUID = s.ID()
+		sample.Slot = (sample.Timestamp.Unix() / int64(sample.Resolution)) % n
+		rows = append(rows, sample)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	err := database.Instance().Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(rows, 500).Error
+	return errors.Wrap(err, "failed to save stats history")
+}
+
+// StatsHistory returns the resource usage samples stored for the server at the
+// given resolution between the two times provided, oldest first.
+func (s *Server) StatsHistory(resolution int, from time.Time, to time.Time) ([]models.StatsSample, error) {
+	var samples []models.StatsSample
+	if err := database.Instance().
+		Where("server_uuid = ? AND resolution = ? AND timestamp >= ? AND timestamp <= ?", s.ID(), resolution, from.UTC(), to.UTC()).
+		Order("timestamp ASC").
+		Find(&samples).Error; err != nil {
+		return nil, errors.Wrap(err, "failed to fetch stats history")
+	}
+	return samples, nil
+}
+
+// DeleteAllStatsHistory removes the stored resource usage history for the
+// server, this is used when the server is being deleted from the node.
+func (s *Server) DeleteAllStatsHistory() error {
+	s.statsHistory.drain()
+	if err := database.Instance().Where("server_uuid = ?", s.ID()).Delete(&models.StatsSample{}).Error; err != nil {
+		return errors.Wrap(err, "failed to delete stats history")
+	}
+	return nil
+}
+
+// PruneStatsHistory removes any samples that are older than the retention for
+// their resolution. Samples are normally overwritten in place, but this catches
+// those left behind when the retention is reduced or a server stops reporting
+// stats for a long period of time.
+func PruneStatsHistory() error {
+	db := database.Instance()
+	for _, resolution := range statsResolutions {
+		cutoff := time.Now().Add(-time.Duration(StatsSamples(resolution)*resolution) * time.Second).UTC()
+		if err := db.Where("resolution = ? AND timestamp < ?", resolution, cutoff).Delete(&models.StatsSample{}).Error; err != nil {
+			return errors.Wrap(err, "failed to prune stats history")
+		}
+	}
+	return nil
+}
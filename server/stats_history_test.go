@@ -0,0 +1,52 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+
+	"github.com/priyxstudio/propel/environment"
+)
+
+func TestStatsHistory(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("statsHistory", func() {
+		start := time.Unix(3600*24, 0)
+
+		g.It("does not emit a sample until the period has ended", func() {
+			var sh statsHistory
+			sh.record(environment.Stats{Memory: 100}, 0, start)
+			g.Assert(len(sh.drain())).Equal(0)
+		})
+
+		g.It("averages the stats reported within a period", func() {
+			var sh statsHistory
+			sh.record(environment.Stats{Memory: 100, CpuAbsolute: 10}, 5, start)
+			sh.record(environment.Stats{Memory: 300, CpuAbsolute: 30}, 7, start.Add(time.Millisecond*500))
+			sh.record(environment.Stats{Memory: 50}, 9, start.Add(time.Second))
+
+			samples := sh.drain()
+			g.Assert(len(samples)).Equal(1)
+			g.Assert(samples[0].Resolution).Equal(StatsResolutionSecond)
+			g.Assert(samples[0].Timestamp.Equal(start)).IsTrue()
+			g.Assert(samples[0].Memory).Equal(uint64(200))
+			g.Assert(samples[0].CpuAbsolute).Equal(float64(20))
+			g.Assert(samples[0].Disk).Equal(int64(7))
+			g.Assert(len(sh.drain())).Equal(0)
+		})
+
+		g.It("emits a sample for every resolution whose period has ended", func() {
+			var sh statsHistory
+			sh.record(environment.Stats{Memory: 100}, 0, start)
+			sh.record(environment.Stats{Memory: 100}, 0, start.Add(time.Hour))
+
+			samples := sh.drain()
+			g.Assert(len(samples)).Equal(3)
+			g.Assert(samples[0].Resolution).Equal(StatsResolutionSecond)
+			g.Assert(samples[1].Resolution).Equal(StatsResolutionMinute)
+			g.Assert(samples[2].Resolution).Equal(StatsResolutionHour)
+		})
+	})
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"gorm.io/gorm/clause"
+
+	"github.com/priyxstudio/propel/environment"
+	"github.com/priyxstudio/propel/internal/database"
+	"github.com/priyxstudio/propel/internal/models"
+)
+
+const trafficMonthLayout = "2006-01"
+
+// TrafficUsage is the network traffic of a server during the current calendar
+// month in UTC.
+type TrafficUsage struct {
+	Month   string `json:"month"`
+	RxBytes uint64 `json:"rx_bytes"`
+	TxBytes uint64 `json:"tx_bytes"`
+}
+
+// trafficCounter accumulates the network traffic of a server over the current
+// month. The counters reported by the environment reset whenever the container
+// restarts, so only the growth between two reports is added to the total.
+type trafficCounter struct {
+	mu     sync.Mutex
+	loaded bool
+	dirty  bool
+	month  string
+	total  environment.NetworkStats
+	last   environment.NetworkStats
+
+	// The final totals of a month that ended before they were saved.
+	previous *models.NetworkTraffic
+}
+
+// counterDelta returns the growth of a counter since it was last reported. If
+// the counter is lower than before it has been reset, so all of it is new.
+func counterDelta(cur uint64, last uint64) uint64 {
+	if cur < last {
+		return cur
+	}
+	return cur - last
+}
+
+// add records the counters reported by the environment, moving on to a new
+// total once the month changes. This must be called while holding the lock.
+func (tc *trafficCounter) add(n environment.NetworkStats, month string) {
+	tc.rollover(month)
+	tc.total.RxBytes += counterDelta(n.RxBytes, tc.last.RxBytes)
+	tc.total.TxBytes += counterDelta(n.TxBytes, tc.last.TxBytes)
+	tc.last = n
+	tc.dirty = true
+}
+
+// rollover starts a new total if the month has changed, keeping the totals of
+// the month that ended until they are saved. This must be called while holding
+// the lock.
+func (tc *trafficCounter) rollover(month string) {
+	if tc.month == month {
+		return
+	}
+	if tc.month != "" && tc.dirty {
+		tc.previous = &models.NetworkTraffic{Month: tc.month, RxBytes: tc.total.RxBytes, TxBytes: tc.total.TxBytes}
+	}
+	tc.month = month
+	tc.total = environment.NetworkStats{}
+}
+
+// lockTraffic acquires the traffic counter lock, loading the totals for the
+// current month from the database the first time it is used.
+func (s *Server) lockTraffic(month string) *trafficCounter {
+	tc := &s.traffic
+	tc.mu.Lock()
+	if tc.loaded {
+		return tc
+	}
+
+	// Mark the totals as loaded even if there is an error, otherwise a database
+	// failure would result in a query for every stats report.
+	tc.loaded = true
+	var row models.NetworkTraffic
+	tx := database.Instance().Where("server_uuid = ? AND month = ?", s.ID(), month).Limit(1).Find(&row)
+	if tx.Error != nil {
+		s.Log().WithField("error", tx.Error).Error("failed to load network traffic")
+		return tc
+	}
+	if tx.RowsAffected > 0 {
+		tc.month = month
+		tc.total = environment.NetworkStats{RxBytes: row.RxBytes, TxBytes: row.TxBytes}
+		tc.last = environment.NetworkStats{RxBytes: row.LastRxBytes, TxBytes: row.LastTxBytes}
+	}
+	return tc
+}
+
+// recordTraffic adds the network counters reported by the environment to the
+// traffic totals for the server.
+func (s *Server) recordTraffic(n environment.NetworkStats) {
+	month := time.Now().UTC().Format(trafficMonthLayout)
+	tc := s.lockTraffic(month)
+	defer tc.mu.Unlock()
+	tc.add(n, month)
+}
+
+// resetTrafficCounters is called when the server process stops, since the
+// counters reported by the next container will start again from zero.
+func (s *Server) resetTrafficCounters() {
+	tc := s.lockTraffic(time.Now().UTC().Format(trafficMonthLayout))
+	defer tc.mu.Unlock()
+	tc.last = environment.NetworkStats{}
+	tc.dirty = true
+}
+
+// Traffic returns the network traffic of the server during the current month.
+func (s *Server) Traffic() TrafficUsage {
+	month := time.Now().UTC().Format(trafficMonthLayout)
+	tc := s.lockTraffic(month)
+	defer tc.mu.Unlock()
+	tc.rollover(month)
+	return TrafficUsage{Month: month, RxBytes: tc.total.RxBytes, TxBytes: tc.total.TxBytes}
+}
+
+// FlushTraffic writes the network traffic totals for the server to the database
+// if they have changed since they were last written.
+func (s *Server) FlushTraffic() error {
+	tc := &s.traffic
+	tc.mu.Lock()
+	if !tc.dirty || tc.month == "" {
+		tc.mu.Unlock()
+		return nil
+	}
+	rows := make([]models.NetworkTraffic, 0, 2)
+	if tc.previous != nil {
+		rows = append(rows, *tc.previous)
+	}
+	rows = append(rows, models.NetworkTraffic{
+		Month:       tc.month,
+		RxBytes:     tc.total.RxBytes,
+		TxBytes:     tc.total.TxBytes,
+		LastRxBytes: tc.last.RxBytes,
+		LastTxBytes: tc.last.TxBytes,
+	})
+	previous := tc.previous
+	tc.previous = nil
+	tc.dirty = false
+	tc.mu.Unlock()
+
+	for i := range rows {
+		rows[i].ServerUUID = s.ID()
+	}
+	if err := database.Instance().Clauses(clause.OnConflict{UpdateAll: true}).Create(&rows).Error; err != nil {
+		tc.mu.Lock()
+		tc.dirty = true
+		if tc.previous == nil {
+			tc.previous = previous
+		}
+		tc.mu.Unlock()
+		return errors.Wrap(err, "failed to save network traffic")
+	}
+	return nil
+}
+
+// TrafficHistory returns the network traffic of the server for every month it
+// has been recorded, newest first.
+func (s *Server) TrafficHistory() ([]models.NetworkTraffic, error) {
+	if err := s.FlushTraffic(); err != nil {
+		return nil, err
+	}
+	var rows []models.NetworkTraffic
+	if err := database.Instance().Where("server_uuid = ?", s.ID()).Order("month DESC").Find(&rows).Error; err != nil {
+		return nil, errors.Wrap(err, "failed to fetch network traffic")
+	}
+	return rows, nil
+}
+
+// DeleteAllTraffic removes the recorded network traffic for the server, this is
+// used when the server is being deleted from the node.
+func (s *Server) DeleteAllTraffic() error {
+	tc := &s.traffic
+	tc.mu.Lock()
+	tc.dirty = false
+	tc.previous = nil
+	tc.mu.Unlock()
+	if err := database.Instance().Where("server_uuid = ?", s.ID()).Delete(&models.NetworkTraffic{}).Error; err != nil {
+		return errors.Wrap(err, "failed to delete network traffic")
+	}
+	return nil
+}
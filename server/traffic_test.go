@@ -0,0 +1,46 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+
+	"github.com/priyxstudio/propel/environment"
+)
+
+func TestTrafficCounter(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("trafficCounter", func() {
+		g.It("only counts the growth between reports", func() {
+			var tc trafficCounter
+			tc.add(environment.NetworkStats{RxBytes: 100, TxBytes: 50}, "2024-01")
+			tc.add(environment.NetworkStats{RxBytes: 150, TxBytes: 80}, "2024-01")
+
+			g.Assert(tc.total.RxBytes).Equal(uint64(150))
+			g.Assert(tc.total.TxBytes).Equal(uint64(80))
+		})
+
+		g.It("counts all traffic after the container counters reset", func() {
+			var tc trafficCounter
+			tc.add(environment.NetworkStats{RxBytes: 100, TxBytes: 50}, "2024-01")
+			tc.add(environment.NetworkStats{RxBytes: 20, TxBytes: 10}, "2024-01")
+
+			g.Assert(tc.total.RxBytes).Equal(uint64(120))
+			g.Assert(tc.total.TxBytes).Equal(uint64(60))
+		})
+
+		g.It("keeps the previous month when the month changes", func() {
+			var tc trafficCounter
+			tc.add(environment.NetworkStats{RxBytes: 100, TxBytes: 50}, "2024-01")
+			tc.add(environment.NetworkStats{RxBytes: 130, TxBytes: 60}, "2024-02")
+
+			g.Assert(tc.previous == nil).IsFalse()
+			g.Assert(tc.previous.Month).Equal("2024-01")
+			g.Assert(tc.previous.RxBytes).Equal(uint64(100))
+			g.Assert(tc.month).Equal("2024-02")
+			g.Assert(tc.total.RxBytes).Equal(uint64(30))
+			g.Assert(tc.total.TxBytes).Equal(uint64(10))
+		})
+	})
+}
@@ -0,0 +1,136 @@
+// Package transcript persists the console output of a server to the disk so
+// that it remains available after the server container has been re-created.
+//
+// Each server has its own directory beneath the configured log directory. The
+// active transcript is written to "console.log", and once it grows beyond the
+// configured size it is rotated into a timestamped, gzip compressed file. Old
+// transcripts are removed once they exceed the configured age or file limits.
+package transcript
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"emperror.dev/errors"
+
+	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/internal/rotatelog"
+)
+
+const (
+	// CurrentFile is the name of the transcript file currently being written to.
+	CurrentFile = "console.log"
+
+	rotatedPrefix = "console-"
+)
+
+// ErrInvalidFile is returned when a transcript file name is requested that does
+// not match one written by this package.
+var ErrInvalidFile = errors.Sentinel("transcript: invalid file name")
+
+// File describes a single transcript file on the disk.
+type File = rotatelog.File
+
+// Writer appends console output for a single server to the transcript on the
+// disk, rotating and pruning the files as needed. The zero value is not usable,
+// use New to create an instance.
+type Writer struct {
+	uuid string
+	w    rotatelog.Writer
+}
+
+// New returns a transcript writer for the given server. The underlying file is
+// not opened until the first line of output is written.
+func New(uuid string) *Writer {
+	return &Writer{uuid: uuid}
+}
+
+// Directory returns the directory where transcripts for the server are stored.
+func Directory(uuid string) string {
+	return filepath.Join(config.Get().System.LogDirectory, "console", uuid)
+}
+
+func dir(uuid string) rotatelog.Dir {
+	return rotatelog.Dir{Path: Directory(uuid), Current: CurrentFile, Prefix: rotatedPrefix}
+}
+
+func limits(cfg config.ConsoleTranscripts) rotatelog.Limits {
+	return rotatelog.Limits{MaxSize: cfg.MaxSize, MaxAge: cfg.MaxAge, MaxFiles: cfg.MaxFiles}
+}
+
+// Path returns the path to a transcript file for the server after validating
+// that the name is one that could have been written by this package.
+func Path(uuid string, name string) (string, error) {
+	d := dir(uuid)
+	if !d.IsLogFile(name) {
+		return "", ErrInvalidFile
+	}
+	return filepath.Join(d.Path, name), nil
+}
+
+// List returns all the transcript files for the server, ordered from oldest to
+// newest. The currently active transcript, if any, is always the last entry.
+func List(uuid string) ([]File, error) {
+	return dir(uuid).List()
+}
+
+// Import writes a transcript file, generally one received from another node
+// during a server transfer, into the transcript directory for the server.
+func Import(uuid string, name string, r io.Reader) error {
+	p, err := Path(uuid, name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(Directory(uuid), 0o700); err != nil {
+		return errors.Wrap(err, "transcript: failed to create directory")
+	}
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(f.Close())
+}
+
+// Remove deletes all the transcripts for the server from the disk.
+func Remove(uuid string) error {
+	return errors.WithStack(os.RemoveAll(Directory(uuid)))
+}
+
+// WriteLine appends a single line of console output to the transcript, prefixed
+// with the current time. If transcripts are disabled this is a no-op.
+func (w *Writer) WriteLine(line []byte) error {
+	cfg := config.Get().System.ConsoleTranscripts
+	if !cfg.Enabled {
+		return nil
+	}
+
+	b := make([]byte, 0, len(line)+32)
+	b = time.Now().UTC().AppendFormat(b, time.RFC3339Nano)
+	b = append(b, ' ')
+	b = append(b, line...)
+	b = append(b, '\n')
+	return w.w.Write(dir(w.uuid), limits(cfg), b)
+}
+
+// Rotate closes the current transcript and moves it aside so that a new one is
+// started with the next line of output.
+func (w *Writer) Rotate() error {
+	return w.w.Rotate(dir(w.uuid), limits(config.Get().System.ConsoleTranscripts))
+}
+
+// Close closes the underlying transcript file if it is open.
+func (w *Writer) Close() error {
+	return w.w.Close()
+}
+
+// Prune removes rotated transcripts that are older than the configured maximum
+// age, and then the oldest remaining transcripts beyond the maximum file count.
+func Prune(uuid string) error {
+	return dir(uuid).Prune(limits(config.Get().System.ConsoleTranscripts))
+}
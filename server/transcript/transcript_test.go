@@ -0,0 +1,112 @@
+package transcript
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/priyxstudio/propel/config"
+)
+
+const testUUID = "8a5b7b6e-3b8c-4c1f-9e6b-2f3f4d5e6a7b"
+
+func setupConfig(t *testing.T) {
+	t.Helper()
+	config.Set(&config.Configuration{
+		AuthenticationToken: "abc",
+		System: config.SystemConfiguration{
+			LogDirectory: t.TempDir(),
+			ConsoleTranscripts: config.ConsoleTranscripts{
+				Enabled:  true,
+				MaxSize:  10,
+				MaxFiles: 2,
+			},
+		},
+	})
+}
+
+func TestPath(t *testing.T) {
+	setupConfig(t)
+
+	valid := []string{CurrentFile, "console-20240101T000000.000000000Z.log.gz"}
+	for _, name := range valid {
+		if _, err := Path(testUUID, name); err != nil {
+			t.Errorf("expected %q to be valid, got %v", name, err)
+		}
+	}
+
+	invalid := []string{"", "../console.log", "console-../../etc/passwd.log.gz", "other.log", "console-x/y.log.gz"}
+	for _, name := range invalid {
+		if _, err := Path(testUUID, name); err == nil {
+			t.Errorf("expected %q to be rejected", name)
+		}
+	}
+}
+
+func TestWriterRotateAndPrune(t *testing.T) {
+	setupConfig(t)
+
+	w := New(testUUID)
+	defer w.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := w.WriteLine([]byte("hello world")); err != nil {
+			t.Fatalf("unexpected error writing line: %v", err)
+		}
+		if err := w.Rotate(); err != nil {
+			t.Fatalf("unexpected error rotating: %v", err)
+		}
+		// Rotated names are based on the current time, make sure they never collide.
+		time.Sleep(time.Millisecond)
+	}
+	if err := w.WriteLine([]byte("current")); err != nil {
+		t.Fatalf("unexpected error writing line: %v", err)
+	}
+
+	// Compression happens in the background, wait for the temporary files to be
+	// cleaned up before checking the results.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		matches, _ := filepath.Glob(filepath.Join(Directory(testUUID), "*[0-9]Z.log"))
+		if len(matches) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for rotated transcripts to be compressed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := Prune(testUUID); err != nil {
+		t.Fatalf("unexpected error pruning: %v", err)
+	}
+
+	files, err := List(testUUID)
+	if err != nil {
+		t.Fatalf("unexpected error listing: %v", err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("expected 3 files after pruning, got %d", len(files))
+	}
+	if files[len(files)-1].Name != CurrentFile {
+		t.Fatalf("expected the current transcript to be listed last, got %q", files[len(files)-1].Name)
+	}
+
+	p, _ := Path(testUUID, files[0].Name)
+	f, err := os.Open(p)
+	if err != nil {
+		t.Fatalf("unexpected error opening rotated transcript: %v", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("rotated transcript is not gzip compressed: %v", err)
+	}
+	b, _ := io.ReadAll(gz)
+	if !strings.HasSuffix(string(b), " hello world\n") {
+		t.Fatalf("unexpected rotated transcript contents: %q", b)
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/priyxstudio/propel/config"
 	"github.com/priyxstudio/propel/internal/progress"
 	"github.com/priyxstudio/propel/server/filesystem"
+	"github.com/priyxstudio/propel/server/transcript"
 )
 
 // Archive returns an archive that can be used to stream the contents of the
@@ -34,10 +35,11 @@ func (t *Transfer) Archive() (*Archive, error) {
 	return t.archive, nil
 }
 
-func (a *Archive) StreamBackups(ctx context.Context, mp *multipart.Writer) error {
+// backupFiles returns the paths of the local backup files for the backups that
+// should be transferred along with the server.
+func (a *Archive) backupFiles() ([]string, error) {
 	if len(a.transfer.BackupUUIDs) == 0 {
-		a.transfer.Log().Debug("no backups specified for transfer")
-		return nil
+		return nil, nil
 	}
 
 	cfg := config.Get()
@@ -45,13 +47,12 @@ func (a *Archive) StreamBackups(ctx context.Context, mp *multipart.Writer) error
 
 	// Check if backup directory exists
 	if _, err := os.Stat(backupPath); os.IsNotExist(err) {
-		a.transfer.Log().Debug("no backups found to transfer")
-		return nil
+		return nil, nil
 	}
 
 	entries, err := os.ReadDir(backupPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Create a set of backup UUIDs for quick lookup
@@ -60,14 +61,27 @@ func (a *Archive) StreamBackups(ctx context.Context, mp *multipart.Writer) error
 		backupSet[uuid+".tar.gz"] = true // Backup files are stored as UUID.tar.gz
 	}
 
-	var backupsToTransfer []os.DirEntry
+	var out []string
 	for _, entry := range entries {
 		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".tar.gz") {
 			if backupSet[entry.Name()] {
-				backupsToTransfer = append(backupsToTransfer, entry)
+				out = append(out, filepath.Join(backupPath, entry.Name()))
 			}
 		}
 	}
+	return out, nil
+}
+
+func (a *Archive) StreamBackups(ctx context.Context, mp *multipart.Writer) error {
+	if len(a.transfer.BackupUUIDs) == 0 {
+		a.transfer.Log().Debug("no backups specified for transfer")
+		return nil
+	}
+
+	backupsToTransfer, err := a.backupFiles()
+	if err != nil {
+		return err
+	}
 
 	totalBackups := len(backupsToTransfer)
 	if totalBackups == 0 {
@@ -78,10 +92,10 @@ func (a *Archive) StreamBackups(ctx context.Context, mp *multipart.Writer) error
 	a.transfer.Log().Infof("Starting transfer of %d backup files", totalBackups)
 	a.transfer.SendMessage(fmt.Sprintf("Starting transfer of %d backup files", totalBackups))
 
-	for _, entry := range backupsToTransfer {
-		backupFile := filepath.Join(backupPath, entry.Name())
+	for _, backupFile := range backupsToTransfer {
+		name := filepath.Base(backupFile)
 
-		a.transfer.Log().WithField("backup", entry.Name()).Debug("streaming backup file")
+		a.transfer.Log().WithField("backup", name).Debug("streaming backup file")
 
 		// Open backup file for reading
 		file, err := os.Open(backupFile)
@@ -94,35 +108,35 @@ func (a *Archive) StreamBackups(ctx context.Context, mp *multipart.Writer) error
 		backupTee := io.TeeReader(file, backupHasher)
 
 		// Create form file for the backup
-		part, err := mp.CreateFormFile("backup_"+entry.Name(), entry.Name())
+		part, err := mp.CreateFormFile("backup_"+name, name)
 		if err != nil {
 			file.Close()
-			return fmt.Errorf("failed to create form file for backup %s: %w", entry.Name(), err)
+			return fmt.Errorf("failed to create form file for backup %s: %w", name, err)
 		}
 
 		// Stream the backup file
 		if _, err := io.Copy(part, backupTee); err != nil {
 			file.Close()
-			return fmt.Errorf("failed to stream backup file %s: %w", entry.Name(), err)
+			return fmt.Errorf("failed to stream backup file %s: %w", name, err)
 		}
 		file.Close()
 
 		// Write individual backup checksum
-		checksumField := "checksum_backup_" + entry.Name()
+		checksumField := "checksum_backup_" + name
 		if err := mp.WriteField(checksumField, hex.EncodeToString(backupHasher.Sum(nil))); err != nil {
-			return fmt.Errorf("failed to write checksum for backup %s: %w", entry.Name(), err)
+			return fmt.Errorf("failed to write checksum for backup %s: %w", name, err)
 		}
 
 		// Update progress tracking
 		a.backupsStreamed++
 
 		// Progress message
-		progressMsg := fmt.Sprintf("Backup %d/%d completed: %s", a.backupsStreamed, totalBackups, entry.Name())
+		progressMsg := fmt.Sprintf("Backup %d/%d completed: %s", a.backupsStreamed, totalBackups, name)
 		a.transfer.Log().Info(progressMsg)
 		a.transfer.SendMessage(progressMsg)
 
 		a.transfer.Log().WithFields(log.Fields{
-			"backup":   entry.Name(),
+			"backup":   name,
 			"checksum": checksumField,
 		}).Debug("backup file streamed with checksum")
 	}
@@ -173,6 +187,54 @@ func (a *Archive) StreamInstallLogs(ctx context.Context, mp *multipart.Writer) e
 	return nil
 }
 
+// StreamConsoleTranscripts streams the persisted console transcripts for the
+// server to the multipart writer. Each transcript is sent as its own part named
+// "console_transcript_<file>".
+func (a *Archive) StreamConsoleTranscripts(ctx context.Context, mp *multipart.Writer) error {
+	files, err := transcript.List(a.transfer.Server.ID())
+	if err != nil {
+		// Don't fail the transfer if we can't read the console transcripts
+		a.transfer.Log().WithError(err).Warn("failed to list console transcripts, skipping")
+		return nil
+	}
+	if len(files) == 0 {
+		a.transfer.Log().Debug("no console transcripts found, skipping")
+		return nil
+	}
+
+	a.transfer.Log().WithField("count", len(files)).Debug("streaming console transcripts")
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := a.streamConsoleTranscript(mp, f.Name); err != nil {
+			a.transfer.Log().WithField("file", f.Name).WithError(err).Warn("failed to stream console transcript, skipping")
+		}
+	}
+
+	a.transfer.Log().Debug("console transcripts streamed successfully")
+	return nil
+}
+
+func (a *Archive) streamConsoleTranscript(mp *multipart.Writer, name string) error {
+	p, err := transcript.Path(a.transfer.Server.ID(), name)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	part, err := mp.CreateFormFile("console_transcript_"+name, name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, file)
+	return err
+}
+
 // Archive represents an archive used to transfer the contents of a server.
 type Archive struct {
 	archive         *filesystem.Archive
@@ -0,0 +1,577 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/goccy/go-json"
+
+	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/internal/progress"
+	"github.com/priyxstudio/propel/server/filesystem"
+	"github.com/priyxstudio/propel/server/transcript"
+)
+
+// MaxChunkSize is the largest chunk that a target node will accept in a single
+// request during a resumable transfer.
+const MaxChunkSize = 64 * 1024 * 1024
+
+// ChunkChecksumHeader is the header containing the SHA-256 checksum of the chunk
+// sent in the body of the request.
+const ChunkChecksumHeader = "X-Chunk-Checksum"
+
+// The longest delay between attempts when retrying a failed request.
+const maxRetryDelay = time.Minute
+
+// Manifest describes every file sent to the target node during a resumable
+// transfer. The names of the files match the form names used by the streamed
+// transfer, such as "archive" or "backup_<uuid>.tar.gz".
+type Manifest struct {
+	ChunkSize int64          `json:"chunk_size"`
+	Files     []ManifestFile `json:"files"`
+
+	// Start is set if the server should be started on the target node once the
+	// transfer is complete, this is used by live transfers of running servers.
+	Start bool `json:"start,omitempty"`
+}
+
+// ManifestFile is a single file sent during a resumable transfer.
+type ManifestFile struct {
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"`
+}
+
+// Offsets reports the number of bytes of each file that the target node has
+// received and written to disk, which is where the source node resumes from.
+type Offsets struct {
+	Files map[string]int64 `json:"files"`
+}
+
+// ChunkResponse is returned by the target node after receiving a chunk. If the
+// chunk did not start at the offset the target expected the request fails with
+// a conflict, and the offset the source should continue from is returned.
+type ChunkResponse struct {
+	Offset int64  `json:"offset"`
+	Error  string `json:"error,omitempty"`
+}
+
+// requestError is returned when the target node responds to a request with an
+// unexpected status code.
+type requestError struct {
+	status  int
+	message string
+}
+
+func (e *requestError) Error() string {
+	return fmt.Sprintf("unexpected status code from destination: %d: %s", e.status, e.message)
+}
+
+// permanent returns true if retrying the request will not change the response.
+// A chunk that failed its checksum check is rejected as unprocessable, and is
+// retried since it was most likely corrupted on the way to the target node.
+func (e *requestError) permanent() bool {
+	return e.status >= 400 && e.status < 500 &&
+		e.status != http.StatusRequestTimeout &&
+		e.status != http.StatusTooManyRequests &&
+		e.status != http.StatusUnprocessableEntity
+}
+
+// stagedFile is a file on the source node that is sent to the target node.
+type stagedFile struct {
+	ManifestFile
+	path string
+}
+
+// retryDelay returns how long to wait before the given attempt of a request,
+// doubling with every attempt up to a maximum.
+func retryDelay(attempt int) time.Duration {
+	d := time.Second
+	for i := 1; i < attempt && d < maxRetryDelay; i++ {
+		d *= 2
+	}
+	return min(d, maxRetryDelay)
+}
+
+// chunkClient sends a server to a target node using the resumable transfer
+// protocol.
+type chunkClient struct {
+	transfer *Transfer
+	url      string
+	token    string
+	client   *http.Client
+}
+
+// endpoint returns the URL for the resumable transfer endpoint with the given
+// name, relative to the URL of the streamed transfer endpoint.
+func (c *chunkClient) endpoint(name string, query url.Values) string {
+	u := strings.TrimSuffix(c.url, "/") + "/" + name
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// do sends a request to the target node, decoding the JSON response into out. A
+// conflict response is decoded as well since it contains the offset to resume
+// from, any other unsuccessful response is returned as an error.
+func (c *chunkClient) do(ctx context.Context, method string, endpoint string, body io.Reader, header http.Header, out interface{}) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Authorization", c.token)
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	v, err := io.ReadAll(res.Body)
+	if err != nil {
+		return res.StatusCode, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if res.StatusCode >= 300 && res.StatusCode != http.StatusConflict {
+		return res.StatusCode, &requestError{status: res.StatusCode, message: strings.TrimSpace(string(v))}
+	}
+	if out != nil && len(v) > 0 {
+		if err := json.Unmarshal(v, out); err != nil {
+			return res.StatusCode, fmt.Errorf("failed to decode response body: %w", err)
+		}
+	}
+	return res.StatusCode, nil
+}
+
+// retry calls fn until it succeeds, the error returned is permanent, or the
+// configured number of retries is used up. The delay between each attempt
+// doubles so that a target node that is restarting has time to come back.
+func (c *chunkClient) retry(ctx context.Context, action string, fn func() error) error {
+	retries := max(config.Get().System.Transfers.MaxRetries, 0)
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt > retries || ctx.Err() != nil {
+			return err
+		}
+		var re *requestError
+		if errors.As(err, &re) && re.permanent() {
+			return err
+		}
+
+		delay := retryDelay(attempt)
+		c.transfer.Log().WithField("attempt", attempt).WithField("delay", delay).WithError(err).Warn("transfer request failed, retrying")
+		c.transfer.SendMessage(fmt.Sprintf("Failed to %s (attempt %d of %d), retrying in %s...", action, attempt, retries+1, delay))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// newChunkClient returns a client for sending the server to the target node at
+// the given URL using the resumable transfer protocol.
+func newChunkClient(t *Transfer, url, token string) *chunkClient {
+	return &chunkClient{transfer: t, url: url, token: token, client: &http.Client{Timeout: 0}}
+}
+
+// supported returns true if the target node supports resumable transfers.
+func (c *chunkClient) supported(ctx context.Context) (bool, error) {
+	err := c.retry(ctx, "contact destination", func() error {
+		_, err := c.do(ctx, http.MethodGet, c.endpoint("session", nil), nil, nil, nil)
+		return err
+	})
+	if err != nil {
+		var re *requestError
+		if errors.As(err, &re) && (re.status == http.StatusNotFound || re.status == http.StatusMethodNotAllowed) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// send sends the files to the target node, resuming each file from the offset
+// the target node reports it has already received.
+func (c *chunkClient) send(ctx context.Context, files []stagedFile, start bool) error {
+	t := c.transfer
+	chunkSize := int64(max(config.Get().System.Transfers.ChunkSize, 1)) * 1024 * 1024
+	chunkSize = min(chunkSize, MaxChunkSize)
+	manifest := Manifest{ChunkSize: chunkSize, Start: start}
+	var total int64
+	for _, f := range files {
+		manifest.Files = append(manifest.Files, f.ManifestFile)
+		total += f.Size
+	}
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	var offsets Offsets
+	err = c.retry(ctx, "start transfer session", func() error {
+		_, err := c.do(ctx, http.MethodPost, c.endpoint("session", nil), bytes.NewReader(body), nil, &offsets)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	var resumed int64
+	for _, f := range files {
+		resumed += min(offsets.Files[f.Name], f.Size)
+	}
+	p := progress.NewProgress(uint64(total))
+	p.Add(uint64(resumed))
+	if resumed > 0 {
+		t.SendMessage("Resuming transfer from " + p.Progress(25))
+	}
+
+	ctx2, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func(ctx context.Context, tc *time.Ticker) {
+		defer tc.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tc.C:
+				message := "Uploading " + p.Progress(25)
+				t.SendMessage(message)
+				t.Log().Info(message)
+			}
+		}
+	}(ctx2, time.NewTicker(5*time.Second))
+
+	for _, f := range files {
+		if err := c.upload(ctx, f, offsets.Files[f.Name], chunkSize, p); err != nil {
+			return fmt.Errorf("failed to send %s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// complete asks the target node to import the server once every file has been
+// sent. The target extracts the archive before responding to this request,
+// which is not safe to repeat, so it is only attempted once.
+func (c *chunkClient) complete(ctx context.Context) error {
+	c.transfer.SendMessage("Finished sending server data to destination, waiting for it to be imported...")
+	if _, err := c.do(ctx, http.MethodPost, c.endpoint("complete", nil), nil, nil, nil); err != nil {
+		return err
+	}
+	c.transfer.SendMessage("Destination finished importing the server.")
+	return nil
+}
+
+// PushToTarget sends the server to the target node. If the target node supports
+// resumable transfers the server is sent in checksummed chunks, resuming from
+// where the target node left off after any failure. Otherwise the server is
+// streamed to the target node in a single request.
+func (t *Transfer) PushToTarget(url, token string, backups []string) error {
+	ctx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
+
+	c := newChunkClient(t, url, token)
+	if ok, err := c.supported(ctx); err != nil {
+		return err
+	} else if !ok {
+		t.Log().Debug("destination does not support resumable transfers, streaming archive instead")
+		_, err := t.PushArchiveToTarget(url, token, backups)
+		return err
+	}
+
+	t.SendMessage("Preparing to send server data to destination...")
+	t.SetStatus(StatusProcessing)
+	t.BackupUUIDs = backups
+
+	a, err := t.Archive()
+	if err != nil {
+		t.Error(err, "Failed to get archive for transfer.")
+		return errors.New("failed to get archive for transfer")
+	}
+
+	// The staged archive is kept when the transfer fails, so that a transfer of
+	// the server that is started again within the resume window continues where
+	// the target node left off instead of starting from zero.
+	archive, ok := t.reuseStaged("archive")
+	if ok {
+		t.SendMessage("Resuming transfer using the previously archived server data...")
+	} else {
+		archive, err = t.stageArchive(ctx, "archive", a.archive)
+		if err != nil {
+			return fmt.Errorf("failed to archive server: %w", err)
+		}
+	}
+	extras, err := t.stageExtras(a)
+	if err != nil {
+		return err
+	}
+	if err := c.send(ctx, append([]stagedFile{archive}, extras...), false); err != nil {
+		return err
+	}
+	if err := c.complete(ctx); err != nil {
+		return err
+	}
+	t.removeStaged()
+	return nil
+}
+
+// upload sends a file to the target node in chunks, starting at the offset the
+// target node has already received. If the target node reports a different
+// offset the upload continues from there instead.
+func (c *chunkClient) upload(ctx context.Context, f stagedFile, offset int64, chunkSize int64, p *progress.Progress) error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	buf := make([]byte, chunkSize)
+	for offset < f.Size {
+		n := min(chunkSize, f.Size-offset)
+		if _, err := file.ReadAt(buf[:n], offset); err != nil {
+			return err
+		}
+		sum := sha256.Sum256(buf[:n])
+		header := http.Header{}
+		header.Set("Content-Type", "application/octet-stream")
+		header.Set(ChunkChecksumHeader, hex.EncodeToString(sum[:]))
+		query := url.Values{"file": {f.Name}, "offset": {strconv.FormatInt(offset, 10)}}
+
+		var res ChunkResponse
+		err := c.retry(ctx, "send "+f.Name, func() error {
+			_, err := c.do(ctx, http.MethodPut, c.endpoint("chunks", query), c.transfer.limitReader(bytes.NewReader(buf[:n])), header, &res)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if res.Offset < 0 || res.Offset > f.Size {
+			return fmt.Errorf("destination reported an invalid offset %d", res.Offset)
+		}
+		if res.Offset > offset {
+			p.Add(uint64(res.Offset - offset))
+		}
+		offset = res.Offset
+	}
+	return nil
+}
+
+// stagedPath returns the path a file is written to before it is sent to the
+// target node.
+func (t *Transfer) stagedPath(name string) string {
+	return filepath.Join(config.Get().System.ArchiveDirectory, t.Server.ID()+"-"+name)
+}
+
+// stagedNames are the names of the files written to disk to be sent to the
+// target node, each of which also has a ".json" file describing it.
+var stagedNames = []string{"archive", "delta", "deleted"}
+
+// removeStaged removes the files written to disk to be sent to the target node.
+func (t *Transfer) removeStaged() {
+	for _, name := range stagedNames {
+		for _, p := range []string{t.stagedPath(name), t.stagedPath(name) + ".json"} {
+			if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+				t.Log().WithField("file", name).WithError(err).Warn("failed to remove staged transfer file")
+			}
+		}
+	}
+}
+
+// reuseStaged returns a file that was staged by an earlier attempt to transfer
+// the server, if it was completely written within the resume window.
+func (t *Transfer) reuseStaged(name string) (stagedFile, bool) {
+	p := t.stagedPath(name)
+	b, err := os.ReadFile(p + ".json")
+	if err != nil {
+		return stagedFile{}, false
+	}
+	var f ManifestFile
+	if err := json.Unmarshal(b, &f); err != nil || f.Name != name {
+		return stagedFile{}, false
+	}
+	st, err := os.Stat(p)
+	if err != nil || st.Size() != f.Size || time.Since(st.ModTime()) > resumeWindow() {
+		return stagedFile{}, false
+	}
+	return stagedFile{ManifestFile: f, path: p}, true
+}
+
+// RemoveExpiredStaged removes the files staged for outgoing transfers that were
+// not completed, once they are older than the resume window and no transfer of
+// the server is running.
+func RemoveExpiredStaged() {
+	dir := config.Get().System.ArchiveDirectory
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.WithError(err).Warn("failed to read archive directory")
+		}
+		return
+	}
+	for _, e := range entries {
+		id, ok := stagedServer(e.Name())
+		if !ok || e.IsDir() || Outgoing().Get(id) != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || time.Since(info.ModTime()) <= resumeWindow() {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, e.Name())); err != nil && !os.IsNotExist(err) {
+			log.WithField("file", e.Name()).WithError(err).Warn("failed to remove expired staged transfer file")
+		}
+	}
+}
+
+// stagedServer returns the server a staged file name belongs to.
+func stagedServer(name string) (string, bool) {
+	name = strings.TrimSuffix(name, ".json")
+	for _, n := range stagedNames {
+		if id, ok := strings.CutSuffix(name, "-"+n); ok && id != "" {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// stageArchive writes an archive of the server to disk, since the archive must
+// be read again from any offset when a transfer is resumed, calculating the
+// checksum while it is written.
+func (t *Transfer) stageArchive(ctx context.Context, name string, a *filesystem.Archive) (stagedFile, error) {
+	p := t.stagedPath(name)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return stagedFile{}, err
+	}
+	// The description of the file is only written once it is complete, so that
+	// a partially written file is never reused.
+	if err := os.Remove(p + ".json"); err != nil && !os.IsNotExist(err) {
+		return stagedFile{}, err
+	}
+	f, err := os.Create(p)
+	if err != nil {
+		return stagedFile{}, err
+	}
+	defer f.Close()
+
+	if a.Progress != nil {
+		ctx2, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func(ctx context.Context, tc *time.Ticker) {
+			defer tc.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-tc.C:
+					t.SendMessage("Archiving " + a.Progress.Progress(25))
+				}
+			}
+		}(ctx2, time.NewTicker(5*time.Second))
+	}
+
+	h := sha256.New()
+	if err := a.Stream(ctx, io.MultiWriter(f, h)); err != nil {
+		return stagedFile{}, err
+	}
+	if err := f.Sync(); err != nil {
+		return stagedFile{}, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		return stagedFile{}, err
+	}
+	mf := ManifestFile{Name: name, Size: st.Size(), Checksum: hex.EncodeToString(h.Sum(nil))}
+	b, err := json.Marshal(mf)
+	if err != nil {
+		return stagedFile{}, err
+	}
+	if err := os.WriteFile(p+".json", b, 0o600); err != nil {
+		return stagedFile{}, err
+	}
+	return stagedFile{ManifestFile: mf, path: p}, nil
+}
+
+// stageExtras returns the backups, install logs and console transcripts of the
+// server that are sent to the target node along with the archive.
+func (t *Transfer) stageExtras(a *Archive) ([]stagedFile, error) {
+	var files []stagedFile
+	backups, err := a.backupFiles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+	for _, p := range backups {
+		f, err := stageFile("backup_"+filepath.Base(p), p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup: %w", err)
+		}
+		files = append(files, f)
+	}
+	if len(backups) > 0 {
+		t.SendMessage(fmt.Sprintf("Sending %d backup files along with the server.", len(backups)))
+	}
+
+	// Install logs and console transcripts are not required for the server to work,
+	// so they are skipped if they cannot be read.
+	p := filepath.Join(config.Get().System.LogDirectory, "install", t.Server.ID()+".log")
+	if f, err := stageFile("install_logs", p); err == nil {
+		files = append(files, f)
+	} else if !os.IsNotExist(err) {
+		t.Log().WithError(err).Warn("failed to read install logs, skipping")
+	}
+	transcripts, err := transcript.List(t.Server.ID())
+	if err != nil {
+		t.Log().WithError(err).Warn("failed to list console transcripts, skipping")
+	}
+	for _, tf := range transcripts {
+		p, err := transcript.Path(t.Server.ID(), tf.Name)
+		if err != nil {
+			continue
+		}
+		f, err := stageFile("console_transcript_"+tf.Name, p)
+		if err != nil {
+			t.Log().WithField("file", tf.Name).WithError(err).Warn("failed to read console transcript, skipping")
+			continue
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// stageFile returns an existing file to send to the target node, calculating its
+// checksum.
+func stageFile(name string, p string) (stagedFile, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return stagedFile{}, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return stagedFile{}, err
+	}
+	return stagedFile{
+		ManifestFile: ManifestFile{Name: name, Size: n, Checksum: hex.EncodeToString(h.Sum(nil))},
+		path:         p,
+	}, nil
+}
@@ -0,0 +1,536 @@
+package transfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/goccy/go-json"
+
+	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/server"
+	"github.com/priyxstudio/propel/server/installer"
+	"github.com/priyxstudio/propel/server/transcript"
+)
+
+var (
+	// ErrUnknownFile is returned when a chunk is received for a file that is not
+	// part of the manifest of the transfer.
+	ErrUnknownFile = errors.New("transfer: file is not part of the transfer manifest")
+
+	// ErrChunkOffset is returned when a chunk does not start at the offset that
+	// has been received so far for the file.
+	ErrChunkOffset = errors.New("transfer: chunk does not start at the expected offset")
+
+	// ErrChunkChecksum is returned when the checksum of a chunk does not match
+	// the checksum sent with it.
+	ErrChunkChecksum = errors.New("transfer: chunk checksum mismatch")
+
+	// ErrIncomplete is returned when a transfer is completed before every file
+	// in the manifest has been received.
+	ErrIncomplete = errors.New("transfer: not every file has been received")
+)
+
+// IncomingState is the state of a resumable transfer being received from the
+// source node. It is written to disk after every chunk so that the transfer can
+// be resumed from the same offsets after the daemon restarts.
+type IncomingState struct {
+	mu sync.Mutex
+
+	Server    string           `json:"server"`
+	Manifest  Manifest         `json:"manifest"`
+	Received  map[string]int64 `json:"received"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+
+	// PreSynced is set once the files copied while the server was still running
+	// on the source node have been imported during a live transfer, after which
+	// only the changes made since then are received.
+	PreSynced bool `json:"pre_synced"`
+
+	// importing is set while the received files are imported, which can take
+	// longer than the resume window without the state being updated.
+	importing atomic.Bool
+}
+
+// resumeWindow returns how long the data of a transfer that has not completed
+// is kept so that it can be resumed.
+func resumeWindow() time.Duration {
+	return time.Duration(max(config.Get().System.Transfers.ResumeWindow, 1)) * time.Hour
+}
+
+// incomingDirectory returns the directory containing the data of every
+// resumable transfer being received.
+func incomingDirectory() string {
+	return filepath.Join(config.Get().System.ArchiveDirectory, "incoming")
+}
+
+func newIncomingState(id string) *IncomingState {
+	return &IncomingState{
+		Server:    id,
+		Received:  make(map[string]int64),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+}
+
+// loadIncomingState reads the state of a resumable transfer from the disk. Any
+// data written for a file past the offset recorded in the state is discarded,
+// since it was never acknowledged to the source node.
+func loadIncomingState(id string) (*IncomingState, error) {
+	st := &IncomingState{Server: id}
+	b, err := os.ReadFile(filepath.Join(st.directory(), "state.json"))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, st); err != nil {
+		return nil, fmt.Errorf("transfer: failed to parse incoming transfer state: %w", err)
+	}
+	if st.Server != id {
+		return nil, fmt.Errorf("transfer: incoming transfer state belongs to server %s", st.Server)
+	}
+	if st.Received == nil {
+		st.Received = make(map[string]int64)
+	}
+	for _, f := range st.Manifest.Files {
+		fi, err := os.Stat(st.Path(f.Name))
+		switch {
+		case err != nil:
+			st.Received[f.Name] = 0
+		case fi.Size() < st.Received[f.Name]:
+			st.Received[f.Name] = fi.Size()
+		case fi.Size() > st.Received[f.Name]:
+			if err := os.Truncate(st.Path(f.Name), st.Received[f.Name]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return st, nil
+}
+
+func (st *IncomingState) directory() string {
+	return filepath.Join(incomingDirectory(), st.Server)
+}
+
+// Path returns the path that a file in the manifest is written to.
+func (st *IncomingState) Path(name string) string {
+	return filepath.Join(st.directory(), "files", name)
+}
+
+// saveLocked writes the state to the disk, replacing the previous state in a
+// single rename so that a crash never leaves a partially written state. This
+// must be called while holding the lock.
+func (st *IncomingState) saveLocked() error {
+	st.UpdatedAt = time.Now()
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(st.directory(), 0o700); err != nil {
+		return err
+	}
+	p := filepath.Join(st.directory(), "state.json")
+	if err := os.WriteFile(p+".tmp", b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(p+".tmp", p)
+}
+
+// fileLocked returns the file with the given name from the manifest. This must
+// be called while holding the lock.
+func (st *IncomingState) fileLocked(name string) (ManifestFile, bool) {
+	for _, f := range st.Manifest.Files {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return ManifestFile{}, false
+}
+
+// validFileName returns true if the name can be used as the name of a file in
+// the directory of the transfer.
+func validFileName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// Reconcile sets the manifest for the transfer. Data already received for a
+// file is kept if the file has the same size and checksum as before, otherwise
+// the file is received again from the start.
+func (st *IncomingState) Reconcile(m Manifest) error {
+	var hasArchive, hasDelta bool
+	names := make(map[string]ManifestFile, len(m.Files))
+	for _, f := range m.Files {
+		if !validFileName(f.Name) || f.Size < 0 {
+			return fmt.Errorf("transfer: invalid file %q in manifest", f.Name)
+		}
+		if _, ok := names[f.Name]; ok {
+			return fmt.Errorf("transfer: duplicate file %q in manifest", f.Name)
+		}
+		names[f.Name] = f
+		hasArchive = hasArchive || f.Name == "archive"
+		hasDelta = hasDelta || f.Name == "delta"
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if !hasArchive && !(st.PreSynced && hasDelta) {
+		return errors.New("transfer: manifest is missing the server archive")
+	}
+
+	received := make(map[string]int64, len(m.Files))
+	for _, f := range st.Manifest.Files {
+		if n, ok := names[f.Name]; ok && n == f {
+			received[f.Name] = min(st.Received[f.Name], f.Size)
+		}
+	}
+	// Remove anything written for files that are no longer in the manifest, or
+	// that are being received again from the start.
+	entries, err := os.ReadDir(filepath.Dir(st.Path("archive")))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, e := range entries {
+		if _, ok := received[e.Name()]; !ok {
+			if err := os.Remove(st.Path(e.Name())); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(st.Path("archive")), 0o700); err != nil {
+		return err
+	}
+	st.Manifest = m
+	st.Received = received
+	return st.saveLocked()
+}
+
+// CompletePreSync marks the files received so far as imported, so that the
+// rest of a live transfer only has to send the changes made since they were
+// copied. Calling this again once the files are imported has no effect.
+func (st *IncomingState) CompletePreSync() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if err := os.RemoveAll(filepath.Dir(st.Path("archive"))); err != nil {
+		return err
+	}
+	st.PreSynced = true
+	st.Manifest = Manifest{}
+	st.Received = map[string]int64{}
+	return st.saveLocked()
+}
+
+// Offsets returns the number of bytes received for each file in the manifest.
+func (st *IncomingState) Offsets() Offsets {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	out := Offsets{Files: make(map[string]int64, len(st.Manifest.Files))}
+	for _, f := range st.Manifest.Files {
+		out.Files[f.Name] = st.Received[f.Name]
+	}
+	return out
+}
+
+// WriteChunk writes a chunk of a file to the disk after verifying its checksum,
+// returning the number of bytes of the file received so far. A chunk that was
+// already received is accepted without being written again so that requests
+// can be safely retried. If the chunk does not start where the data received
+// so far ends ErrChunkOffset is returned along with the expected offset.
+func (st *IncomingState) WriteChunk(name string, offset int64, data []byte, checksum string) (int64, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	f, ok := st.fileLocked(name)
+	if !ok {
+		return 0, ErrUnknownFile
+	}
+	current := st.Received[name]
+	end := offset + int64(len(data))
+	if offset < current && end <= current {
+		return current, nil
+	}
+	if offset != current {
+		return current, ErrChunkOffset
+	}
+	if end > f.Size {
+		return current, fmt.Errorf("transfer: chunk extends past the end of %s", name)
+	}
+	sum := sha256.Sum256(data)
+	if !strings.EqualFold(hex.EncodeToString(sum[:]), checksum) {
+		return current, ErrChunkChecksum
+	}
+
+	file, err := os.OpenFile(st.Path(name), os.O_WRONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		return current, err
+	}
+	if _, err := file.WriteAt(data, offset); err != nil {
+		file.Close()
+		return current, err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return current, err
+	}
+	if err := file.Close(); err != nil {
+		return current, err
+	}
+
+	st.Received[name] = end
+	if err := st.saveLocked(); err != nil {
+		st.Received[name] = current
+		return current, err
+	}
+	return end, nil
+}
+
+// Verify checks that every file in the manifest has been received in full. If
+// checksums is true the checksum of each file is verified as well.
+func (st *IncomingState) Verify(checksums bool) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for _, f := range st.Manifest.Files {
+		if st.Received[f.Name] != f.Size {
+			return fmt.Errorf("%w: received %d of %d bytes of %s", ErrIncomplete, st.Received[f.Name], f.Size, f.Name)
+		}
+		if !checksums {
+			continue
+		}
+		sum, err := fileChecksum(st.Path(f.Name))
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(sum, f.Checksum) {
+			return fmt.Errorf("transfer: checksum mismatch for %s", f.Name)
+		}
+	}
+	return nil
+}
+
+// Remove deletes the state and all the data received for the transfer.
+func (st *IncomingState) Remove() error {
+	return os.RemoveAll(st.directory())
+}
+
+func fileChecksum(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// NewIncoming creates a resumable transfer for a server being received from the
+// source node, creating the server on this node. Any data received for the
+// server before the daemon was restarted is kept so that it can be resumed.
+func NewIncoming(ctx context.Context, manager *server.Manager, id string) (*Transfer, error) {
+	st, err := loadIncomingState(id)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.WithField("server", id).WithError(err).Warn("failed to load incoming transfer state, starting transfer again")
+		}
+		st = newIncomingState(id)
+	}
+
+	i, err := installer.New(ctx, manager, installer.ServerDetails{UUID: id})
+	if err != nil {
+		return nil, err
+	}
+	t := New(context.Background(), i.Server())
+	t.State = st
+
+	i.Server().SetTransferring(true)
+	manager.Add(i.Server())
+	Incoming().Add(t)
+	return t, nil
+}
+
+// ExpiredIncoming returns the resumable transfers being received that have not
+// been updated within the resume window, which the source node has given up on.
+func ExpiredIncoming() []*Transfer {
+	m := Incoming()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var expired []*Transfer
+	window := resumeWindow()
+	for _, t := range m.transfers {
+		if t.State != nil && t.State.expired(window) {
+			expired = append(expired, t)
+		}
+	}
+	return expired
+}
+
+func (st *IncomingState) expired(window time.Duration) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return !st.importing.Load() && time.Since(st.UpdatedAt) > window
+}
+
+// RestoreIncoming restores the resumable transfers that were being received when
+// the daemon was stopped, so that the source nodes can resume them. Transfers
+// that have not been updated within the configured resume window are removed.
+func RestoreIncoming(ctx context.Context, manager *server.Manager) {
+	entries, err := os.ReadDir(incomingDirectory())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.WithError(err).Warn("failed to read incoming transfers directory")
+		}
+		return
+	}
+
+	window := resumeWindow()
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		logger := log.WithField("server", e.Name()).WithField("subsystem", "transfer")
+		st, err := loadIncomingState(e.Name())
+		if err != nil {
+			logger.WithError(err).Warn("failed to load incoming transfer, removing it")
+			_ = os.RemoveAll(filepath.Join(incomingDirectory(), e.Name()))
+			continue
+		}
+		if _, ok := manager.Get(st.Server); ok || time.Since(st.UpdatedAt) > window {
+			logger.Info("removing incoming transfer that was not resumed")
+			if err := st.Remove(); err != nil {
+				logger.WithError(err).Warn("failed to remove incoming transfer")
+			}
+			continue
+		}
+		if _, err := NewIncoming(ctx, manager, st.Server); err != nil {
+			logger.WithError(err).Warn("failed to restore incoming transfer, it will be restored when the source node resumes it")
+			continue
+		}
+		logger.Info("restored incoming transfer, waiting for source node to resume it")
+	}
+}
+
+// ImportStaged moves the files received during a resumable transfer into place,
+// extracting the server archive into the data directory of the server. During
+// a live transfer this also applies the files changed and deleted since the
+// server data was first copied.
+func (t *Transfer) ImportStaged(ctx context.Context) error {
+	if t.State == nil {
+		return errors.New("transfer: transfer is not resumable")
+	}
+	t.State.importing.Store(true)
+	defer t.State.importing.Store(false)
+	id := t.Server.ID()
+	cfg := config.Get()
+
+	for _, f := range t.State.Manifest.Files {
+		p := t.State.Path(f.Name)
+		switch {
+		case f.Name == "archive", f.Name == "delta":
+			if err := t.Server.EnsureDataDirectoryExists(); err != nil {
+				return err
+			}
+			file, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			err = t.Server.Filesystem().ExtractStreamUnsafe(ctx, "/", file)
+			file.Close()
+			if err != nil {
+				return err
+			}
+			t.Log().WithField("file", f.Name).Debug("archive extracted")
+
+		case f.Name == "deleted":
+			b, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			var deleted []string
+			if err := json.Unmarshal(b, &deleted); err != nil {
+				return fmt.Errorf("failed to parse deleted files: %w", err)
+			}
+			for _, d := range deleted {
+				if err := t.Server.Filesystem().Delete(d); err != nil && !errors.Is(err, os.ErrNotExist) {
+					return fmt.Errorf("failed to delete %s: %w", d, err)
+				}
+			}
+			t.Log().WithField("files", len(deleted)).Debug("removed files deleted on source node")
+
+		case strings.HasPrefix(f.Name, "backup_"):
+			dir := filepath.Join(cfg.System.BackupDirectory, id)
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return fmt.Errorf("failed to create backup directory: %w", err)
+			}
+			if err := moveFile(p, filepath.Join(dir, strings.TrimPrefix(f.Name, "backup_"))); err != nil {
+				return fmt.Errorf("failed to move backup file %s: %w", f.Name, err)
+			}
+
+		// Install logs and console transcripts are not required for the server to
+		// work, so the transfer does not fail if they cannot be saved.
+		case f.Name == "install_logs":
+			dir := filepath.Join(cfg.System.LogDirectory, "install")
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				t.Log().WithError(err).Warn("failed to create install log directory, skipping")
+				continue
+			}
+			if err := moveFile(p, filepath.Join(dir, id+".log")); err != nil {
+				t.Log().WithError(err).Warn("failed to save install logs, skipping")
+			}
+
+		case strings.HasPrefix(f.Name, "console_transcript_"):
+			name := strings.TrimPrefix(f.Name, "console_transcript_")
+			file, err := os.Open(p)
+			if err != nil {
+				t.Log().WithField("file", name).WithError(err).Warn("failed to open console transcript, skipping")
+				continue
+			}
+			if err := transcript.Import(id, name, file); err != nil {
+				t.Log().WithField("file", name).WithError(err).Warn("failed to save console transcript, skipping")
+			}
+			file.Close()
+		}
+	}
+	return nil
+}
+
+// moveFile moves a file, copying it if it cannot be renamed because the
+// destination is on another filesystem.
+func moveFile(src string, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
@@ -0,0 +1,167 @@
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/priyxstudio/propel/config"
+)
+
+const testUUID = "8a5b7b6e-3b8c-4c1f-9e6b-2f3f4d5e6a7b"
+
+func checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestIncomingState(t *testing.T) {
+	config.Set(&config.Configuration{
+		AuthenticationToken: "abc",
+		System:              config.SystemConfiguration{ArchiveDirectory: t.TempDir()},
+	})
+
+	data := []byte("0123456789")
+	manifest := Manifest{ChunkSize: 4, Files: []ManifestFile{{Name: "archive", Size: int64(len(data)), Checksum: checksum(data)}}}
+
+	st := newIncomingState(testUUID)
+	if err := st.Reconcile(Manifest{Files: []ManifestFile{{Name: "../archive"}}}); err == nil {
+		t.Fatal("expected manifest with invalid file name to be rejected")
+	}
+	if err := st.Reconcile(manifest); err != nil {
+		t.Fatalf("failed to reconcile manifest: %v", err)
+	}
+
+	if _, err := st.WriteChunk("archive", 0, data[:4], checksum(data[1:5])); !errors.Is(err, ErrChunkChecksum) {
+		t.Fatalf("expected checksum error, got %v", err)
+	}
+	if n, err := st.WriteChunk("archive", 0, data[:4], checksum(data[:4])); err != nil || n != 4 {
+		t.Fatalf("expected offset 4, got %d (%v)", n, err)
+	}
+	// Retrying a chunk that was already received is accepted.
+	if n, err := st.WriteChunk("archive", 0, data[:4], checksum(data[:4])); err != nil || n != 4 {
+		t.Fatalf("expected retried chunk to be accepted at offset 4, got %d (%v)", n, err)
+	}
+	if n, err := st.WriteChunk("archive", 8, data[8:], checksum(data[8:])); !errors.Is(err, ErrChunkOffset) || n != 4 {
+		t.Fatalf("expected offset error with offset 4, got %d (%v)", n, err)
+	}
+	if err := st.Verify(false); !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("expected incomplete error, got %v", err)
+	}
+
+	// Data written past the recorded offset is discarded when the state is loaded.
+	f, err := os.OpenFile(st.Path("archive"), os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte("xx"))
+	f.Close()
+
+	loaded, err := loadIncomingState(testUUID)
+	if err != nil {
+		t.Fatalf("failed to load state: %v", err)
+	}
+	if got := loaded.Offsets().Files["archive"]; got != 4 {
+		t.Fatalf("expected loaded offset 4, got %d", got)
+	}
+	if n, err := loaded.WriteChunk("archive", 4, data[4:], checksum(data[4:])); err != nil || n != 10 {
+		t.Fatalf("expected offset 10, got %d (%v)", n, err)
+	}
+	if err := loaded.Verify(true); err != nil {
+		t.Fatalf("expected transfer to verify, got %v", err)
+	}
+
+	// A file that changed on the source node is received again from the start.
+	changed := manifest
+	changed.Files = []ManifestFile{{Name: "archive", Size: 3, Checksum: checksum(data[:3])}}
+	if err := loaded.Reconcile(changed); err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.Offsets().Files["archive"]; got != 0 {
+		t.Fatalf("expected offset to be reset, got %d", got)
+	}
+	if _, err := os.Stat(loaded.Path("archive")); !os.IsNotExist(err) {
+		t.Fatalf("expected previous data to be removed, got %v", err)
+	}
+
+	if err := loaded.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadIncomingState(testUUID); !os.IsNotExist(err) {
+		t.Fatalf("expected state to be removed, got %v", err)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second}
+	for i, d := range expected {
+		if got := retryDelay(i + 1); got != d {
+			t.Errorf("attempt %d: expected %s, got %s", i+1, d, got)
+		}
+	}
+	if got := retryDelay(20); got != maxRetryDelay {
+		t.Errorf("expected delay to be capped at %s, got %s", maxRetryDelay, got)
+	}
+}
+
+func TestIncomingStatePreSync(t *testing.T) {
+	config.Set(&config.Configuration{
+		AuthenticationToken: "abc",
+		System:              config.SystemConfiguration{ArchiveDirectory: t.TempDir()},
+	})
+
+	data := []byte("delta")
+	delta := Manifest{ChunkSize: 4, Files: []ManifestFile{{Name: "delta", Size: int64(len(data)), Checksum: checksum(data)}}}
+
+	st := newIncomingState(testUUID)
+	if err := st.Reconcile(delta); err == nil {
+		t.Fatal("expected manifest without an archive to be rejected before the pre-sync")
+	}
+	if err := st.Reconcile(Manifest{ChunkSize: 4, Files: []ManifestFile{{Name: "archive", Size: 1, Checksum: checksum([]byte("a"))}}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.WriteChunk("archive", 0, []byte("a"), checksum([]byte("a"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.CompletePreSync(); err != nil {
+		t.Fatalf("failed to complete pre-sync: %v", err)
+	}
+	if _, err := os.Stat(st.Path("archive")); !os.IsNotExist(err) {
+		t.Fatalf("expected pre-synced data to be removed, got %v", err)
+	}
+	// Completing the pre-sync again, as happens when the request is retried, is
+	// accepted.
+	if err := st.CompletePreSync(); err != nil {
+		t.Fatalf("failed to repeat pre-sync: %v", err)
+	}
+
+	loaded, err := loadIncomingState(testUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.PreSynced {
+		t.Fatal("expected pre-sync to be persisted")
+	}
+	if err := loaded.Reconcile(delta); err != nil {
+		t.Fatalf("expected delta manifest to be accepted after the pre-sync, got %v", err)
+	}
+}
+
+func TestStagedServer(t *testing.T) {
+	for name, want := range map[string]string{
+		testUUID + "-archive":      testUUID,
+		testUUID + "-archive.json": testUUID,
+		testUUID + "-delta":        testUUID,
+		testUUID + ".tar.gz":       "",
+		"-archive":                 "",
+		"incoming":                 "",
+	} {
+		id, ok := stagedServer(name)
+		if id != want || ok != (want != "") {
+			t.Errorf("stagedServer(%q) = %q, %v, want %q", name, id, ok, want)
+		}
+	}
+}
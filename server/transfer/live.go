@@ -0,0 +1,134 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/goccy/go-json"
+
+	"github.com/priyxstudio/propel/environment"
+	"github.com/priyxstudio/propel/server/filesystem"
+)
+
+// PushLiveToTarget sends the server to the target node while keeping it online
+// for as much of the transfer as possible. The server data is first copied to
+// the target node while the server is running, then the server is stopped using
+// the given function and only the files changed or deleted since then are sent.
+// If the server was running it is started again on the target node once the
+// transfer is complete.
+//
+// If the target node does not support resumable transfers the server is stopped
+// and streamed to the target node in a single request instead.
+func (t *Transfer) PushLiveToTarget(url, token string, backups []string, stop func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
+
+	c := newChunkClient(t, url, token)
+	if ok, err := c.supported(ctx); err != nil {
+		return err
+	} else if !ok {
+		t.SendMessage("Destination does not support live transfers, stopping the server to transfer it...")
+		if err := stop(ctx); err != nil {
+			return fmt.Errorf("failed to stop server: %w", err)
+		}
+		_, err := t.PushArchiveToTarget(url, token, backups)
+		return err
+	}
+
+	running := t.Server.Environment.State() != environment.ProcessOfflineState
+	t.BackupUUIDs = backups
+	defer t.removeStaged()
+
+	// Copy all the server data while the server keeps running, recording the
+	// state of every file that was copied.
+	t.SetStatus(StatusPreSyncing)
+	t.SendMessage("Copying server data to destination while the server is running...")
+	a, err := t.Archive()
+	if err != nil {
+		t.Error(err, "Failed to get archive for transfer.")
+		return errors.New("failed to get archive for transfer")
+	}
+	snapshot := filesystem.Snapshot{}
+	a.archive.Snapshot = snapshot
+	archive, err := t.stageArchive(ctx, "archive", a.archive)
+	if err != nil {
+		return fmt.Errorf("failed to archive server: %w", err)
+	}
+	if err := c.send(ctx, []stagedFile{archive}, false); err != nil {
+		return err
+	}
+	// Importing the files on the target node can safely be repeated, so this is
+	// retried like any other request.
+	err = c.retry(ctx, "import copied server data", func() error {
+		_, err := c.do(ctx, http.MethodPost, c.endpoint("presync", nil), nil, nil, nil)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	t.removeStaged()
+
+	// Stop the server and send only what changed while it was being copied.
+	t.SetStatus(StatusFinalSyncing)
+	t.SendMessage("Stopping server to copy the remaining changes to destination...")
+	stopped := time.Now()
+	if err := stop(ctx); err != nil {
+		return fmt.Errorf("failed to stop server: %w", err)
+	}
+
+	current := filesystem.Snapshot{}
+	delta, err := t.stageArchive(ctx, "delta", &filesystem.Archive{
+		Filesystem: t.Server.Filesystem(),
+		Since:      snapshot,
+		Snapshot:   current,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to archive changed files: %w", err)
+	}
+	deletedFiles := snapshot.Deleted(current)
+	deleted, err := t.stageDeleted(deletedFiles)
+	if err != nil {
+		return fmt.Errorf("failed to write deleted files: %w", err)
+	}
+	extras, err := t.stageExtras(a)
+	if err != nil {
+		return err
+	}
+
+	var changed int
+	for p, st := range current {
+		if prev, ok := snapshot[p]; !ok || prev != st {
+			changed++
+		}
+	}
+	t.SendMessage(fmt.Sprintf("Sending %d changed and %d deleted files to destination...", changed, len(deletedFiles)))
+	if err := c.send(ctx, append([]stagedFile{delta, deleted}, extras...), running); err != nil {
+		return err
+	}
+	if err := c.complete(ctx); err != nil {
+		return err
+	}
+	t.SendMessage(fmt.Sprintf("Server was offline for %s during the transfer.", time.Since(stopped).Round(time.Second)))
+	return nil
+}
+
+// stageDeleted writes the paths of the files deleted since the pre-sync to disk
+// so they can be sent to the target node like any other file.
+func (t *Transfer) stageDeleted(paths []string) (stagedFile, error) {
+	if paths == nil {
+		paths = []string{}
+	}
+	b, err := json.Marshal(paths)
+	if err != nil {
+		return stagedFile{}, err
+	}
+	p := t.stagedPath("deleted")
+	if err := os.WriteFile(p, b, 0o600); err != nil {
+		return stagedFile{}, err
+	}
+	return stageFile("deleted", p)
+}
@@ -23,12 +23,23 @@ func Outgoing() *Manager {
 type Manager struct {
 	mu        sync.RWMutex
 	transfers map[string]*Transfer
+
+	// The servers waiting to start, in order, and those that have started when
+	// the transfers are run through the queue.
+	queued  []string
+	running map[string]struct{}
+
+	// Closed and replaced whenever the queue changes, waking every queued
+	// transfer so that it can check whether it can start.
+	wake chan struct{}
 }
 
 // NewManager returns a new transfer manager.
 func NewManager() *Manager {
 	return &Manager{
 		transfers: make(map[string]*Transfer),
+		running:   make(map[string]struct{}),
+		wake:      make(chan struct{}),
 	}
 }
 
@@ -46,6 +57,7 @@ func (m *Manager) Remove(transfer *Transfer) {
 	defer m.mu.Unlock()
 
 	delete(m.transfers, transfer.Server.ID())
+	m.removeQueuedLocked(transfer.Server.ID())
 }
 
 // Get gets a transfer from the manager using a server ID.
@@ -0,0 +1,268 @@
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+
+	"github.com/priyxstudio/propel/config"
+)
+
+// queuePollInterval is how often a queued transfer checks again whether it can
+// start, since transfer windows open without any event being emitted.
+const queuePollInterval = time.Second * 30
+
+// QueueStatus is the state of the queue of outgoing transfers on the node.
+type QueueStatus struct {
+	// Limit is the number of transfers that can run at once, 0 if unlimited.
+	Limit int `json:"limit"`
+	// Running are the IDs of the servers currently being transferred.
+	Running []string `json:"running"`
+	// Queued are the IDs of the servers waiting to be transferred, in the order
+	// they will be started.
+	Queued []string `json:"queued"`
+	// WindowOpen is true if queued transfers are allowed to start right now.
+	WindowOpen bool `json:"window_open"`
+	// NextWindow is when the next transfer window opens, this is only set when
+	// the current time is outside every window.
+	NextWindow *time.Time `json:"next_window,omitempty"`
+}
+
+// window is a daily time range in which queued transfers are allowed to start,
+// stored as offsets from midnight. A window that ends before it starts wraps
+// around midnight, and one that starts and ends at the same time is open all
+// day.
+type window struct {
+	start time.Duration
+	end   time.Duration
+}
+
+// parseWindow parses a time range in the format "15:04-15:04".
+func parseWindow(v string) (window, error) {
+	from, to, ok := strings.Cut(strings.TrimSpace(v), "-")
+	if !ok {
+		return window{}, fmt.Errorf("transfer: invalid window %q, expected a range such as 22:00-06:00", v)
+	}
+	var w window
+	for i, part := range []string{from, to} {
+		t, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return window{}, fmt.Errorf("transfer: invalid window %q: %w", v, err)
+		}
+		d := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+		if i == 0 {
+			w.start = d
+		} else {
+			w.end = d
+		}
+	}
+	return w, nil
+}
+
+// contains returns true if the offset from midnight is inside the window.
+func (w window) contains(d time.Duration) bool {
+	switch {
+	case w.start == w.end:
+		return true
+	case w.start < w.end:
+		return d >= w.start && d < w.end
+	default:
+		return d >= w.start || d < w.end
+	}
+}
+
+// transferWindows returns the configured transfer windows, skipping any that
+// cannot be parsed.
+func transferWindows() []window {
+	var windows []window
+	for _, v := range config.Get().System.Transfers.Windows {
+		w, err := parseWindow(v)
+		if err != nil {
+			log.WithField("window", v).WithError(err).Warn("ignoring invalid transfer window")
+			continue
+		}
+		windows = append(windows, w)
+	}
+	return windows
+}
+
+// sinceMidnight returns the time elapsed since midnight of the day of t.
+func sinceMidnight(t time.Time) time.Duration {
+	y, m, d := t.Date()
+	return t.Sub(time.Date(y, m, d, 0, 0, 0, 0, t.Location()))
+}
+
+// windowOpen returns true if transfers are allowed to start at the given time.
+// Transfers can start at any time if there are no windows.
+func windowOpen(now time.Time, windows []window) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	d := sinceMidnight(now)
+	for _, w := range windows {
+		if w.contains(d) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextWindow returns the next time after now that one of the windows opens.
+func nextWindow(now time.Time, windows []window) time.Time {
+	var next time.Time
+	y, m, d := now.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	for _, w := range windows {
+		start := midnight.Add(w.start)
+		if !start.After(now) {
+			start = time.Date(y, m, d+1, 0, 0, 0, 0, now.Location()).Add(w.start)
+		}
+		if next.IsZero() || start.Before(next) {
+			next = start
+		}
+	}
+	return next
+}
+
+// admitLocked starts the transfer if it is first in the queue, there is a free
+// slot and transfers are allowed to start right now. This must be called while
+// holding the lock.
+func (m *Manager) admitLocked(id string, limit int, open bool) bool {
+	if _, ok := m.running[id]; ok {
+		return true
+	}
+	if len(m.queued) == 0 || m.queued[0] != id || !open || (limit > 0 && len(m.running) >= limit) {
+		return false
+	}
+	m.queued = m.queued[1:]
+	m.running[id] = struct{}{}
+	m.broadcastLocked()
+	return true
+}
+
+// broadcastLocked wakes every queued transfer so that it checks whether it can
+// start. This must be called while holding the lock.
+func (m *Manager) broadcastLocked() {
+	close(m.wake)
+	m.wake = make(chan struct{})
+}
+
+// removeQueuedLocked removes a server from the queue, freeing its slot if the
+// transfer was running. This must be called while holding the lock.
+func (m *Manager) removeQueuedLocked(id string) {
+	for i, v := range m.queued {
+		if v == id {
+			m.queued = append(m.queued[:i:i], m.queued[i+1:]...)
+			break
+		}
+	}
+	delete(m.running, id)
+	m.broadcastLocked()
+}
+
+// Enqueue adds the transfer to the end of the queue, returning true if it was
+// started straight away. A transfer that was not started must call Wait before
+// it runs. The transfer leaves the queue once it is removed from the manager.
+func (m *Manager) Enqueue(t *Transfer) bool {
+	cfg := config.Get().System.Transfers
+	open := windowOpen(time.Now(), transferWindows())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := t.Server.ID()
+	m.removeQueuedLocked(id)
+	m.queued = append(m.queued, id)
+	return m.admitLocked(id, cfg.MaxConcurrent, open)
+}
+
+// Wait blocks until the queued transfer is allowed to start, keeping the status
+// of the transfer up to date while it waits.
+func (m *Manager) Wait(ctx context.Context, t *Transfer) error {
+	id := t.Server.ID()
+	t.SetStatus(StatusQueued)
+
+	var last int
+	for {
+		windows := transferWindows()
+		now := time.Now()
+		open := windowOpen(now, windows)
+
+		m.mu.Lock()
+		if m.admitLocked(id, config.Get().System.Transfers.MaxConcurrent, open) {
+			m.mu.Unlock()
+			return nil
+		}
+		position := m.positionLocked(id)
+		wake := m.wake
+		m.mu.Unlock()
+
+		if position == 0 {
+			return fmt.Errorf("transfer: server %s is no longer queued", id)
+		}
+		if position != last {
+			last = position
+			if position == 1 && !open {
+				t.SendMessage(fmt.Sprintf("Transfer is queued until the next transfer window opens at %s.", nextWindow(now, windows).Format(time.Kitchen)))
+			} else {
+				t.SendMessage(fmt.Sprintf("Transfer is queued at position %d.", position))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-wake:
+		case <-time.After(queuePollInterval):
+		}
+	}
+}
+
+// positionLocked returns the position of the server in the queue starting at 1,
+// or 0 if it is not queued. This must be called while holding the lock.
+func (m *Manager) positionLocked(id string) int {
+	for i, v := range m.queued {
+		if v == id {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Position returns the position of the server in the queue starting at 1, or 0
+// if it is not queued.
+func (m *Manager) Position(id string) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.positionLocked(id)
+}
+
+// Queue returns the state of the queue.
+func (m *Manager) Queue() QueueStatus {
+	windows := transferWindows()
+	now := time.Now()
+	status := QueueStatus{
+		Limit:      max(config.Get().System.Transfers.MaxConcurrent, 0),
+		Running:    []string{},
+		WindowOpen: windowOpen(now, windows),
+	}
+	if !status.WindowOpen {
+		next := nextWindow(now, windows)
+		status.NextWindow = &next
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for id := range m.running {
+		status.Running = append(status.Running, id)
+	}
+	sort.Strings(status.Running)
+	status.Queued = append([]string{}, m.queued...)
+	return status
+}
@@ -0,0 +1,80 @@
+package transfer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTransferWindows(t *testing.T) {
+	if _, err := parseWindow("22:00"); err == nil {
+		t.Fatal("expected window without an end to be rejected")
+	}
+	if _, err := parseWindow("25:00-06:00"); err == nil {
+		t.Fatal("expected window with an invalid time to be rejected")
+	}
+	night, err := parseWindow("22:00-06:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lunch, err := parseWindow(" 12:00 - 13:30 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	windows := []window{night, lunch}
+
+	at := func(h, m int) time.Time {
+		return time.Date(2024, 3, 10, h, m, 0, 0, time.UTC)
+	}
+	cases := map[time.Time]bool{
+		at(23, 0):  true,
+		at(3, 0):   true,
+		at(6, 0):   false,
+		at(12, 30): true,
+		at(13, 30): false,
+		at(18, 0):  false,
+	}
+	for now, expected := range cases {
+		if got := windowOpen(now, windows); got != expected {
+			t.Errorf("%s: expected open to be %t", now.Format("15:04"), expected)
+		}
+	}
+	if !windowOpen(at(18, 0), nil) {
+		t.Error("expected transfers to start at any time without windows")
+	}
+
+	if next := nextWindow(at(18, 0), windows); !next.Equal(at(22, 0)) {
+		t.Errorf("expected next window at 22:00, got %s", next)
+	}
+	if next := nextWindow(at(14, 0), []window{lunch}); !next.Equal(at(12, 0).AddDate(0, 0, 1)) {
+		t.Errorf("expected next window tomorrow at 12:00, got %s", next)
+	}
+}
+
+func TestQueueOrder(t *testing.T) {
+	m := NewManager()
+	m.queued = []string{"a", "b", "c"}
+
+	if m.admitLocked("b", 2, true) {
+		t.Fatal("expected transfer behind the head of the queue to wait")
+	}
+	if !m.admitLocked("a", 2, true) || !m.admitLocked("b", 2, true) {
+		t.Fatal("expected transfers to start while there are free slots")
+	}
+	if m.admitLocked("c", 2, true) {
+		t.Fatal("expected transfer to wait while every slot is in use")
+	}
+	if got := m.positionLocked("c"); got != 1 {
+		t.Fatalf("expected position 1, got %d", got)
+	}
+
+	m.removeQueuedLocked("a")
+	if m.admitLocked("c", 2, false) {
+		t.Fatal("expected transfer to wait for a transfer window")
+	}
+	if !m.admitLocked("c", 2, true) {
+		t.Fatal("expected transfer to start once a slot is free")
+	}
+	if got := m.positionLocked("c"); got != 0 {
+		t.Fatalf("expected running transfer to have no position, got %d", got)
+	}
+}
@@ -63,7 +63,7 @@ func (t *Transfer) PushArchiveToTarget(url, token string, backups []string) ([]b
 	req.Header.Set("Authorization", token)
 
 	// Create a new multipart writer that writes the archive to the pipe.
-	mp := multipart.NewWriter(writer)
+	mp := multipart.NewWriter(t.limitWriter(writer))
 	defer mp.Close()
 	req.Header.Set("Content-Type", mp.FormDataContentType())
 
@@ -146,6 +146,11 @@ func (t *Transfer) PushArchiveToTarget(url, token string, backups []string) ([]b
 		}
 		t.SendMessage("Finished streaming the install logs to destination.")
 
+		if err := a.StreamConsoleTranscripts(ctx, mp); err != nil {
+			errChan <- fmt.Errorf("failed to stream console transcripts: %w", err)
+			return
+		}
+
 		if err := mp.Close(); err != nil {
 			t.Log().WithError(err).Error("error while closing multipart writer")
 		}
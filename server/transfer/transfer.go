@@ -2,11 +2,16 @@ package transfer
 
 import (
 	"context"
+	"io"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/apex/log"
+	"github.com/juju/ratelimit"
 	"github.com/mitchellh/colorstring"
 
+	"github.com/priyxstudio/propel/config"
 	"github.com/priyxstudio/propel/server"
 	"github.com/priyxstudio/propel/system"
 )
@@ -22,9 +27,18 @@ func (s Status) String() string {
 const (
 	// StatusPending is the status of a transfer when it is first created.
 	StatusPending Status = "pending"
+	// StatusQueued is the status of a transfer while it waits in the queue of
+	// outgoing transfers for a free slot or transfer window.
+	StatusQueued Status = "queued"
 	// StatusProcessing is the status of a transfer when it is currently in
 	// progress, such as when the archive is being streamed to the target node.
 	StatusProcessing Status = "processing"
+	// StatusPreSyncing is the status of a live transfer while the server data is
+	// being copied to the target node as the server keeps running.
+	StatusPreSyncing Status = "pre-syncing"
+	// StatusFinalSyncing is the status of a live transfer once the server has
+	// been stopped and only the files changed since the pre-sync are being sent.
+	StatusFinalSyncing Status = "final-syncing"
 
 	// StatusCancelling is the status of a transfer when it is in the process of
 	// being cancelled.
@@ -56,6 +70,18 @@ type Transfer struct {
 
 	// BackupUUIDs is a list of backup UUIDs to transfer along with the server.
 	BackupUUIDs []string
+
+	// State is the persisted state of an incoming resumable transfer, this is nil
+	// for transfers received in a single request.
+	State *IncomingState
+
+	// finished is set once the result of an incoming transfer has been handled.
+	finished atomic.Bool
+
+	// bucket limits the rate data is sent to the target node, shared by every
+	// request made for the transfer.
+	bucket     *ratelimit.Bucket
+	bucketOnce sync.Once
 }
 
 // New returns a new transfer instance for the given server.
@@ -94,6 +120,12 @@ func (t *Transfer) Cancel() {
 	(*t.cancel)()
 }
 
+// MarkFinished marks the transfer as finished, returning false if it had been
+// marked as finished already.
+func (t *Transfer) MarkFinished() bool {
+	return t.finished.CompareAndSwap(false, true)
+}
+
 // Status returns the current status of the transfer.
 func (t *Transfer) Status() Status {
 	return t.status.Load()
@@ -122,6 +154,36 @@ func (t *Transfer) Error(err error, v string) {
 	t.SendMessage(v)
 }
 
+// uploadBucket returns the token bucket used to limit the rate data is sent to
+// the target node, or nil if there is no upload limit.
+func (t *Transfer) uploadBucket() *ratelimit.Bucket {
+	t.bucketOnce.Do(func() {
+		// Token bucket with a capacity of "limit" MiB, adding "limit" MiB/s.
+		if limit := int64(config.Get().System.Transfers.UploadLimit) * 1024 * 1024; limit > 0 {
+			t.bucket = ratelimit.NewBucketWithRate(float64(limit), limit)
+		}
+	})
+	return t.bucket
+}
+
+// limitReader wraps a reader of data being sent to the target node with the
+// upload limit of the transfer.
+func (t *Transfer) limitReader(r io.Reader) io.Reader {
+	if b := t.uploadBucket(); b != nil {
+		return ratelimit.Reader(r, b)
+	}
+	return r
+}
+
+// limitWriter wraps a writer of data being sent to the target node with the
+// upload limit of the transfer.
+func (t *Transfer) limitWriter(w io.Writer) io.Writer {
+	if b := t.uploadBucket(); b != nil {
+		return ratelimit.Writer(w, b)
+	}
+	return w
+}
+
 // Log returns a logger for the transfer.
 func (t *Transfer) Log() *log.Entry {
 	if t.Server == nil {
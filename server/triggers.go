@@ -0,0 +1,314 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/apex/log"
+	"github.com/goccy/go-json"
+	"gorm.io/gorm"
+
+	"github.com/priyxstudio/propel/internal/database"
+	"github.com/priyxstudio/propel/internal/models"
+	"github.com/priyxstudio/propel/remote"
+	"github.com/priyxstudio/propel/system"
+)
+
+// ErrConsoleTriggerNotFound is returned when a console trigger does not exist for
+// the server it is being requested for.
+var ErrConsoleTriggerNotFound = errors.Sentinel("server: console trigger not found")
+
+// The minimum amount of time between two executions of the same trigger. This
+// applies even when a trigger is configured without a cooldown so that a single
+// noisy line of output cannot flood the server with actions.
+const minimumTriggerCooldown = time.Second
+
+type TriggerMatchPayload struct {
+	ID     uint                        `json:"id"`
+	Name   string                      `json:"name"`
+	Action models.ConsoleTriggerAction `json:"action"`
+	Line   string                      `json:"line"`
+}
+
+type compiledTrigger struct {
+	models.ConsoleTrigger
+	re *regexp.Regexp
+}
+
+// triggerSet caches the compiled console triggers for a server so that the
+// database is not queried for every line of output. The zero value is ready
+// to use, and the triggers are loaded on the first line of output processed.
+type triggerSet struct {
+	mu       sync.Mutex
+	loaded   bool
+	triggers []compiledTrigger
+	fired    map[uint]time.Time
+}
+
+// invalidate marks the cached triggers as stale, causing them to be loaded from
+// the database again when the next line of output is processed.
+func (ts *triggerSet) invalidate() {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.loaded = false
+}
+
+// claim records an execution of the trigger and returns true if the trigger is
+// not currently in its cooldown period.
+func (ts *triggerSet) claim(t models.ConsoleTrigger, now time.Time) bool {
+	cooldown := time.Duration(t.Cooldown) * time.Second
+	if cooldown < minimumTriggerCooldown {
+		cooldown = minimumTriggerCooldown
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if last, ok := ts.fired[t.ID]; ok && now.Sub(last) < cooldown {
+		return false
+	}
+	if ts.fired == nil {
+		ts.fired = make(map[uint]time.Time)
+	}
+	ts.fired[t.ID] = now
+	return true
+}
+
+// ValidateConsoleTrigger ensures that a console trigger has a valid pattern and
+// action, and that the payload is valid for the action being performed.
+func ValidateConsoleTrigger(t *models.ConsoleTrigger) error {
+	if _, err := regexp.Compile(t.Pattern); err != nil {
+		return errors.Errorf("invalid pattern: %s", err)
+	}
+	if !t.Action.IsValid() {
+		return errors.Errorf("invalid action: %s", t.Action)
+	}
+	if t.Cooldown < 0 {
+		return errors.New("cooldown must not be negative")
+	}
+	switch t.Action {
+	case models.ConsoleTriggerActionCommand:
+		if t.Payload == "" {
+			return errors.New("a command must be provided for command actions")
+		}
+	case models.ConsoleTriggerActionWebhook:
+		u, err := url.Parse(t.Payload)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("a valid http(s) URL must be provided for webhook actions")
+		}
+	}
+	return nil
+}
+
+// ConsoleTriggers returns all the console triggers defined for the server.
+func (s *Server) ConsoleTriggers() ([]models.ConsoleTrigger, error) {
+	var triggers []models.ConsoleTrigger
+	if err := database.Instance().Where("server_uuid = ?", s.ID()).
+		Order("id ASC").
+		Find(&triggers).Error; err != nil {
+		return nil, errors.Wrap(err, "failed to fetch console triggers")
+	}
+	return triggers, nil
+}
+
+// ConsoleTrigger returns a single console trigger for the server.
+func (s *Server) ConsoleTrigger(id uint) (*models.ConsoleTrigger, error) {
+	var t models.ConsoleTrigger
+	if err := database.Instance().Where("server_uuid = ?", s.ID()).First(&t, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrConsoleTriggerNotFound
+		}
+		return nil, errors.Wrap(err, "failed to fetch console trigger")
+	}
+	return &t, nil
+}
+
+// SaveConsoleTrigger validates and then creates or updates the console trigger
+// for the server. The triggers in use are reloaded once it has been saved.
+func (s *Server) SaveConsoleTrigger(t *models.ConsoleTrigger) error {
+	if err := ValidateConsoleTrigger(t); err != nil {
+		return err
+	}
+	t.ServerUUID = s.ID()
+	if err := database.Instance().Save(t).Error; err != nil {
+		return errors.Wrap(err, "failed to save console trigger")
+	}
+	s.triggers.invalidate()
+	return nil
+}
+
+// DeleteConsoleTrigger deletes a single console trigger for the server.
+func (s *Server) DeleteConsoleTrigger(id uint) error {
+	tx := database.Instance().Unscoped().Where("server_uuid = ?", s.ID()).Delete(&models.ConsoleTrigger{}, id)
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "failed to delete console trigger")
+	}
+	if tx.RowsAffected == 0 {
+		return ErrConsoleTriggerNotFound
+	}
+	s.triggers.invalidate()
+	return nil
+}
+
+// DeleteAllConsoleTriggers removes every console trigger for the server, this
+// is used when the server is being deleted from the node.
+func (s *Server) DeleteAllConsoleTriggers() error {
+	if err := database.Instance().Unscoped().Where("server_uuid = ?", s.ID()).Delete(&models.ConsoleTrigger{}).Error; err != nil {
+		return errors.Wrap(err, "failed to delete console triggers")
+	}
+	s.triggers.invalidate()
+	return nil
+}
+
+// loadTriggers returns the enabled console triggers for the server, loading
+// and compiling them from the database if they are not already cached.
+func (s *Server) loadTriggers() []compiledTrigger {
+	s.triggers.mu.Lock()
+	defer s.triggers.mu.Unlock()
+	if s.triggers.loaded {
+		return s.triggers.triggers
+	}
+
+	// Mark the triggers as loaded even if there is an error, otherwise a database
+	// failure would result in a query for every single line of output.
+	s.triggers.loaded = true
+	s.triggers.triggers = nil
+
+	var rows []models.ConsoleTrigger
+	if err := database.Instance().Where("server_uuid = ? AND enabled = ?", s.ID(), true).
+		Order("id ASC").
+		Find(&rows).Error; err != nil {
+		s.Log().WithField("error", err).Error("failed to load console triggers")
+		return nil
+	}
+
+	triggers := make([]compiledTrigger, 0, len(rows))
+	for _, row := range rows {
+		re, err := regexp.Compile(row.Pattern)
+		if err != nil {
+			s.Log().WithField("trigger", row.ID).WithField("error", err).Warn("skipping console trigger with invalid pattern")
+			continue
+		}
+		triggers = append(triggers, compiledTrigger{ConsoleTrigger: row, re: re})
+	}
+	s.triggers.triggers = triggers
+	return triggers
+}
+
+// evaluateTriggers checks a line of console output against the triggers for the
+// server and executes the action for any that match and are not cooling down.
+func (s *Server) evaluateTriggers(data []byte) {
+	triggers := s.loadTriggers()
+	if len(triggers) == 0 {
+		return
+	}
+
+	line := string(stripAnsiRegex.ReplaceAll(data, []byte("")))
+	now := time.Now()
+	for _, t := range triggers {
+		if !t.re.MatchString(line) || !s.triggers.claim(t.ConsoleTrigger, now) {
+			continue
+		}
+		go s.runTrigger(t.ConsoleTrigger, line)
+	}
+}
+
+// runTrigger performs the action for a console trigger that has matched a line
+// of output, and records the match in the activity log for the server.
+func (s *Server) runTrigger(t models.ConsoleTrigger, line string) {
+	l := s.Log().WithFields(log.Fields{"trigger": t.ID, "action": t.Action})
+	l.WithField("against", strconv.QuoteToASCII(line)).Debug("console trigger matched output")
+
+	s.Events().Publish(TriggerMatchEvent, TriggerMatchPayload{
+		ID:     t.ID,
+		Name:   t.Name,
+		Action: t.Action,
+		Line:   line,
+	})
+	s.SaveActivity(s.NewRequestActivity("", ""), ActivityConsoleTrigger, models.ActivityMeta{
+		"trigger": t.ID,
+		"name":    t.Name,
+		"pattern": t.Pattern,
+		"action":  t.Action,
+		"line":    line,
+	})
+
+	var err error
+	switch t.Action {
+	case models.ConsoleTriggerActionCommand:
+		err = s.Environment.SendCommand(t.Payload)
+	case models.ConsoleTriggerActionRestart:
+		s.PublishConsoleOutputFromDaemon("Console trigger matched, restarting server...")
+		err = s.HandlePowerAction(PowerActionRestart)
+	case models.ConsoleTriggerActionStop:
+		s.PublishConsoleOutputFromDaemon("Console trigger matched, stopping server...")
+		err = s.HandlePowerAction(PowerActionStop)
+	case models.ConsoleTriggerActionBackup:
+		s.PublishConsoleOutputFromDaemon("Console trigger matched, requesting a backup...")
+		err = s.requestTriggerBackup(t)
+	case models.ConsoleTriggerActionWebhook:
+		err = s.sendTriggerWebhook(t, line)
+	}
+	if err != nil {
+		l.WithField("error", err).Warn("failed to execute console trigger action")
+	}
+}
+
+// requestTriggerBackup asks the Panel to create a backup of the server, named
+// after the trigger that requested it.
+func (s *Server) requestTriggerBackup(t models.ConsoleTrigger) error {
+	name := t.Name
+	if name == "" {
+		name = "trigger #" + strconv.FormatUint(uint64(t.ID), 10)
+	}
+	ctx, cancel := context.WithTimeout(s.Context(), time.Second*30)
+	defer cancel()
+	if err := s.client.RequestBackup(ctx, s.ID(), remote.CreateBackupRequest{
+		Name: "Console trigger: " + name,
+	}); err != nil {
+		return errors.Wrap(err, "failed to request backup from panel")
+	}
+	return nil
+}
+
+// sendTriggerWebhook delivers a JSON payload describing the trigger match to the
+// URL configured for the trigger.
+func (s *Server) sendTriggerWebhook(t models.ConsoleTrigger, line string) error {
+	b, err := json.Marshal(map[string]interface{}{
+		"server":    s.ID(),
+		"trigger":   t.ID,
+		"name":      t.Name,
+		"pattern":   t.Pattern,
+		"line":      line,
+		"timestamp": time.Now().UTC(),
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	ctx, cancel := context.WithTimeout(s.Context(), time.Second*10)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.Payload, bytes.NewReader(b))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Propel Wings/v"+system.Version)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return errors.Errorf("webhook responded with status code %d", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+
+	"github.com/priyxstudio/propel/internal/models"
+	"github.com/priyxstudio/propel/remote"
+)
+
+// backupClient records the backups requested from the Panel.
+type backupClient struct {
+	remote.Client
+	uuid     string
+	requests []remote.CreateBackupRequest
+}
+
+func (c *backupClient) RequestBackup(_ context.Context, uuid string, data remote.CreateBackupRequest) error {
+	c.uuid = uuid
+	c.requests = append(c.requests, data)
+	return nil
+}
+
+func TestConsoleTriggers(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("ValidateConsoleTrigger", func() {
+		g.It("accepts a valid command trigger", func() {
+			err := ValidateConsoleTrigger(&models.ConsoleTrigger{
+				Pattern: "^Done \\(",
+				Action:  models.ConsoleTriggerActionCommand,
+				Payload: "say hello",
+			})
+			g.Assert(err).IsNil()
+		})
+
+		g.It("rejects an invalid pattern", func() {
+			err := ValidateConsoleTrigger(&models.ConsoleTrigger{
+				Pattern: "([a-z",
+				Action:  models.ConsoleTriggerActionRestart,
+			})
+			g.Assert(err == nil).IsFalse()
+		})
+
+		g.It("rejects an unknown action", func() {
+			err := ValidateConsoleTrigger(&models.ConsoleTrigger{
+				Pattern: "crash",
+				Action:  "explode",
+			})
+			g.Assert(err == nil).IsFalse()
+		})
+
+		g.It("requires a URL for webhook actions", func() {
+			err := ValidateConsoleTrigger(&models.ConsoleTrigger{
+				Pattern: "crash",
+				Action:  models.ConsoleTriggerActionWebhook,
+				Payload: "file:///etc/passwd",
+			})
+			g.Assert(err == nil).IsFalse()
+		})
+	})
+
+	g.Describe("requestTriggerBackup", func() {
+		g.It("asks the panel to create a backup", func() {
+			client := &backupClient{}
+			s, err := New(client)
+			g.Assert(err).IsNil()
+			s.cfg.Uuid = "8a5b7b6e-3b8c-4c1f-9e6b-2f3f4d5e6a7b"
+
+			err = s.requestTriggerBackup(models.ConsoleTrigger{ID: 3, Name: "world corrupted", Action: models.ConsoleTriggerActionBackup})
+			g.Assert(err).IsNil()
+			g.Assert(client.uuid).Equal(s.ID())
+			g.Assert(len(client.requests)).Equal(1)
+			g.Assert(client.requests[0].Name).Equal("Console trigger: world corrupted")
+		})
+	})
+
+	g.Describe("triggerSet", func() {
+		g.It("does not fire a trigger again during its cooldown", func() {
+			var ts triggerSet
+			trigger := models.ConsoleTrigger{ID: 1, Cooldown: 10}
+			now := time.Now()
+
+			g.Assert(ts.claim(trigger, now)).IsTrue()
+			g.Assert(ts.claim(trigger, now.Add(time.Second*5))).IsFalse()
+			g.Assert(ts.claim(trigger, now.Add(time.Second*10))).IsTrue()
+		})
+
+		g.It("applies a minimum cooldown", func() {
+			var ts triggerSet
+			trigger := models.ConsoleTrigger{ID: 1}
+			now := time.Now()
+
+			g.Assert(ts.claim(trigger, now)).IsTrue()
+			g.Assert(ts.claim(trigger, now.Add(time.Millisecond))).IsFalse()
+			g.Assert(ts.claim(models.ConsoleTrigger{ID: 2}, now)).IsTrue()
+		})
+	})
+}
@@ -27,7 +27,7 @@ func (s *Server) SyncWithEnvironment() {
 	s.Environment.Config().SetSettings(environment.Settings{
 		Mounts:      s.Mounts(),
 		Allocations: cfg.Allocations,
-		Limits:      cfg.Build,
+		Limits:      s.placedLimits(),
 		Labels:      cfg.Labels,
 	})
 
@@ -0,0 +1,556 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/gammazero/workerpool"
+	"github.com/goccy/go-json"
+	"gorm.io/gorm"
+
+	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/events"
+	"github.com/priyxstudio/propel/internal/database"
+	"github.com/priyxstudio/propel/internal/models"
+	"github.com/priyxstudio/propel/system"
+)
+
+// ErrWebhookNotFound is returned when a webhook does not exist for the server it
+// is being requested for.
+var ErrWebhookNotFound = errors.Sentinel("server: webhook not found")
+
+// Defines the server lifecycle events that can be delivered to webhooks.
+const (
+	WebhookEventStatus            = "server.status"
+	WebhookEventCrashed           = "server.crashed"
+	WebhookEventUnhealthy         = "server.unhealthy"
+	WebhookEventInstalled         = "server.installed"
+	WebhookEventBackupCompleted   = "backup.completed"
+	WebhookEventBackupFailed      = "backup.failed"
+	WebhookEventTransferStatus    = "transfer.status"
+	WebhookEventCertificateFailed = "proxy.certificate_failed"
+)
+
+// WebhookEvents contains every event that can be delivered to a webhook.
+var WebhookEvents = []string{
+	WebhookEventStatus,
+	WebhookEventCrashed,
+	WebhookEventUnhealthy,
+	WebhookEventInstalled,
+	WebhookEventBackupCompleted,
+	WebhookEventBackupFailed,
+	WebhookEventTransferStatus,
+	WebhookEventCertificateFailed,
+}
+
+// The maximum number of queued deliveries that are attempted in a single run of
+// the delivery queue.
+const webhookDeliveryBatchSize = 100
+
+// The number of endpoints that queued deliveries are sent to at the same time.
+const webhookDeliveryWorkers = 4
+
+// WebhookPayload is the body delivered to webhooks using the generic JSON format.
+type WebhookPayload struct {
+	Event     string      `json:"event"`
+	Server    string      `json:"server"`
+	Name      string      `json:"name"`
+	Message   string      `json:"message"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// ValidateWebhook ensures that a webhook has a valid URL and format, and only
+// subscribes to events that exist.
+func ValidateWebhook(w *models.Webhook) error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("a valid http(s) URL must be provided")
+	}
+	if !w.Format.IsValid() {
+		return errors.Errorf("invalid format: %s", w.Format)
+	}
+	for _, e := range w.Events {
+		if !slices.Contains(WebhookEvents, e) {
+			return errors.Errorf("invalid event: %s", e)
+		}
+	}
+	return nil
+}
+
+// Webhooks returns all the webhooks defined for the server.
+func (s *Server) Webhooks() ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	if err := database.Instance().Where("server_uuid = ?", s.ID()).
+		Order("id ASC").
+		Find(&webhooks).Error; err != nil {
+		return nil, errors.Wrap(err, "failed to fetch webhooks")
+	}
+	return webhooks, nil
+}
+
+// Webhook returns a single webhook for the server.
+func (s *Server) Webhook(id uint) (*models.Webhook, error) {
+	var w models.Webhook
+	if err := database.Instance().Where("server_uuid = ?", s.ID()).First(&w, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, errors.Wrap(err, "failed to fetch webhook")
+	}
+	return &w, nil
+}
+
+// SaveWebhook validates and then creates or updates the webhook for the server.
+func (s *Server) SaveWebhook(w *models.Webhook) error {
+	if err := ValidateWebhook(w); err != nil {
+		return err
+	}
+	w.ServerUUID = s.ID()
+	if err := database.Instance().Save(w).Error; err != nil {
+		return errors.Wrap(err, "failed to save webhook")
+	}
+	return nil
+}
+
+// DeleteWebhook deletes a single webhook for the server. Any deliveries that are
+// still queued for the webhook are discarded.
+func (s *Server) DeleteWebhook(id uint) error {
+	tx := database.Instance().Unscoped().Where("server_uuid = ?", s.ID()).Delete(&models.Webhook{}, id)
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "failed to delete webhook")
+	}
+	if tx.RowsAffected == 0 {
+		return ErrWebhookNotFound
+	}
+	if err := database.Instance().
+		Where("webhook_id = ? AND status = ?", id, models.WebhookDeliveryPending).
+		Delete(&models.WebhookDelivery{}).Error; err != nil {
+		return errors.Wrap(err, "failed to delete queued webhook deliveries")
+	}
+	return nil
+}
+
+// DeleteAllWebhooks removes every webhook and webhook delivery for the server,
+// this is used when the server is being deleted from the node.
+func (s *Server) DeleteAllWebhooks() error {
+	db := database.Instance()
+	if err := db.Unscoped().Where("server_uuid = ?", s.ID()).Delete(&models.Webhook{}).Error; err != nil {
+		return errors.Wrap(err, "failed to delete webhooks")
+	}
+	if err := db.Where("server_uuid = ?", s.ID()).Delete(&models.WebhookDelivery{}).Error; err != nil {
+		return errors.Wrap(err, "failed to delete webhook deliveries")
+	}
+	return nil
+}
+
+// WebhookDeliveries returns the most recent webhook deliveries for the server,
+// newest first. If a webhook ID is provided only the deliveries for that webhook
+// are returned.
+func (s *Server) WebhookDeliveries(webhook uint, limit int) ([]models.WebhookDelivery, error) {
+	tx := database.Instance().Where("server_uuid = ?", s.ID())
+	if webhook != 0 {
+		tx = tx.Where("webhook_id = ?", webhook)
+	}
+	var deliveries []models.WebhookDelivery
+	if err := tx.Order("id DESC").Limit(limit).Find(&deliveries).Error; err != nil {
+		return nil, errors.Wrap(err, "failed to fetch webhook deliveries")
+	}
+	return deliveries, nil
+}
+
+// WebhookDeliveries returns the most recent webhook deliveries for every server
+// on the node, newest first. If a status is provided only deliveries with that
+// status are returned.
+func WebhookDeliveries(status models.WebhookDeliveryStatus, limit int) ([]models.WebhookDelivery, error) {
+	tx := database.Instance()
+	if status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+	var deliveries []models.WebhookDelivery
+	if err := tx.Order("id DESC").Limit(limit).Find(&deliveries).Error; err != nil {
+		return nil, errors.Wrap(err, "failed to fetch webhook deliveries")
+	}
+	return deliveries, nil
+}
+
+// listenForWebhookEvents converts the events emitted for the server into webhook
+// deliveries until the server is deleted.
+func (s *Server) listenForWebhookEvents() {
+	c := make(chan []byte, 8)
+	s.Events().On(c)
+
+	go func() {
+		defer s.Events().Off(c)
+		for {
+			select {
+			case v, ok := <-c:
+				if !ok {
+					return
+				}
+				var e events.Event
+				if err := events.DecodeTo(v, &e); err != nil {
+					continue
+				}
+				if event, data, ok := webhookEvent(e); ok {
+					s.notifyWebhooks(event, data)
+				}
+			case <-s.Context().Done():
+				return
+			}
+		}
+	}()
+}
+
+// webhookEvent returns the webhook event and data for an event emitted by the
+// server. Events that are not delivered to webhooks return false.
+func webhookEvent(e events.Event) (string, interface{}, bool) {
+	switch e.Topic {
+	case StatusEvent:
+		return WebhookEventStatus, map[string]interface{}{"state": e.Data}, true
+	case InstallCompletedEvent:
+		return WebhookEventInstalled, nil, true
+	case BackupCompletedEvent:
+		if d, ok := e.Data.(map[string]interface{}); ok && d["is_successful"] == true {
+			return WebhookEventBackupCompleted, e.Data, true
+		}
+		return WebhookEventBackupFailed, e.Data, true
+	case TransferStatusEvent:
+		return WebhookEventTransferStatus, map[string]interface{}{"status": e.Data}, true
+	case CertificateRenewalFailedEvent:
+		return WebhookEventCertificateFailed, e.Data, true
+	}
+	return "", nil, false
+}
+
+// webhookMessage returns a short human readable description of a webhook event
+// that is used for the chat formats.
+func webhookMessage(name string, event string, data interface{}) string {
+	switch event {
+	case WebhookEventStatus:
+		if d, ok := data.(map[string]interface{}); ok {
+			return fmt.Sprintf("%s is now %v.", name, d["state"])
+		}
+	case WebhookEventCrashed:
+		if r, ok := data.(*models.CrashReport); ok {
+			return fmt.Sprintf("%s crashed with exit code %d (out of memory: %t), outcome: %s.", name, r.ExitCode, r.OOMKilled, r.Outcome)
+		}
+	case WebhookEventUnhealthy:
+		if d, ok := data.(map[string]interface{}); ok {
+			return fmt.Sprintf("%s failed %v consecutive health checks, action: %v.", name, d["failures"], d["action"])
+		}
+	case WebhookEventInstalled:
+		return fmt.Sprintf("Installation of %s has completed.", name)
+	case WebhookEventBackupCompleted:
+		if d, ok := data.(map[string]interface{}); ok {
+			return fmt.Sprintf("Backup %v of %s completed successfully.", d["uuid"], name)
+		}
+	case WebhookEventBackupFailed:
+		if d, ok := data.(map[string]interface{}); ok {
+			return fmt.Sprintf("Backup %v of %s failed.", d["uuid"], name)
+		}
+	case WebhookEventTransferStatus:
+		if d, ok := data.(map[string]interface{}); ok {
+			return fmt.Sprintf("Transfer of %s is now %v.", name, d["status"])
+		}
+	case WebhookEventCertificateFailed:
+		if d, ok := data.(map[string]interface{}); ok {
+			return fmt.Sprintf("The certificate of %v for %s could not be renewed and expires at %v.", d["domain"], name, d["expires_at"])
+		}
+	}
+	return fmt.Sprintf("%s: %s", name, event)
+}
+
+// webhookColor returns the embed color used for an event in the chat formats.
+func webhookColor(event string) int {
+	switch event {
+	case WebhookEventCrashed, WebhookEventUnhealthy, WebhookEventBackupFailed:
+		return 0xe74c3c
+	case WebhookEventInstalled, WebhookEventBackupCompleted:
+		return 0x2ecc71
+	}
+	return 0x3498db
+}
+
+// renderWebhookPayload renders the body of a webhook request in the given format.
+func renderWebhookPayload(format models.WebhookFormat, p WebhookPayload) ([]byte, error) {
+	var v interface{}
+	switch format {
+	case models.WebhookFormatDiscord:
+		v = map[string]interface{}{
+			"username": "Propel Wings",
+			"embeds": []map[string]interface{}{{
+				"title":       p.Event,
+				"description": p.Message,
+				"color":       webhookColor(p.Event),
+				"timestamp":   p.Timestamp.Format(time.RFC3339),
+				"footer":      map[string]string{"text": p.Server},
+			}},
+		}
+	case models.WebhookFormatSlack:
+		v = map[string]interface{}{
+			"text": p.Message,
+			"attachments": []map[string]interface{}{{
+				"color":  fmt.Sprintf("#%06x", webhookColor(p.Event)),
+				"title":  p.Event,
+				"text":   p.Message,
+				"footer": p.Server,
+				"ts":     p.Timestamp.Unix(),
+			}},
+		}
+	default:
+		v = p
+	}
+	b, err := json.Marshal(v)
+	return b, errors.WithStack(err)
+}
+
+// signWebhookPayload returns the HMAC-SHA256 signature of the payload using the
+// secret, or an empty string if there is no secret.
+func signWebhookPayload(secret string, payload []byte) string {
+	if secret == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// wantsWebhookEvent returns true if a webhook subscribed to the given events
+// should receive the event.
+func wantsWebhookEvent(subscribed []string, event string) bool {
+	return len(subscribed) == 0 || slices.Contains(subscribed, event)
+}
+
+// newWebhookDelivery renders the payload for a webhook and returns a delivery for
+// it that is ready to be queued.
+func newWebhookDelivery(p WebhookPayload, webhook uint, u string, format models.WebhookFormat, secret string) (models.WebhookDelivery, error) {
+	if format == "" {
+		format = models.WebhookFormatJSON
+	}
+	b, err := renderWebhookPayload(format, p)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	return models.WebhookDelivery{
+		ServerUUID:    p.Server,
+		WebhookID:     webhook,
+		Event:         p.Event,
+		URL:           u,
+		Format:        format,
+		Payload:       string(b),
+		Signature:     signWebhookPayload(secret, b),
+		Status:        models.WebhookDeliveryPending,
+		NextAttemptAt: p.Timestamp,
+	}, nil
+}
+
+// notifyWebhooks queues a delivery of the event to each node level webhook and
+// each enabled webhook for the server that is subscribed to it. Deliveries are
+// sent by the delivery queue, so this never blocks on the webhooks themselves.
+func (s *Server) notifyWebhooks(event string, data interface{}) {
+	cfg := config.Get().System.Webhooks
+	if !cfg.Enabled {
+		return
+	}
+
+	name := s.Config().Meta.Name
+	if name == "" {
+		name = s.ID()
+	}
+	p := WebhookPayload{
+		Event:     event,
+		Server:    s.ID(),
+		Name:      name,
+		Message:   webhookMessage(name, event, data),
+		Timestamp: time.Now().UTC(),
+		Data:      data,
+	}
+
+	var deliveries []models.WebhookDelivery
+	queue := func(webhook uint, u string, format models.WebhookFormat, secret string) {
+		d, err := newWebhookDelivery(p, webhook, u, format, secret)
+		if err != nil {
+			s.Log().WithField("event", event).WithField("error", err).Warn("failed to render webhook payload")
+			return
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	for _, e := range cfg.Endpoints {
+		if e.URL != "" && wantsWebhookEvent(e.Events, event) {
+			queue(0, e.URL, models.WebhookFormat(e.Format), e.Secret)
+		}
+	}
+
+	var webhooks []models.Webhook
+	if err := database.Instance().Where("server_uuid = ? AND enabled = ?", s.ID(), true).Find(&webhooks).Error; err != nil {
+		s.Log().WithField("error", err).Error("failed to load webhooks")
+	}
+	for _, w := range webhooks {
+		if wantsWebhookEvent(w.Events, event) {
+			queue(w.ID, w.URL, w.Format, w.Secret)
+		}
+	}
+
+	if len(deliveries) == 0 {
+		return
+	}
+	if err := database.Instance().Create(&deliveries).Error; err != nil {
+		s.Log().WithField("event", event).WithField("error", err).Error("failed to queue webhook deliveries")
+	}
+}
+
+// webhookBackoff returns the delay before the next attempt of a delivery that has
+// failed the given number of times.
+func webhookBackoff(cfg config.WebhooksConfiguration, attempts int) time.Duration {
+	delay := time.Duration(cfg.BackoffInitial) * time.Second
+	limit := time.Duration(cfg.BackoffMax) * time.Second
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if limit > 0 && delay >= limit {
+			break
+		}
+	}
+	if limit > 0 && delay > limit {
+		delay = limit
+	}
+	return delay
+}
+
+// ProcessWebhookDeliveries attempts each queued webhook delivery that is due.
+// Failed deliveries are retried with an exponential backoff until they have
+// been attempted the configured maximum number of times.
+func ProcessWebhookDeliveries(ctx context.Context) error {
+	cfg := config.Get().System.Webhooks
+	db := database.Instance()
+
+	var deliveries []models.WebhookDelivery
+	if err := db.Where("status = ? AND next_attempt_at <= ?", models.WebhookDeliveryPending, time.Now().UTC()).
+		Order("next_attempt_at ASC").
+		Limit(webhookDeliveryBatchSize).
+		Find(&deliveries).Error; err != nil {
+		return errors.Wrap(err, "failed to fetch queued webhook deliveries")
+	}
+
+	// Deliveries are grouped by endpoint and each endpoint is handled by a single
+	// worker, so that a slow or unreachable endpoint only holds up its own
+	// deliveries. Once a delivery to an endpoint fails the remaining deliveries
+	// for it are left for the next run rather than each waiting for the timeout.
+	var urls []string
+	byURL := make(map[string][]*models.WebhookDelivery)
+	for i := range deliveries {
+		d := &deliveries[i]
+		if _, ok := byURL[d.URL]; !ok {
+			urls = append(urls, d.URL)
+		}
+		byURL[d.URL] = append(byURL[d.URL], d)
+	}
+
+	var mu sync.Mutex
+	var attempted []*models.WebhookDelivery
+	client := &http.Client{Timeout: time.Duration(max(cfg.Timeout, 1)) * time.Second}
+	pool := workerpool.New(webhookDeliveryWorkers)
+	for _, u := range urls {
+		queued := byURL[u]
+		pool.Submit(func() {
+			for _, d := range queued {
+				if ctx.Err() != nil {
+					return
+				}
+				ok := attemptWebhookDelivery(ctx, cfg, client, d)
+				mu.Lock()
+				attempted = append(attempted, d)
+				mu.Unlock()
+				if !ok {
+					return
+				}
+			}
+		})
+	}
+	pool.StopWait()
+
+	for _, d := range attempted {
+		if err := db.Save(d).Error; err != nil {
+			return errors.Wrap(err, "failed to update webhook delivery")
+		}
+	}
+	return ctx.Err()
+}
+
+// attemptWebhookDelivery sends the delivery and updates it with the result of the
+// attempt, returning false if the attempt failed.
+func attemptWebhookDelivery(ctx context.Context, cfg config.WebhooksConfiguration, client *http.Client, d *models.WebhookDelivery) bool {
+	code, err := sendWebhookDelivery(ctx, client, d)
+	d.Attempts++
+	d.ResponseCode = code
+	if err != nil {
+		d.LastError = err.Error()
+		if d.Attempts >= cfg.MaxAttempts {
+			d.Status = models.WebhookDeliveryFailed
+		} else {
+			d.NextAttemptAt = time.Now().UTC().Add(webhookBackoff(cfg, d.Attempts))
+		}
+		return false
+	}
+	now := time.Now().UTC()
+	d.Status = models.WebhookDeliveryDelivered
+	d.DeliveredAt = &now
+	d.LastError = ""
+	return true
+}
+
+// sendWebhookDelivery performs a single attempt of a webhook delivery, returning
+// the status code of the response if one was received.
+func sendWebhookDelivery(ctx context.Context, client *http.Client, d *models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader([]byte(d.Payload)))
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Propel Wings/v"+system.Version)
+	req.Header.Set("X-Propel-Event", d.Event)
+	req.Header.Set("X-Propel-Delivery", strconv.FormatUint(uint64(d.ID), 10))
+	if d.Signature != "" {
+		req.Header.Set("X-Propel-Signature", d.Signature)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, errors.Errorf("webhook responded with status code %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+// PruneWebhookDeliveries removes completed deliveries that are older than the
+// configured retention from the delivery log.
+func PruneWebhookDeliveries() error {
+	days := config.Get().System.Webhooks.Retention
+	if days <= 0 {
+		return nil
+	}
+	cutoff := time.Now().Add(-time.Duration(days) * time.Hour * 24).UTC()
+	if err := database.Instance().
+		Where("status <> ? AND updated_at < ?", models.WebhookDeliveryPending, cutoff).
+		Delete(&models.WebhookDelivery{}).Error; err != nil {
+		return errors.Wrap(err, "failed to prune webhook deliveries")
+	}
+	return nil
+}
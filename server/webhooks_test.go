@@ -0,0 +1,104 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/goccy/go-json"
+
+	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/events"
+	"github.com/priyxstudio/propel/internal/models"
+)
+
+func TestWebhooks(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("webhookEvent", func() {
+		g.It("splits backups into completed and failed events", func() {
+			event, _, ok := webhookEvent(events.Event{Topic: BackupCompletedEvent, Data: map[string]interface{}{"is_successful": true}})
+			g.Assert(ok).IsTrue()
+			g.Assert(event).Equal(WebhookEventBackupCompleted)
+
+			event, _, ok = webhookEvent(events.Event{Topic: BackupCompletedEvent, Data: map[string]interface{}{"is_successful": false}})
+			g.Assert(ok).IsTrue()
+			g.Assert(event).Equal(WebhookEventBackupFailed)
+		})
+
+		g.It("ignores events that are not delivered to webhooks", func() {
+			_, _, ok := webhookEvent(events.Event{Topic: StatsEvent})
+			g.Assert(ok).IsFalse()
+		})
+	})
+
+	g.Describe("wantsWebhookEvent", func() {
+		g.It("delivers every event when none are subscribed to", func() {
+			g.Assert(wantsWebhookEvent(nil, WebhookEventCrashed)).IsTrue()
+		})
+
+		g.It("only delivers subscribed events", func() {
+			subscribed := []string{WebhookEventCrashed, WebhookEventBackupFailed}
+			g.Assert(wantsWebhookEvent(subscribed, WebhookEventBackupFailed)).IsTrue()
+			g.Assert(wantsWebhookEvent(subscribed, WebhookEventStatus)).IsFalse()
+		})
+	})
+
+	g.Describe("newWebhookDelivery", func() {
+		p := WebhookPayload{
+			Event:     WebhookEventCrashed,
+			Server:    "uuid",
+			Name:      "test",
+			Message:   "test crashed",
+			Timestamp: time.Unix(1700000000, 0).UTC(),
+		}
+
+		g.It("signs the payload when a secret is provided", func() {
+			d, err := newWebhookDelivery(p, 1, "https://example.com", models.WebhookFormatJSON, "secret")
+			g.Assert(err).IsNil()
+			g.Assert(d.Signature).Equal(signWebhookPayload("secret", []byte(d.Payload)))
+			g.Assert(d.Status).Equal(models.WebhookDeliveryPending)
+
+			d, err = newWebhookDelivery(p, 1, "https://example.com", models.WebhookFormatJSON, "")
+			g.Assert(err).IsNil()
+			g.Assert(d.Signature).Equal("")
+		})
+
+		g.It("renders the chat formats", func() {
+			d, err := newWebhookDelivery(p, 0, "https://example.com", models.WebhookFormatDiscord, "")
+			g.Assert(err).IsNil()
+			var discord struct {
+				Embeds []struct {
+					Description string `json:"description"`
+				} `json:"embeds"`
+			}
+			g.Assert(json.Unmarshal([]byte(d.Payload), &discord)).IsNil()
+			g.Assert(discord.Embeds[0].Description).Equal("test crashed")
+
+			d, err = newWebhookDelivery(p, 0, "https://example.com", models.WebhookFormatSlack, "")
+			g.Assert(err).IsNil()
+			var slack struct {
+				Text string `json:"text"`
+			}
+			g.Assert(json.Unmarshal([]byte(d.Payload), &slack)).IsNil()
+			g.Assert(slack.Text).Equal("test crashed")
+		})
+
+		g.It("defaults to the generic JSON format", func() {
+			d, err := newWebhookDelivery(p, 0, "https://example.com", "", "")
+			g.Assert(err).IsNil()
+			g.Assert(d.Format).Equal(models.WebhookFormatJSON)
+		})
+	})
+
+	g.Describe("webhookBackoff", func() {
+		cfg := config.WebhooksConfiguration{BackoffInitial: 5, BackoffMax: 60}
+
+		g.It("doubles with each attempt up to the maximum", func() {
+			g.Assert(webhookBackoff(cfg, 1)).Equal(time.Second * 5)
+			g.Assert(webhookBackoff(cfg, 2)).Equal(time.Second * 10)
+			g.Assert(webhookBackoff(cfg, 3)).Equal(time.Second * 20)
+			g.Assert(webhookBackoff(cfg, 100)).Equal(time.Second * 60)
+		})
+	})
+}
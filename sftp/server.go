@@ -20,6 +20,7 @@ import (
 	"golang.org/x/crypto/ssh"
 
 	"github.com/priyxstudio/propel/config"
+	"github.com/priyxstudio/propel/internal/metrics"
 	"github.com/priyxstudio/propel/remote"
 	"github.com/priyxstudio/propel/server"
 )
@@ -171,6 +172,9 @@ func (c *SFTPServer) Handle(conn *ssh.ServerConn, srv *server.Server, channel ss
 		return errors.WithStackIf(err)
 	}
 
+	metrics.SftpSessions.Inc(srv.ID())
+	defer metrics.SftpSessions.Dec(srv.ID())
+
 	ctx := srv.Sftp().Context(handler.User())
 	rs := sftp.NewRequestServer(channel, handler.Handlers())
 
@@ -0,0 +1,66 @@
+package system
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"emperror.dev/errors"
+)
+
+// ParseCPUSet parses a cpuset list in the format used by the kernel and Docker,
+// such as "0-3,8,10-11", returning the sorted CPU numbers it contains.
+func ParseCPUSet(v string) ([]int, error) {
+	seen := make(map[int]struct{})
+	for _, part := range strings.Split(strings.TrimSpace(v), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		lo, hi, ranged := strings.Cut(part, "-")
+		start, err := strconv.Atoi(lo)
+		if err != nil || start < 0 {
+			return nil, errors.Errorf("system: invalid cpuset entry %q", part)
+		}
+		end := start
+		if ranged {
+			if end, err = strconv.Atoi(hi); err != nil || end < start {
+				return nil, errors.Errorf("system: invalid cpuset entry %q", part)
+			}
+		}
+		for i := start; i <= end; i++ {
+			seen[i] = struct{}{}
+		}
+	}
+
+	cpus := make([]int, 0, len(seen))
+	for cpu := range seen {
+		cpus = append(cpus, cpu)
+	}
+	sort.Ints(cpus)
+	return cpus, nil
+}
+
+// FormatCPUSet formats the given CPU numbers as a cpuset list, collapsing any
+// consecutive numbers into a range.
+func FormatCPUSet(cpus []int) string {
+	sorted := append([]int(nil), cpus...)
+	sort.Ints(sorted)
+
+	var b strings.Builder
+	for i := 0; i < len(sorted); i++ {
+		start := sorted[i]
+		for i+1 < len(sorted) && sorted[i+1] <= sorted[i]+1 {
+			i++
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.Itoa(start))
+		if sorted[i] != start {
+			b.WriteByte('-')
+			b.WriteString(strconv.Itoa(sorted[i]))
+		}
+	}
+	return b.String()
+}
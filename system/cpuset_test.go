@@ -0,0 +1,41 @@
+package system
+
+import (
+	"testing"
+
+	. "github.com/franela/goblin"
+)
+
+func TestCPUSet(t *testing.T) {
+	g := Goblin(t)
+
+	g.Describe("ParseCPUSet", func() {
+		g.It("parses ranges and single threads", func() {
+			cpus, err := ParseCPUSet("0-2,8, 4\n")
+			g.Assert(err).IsNil()
+			g.Assert(cpus).Equal([]int{0, 1, 2, 4, 8})
+		})
+
+		g.It("returns nothing for an empty set", func() {
+			cpus, err := ParseCPUSet("")
+			g.Assert(err).IsNil()
+			g.Assert(len(cpus)).Equal(0)
+		})
+
+		g.It("rejects invalid entries", func() {
+			_, err := ParseCPUSet("3-1")
+			g.Assert(err == nil).IsFalse()
+
+			_, err = ParseCPUSet("a")
+			g.Assert(err == nil).IsFalse()
+		})
+	})
+
+	g.Describe("FormatCPUSet", func() {
+		g.It("collapses consecutive threads into ranges", func() {
+			g.Assert(FormatCPUSet([]int{8, 0, 1, 2, 4, 5})).Equal("0-2,4-5,8")
+			g.Assert(FormatCPUSet([]int{3})).Equal("3")
+			g.Assert(FormatCPUSet(nil)).Equal("")
+		})
+	})
+}
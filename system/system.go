@@ -6,6 +6,7 @@ import (
 	"runtime"
 	"strings"
 
+	"github.com/apex/log"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk"
 	"github.com/shirou/gopsutil/v3/load"
@@ -54,6 +55,10 @@ type System struct {
 	KernelVersion string `json:"kernel_version"`
 	OS            string `json:"os"`
 	OSType        string `json:"os_type"`
+
+	// The layout of the CPU threads on the host, used when assigning threads to
+	// server containers. This is omitted if the topology could not be read.
+	CPUTopology *CPUTopology `json:"cpu_topology,omitempty"`
 }
 
 type IpAddresses struct {
@@ -106,6 +111,15 @@ func GetSystemInformation() (*Information, error) {
 		return nil, err
 	}
 
+	// The topology cannot be read in some environments, such as containers, which
+	// should not prevent the rest of the information from being returned.
+	var topology *CPUTopology
+	if t, err := GetCPUTopology(); err != nil {
+		log.WithField("error", err).Warn("failed to read CPU topology for system information")
+	} else {
+		topology = &t
+	}
+
 	var filesystem string
 	for _, v := range info.DriverStatus {
 		if v[0] != "Backing Filesystem" {
@@ -144,6 +158,7 @@ func GetSystemInformation() (*Information, error) {
 			KernelVersion: kernelVersion,
 			OS:            osName,
 			OSType:        runtime.GOOS,
+			CPUTopology:   topology,
 		},
 	}, nil
 }
@@ -0,0 +1,31 @@
+package system
+
+// CPUTopology is the layout of the CPU threads on the host system, grouped by
+// the NUMA node they belong to.
+type CPUTopology struct {
+	Nodes []NUMANode `json:"nodes"`
+}
+
+// NUMANode is a NUMA node on the host system and the CPU threads local to it.
+type NUMANode struct {
+	ID          int    `json:"id"`
+	MemoryBytes uint64 `json:"memory_bytes"`
+	CPUs        []CPU  `json:"cpus"`
+}
+
+// CPU is a single CPU thread on the host system. Threads that share the same
+// package and core are hyperthread siblings of one another.
+type CPU struct {
+	ID      int `json:"id"`
+	Core    int `json:"core"`
+	Package int `json:"package"`
+}
+
+// Threads returns the number of CPU threads across all the NUMA nodes.
+func (t CPUTopology) Threads() int {
+	var n int
+	for _, node := range t.Nodes {
+		n += len(node.CPUs)
+	}
+	return n
+}
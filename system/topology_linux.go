@@ -0,0 +1,124 @@
+//go:build linux
+
+package system
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"emperror.dev/errors"
+)
+
+const sysDevicesSystem = "/sys/devices/system"
+
+// GetCPUTopology returns the CPU and NUMA topology of the host system. If the
+// kernel does not expose any NUMA nodes all the CPU threads are returned as
+// part of a single node.
+func GetCPUTopology() (CPUTopology, error) {
+	online, err := readCPUSetFile(filepath.Join(sysDevicesSystem, "cpu", "online"))
+	if err != nil {
+		return CPUTopology{}, err
+	}
+
+	cpus := make(map[int]CPU, len(online))
+	for _, id := range online {
+		dir := filepath.Join(sysDevicesSystem, "cpu", "cpu"+strconv.Itoa(id), "topology")
+		cpus[id] = CPU{
+			ID:      id,
+			Core:    readIntFile(filepath.Join(dir, "core_id"), id),
+			Package: readIntFile(filepath.Join(dir, "physical_package_id"), 0),
+		}
+	}
+
+	var t CPUTopology
+	nodes, _ := filepath.Glob(filepath.Join(sysDevicesSystem, "node", "node[0-9]*"))
+	for _, dir := range nodes {
+		id, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(dir), "node"))
+		if err != nil {
+			continue
+		}
+		list, err := readCPUSetFile(filepath.Join(dir, "cpulist"))
+		if err != nil {
+			return CPUTopology{}, err
+		}
+		node := NUMANode{ID: id, MemoryBytes: readNodeMemory(filepath.Join(dir, "meminfo"))}
+		for _, cpu := range list {
+			if c, ok := cpus[cpu]; ok {
+				node.CPUs = append(node.CPUs, c)
+				delete(cpus, cpu)
+			}
+		}
+		t.Nodes = append(t.Nodes, node)
+	}
+
+	if len(t.Nodes) == 0 {
+		t.Nodes = []NUMANode{{ID: 0}}
+	}
+	// Any online thread not listed by a NUMA node is placed on the first node so
+	// that every thread on the system is available.
+	for _, cpu := range online {
+		if c, ok := cpus[cpu]; ok {
+			t.Nodes[0].CPUs = append(t.Nodes[0].CPUs, c)
+		}
+	}
+
+	sort.Slice(t.Nodes, func(i, j int) bool { return t.Nodes[i].ID < t.Nodes[j].ID })
+	for _, node := range t.Nodes {
+		sort.Slice(node.CPUs, func(i, j int) bool { return node.CPUs[i].ID < node.CPUs[j].ID })
+	}
+	if t.Threads() == 0 {
+		return fallbackCPUTopology(), nil
+	}
+	return t, nil
+}
+
+func readCPUSetFile(path string) ([]int, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "system: could not read cpu topology")
+	}
+	return ParseCPUSet(string(b))
+}
+
+func readIntFile(path string, fallback int) int {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fallback
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
+// readNodeMemory returns the total memory for a NUMA node from its meminfo file,
+// which contains lines in the format "Node 0 MemTotal: 16384 kB".
+func readNodeMemory(path string) uint64 {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 4 && fields[2] == "MemTotal:" {
+			v, _ := strconv.ParseUint(fields[3], 10, 64)
+			return v * 1024
+		}
+	}
+	return 0
+}
+
+// fallbackCPUTopology returns a topology with a single NUMA node where every CPU
+// thread is its own core.
+func fallbackCPUTopology() CPUTopology {
+	node := NUMANode{ID: 0}
+	for i := 0; i < runtime.NumCPU(); i++ {
+		node.CPUs = append(node.CPUs, CPU{ID: i, Core: i})
+	}
+	return CPUTopology{Nodes: []NUMANode{node}}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package system
+
+import "runtime"
+
+// GetCPUTopology returns a topology with a single NUMA node where every CPU
+// thread is its own core, since the topology is only read on Linux.
+func GetCPUTopology() (CPUTopology, error) {
+	node := NUMANode{ID: 0}
+	for i := 0; i < runtime.NumCPU(); i++ {
+		node.CPUs = append(node.CPUs, CPU{ID: i, Core: i})
+	}
+	return CPUTopology{Nodes: []NUMANode{node}}, nil
+}